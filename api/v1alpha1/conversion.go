@@ -0,0 +1,36 @@
+package v1alpha1
+
+import (
+	"encoding/json"
+
+	"github.com/openshift/cli-manager/api/v1beta1"
+)
+
+// ConvertTo converts the Plugin to the v1beta1 storage version. The v1beta1 schema is the v1alpha1
+// schema graduated as is, so the fields are copied through their JSON representation.
+func (src *Plugin) ConvertTo(dst *v1beta1.Plugin) error {
+	if err := convert(src, dst); err != nil {
+		return err
+	}
+	dst.APIVersion = v1beta1.GroupVersion.String()
+	dst.Kind = "Plugin"
+	return nil
+}
+
+// ConvertFrom converts the Plugin from the v1beta1 storage version.
+func (dst *Plugin) ConvertFrom(src *v1beta1.Plugin) error {
+	if err := convert(src, dst); err != nil {
+		return err
+	}
+	dst.APIVersion = GroupVersion.String()
+	dst.Kind = "Plugin"
+	return nil
+}
+
+func convert(src, dst interface{}) error {
+	raw, err := json.Marshal(src)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(raw, dst)
+}
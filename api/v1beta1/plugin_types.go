@@ -0,0 +1,822 @@
+package v1beta1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// PluginSpec defines the desired state of Plugin
+// +kubebuilder:validation:XValidation:rule="self.platforms.all(p, self.platforms.exists_one(q, q.platform == p.platform))",message="platforms must be unique"
+// +kubebuilder:validation:XValidation:rule="!has(self.channels) || size(self.channels) == 0 || size(self.version) > 0",message="version is required when channels are used"
+// +kubebuilder:validation:XValidation:rule="!has(self.channels) || self.channels.all(c, c.version == self.version || (has(self.versions) && self.versions.exists(v, v.version == c.version)))",message="channels must point at version or one of versions"
+// +kubebuilder:validation:XValidation:rule="has(self.image) || self.platforms.all(p, has(p.image) || has(p.url) || has(p.github))",message="platforms without image, url or github require the image of the spec"
+type PluginSpec struct {
+	// ShortDescription of the plugin, listed by krew search.
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:validation:MaxLength=50
+	// +required
+	ShortDescription string `json:"shortDescription"`
+
+	// Description of the plugin, shown by krew info.
+	// +kubebuilder:validation:MaxLength=4096
+	// +optional
+	Description string `json:"description,omitempty"`
+
+	// Caveats of using the plugin, shown by krew once the plugin is installed.
+	// +kubebuilder:validation:MaxLength=4096
+	// +optional
+	Caveats string `json:"caveats,omitempty"`
+
+	// Homepage of the plugin, an http or https URL.
+	// +kubebuilder:validation:MaxLength=2048
+	// +kubebuilder:validation:Pattern=`^https?://`
+	// +optional
+	Homepage string `json:"homepage,omitempty"`
+
+	// Version of the plugin.
+	// +kubebuilder:validation:MaxLength=128
+	// +required
+	Version string `json:"version"`
+
+	// Image of the platforms without image, url or github of their own, for the images built for all
+	// the platforms as a manifest list. The platforms of the images built separately set their own.
+	// +optional
+	Image string `json:"image,omitempty"`
+
+	// Platforms the plugin supports.
+	// +kubebuilder:validation:MaxItems=32
+	// +required
+	Platforms []PluginPlatform `json:"platforms"`
+
+	// ExpiresAt is the time after which the plugin is automatically
+	// unpublished from the index and its artifacts are removed.
+	// Useful for publishing temporary tools, e.g. during an incident.
+	// +optional
+	ExpiresAt *metav1.Time `json:"expiresAt,omitempty"`
+
+	// Preview stages the plugin in the preview index only.
+	// Admins can point a test krew at the preview index to validate the plugin
+	// and promote the same content to the main index by unsetting this field.
+	// +optional
+	Preview bool `json:"preview,omitempty"`
+
+	// ValidateOnly pulls the images and looks up the files of every platform in them, reporting
+	// the files not found in the PluginInstalled condition, without publishing the plugin.
+	// Authors can validate new manifests safely and publish them by unsetting this field.
+	// +optional
+	ValidateOnly bool `json:"validateOnly,omitempty"`
+
+	// Paused suspends the sync of the plugin, i.e. during an incident or an investigation. The
+	// artifacts published last keep being served, and the images, archives and resolver of the
+	// plugin are not looked up again until this field is unset.
+	// +optional
+	Paused bool `json:"paused,omitempty"`
+
+	// ResyncInterval is how often the plugin is synced again, so that the tags of its images are
+	// tracked and its artifacts are checked, overriding the resync interval of the controller.
+	// The plugins changing daily set a short interval, and 0s stops the plugins that never
+	// change from being synced again until their spec or their image streams change.
+	// +optional
+	ResyncInterval *metav1.Duration `json:"resyncInterval,omitempty"`
+
+	// Priority orders the syncs of the plugins queued at once, i.e. when hundreds of Plugins are
+	// created by a GitOps bootstrap, so that the critical plugins are extracted and published before
+	// the long tail. The plugins of a higher priority are synced first, 0 if not set.
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Maximum=1000
+	// +optional
+	Priority int32 `json:"priority,omitempty"`
+
+	// ArchitectureFallback is what is done when the image of a platform is not built
+	// for its architecture. Fail fails the publication of the plugin, FallbackToAMD64
+	// publishes the amd64 binaries of the same operating system with a caveat note,
+	// i.e. for emulation, and Skip publishes the plugin without the platform.
+	// +kubebuilder:default:=Fail
+	// +optional
+	ArchitectureFallback ArchitectureFallbackPolicy `json:"architectureFallback,omitempty"`
+
+	// Resolver is the webhook the current version and images of the plugin are resolved with,
+	// i.e. from an internal release service, instead of Version and the Image of the platforms.
+	// +optional
+	Resolver *VersionResolver `json:"resolver,omitempty"`
+
+	// Licenses are the license and documentation files of the images bundled into the
+	// licenses directory of the artifacts of every platform, which many organizations
+	// require for redistributed binaries.
+	// +optional
+	Licenses *Licenses `json:"licenses,omitempty"`
+
+	// Versions are the older versions of the plugin published next to Version, each with the
+	// images of its own platforms, so that users can pin a release. Every version is published
+	// to the index as the plugin named <name>_<version>, the dots and plus signs of the version
+	// replaced by dashes, i.e. tool_v1-2-0, and its artifacts are kept with the ones of Version.
+	// +kubebuilder:validation:MaxItems=64
+	// +optional
+	Versions []PluginVersion `json:"versions,omitempty"`
+
+	// Retention is how many of the older versions are published and for how long, overriding the
+	// retention of the controller. The versions superseded by Version beyond it are unpublished and
+	// their artifacts removed, except the ones the channels point at. They are all kept if not set.
+	// +optional
+	Retention *VersionRetention `json:"retention,omitempty"`
+
+	// Channels point the release channels at the versions of the plugin, Version or one of
+	// Versions. Every channel is served as its own index, publishing the plugin under its own
+	// name with the version the channel points at, so that a version is promoted between the
+	// channels without being extracted again.
+	// +kubebuilder:validation:MaxItems=3
+	// +listType=map
+	// +listMapKey=name
+	// +optional
+	Channels []PluginChannel `json:"channels,omitempty"`
+
+	// Deprecation marks the plugin and all its versions deprecated, so that users migrate off it.
+	// The deprecation is noted in the index, the catalog and the downloads of the artifacts, and
+	// ExpiresAt can be set to the end of life of the plugin, once it is unpublished.
+	// +optional
+	Deprecation *Deprecation `json:"deprecation,omitempty"`
+
+	// Dependencies are the managed plugins the plugin requires, i.e. the helper binary of a wrapper
+	// plugin. krew does not install dependencies, so they are noted in the caveats of the plugin,
+	// which is not published until they exist in the version required.
+	// +listType=map
+	// +listMapKey=name
+	// +optional
+	Dependencies []PluginDependency `json:"dependencies,omitempty"`
+
+	// Aliases are the other names the plugin is published under, i.e. short or legacy names, so that
+	// the plugin is renamed without breaking the install commands of its users. The plugins named
+	// after an alias take precedence over it.
+	// +kubebuilder:validation:MaxItems=16
+	// +listType=set
+	// +optional
+	Aliases []string `json:"aliases,omitempty"`
+
+	// Categories are the broad areas of the plugin, i.e. networking or security, which the plugins
+	// are browsed and filtered by in the catalog and the plugins API.
+	// +kubebuilder:validation:MaxItems=8
+	// +kubebuilder:validation:items:MaxLength=63
+	// +kubebuilder:validation:items:Pattern=`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`
+	// +listType=set
+	// +optional
+	Categories []string `json:"categories,omitempty"`
+
+	// Tags are the keywords of the plugin, i.e. the tools or the products it works with, which the
+	// plugins are filtered by like their categories.
+	// +kubebuilder:validation:MaxItems=16
+	// +kubebuilder:validation:items:MaxLength=63
+	// +kubebuilder:validation:items:Pattern=`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`
+	// +listType=set
+	// +optional
+	Tags []string `json:"tags,omitempty"`
+}
+
+// PluginDependency is a managed plugin required by another plugin.
+type PluginDependency struct {
+	// Name of the required Plugin.
+	// +required
+	Name string `json:"name"`
+
+	// MinVersion is the minimum version of the required plugin, in v0.0.0 format, if any.
+	// +optional
+	MinVersion string `json:"minVersion,omitempty"`
+}
+
+// Deprecation marks a plugin or one of its versions deprecated.
+type Deprecation struct {
+	// Message tells the users why the plugin is deprecated and how to migrate off it.
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:validation:MaxLength=1024
+	// +required
+	Message string `json:"message"`
+
+	// Replacement is the plugin replacing the deprecated one, if any.
+	// +optional
+	Replacement string `json:"replacement,omitempty"`
+}
+
+// ChannelName is a release channel of the plugins.
+// +kubebuilder:validation:Enum=stable;candidate;edge
+type ChannelName string
+
+const (
+	// ChannelStable publishes the versions recommended to every user.
+	ChannelStable ChannelName = "stable"
+	// ChannelCandidate publishes the versions candidate to stable.
+	ChannelCandidate ChannelName = "candidate"
+	// ChannelEdge publishes the latest versions.
+	ChannelEdge ChannelName = "edge"
+)
+
+// Channels are the release channels of the plugins, from the most to the least mature.
+var Channels = []ChannelName{ChannelStable, ChannelCandidate, ChannelEdge}
+
+// PluginChannel points a release channel at a version of the plugin.
+type PluginChannel struct {
+	// Name of the channel, stable, candidate or edge.
+	// +required
+	Name ChannelName `json:"name"`
+
+	// Version published in the channel, Version or one of Versions.
+	// +kubebuilder:validation:MaxLength=128
+	// +required
+	Version string `json:"version"`
+}
+
+// PluginVersion is an older version of the plugin published next to the current one.
+// +kubebuilder:validation:XValidation:rule="self.platforms.all(p, self.platforms.exists_one(q, q.platform == p.platform))",message="platforms must be unique"
+// +kubebuilder:validation:XValidation:rule="has(self.image) || self.platforms.all(p, has(p.image) || has(p.url) || has(p.github))",message="platforms without image, url or github require the image of the version"
+type PluginVersion struct {
+	// Version of the plugin, in v0.0.0 format.
+	// +kubebuilder:validation:MaxLength=128
+	// +required
+	Version string `json:"version"`
+
+	// Image of the platforms of the version without image, url or github of their own.
+	// +optional
+	Image string `json:"image,omitempty"`
+
+	// Platforms the version supports.
+	// +kubebuilder:validation:MaxItems=32
+	// +required
+	Platforms []PluginPlatform `json:"platforms"`
+
+	// Deprecation marks the version deprecated, in addition to the deprecation of the plugin.
+	// +optional
+	Deprecation *Deprecation `json:"deprecation,omitempty"`
+}
+
+// Licenses are the license and documentation files bundled into the artifacts.
+type Licenses struct {
+	// Files are the absolute paths of the license and documentation files within the images,
+	// or glob patterns matching them, like /usr/share/licenses/tool/*, copied to licenses.
+	// If empty, the files found in the common locations are copied: /LICENSE*, /COPYING*,
+	// /NOTICE* and /README* to licenses, /licenses/* to licenses/image, and
+	// /usr/share/licenses/<plugin>/* to licenses/<plugin>.
+	// +optional
+	Files []string `json:"files,omitempty"`
+}
+
+// VersionRetention is how many of the older versions of a plugin are published and for how long.
+type VersionRetention struct {
+	// MaxVersions is the number of older versions published, the newest ones older than Version.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	MaxVersions *int32 `json:"maxVersions,omitempty"`
+
+	// MaxAge is how long the older versions are published once they are first published, i.e. 2160h.
+	// +optional
+	MaxAge *metav1.Duration `json:"maxAge,omitempty"`
+}
+
+// VersionResolver is a webhook resolving the current version and images of a plugin. The controller
+// POSTs the name, the version and the platforms of the plugin in JSON format, and the webhook
+// responds with the version and the images to publish.
+type VersionResolver struct {
+	// URL of the webhook.
+	// +kubebuilder:validation:Pattern=`^https://`
+	// +required
+	URL string `json:"url"`
+
+	// CABundle is the PEM bundle trusted for the webhook in addition to the system roots.
+	// +optional
+	CABundle []byte `json:"caBundle,omitempty"`
+
+	// TokenSecret is the Secret whose token key is sent to the webhook as bearer token.
+	// Secrets in other namespaces can be referenced in namespace/name format.
+	// +optional
+	TokenSecret string `json:"tokenSecret,omitempty"`
+
+	// Interval between the resolutions of the plugin, 10m if not set.
+	// +optional
+	Interval *metav1.Duration `json:"interval,omitempty"`
+}
+
+// ArchitectureFallbackPolicy is what is done when the image of a platform is not built for its architecture.
+// +kubebuilder:validation:Enum=Fail;FallbackToAMD64;Skip
+type ArchitectureFallbackPolicy string
+
+const (
+	// ArchitectureFallbackFail fails the publication of the plugin.
+	ArchitectureFallbackFail ArchitectureFallbackPolicy = "Fail"
+	// ArchitectureFallbackAMD64 publishes the amd64 binaries of the same operating system.
+	ArchitectureFallbackAMD64 ArchitectureFallbackPolicy = "FallbackToAMD64"
+	// ArchitectureFallbackSkip publishes the plugin without the platform.
+	ArchitectureFallbackSkip ArchitectureFallbackPolicy = "Skip"
+)
+
+// PluginPlatform defines per-OS and per-Arch binaries for the given plugin.
+// +kubebuilder:validation:XValidation:rule="size(self.files) > 0",message="platform has no files"
+// +kubebuilder:validation:XValidation:rule="(has(self.image) ? 1 : 0) + (has(self.url) ? 1 : 0) + (has(self.github) ? 1 : 0) <= 1",message="at most one of image, url and github is set"
+// +kubebuilder:validation:XValidation:rule="!has(self.url) || has(self.sha256)",message="sha256 is required with url"
+type PluginPlatform struct {
+	// Platform for the given binary (i.e. linux/amd64, darwin/amd64, windows/amd64).
+	// +kubebuilder:validation:MaxLength=64
+	// +required
+	Platform string `json:"platform"`
+
+	// Image containing plugin, unless URL or GitHub is set. The image of the spec, or of the version
+	// of the platform, is used if none of them is set.
+	// +optional
+	Image string `json:"image,omitempty"`
+
+	// URL is the HTTPS URL of a tar.gz or zip archive of the plugin, i.e. a release tarball, published
+	// instead of the files of an image. The archive is downloaded, verified against Sha256 and rehosted
+	// as is, so Files are the paths krew installs from the archive, like in a krew manifest.
+	// +kubebuilder:validation:MaxLength=2048
+	// +kubebuilder:validation:Pattern=`^https://`
+	// +optional
+	URL string `json:"url,omitempty"`
+
+	// Sha256 checksum of the archive of URL.
+	// +kubebuilder:validation:Pattern=`^[a-fA-F0-9]{64}$`
+	// +optional
+	Sha256 string `json:"sha256,omitempty"`
+
+	// GitHub is the release asset of a GitHub repository published instead of the files of an image.
+	// The asset is downloaded and rehosted as is like the archive of URL, so Files are the paths krew
+	// installs from it.
+	// +optional
+	GitHub *GitHubRelease `json:"github,omitempty"`
+
+	// ImagePullSecret to use when connecting to an image registry that requires authentication.
+	// +optional
+	ImagePullSecret string `json:"imagePullSecret,omitempty"`
+
+	// Credentials are the sources of the registry credentials tried in order, after ImagePullSecret
+	// if it is set, until the registry accepts one of them. They ease the migrations between registry
+	// accounts, since the credentials of the new account can be tried before the ones of the old one.
+	// +optional
+	Credentials []CredentialSource `json:"credentials,omitempty"`
+
+	// ClientCertificateSecret is the kubernetes.io/tls Secret whose tls.crt and tls.key
+	// are presented to registries requiring client certificate authentication.
+	// Secrets in other namespaces can be referenced in namespace/name format.
+	// +optional
+	ClientCertificateSecret string `json:"clientCertificateSecret,omitempty"`
+
+	// Proxy is the URL of the proxy the image is pulled through, overriding the
+	// proxy of the controller. http, https, socks5 and socks5h schemes are supported,
+	// and the credentials can be given as user:password in the URL.
+	// +optional
+	Proxy string `json:"proxy,omitempty"`
+
+	// ProxySecret is the Secret holding the credentials of the proxy, so that they are kept
+	// out of the Plugin. The Secret has either username and password keys, or a proxyURL
+	// key with the full proxy URL including the credentials, which replaces Proxy.
+	// Secrets in other namespaces can be referenced in namespace/name format.
+	// +optional
+	ProxySecret string `json:"proxySecret,omitempty"`
+
+	// Files is a list of file locations within the image that need to be extracted.
+	// +required
+	Files []FileLocation `json:"files"`
+
+	// Disabled removes the platform from the index, along with its artifacts, while keeping it in
+	// the spec so that it is published again once enabled.
+	// +optional
+	Disabled bool `json:"disabled,omitempty"`
+
+	// Bin specifies the path to the plugin executable.
+	// The path is relative to the root of the installation folder.
+	// The binary will be linked after all FileOperations are executed.
+	// If not specified, plugin name is set.
+	// +optional
+	Bin string `json:"bin"`
+
+	// ArchiveFormat is the format of the artifact, tar.gz or zip.
+	// Default is zip for the windows platforms and tar.gz for the others.
+	// +optional
+	ArchiveFormat ArchiveFormat `json:"archiveFormat,omitempty"`
+
+	// RawBinary publishes the plugin executable uncompressed next to the artifact as well,
+	// for the clients downloading it without krew, i.e. install scripts.
+	// +optional
+	RawBinary bool `json:"rawBinary,omitempty"`
+
+	// Completions are the shell completion scripts of the plugin in the image, bundled in the
+	// completions directory of the artifact and served alongside it.
+	// +optional
+	Completions *Completions `json:"completions,omitempty"`
+
+	// ManPages are the absolute paths or glob patterns of the man pages of the plugin in the image,
+	// i.e. /usr/share/man/man1/tool*.1.gz, or of their section directories. They are bundled in the
+	// man directory of the artifact, and served alongside it for offline viewing. The man pages not
+	// found in the image are skipped.
+	// +optional
+	ManPages []string `json:"manPages,omitempty"`
+}
+
+// GitHubRelease is a tar.gz or zip asset of a release of a GitHub repository.
+type GitHubRelease struct {
+	// Repository in owner/name format, i.e. ahmetb/kubectx.
+	// +kubebuilder:validation:Pattern=`^[A-Za-z0-9_.-]+/[A-Za-z0-9_.-]+$`
+	// +required
+	Repository string `json:"repository"`
+
+	// Tag of the release, the latest release if not set. ${version} is replaced by the version of
+	// the plugin without its v prefix, i.e. v${version} is the release of the version.
+	// +optional
+	Tag string `json:"tag,omitempty"`
+
+	// Asset is the glob pattern of the name of the asset of the platform, i.e. kubectx_*_linux_x86_64.tar.gz.
+	// ${version} is replaced like in Tag.
+	// +required
+	Asset string `json:"asset"`
+
+	// Checksums is the glob pattern of the name of the asset listing the sha256 checksums of the
+	// assets, in sha256sum format, i.e. checksums.txt. The digest GitHub computes for the asset is
+	// used if not set.
+	// +optional
+	Checksums string `json:"checksums,omitempty"`
+
+	// TokenSecret is the Secret whose token key authenticates the requests to GitHub, for the
+	// private repositories and the higher rate limits. Secrets in other namespaces can be referenced
+	// in namespace/name format.
+	// +optional
+	TokenSecret string `json:"tokenSecret,omitempty"`
+}
+
+// Completions are the absolute paths of the shell completion scripts of a plugin in its image.
+// The scripts not found in the image are skipped.
+type Completions struct {
+	// Bash completion script, bundled as completions/bash.
+	// +optional
+	Bash string `json:"bash,omitempty"`
+
+	// Zsh completion script, bundled as completions/zsh.
+	// +optional
+	Zsh string `json:"zsh,omitempty"`
+
+	// Fish completion script, bundled as completions/fish.
+	// +optional
+	Fish string `json:"fish,omitempty"`
+}
+
+// CredentialSourceType is the type of a source of registry credentials.
+// +kubebuilder:validation:Enum=Secret;ServiceAccount;Global
+type CredentialSourceType string
+
+const (
+	// CredentialSourceSecret is a kubernetes.io/dockercfg or kubernetes.io/dockerconfigjson Secret.
+	CredentialSourceSecret CredentialSourceType = "Secret"
+	// CredentialSourceServiceAccount are the image pull Secrets of a service account.
+	CredentialSourceServiceAccount CredentialSourceType = "ServiceAccount"
+	// CredentialSourceGlobal is the global pull secret of the cluster, openshift-config/pull-secret.
+	CredentialSourceGlobal CredentialSourceType = "Global"
+)
+
+// CredentialSource is a source of the credentials of the registry of an image.
+type CredentialSource struct {
+	// Type is Secret, ServiceAccount or Global.
+	// +required
+	Type CredentialSourceType `json:"type"`
+
+	// SecretRef is the image pull Secret of the Secret type.
+	// Secrets in other namespaces can be referenced in namespace/name format.
+	// +optional
+	SecretRef string `json:"secretRef,omitempty"`
+
+	// ServiceAccount is the service account of the ServiceAccount type, whose image pull
+	// Secrets are tried in order. Service accounts in other namespaces can be referenced
+	// in namespace/name format.
+	// +optional
+	ServiceAccount string `json:"serviceAccount,omitempty"`
+}
+
+// ArchiveFormat is the format of the artifact of a platform.
+// +kubebuilder:validation:Enum=tar.gz;zip
+type ArchiveFormat string
+
+const (
+	// ArchiveFormatTarGz is a gzip compressed tarball.
+	ArchiveFormatTarGz ArchiveFormat = "tar.gz"
+	// ArchiveFormatZip is a zip archive, conventionally consumed by krew on Windows.
+	ArchiveFormatZip ArchiveFormat = "zip"
+)
+
+// FileLocation specifies a file copying operation from plugin archive to the
+// installation directory.
+type FileLocation struct {
+	// From is the absolute file path within the image to copy from, or a glob
+	// pattern like /usr/local/bin/tool-v* matching the files to copy, in any layer.
+	// Directories are copied with all the files in them, and symbolic links are
+	// copied as the files they point to.
+	// +required
+	From string `json:"from"`
+
+	// To is the relative path within the root of the installation folder to place the file.
+	// Default is set to "." where points the default Krew directory.
+	// +required
+	// +kubebuilder:default:="."
+	To string `json:"to"`
+
+	// Optional files, like shell completions and docs, are skipped if they are not
+	// found in the image instead of failing the publication of the plugin.
+	// +optional
+	Optional bool `json:"optional,omitempty"`
+
+	// Exclude are the patterns of the files not to copy from the directories From, relative to the
+	// directories, like test/** or **/*.a, where ** matches any number of directories. The files
+	// matching a glob pattern From are excluded by their base names.
+	// +optional
+	Exclude []string `json:"exclude,omitempty"`
+
+	// StripComponents is the number of leading components dropped from the paths of the files
+	// of the directories in the artifact, like tar --strip-components, so that the contents of
+	// the directory From are installed in To. Files keep at least their base names. It requires
+	// To to be a directory.
+	// +optional
+	// +kubebuilder:validation:Minimum=0
+	StripComponents int32 `json:"stripComponents,omitempty"`
+
+	// Transforms are applied in order to the files as they are written to the artifact,
+	// i.e. to customize the config files of the plugin for the cluster.
+	// +optional
+	Transforms []FileTransform `json:"transforms,omitempty"`
+}
+
+// FileTransformType is the type of a transform applied to the extracted files.
+// +kubebuilder:validation:Enum=Rename;Chmod;Substitute
+type FileTransformType string
+
+const (
+	// FileTransformRename renames the file or the directory in the installation folder.
+	FileTransformRename FileTransformType = "Rename"
+	// FileTransformChmod sets the permission bits of the files.
+	FileTransformChmod FileTransformType = "Chmod"
+	// FileTransformSubstitute replaces the placeholders like ${CLUSTER_API_URL} in the files with their values.
+	FileTransformSubstitute FileTransformType = "Substitute"
+)
+
+// FileTransform is a transform applied to the files copied by a FileLocation.
+type FileTransform struct {
+	// Type is Rename, Chmod or Substitute.
+	// +required
+	Type FileTransformType `json:"type"`
+
+	// Name is the new base name of the file or the directory, for Rename.
+	// +optional
+	Name string `json:"name,omitempty"`
+
+	// Mode is the octal permission bits of the files, like 0644, for Chmod.
+	// +optional
+	Mode string `json:"mode,omitempty"`
+}
+
+// The types of the conditions of the Plugins.
+const (
+	// PluginInstalledCondition reports the outcome of the last sync of the plugin, with the reason
+	// it failed with, if it did.
+	PluginInstalledCondition = "PluginInstalled"
+	// ReadyCondition reports whether the plugin is published to the index once synced, so that
+	// oc wait --for=condition=Ready waits for it.
+	ReadyCondition = "Ready"
+	// ProgressingCondition reports whether the images of the plugin are being pulled and extracted.
+	// Syncs completing quickly are only reported once completed.
+	ProgressingCondition = "Progressing"
+	// DegradedCondition reports that the plugin can not be published as declared, i.e. since files
+	// of its spec are not found in the images.
+	DegradedCondition = "Degraded"
+	// SignatureVerifiedCondition reports whether the signatures of the images of the plugin are verified.
+	SignatureVerifiedCondition = "SignatureVerified"
+	// ArtifactAvailableCondition reports whether the artifacts of the plugin are served for download.
+	ArtifactAvailableCondition = "ArtifactAvailable"
+	// PausedCondition reports whether the sync of the plugin is suspended by its Paused field.
+	PausedCondition = "Paused"
+)
+
+// PluginStatus defines the observed state of Plugin.
+type PluginStatus struct {
+	// Conditions are the PluginInstalled condition, the Ready, Progressing, Degraded,
+	// SignatureVerified and ArtifactAvailable conditions derived from it once the plugin is synced,
+	// and the Paused condition.
+	// +patchMergeKey=type
+	// +patchStrategy=merge
+	// +listType=map
+	// +listMapKey=type
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+
+	// Platforms are the platforms published to the index by the controller.
+	// +optional
+	Platforms []PluginPlatformStatus `json:"platforms,omitempty"`
+
+	// SkippedPlatforms are the platforms not published since their images are not
+	// built for their architecture, with the Skip architecture fallback. The platforms
+	// of the older versions are followed by their version, i.e. linux/arm64 of version v1.2.0.
+	// +optional
+	SkippedPlatforms []string `json:"skippedPlatforms,omitempty"`
+
+	// Progress of the running pull and extraction. It is only reported for syncs
+	// taking long enough to be observed and is removed once the sync completes.
+	// +optional
+	Progress *PluginProgress `json:"progress,omitempty"`
+
+	// ResolvedVersion is the version published, if it is resolved by the resolver webhook.
+	// +optional
+	ResolvedVersion string `json:"resolvedVersion,omitempty"`
+
+	// Versions are the older versions published to the index by the controller.
+	// +optional
+	Versions []PluginVersionStatus `json:"versions,omitempty"`
+
+	// LastSyncTime is the last time the plugin is synced successfully.
+	// +optional
+	LastSyncTime *metav1.Time `json:"lastSyncTime,omitempty"`
+}
+
+// PluginVersionStatus is an older version of the plugin published to the index.
+type PluginVersionStatus struct {
+	// Version of the plugin.
+	Version string `json:"version"`
+
+	// Name is the name the version is published to the index with.
+	Name string `json:"name"`
+
+	// Platforms are the platforms of the version published to the index.
+	// +optional
+	Platforms []PluginPlatformStatus `json:"platforms,omitempty"`
+
+	// PublishedTime is the time the version is first published, which the MaxAge of the retention
+	// of the plugin is counted from.
+	// +optional
+	PublishedTime *metav1.Time `json:"publishedTime,omitempty"`
+}
+
+// PluginProgress is the progress of a running sync of the plugin.
+type PluginProgress struct {
+	// Phase of the sync, i.e. Extracting while the layers are downloaded and extracted.
+	Phase string `json:"phase"`
+
+	// Platform being synced.
+	Platform string `json:"platform"`
+
+	// LayersProcessed is the number of image layers processed so far.
+	LayersProcessed int32 `json:"layersProcessed"`
+
+	// LayersTotal is the number of image layers.
+	LayersTotal int32 `json:"layersTotal"`
+
+	// BytesDownloaded is the number of bytes downloaded from the registry so far.
+	BytesDownloaded int64 `json:"bytesDownloaded"`
+
+	// LastUpdateTime is the last time the progress is reported.
+	LastUpdateTime metav1.Time `json:"lastUpdateTime"`
+}
+
+// PluginPlatformStatus is the published state of a single platform of the plugin.
+type PluginPlatformStatus struct {
+	// Platform of the published artifact (i.e. linux/amd64).
+	Platform string `json:"platform"`
+
+	// URI the artifact is served from.
+	URI string `json:"uri"`
+
+	// Sha256 checksum of the artifact.
+	Sha256 string `json:"sha256"`
+
+	// URL the artifact is downloaded from, if the platform is published from an archive URL.
+	// +optional
+	URL string `json:"url,omitempty"`
+
+	// Release is the tag of the GitHub release the artifact is downloaded from, if the platform is
+	// published from a GitHub release.
+	// +optional
+	Release string `json:"release,omitempty"`
+
+	// Files are the file locations packaged into the artifact.
+	// +optional
+	Files []FileLocation `json:"files,omitempty"`
+
+	// Bin is the path to the plugin executable within the installation folder.
+	// +optional
+	Bin string `json:"bin,omitempty"`
+
+	// Architecture of the binaries in the artifact, if it is not the architecture of the
+	// platform, i.e. amd64 with the FallbackToAMD64 architecture fallback.
+	// +optional
+	Architecture string `json:"architecture,omitempty"`
+
+	// ArchiveFormat of the artifact, tar.gz if not set.
+	// +optional
+	ArchiveFormat ArchiveFormat `json:"archiveFormat,omitempty"`
+
+	// CredentialSource is the source of the credentials the image is pulled with, i.e.
+	// Secret namespace/name, if the platform has image pull credentials.
+	// +optional
+	CredentialSource string `json:"credentialSource,omitempty"`
+
+	// Image the artifact is extracted from, if it is resolved by the resolver webhook.
+	// +optional
+	Image string `json:"image,omitempty"`
+
+	// SBOM of the image, served alongside the artifact if it is found.
+	// +optional
+	SBOM *PlatformSBOM `json:"sbom,omitempty"`
+
+	// Binary is the plugin executable published uncompressed, if RawBinary is set.
+	// +optional
+	Binary *PlatformBinary `json:"binary,omitempty"`
+
+	// Completions are the shell completion scripts published, if Completions are set.
+	// +optional
+	Completions []PlatformCompletion `json:"completions,omitempty"`
+
+	// ManPages is the archive of the man pages published, if ManPages are set.
+	// +optional
+	ManPages *PlatformManPages `json:"manPages,omitempty"`
+
+	// Digest of the image manifest the artifact is extracted from.
+	// +optional
+	Digest string `json:"digest,omitempty"`
+
+	// ExtractionHash is the hash of the files of the platform and of the settings the artifact
+	// is extracted with. The artifact is not extracted again while the digest and the hash match.
+	// +optional
+	ExtractionHash string `json:"extractionHash,omitempty"`
+
+	// Size of the artifact in bytes.
+	// +optional
+	Size int64 `json:"size,omitempty"`
+
+	// ExtractionDuration is how long the artifact took to be pulled and extracted.
+	// +optional
+	ExtractionDuration *metav1.Duration `json:"extractionDuration,omitempty"`
+
+	// ExtractionTime is the time the artifact is extracted at.
+	// +optional
+	ExtractionTime *metav1.Time `json:"extractionTime,omitempty"`
+}
+
+// PlatformBinary is the plugin executable of a platform published uncompressed.
+type PlatformBinary struct {
+	// URI the executable is served from.
+	URI string `json:"uri"`
+
+	// Sha256 checksum of the executable.
+	Sha256 string `json:"sha256"`
+}
+
+// PlatformCompletion is a shell completion script of a platform.
+type PlatformCompletion struct {
+	// Shell of the script, bash, zsh or fish.
+	Shell string `json:"shell"`
+
+	// URI the script is served from.
+	URI string `json:"uri"`
+
+	// Sha256 checksum of the script.
+	Sha256 string `json:"sha256"`
+}
+
+// PlatformManPages is the tar archive of the man pages of a platform.
+type PlatformManPages struct {
+	// URI the archive is served from.
+	URI string `json:"uri"`
+
+	// Sha256 checksum of the archive.
+	Sha256 string `json:"sha256"`
+}
+
+// PlatformSBOM is the SBOM of the image of a platform.
+type PlatformSBOM struct {
+	// Format of the SBOM, SPDX or CycloneDX.
+	Format string `json:"format"`
+
+	// URI the SBOM is served from.
+	URI string `json:"uri"`
+
+	// Sha256 checksum of the SBOM.
+	Sha256 string `json:"sha256"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:storageversion
+//+kubebuilder:resource:path=Plugins,scope=Cluster
+//+kubebuilder:printcolumn:name="Version",type=string,JSONPath=`.spec.version`
+//+kubebuilder:printcolumn:name="Ready",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].status`
+//+kubebuilder:printcolumn:name="Reason",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].reason`
+//+kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// Plugin is the Schema for the plugins API
+type Plugin struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   PluginSpec   `json:"spec,omitempty"`
+	Status PluginStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// PluginList contains a list of Plugin
+type PluginList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []Plugin `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&Plugin{}, &PluginList{})
+}
@@ -0,0 +1,104 @@
+package v1beta1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// PluginRepositoryType is the layout of an external krew index.
+// +kubebuilder:validation:Enum=Git;HTTP
+type PluginRepositoryType string
+
+const (
+	// PluginRepositoryGit is a git repository, like the krew indexes added with kubectl krew index add.
+	PluginRepositoryGit PluginRepositoryType = "Git"
+	// PluginRepositoryHTTP is a tar.gz archive of the index served over HTTP, i.e. the archive of
+	// a branch of the git repository of the index served by its git forge.
+	PluginRepositoryHTTP PluginRepositoryType = "HTTP"
+)
+
+// PluginRepositorySpec defines the external krew index mirrored into the indexes of the controller.
+type PluginRepositorySpec struct {
+	// URL of the index, the git repository or the tar.gz archive of the index.
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:validation:MaxLength=2048
+	// +kubebuilder:validation:Pattern=`^https?://`
+	// +required
+	URL string `json:"url"`
+
+	// Type is the layout of the index, Git or HTTP.
+	// +kubebuilder:default:=Git
+	// +optional
+	Type PluginRepositoryType `json:"type,omitempty"`
+
+	// Ref is the branch or the tag of the git repository, its default branch if not set.
+	// +optional
+	Ref string `json:"ref,omitempty"`
+
+	// Plugins are the names of the plugins of the index that are mirrored, all of them if not set.
+	// +optional
+	Plugins []string `json:"plugins,omitempty"`
+
+	// Rehost downloads the archives of the mirrored plugins and serves them like the artifacts of
+	// the Plugins, instead of publishing the upstream URIs of the archives.
+	// +optional
+	Rehost bool `json:"rehost,omitempty"`
+
+	// Interval the index is synced at, 1h by default.
+	// +optional
+	Interval *metav1.Duration `json:"interval,omitempty"`
+}
+
+// PluginRepositoryStatus defines the observed state of the PluginRepository.
+type PluginRepositoryStatus struct {
+	// Conditions of the PluginRepository, Ready once the index is mirrored.
+	// +patchMergeKey=type
+	// +patchStrategy=merge
+	// +listType=map
+	// +listMapKey=type
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+
+	// Plugins are the names of the plugins of the index that are published.
+	// +optional
+	Plugins []string `json:"plugins,omitempty"`
+
+	// Revision of the index last mirrored, the commit of the git repository or the sha256
+	// checksum of the archive.
+	// +optional
+	Revision string `json:"revision,omitempty"`
+
+	// LastSyncTime is the time the index is last mirrored at.
+	// +optional
+	LastSyncTime *metav1.Time `json:"lastSyncTime,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:resource:path=pluginrepositories,scope=Cluster
+//+kubebuilder:printcolumn:name="URL",type=string,JSONPath=`.spec.url`
+//+kubebuilder:printcolumn:name="Ready",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].status`
+//+kubebuilder:printcolumn:name="Reason",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].reason`
+//+kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// PluginRepository is an external krew index whose plugins are mirrored into the indexes of the
+// controller, next to the Plugins.
+type PluginRepository struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   PluginRepositorySpec   `json:"spec,omitempty"`
+	Status PluginRepositoryStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// PluginRepositoryList contains a list of PluginRepository
+type PluginRepositoryList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []PluginRepository `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&PluginRepository{}, &PluginRepositoryList{})
+}
@@ -6,7 +6,12 @@ import (
 	"github.com/spf13/cobra"
 	"k8s.io/component-base/cli"
 
+	"github.com/openshift/cli-manager/pkg/cmd/apply"
 	cli_manager "github.com/openshift/cli-manager/pkg/cmd/cli-manager"
+	"github.com/openshift/cli-manager/pkg/cmd/fsck"
+	"github.com/openshift/cli-manager/pkg/cmd/generate"
+	"github.com/openshift/cli-manager/pkg/cmd/upgrades"
+	"github.com/openshift/cli-manager/pkg/cmd/verify"
 )
 
 func main() {
@@ -27,6 +32,11 @@ func NewCLIManagerCommand() *cobra.Command {
 
 	start := cli_manager.NewCLIManagerCommand("start", false)
 	cmd.AddCommand(start)
+	cmd.AddCommand(verify.NewVerifyCommand("verify"))
+	cmd.AddCommand(fsck.NewFsckCommand("fsck"))
+	cmd.AddCommand(apply.NewApplyCommand("apply"))
+	cmd.AddCommand(upgrades.NewUpgradesCommand("upgrades"))
+	cmd.AddCommand(generate.NewGenerateCommand("generate"))
 
 	return cmd
 }
@@ -0,0 +1,93 @@
+// Package adminclient connects the commands to the admin API of the running CLI manager.
+package adminclient
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/pflag"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// Options holds the connection to the admin API.
+type Options struct {
+	// Server is the URL of the CLI manager route, i.e. https://<route host>.
+	Server string
+	// PathPrefix is the URL path the CLI manager serves the API under.
+	PathPrefix string
+	// Token authenticates the user, it is read from the kubeconfig if empty.
+	Token string
+	// CAFile is the CA bundle trusted for the route.
+	CAFile string
+	// InsecureSkipTLSVerify disables the verification of the route certificate.
+	InsecureSkipTLSVerify bool
+	// IdempotencyKey is sent with the mutating requests, so that retries are not performed twice.
+	IdempotencyKey string
+}
+
+// AddFlags adds the connection flags. The server flag is required.
+func (o *Options) AddFlags(flags *pflag.FlagSet) {
+	flags.StringVar(&o.Server, "server", o.Server, "URL of the CLI manager route.")
+	flags.StringVar(&o.PathPrefix, "path-prefix", "/cli-manager", "URL path prefix the CLI manager is configured with.")
+	flags.StringVar(&o.Token, "token", o.Token, "bearer token of the user, the token of the current kubeconfig context is used if not set.")
+	flags.StringVar(&o.CAFile, "certificate-authority", o.CAFile, "CA bundle trusted for the route in addition to the system roots.")
+	flags.BoolVar(&o.InsecureSkipTLSVerify, "insecure-skip-tls-verify", o.InsecureSkipTLSVerify, "skip the verification of the route certificate.")
+	flags.StringVar(&o.IdempotencyKey, "idempotency-key", o.IdempotencyKey, "key identifying the operation, so that retries with the same key replay the response of the first attempt instead of performing the operation again.")
+}
+
+// Do sends the request to the path of the admin API under the path prefix, authenticated with the token of the user.
+func (o *Options) Do(method, path, contentType string, body io.Reader) (*http.Response, error) {
+	token := o.Token
+	if len(token) == 0 {
+		config, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(clientcmd.NewDefaultClientConfigLoadingRules(), &clientcmd.ConfigOverrides{}).ClientConfig()
+		if err != nil {
+			return nil, fmt.Errorf("loading kubeconfig: %w", err)
+		}
+		token = config.BearerToken
+	}
+	if len(token) == 0 {
+		return nil, fmt.Errorf("no token found in the kubeconfig, please log in or set --token")
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: o.InsecureSkipTLSVerify,
+	}
+	if len(o.CAFile) > 0 {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		ca, err := os.ReadFile(o.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		pool.AppendCertsFromPEM(ca)
+		tlsConfig.RootCAs = pool
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	client := &http.Client{Transport: transport, Timeout: 10 * time.Minute}
+
+	if prefix := strings.Trim(o.PathPrefix, "/"); len(prefix) > 0 {
+		path = "/" + prefix + path
+	}
+	req, err := http.NewRequest(method, strings.TrimSuffix(o.Server, "/")+path, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	if len(contentType) > 0 {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if len(o.IdempotencyKey) > 0 && method != http.MethodGet {
+		req.Header.Set("Idempotency-Key", o.IdempotencyKey)
+	}
+	return client.Do(req)
+}
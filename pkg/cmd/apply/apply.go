@@ -0,0 +1,121 @@
+package apply
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"github.com/openshift/cli-manager/pkg/cmd/adminclient"
+	"github.com/openshift/cli-manager/pkg/server"
+)
+
+// Options holds the inputs of the apply command.
+type Options struct {
+	adminclient.Options
+	// Filenames are the multi-document manifests of the plugins, - reads the standard input.
+	Filenames []string
+	// DryRun only validates the batch.
+	DryRun bool
+
+	In  io.Reader
+	Out io.Writer
+}
+
+// NewApplyCommand returns the command applying a batch of plugins
+// through the admin API of the running CLI manager.
+func NewApplyCommand(name string) *cobra.Command {
+	o := &Options{}
+	cmd := &cobra.Command{
+		Use:   name + " --server=https://<route host> -f plugins.yaml",
+		Short: "Apply a batch of plugins with a single index regeneration",
+		Long: `Apply a batch of plugins with a single index regeneration.
+
+The plugins of the multi-document manifests are validated as a whole by the running CLI manager
+before any of them is applied: the names must be unique, the images must satisfy the registry
+policy and every plugin must be accepted by the API server. The index is regenerated once after
+the plugins of the batch are synced, instead of once per plugin.
+
+Applying requires the create and update permissions on plugins.
+The token of the current kubeconfig context is used unless --token is set.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			o.In = cmd.InOrStdin()
+			o.Out = cmd.OutOrStdout()
+			return o.Run()
+		},
+		SilenceUsage: true,
+	}
+	o.AddFlags(cmd.Flags())
+	cmd.Flags().StringSliceVarP(&o.Filenames, "filename", "f", o.Filenames, "manifests of the plugins, - reads the standard input.")
+	cmd.Flags().BoolVar(&o.DryRun, "dry-run", o.DryRun, "only validate the batch without applying it.")
+	cmd.MarkFlagRequired("server")
+	cmd.MarkFlagRequired("filename")
+	return cmd
+}
+
+// Run sends the manifests to the apply endpoint and prints the results.
+func (o *Options) Run() error {
+	manifest := &bytes.Buffer{}
+	for _, filename := range o.Filenames {
+		var content []byte
+		var err error
+		if filename == "-" {
+			content, err = io.ReadAll(o.In)
+		} else {
+			content, err = os.ReadFile(filename)
+		}
+		if err != nil {
+			return err
+		}
+		manifest.WriteString("\n---\n")
+		manifest.Write(content)
+	}
+
+	path := "/api/v1alpha1/admin/apply"
+	if o.DryRun {
+		path += "?dryRun=true"
+	}
+	resp, err := o.Do(http.MethodPost, path, "application/yaml", manifest)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusUnprocessableEntity && resp.StatusCode != http.StatusConflict {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("apply failed with %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	result := &server.ApplyResult{}
+	if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+		return fmt.Errorf("invalid apply result: %w", err)
+	}
+	w := tabwriter.NewWriter(o.Out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "PLUGIN\tACTION\tERROR")
+	failed := 0
+	for _, p := range result.Plugins {
+		action := p.Action
+		switch {
+		case len(p.Error) > 0:
+			failed++
+			action = "failed"
+		case result.DryRun:
+			action = "validated"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", p.Name, action, p.Error)
+	}
+	w.Flush()
+	if failed > 0 {
+		if resp.StatusCode == http.StatusUnprocessableEntity {
+			return fmt.Errorf("%d of %d plugins are invalid, none is applied", failed, len(result.Plugins))
+		}
+		return fmt.Errorf("%d of %d plugins failed", failed, len(result.Plugins))
+	}
+	return nil
+}
@@ -6,31 +6,118 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	apiextensionsclient "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/dynamic/dynamicinformer"
 	"k8s.io/client-go/kubernetes"
+	cliflag "k8s.io/component-base/cli/flag"
+	"k8s.io/component-base/metrics/legacyregistry"
 	"k8s.io/klog/v2"
 
+	configclient "github.com/openshift/client-go/config/clientset/versioned/typed/config/v1"
 	routeclient "github.com/openshift/client-go/route/clientset/versioned/typed/route/v1"
 	"github.com/openshift/library-go/pkg/controller/controllercmd"
 
+	"github.com/openshift/cli-manager/api/v1alpha1"
 	"github.com/openshift/cli-manager/pkg/controller"
 	"github.com/openshift/cli-manager/pkg/git"
+	"github.com/openshift/cli-manager/pkg/image"
+	"github.com/openshift/cli-manager/pkg/server"
 )
 
 const (
 	PortNumber        = 9449
 	MetricsPortNumber = 8443
+	// WebhookPortNumber serves the admission and conversion webhooks over HTTPS to the API server.
+	WebhookPortNumber = 9443
 	tlsCRT            = "/etc/secrets/tls.crt"
 	tlsKey            = "/etc/secrets/tls.key"
 )
 
-var ServeArtifactAsHttp bool
+var (
+	ServeArtifactAsHttp bool
+	// RouteName is the route the artifacts of this controller are served from.
+	RouteName = "openshift-cli-manager"
+	// Shards is the number of controller shards plugins are partitioned into.
+	Shards = 1
+	// ShardID is the shard this controller manages.
+	ShardID = 0
+	// RegistryClientCertificateSecrets maps registry hosts to client certificate Secrets.
+	RegistryClientCertificateSecrets map[string]string
+	// PublisherTokensSecret is the Secret of tokens CI systems publish plugins with.
+	PublisherTokensSecret string
+	// OAuthOptions gates the catalog behind the cluster OAuth server.
+	OAuthOptions server.OAuthOptions
+	// RBACVisibility limits the catalog to the plugins users are allowed to get.
+	RBACVisibility bool
+	// OnDemandPlatforms are the platforms only published once demanded by users.
+	OnDemandPlatforms []string
+	// RegistryProxySecret is the Secret holding the credentials of the registry proxy.
+	RegistryProxySecret string
+	// CredentialsExpiryWarning is how long before their expiry the image pull credentials are reported.
+	CredentialsExpiryWarning = 7 * 24 * time.Hour
+	// MigrateStorageVersion rewrites the Plugins stored in older versions on startup.
+	MigrateStorageVersion = true
+	// TLSMinVersion is the minimum TLS version of the metrics listener and the registry connections.
+	TLSMinVersion = "VersionTLS12"
+	// TLSCipherSuites are the cipher suites of the metrics listener and the registry connections up to TLS 1.2.
+	TLSCipherSuites []string
+	// UpstreamIndexURL is the upstream krew index the mirrored plugins are compared against.
+	UpstreamIndexURL = server.DefaultUpstreamIndexURL
+	// PlatformWorkers is the number of platforms of a plugin pulled and extracted concurrently.
+	PlatformWorkers = 4
+	// ResyncInterval is how often the plugins are synced again by default.
+	ResyncInterval time.Duration
+	// MaxVersions is the number of older versions of the plugins published by default.
+	MaxVersions int
+	// MaxVersionAge is how long the older versions of the plugins are published by default.
+	MaxVersionAge time.Duration
+	// HSTSMaxAge is the max-age of the Strict-Transport-Security header of the HTTPS responses.
+	HSTSMaxAge = 365 * 24 * time.Hour
+)
 
 func RunCLIManager(ctx context.Context, controllerContext *controllercmd.ControllerContext) error {
+	git.PathPrefix = "/" + strings.Trim(git.PathPrefix, "/")
+	if git.PathPrefix == "/" {
+		return fmt.Errorf("path prefix must not be empty")
+	}
+	if err := image.ValidateGzipLevel(image.GzipLevel); err != nil {
+		return err
+	}
+	if err := image.ValidateArtifactOwner(image.ArtifactUID, image.ArtifactGID, image.ArtifactUname, image.ArtifactGname); err != nil {
+		return err
+	}
+	tlsConfig, err := newTLSConfig()
+	if err != nil {
+		return err
+	}
+	image.TLSMinVersion = tlsConfig.MinVersion
+	image.TLSCipherSuites = tlsConfig.CipherSuites
+
+	// the webhooks are served first, the API server converts the plugins the controller reads and
+	// migrates with the conversion webhook
+	webhookMux := http.NewServeMux()
+	server.RegisterWebhookHandlers(webhookMux)
+	webhookServer := &http.Server{
+		Addr:      fmt.Sprintf(":%d", WebhookPortNumber),
+		Handler:   webhookMux,
+		TLSConfig: tlsConfig,
+	}
+
+	go func() {
+		if err := webhookServer.ListenAndServeTLS(tlsCRT, tlsKey); !errors.Is(err, http.ErrServerClosed) {
+			klog.Errorf("webhook server exited with error %s", err.Error())
+		}
+	}()
+
 	dynamicClient, err := dynamic.NewForConfig(controllerContext.KubeConfig)
 	if err != nil {
 		return err
@@ -46,24 +133,103 @@ func RunCLIManager(ctx context.Context, controllerContext *controllercmd.Control
 		return err
 	}
 
-	repo, err := git.PrepareLocalGit()
+	if MigrateStorageVersion && ShardID == 0 {
+		crdClient, err := apiextensionsclient.NewForConfig(controllerContext.KubeConfig)
+		if err != nil {
+			return err
+		}
+		// the plugins keep being served from the older versions if the migration fails
+		if err := controller.MigrateStorageVersion(ctx, crdClient, dynamicClient); err != nil {
+			klog.Errorf("storage version migration failed: %v", err)
+		}
+	}
+
+	if _, ok := image.Placeholders[image.PlaceholderClusterAPIURL]; !ok {
+		config, err := configclient.NewForConfig(controllerContext.KubeConfig)
+		if err != nil {
+			return err
+		}
+		infrastructure, err := config.Infrastructures().Get(ctx, "cluster", metav1.GetOptions{})
+		if err != nil {
+			klog.Warningf("%s placeholder is not substituted, the cluster infrastructure is not found: %v", image.PlaceholderClusterAPIURL, err)
+		} else if len(infrastructure.Status.APIServerURL) > 0 {
+			if image.Placeholders == nil {
+				image.Placeholders = map[string]string{}
+			}
+			image.Placeholders[image.PlaceholderClusterAPIURL] = infrastructure.Status.APIServerURL
+		}
+	}
+
+	if err := os.MkdirAll(image.TarballPath, 0755); err != nil {
+		return fmt.Errorf("creating the artifacts directory: %w", err)
+	}
+	// the artifacts being written when the previous process stopped are never completed
+	if err := image.RemoveTemporaryFiles(image.TarballPath); err != nil {
+		return err
+	}
+
+	repo, err := git.PrepareLocalGit(git.GitRepoPath)
+	if err != nil {
+		return err
+	}
+
+	previewRepo, err := git.PrepareLocalGit(git.PreviewGitRepoPath)
 	if err != nil {
 		return err
 	}
 
+	channelRepos := map[string]*git.Repo{}
+	for _, channel := range v1alpha1.Channels {
+		channelRepos[string(channel)], err = git.PrepareLocalGit(filepath.Join(git.ChannelsGitRepoPath, string(channel)))
+		if err != nil {
+			return err
+		}
+	}
+
 	informers := dynamicinformer.NewDynamicSharedInformerFactory(dynamicClient, 0)
-	cliSyncController, err := controller.NewCLISyncController(repo, informers, client, dynamicClient, route, ServeArtifactAsHttp, controllerContext.EventRecorder)
+	cliSyncController, err := controller.NewCLISyncController(repo, previewRepo, channelRepos, informers, client, dynamicClient, route, controller.Options{
+		InsecureHTTP: ServeArtifactAsHttp,
+		RouteName:    RouteName,
+		Shards:       Shards,
+		ShardID:      ShardID,
+
+		RegistryClientCertificateSecrets: RegistryClientCertificateSecrets,
+		OnDemandPlatforms:                OnDemandPlatforms,
+		CredentialsExpiryWarning:         CredentialsExpiryWarning,
+		RegistryProxySecret:              RegistryProxySecret,
+		PlatformWorkers:                  PlatformWorkers,
+		ResyncInterval:                   ResyncInterval,
+		MaxVersions:                      MaxVersions,
+		MaxVersionAge:                    MaxVersionAge,
+	}, controllerContext.EventRecorder)
+	if err != nil {
+		return err
+	}
+	repositoryController, err := controller.NewRepositoryController(cliSyncController, informers, controllerContext.EventRecorder)
 	if err != nil {
 		return err
 	}
 
 	informers.Start(ctx.Done())
-	informers.WaitForCacheSync(ctx.Done())
+	start := time.Now()
+	synced := informers.WaitForCacheSync(ctx.Done())
+	controller.ObserveInformerCacheSync(synced, time.Since(start))
 
-	mux := git.PrepareGitServer()
-	server := &http.Server{
+	mux := git.PrepareGitServer(repo, previewRepo, channelRepos)
+	apiServer, err := server.New(ctx, client, dynamicClient, cliSyncController, server.Options{
+		PublisherTokensSecret: PublisherTokensSecret,
+		OAuth:                 OAuthOptions,
+		RBACVisibility:        RBACVisibility,
+		OnDemandPlatforms:     OnDemandPlatforms,
+		UpstreamIndexURL:      UpstreamIndexURL,
+	})
+	if err != nil {
+		return err
+	}
+	apiServer.RegisterHandlers(mux)
+	gitServer := &http.Server{
 		Addr:         fmt.Sprintf(":%d", PortNumber),
-		Handler:      mux,
+		Handler:      server.StrictTransportSecurity(mux, HSTSMaxAge),
 		ReadTimeout:  5 * time.Minute,
 		WriteTimeout: 15 * time.Minute,
 		// 1MB size should be sufficient
@@ -72,16 +238,18 @@ func RunCLIManager(ctx context.Context, controllerContext *controllercmd.Control
 	}
 
 	go func() {
-		if err := server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		if err := gitServer.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
 			klog.Errorf("git server exited with error %s", err.Error())
 		}
 	}()
 
 	metricsMux := http.NewServeMux()
-	metricsMux.Handle("/metrics", promhttp.Handler())
+	// controller metrics are registered to the legacy registry of the component-base
+	metricsMux.Handle("/metrics", promhttp.HandlerFor(prometheus.Gatherers{prometheus.DefaultGatherer, legacyregistry.DefaultGatherer}, promhttp.HandlerOpts{}))
 	metricsServer := &http.Server{
-		Addr:    fmt.Sprintf(":%d", MetricsPortNumber),
-		Handler: metricsMux,
+		Addr:      fmt.Sprintf(":%d", MetricsPortNumber),
+		Handler:   server.StrictTransportSecurity(metricsMux, HSTSMaxAge),
+		TLSConfig: tlsConfig,
 	}
 
 	go func() {
@@ -91,6 +259,26 @@ func RunCLIManager(ctx context.Context, controllerContext *controllercmd.Control
 	}()
 
 	go cliSyncController.Run(ctx, 1)
+	go repositoryController.Run(ctx, 1)
 	<-ctx.Done()
 	return nil
 }
+
+// newTLSConfig returns the TLS configuration of the listeners from TLSMinVersion and TLSCipherSuites.
+func newTLSConfig() (*tls.Config, error) {
+	minVersion, err := cliflag.TLSVersion(TLSMinVersion)
+	if err != nil {
+		return nil, err
+	}
+	cipherSuites, err := cliflag.TLSCipherSuites(TLSCipherSuites)
+	if err != nil {
+		return nil, err
+	}
+	if minVersion == tls.VersionTLS13 && len(cipherSuites) > 0 {
+		return nil, fmt.Errorf("cipher suites are not configurable with TLS 1.3")
+	}
+	return &tls.Config{
+		MinVersion:   minVersion,
+		CipherSuites: cipherSuites,
+	}, nil
+}
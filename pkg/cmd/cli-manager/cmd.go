@@ -8,12 +8,17 @@ import (
 	"github.com/spf13/cobra"
 	corev1 "k8s.io/api/core/v1"
 
+	"github.com/openshift/cli-manager/pkg/controller"
+	"github.com/openshift/cli-manager/pkg/git"
+	"github.com/openshift/cli-manager/pkg/image"
 	"github.com/openshift/cli-manager/pkg/version"
 )
 
 const (
 	podNameEnv      = "POD_NAME"
 	podNamespaceEnv = "POD_NAMESPACE"
+	// artifactsDirEnv sets the default of --artifacts-dir
+	artifactsDirEnv = "ARTIFACTS_DIR"
 )
 
 func NewCLIManagerCommand(name string, supportHttp bool) *cobra.Command {
@@ -27,6 +32,64 @@ func NewCLIManagerCommand(name string, supportHttp bool) *cobra.Command {
 	cmd.Use = name
 	cmd.Short = "Start the CLI manager controllers"
 
+	if dir := os.Getenv(artifactsDirEnv); len(dir) > 0 {
+		image.TarballPath = dir
+	}
+
+	cmd.Flags().StringVar(&git.PathPrefix, "path-prefix", git.PathPrefix, "URL path prefix the indexes, the artifacts, the catalog and the JSON API are served under, for routes multiplexing several services. The preview index is served under the prefix followed by -preview.")
+	cmd.Flags().StringVar(&RouteName, "route-name", RouteName, "name of the route in openshift-cli-manager-operator namespace the artifacts are served from. Each shard should be exposed by its own route.")
+	cmd.Flags().IntVar(&Shards, "shards", Shards, "number of controller shards the plugins are partitioned into by the hash of their names.")
+	cmd.Flags().IntVar(&ShardID, "shard-id", ShardID, "shard managed by this controller, in the range [0, shards). Each shard extracts its own plugins and serves an index merged from all shards.")
+
+	cmd.Flags().StringToStringVar(&RegistryClientCertificateSecrets, "registry-client-certificate-secrets", RegistryClientCertificateSecrets, "registry host to kubernetes.io/tls Secret (in namespace/name format) mappings, whose certificates are presented to the registries requiring client certificate authentication.")
+	cmd.Flags().StringSliceVar(&OnDemandPlatforms, "on-demand-platforms", OnDemandPlatforms, "minority platforms (os/arch, or arch for any os, e.g. s390x) that are only extracted and published once a user demands them through the API.")
+	cmd.Flags().DurationVar(&CredentialsExpiryWarning, "credentials-expiry-warning", CredentialsExpiryWarning, "how long before the expiry of the image pull credentials the CredentialsExpiring condition of the plugins is raised.")
+	cmd.Flags().StringVar(&PublisherTokensSecret, "publisher-tokens-secret", PublisherTokensSecret, "namespace/name of the Secret mapping plugin name prefixes to the tokens CI systems publish those plugins with. The publish API is disabled if not set.")
+	cmd.Flags().StringVar(&OAuthOptions.ClientID, "oauth-client-id", OAuthOptions.ClientID, "OAuthClient the catalog and the plugins API authenticate users with. Both are served without authentication if not set.")
+	cmd.Flags().StringVar(&OAuthOptions.ClientSecretFile, "oauth-client-secret-file", OAuthOptions.ClientSecretFile, "file containing the secret of the OAuthClient.")
+	cmd.Flags().StringVar(&OAuthOptions.RedirectURL, "oauth-redirect-url", OAuthOptions.RedirectURL, "redirect URL registered in the OAuthClient, i.e. https://<route host>/cli-manager/oauth/callback.")
+	cmd.Flags().StringVar(&OAuthOptions.CAFile, "oauth-ca-file", OAuthOptions.CAFile, "PEM bundle trusted when connecting to the OAuth server in addition to the system roots.")
+	cmd.Flags().StringVar(&OAuthOptions.SessionSecretFile, "oauth-session-secret-file", OAuthOptions.SessionSecretFile, "file containing the key sessions are signed with. A random key is used if not set, which invalidates sessions on restarts and across replicas.")
+	cmd.Flags().StringVar(&UpstreamIndexURL, "upstream-index-url", UpstreamIndexURL, "URL of the plugins directory of the upstream krew index the mirrored plugins are compared against in the upgrade report. The report is disabled if empty.")
+	cmd.Flags().BoolVar(&RBACVisibility, "rbac-scoped-visibility", RBACVisibility, "limit the catalog and the plugins API to the plugins the user is allowed to get. Impersonation headers are honored for the callers allowed to impersonate.")
+	cmd.Flags().StringVar(&TLSMinVersion, "tls-min-version", TLSMinVersion, "minimum TLS version of the metrics listener and the connections to image registries, e.g. VersionTLS12 or VersionTLS13.")
+	cmd.Flags().StringSliceVar(&TLSCipherSuites, "tls-cipher-suites", TLSCipherSuites, "IANA names of the cipher suites of the metrics listener and the connections to image registries up to TLS 1.2. The Go defaults are used if not set.")
+	cmd.Flags().DurationVar(&HSTSMaxAge, "hsts-max-age", HSTSMaxAge, "max-age of the Strict-Transport-Security header added to the responses served over HTTPS, directly or through the route. The header is not sent if 0.")
+	cmd.Flags().BoolVar(&MigrateStorageVersion, "migrate-storage-version", MigrateStorageVersion, "rewrite the plugins stored in older versions than the storage version of the CRD on startup, and drop the older versions from its stored versions once all the plugins round-trip.")
+	cmd.Flags().IntVar(&controller.MaxPluginMetricLabels, "metrics-max-plugin-labels", controller.MaxPluginMetricLabels, "maximum number of plugins with their own label in per-plugin metrics, the rest are aggregated to bound the cardinality.")
+	cmd.Flags().StringVar(&image.UserAgent, "registry-user-agent", image.UserAgent, "User-Agent header sent to image registries instead of the default one.")
+	cmd.Flags().StringToStringVar(&image.RegistryHeaders, "registry-headers", image.RegistryHeaders, "static headers in key=value format added to every request sent to image registries.")
+	cmd.Flags().StringToStringVar(&image.Placeholders, "placeholders", image.Placeholders, "values in key=value format substituted for the ${key} placeholders in the plugin files with the Substitute transform. CLUSTER_API_URL is discovered from the cluster Infrastructure if not set.")
+	cmd.Flags().StringSliceVar(&image.AllowedRegistries, "allowed-registries", image.AllowedRegistries, "registry prefixes (e.g. quay.io or quay.io/org) plugin images may be pulled from. All registries are allowed if not set.")
+	cmd.Flags().StringSliceVar(&image.BlockedRegistries, "blocked-registries", image.BlockedRegistries, "registry prefixes plugin images must not be pulled from, taking precedence over --allowed-registries.")
+	cmd.Flags().StringVar(&image.RegistryProxy, "registry-proxy", image.RegistryProxy, "URL of the proxy image registries are accessed through (http, https, socks5 or socks5h scheme, with optional user:password), overriding the proxy environment variables. Plugin platforms may override it with their proxy field.")
+	cmd.Flags().StringVar(&RegistryProxySecret, "registry-proxy-secret", RegistryProxySecret, "Secret (in namespace/name format) holding the credentials of the registry proxy, either in username and password keys, or in a proxyURL key with the full proxy URL replacing --registry-proxy.")
+	cmd.Flags().BoolVar(&image.LazyPull, "lazy-pull", image.LazyPull, "fetch only the chunks of the plugin files from the eStargz layers with range requests, instead of downloading the whole layers.")
+	cmd.Flags().IntVar(&image.LayerIndexCacheSize, "layer-index-cache-size", image.LayerIndexCacheSize, "number of entries of the indexes of the image layers cached in memory, so that the layers that can not contain the plugin files are not read again. The layers are not indexed if 0.")
+	cmd.Flags().Int64Var(&image.MaxImageSize, "max-image-size", image.MaxImageSize, "maximum total compressed size in bytes of the plugin images, checked against the manifest before downloading any layer. The size is not limited if 0.")
+	cmd.Flags().Int64Var(&image.MaxFileSize, "max-file-size", image.MaxFileSize, "maximum size in bytes of the files extracted into the plugin artifacts. The size is not limited if 0.")
+	cmd.Flags().Int64Var(&image.MaxArtifactSize, "max-artifact-size", image.MaxArtifactSize, "maximum total size in bytes of the files extracted into a plugin artifact, before compression. The size is not limited if 0.")
+	cmd.Flags().BoolVar(&image.RejectPrivilegedFiles, "reject-privileged-files", image.RejectPrivilegedFiles, "fail the extraction of the plugin platforms with setuid or setgid files, or device files. Their bits are dropped and the devices are skipped if false.")
+	cmd.Flags().DurationVar(&ResyncInterval, "resync-interval", ResyncInterval, "how often the plugins are synced again, so that the tags of their images are tracked, unless they set their own resyncInterval. The plugins are only synced once changed if 0.")
+	cmd.Flags().IntVar(&MaxVersions, "max-plugin-versions", MaxVersions, "number of older versions of the plugins published, the newest ones, unless the plugins set their own retention. The older versions beyond it are unpublished and their artifacts removed. All of them are published if 0.")
+	cmd.Flags().DurationVar(&MaxVersionAge, "max-plugin-version-age", MaxVersionAge, "how long the older versions of the plugins are published once first published, unless the plugins set their own retention. They are published without limit if 0.")
+	cmd.Flags().IntVar(&PlatformWorkers, "platform-workers", PlatformWorkers, "number of platforms of a plugin whose images are pulled and extracted concurrently.")
+	cmd.Flags().StringVar(&image.ScanWebhookURL, "scan-webhook-url", image.ScanWebhookURL, "webhook every artifact is streamed to before it is published, i.e. a malware scanner. The artifacts are not scanned if empty.")
+	cmd.Flags().StringVar(&image.ScanWebhookCAFile, "scan-webhook-ca-file", image.ScanWebhookCAFile, "PEM bundle trusted for the scan webhook in addition to the system roots.")
+	cmd.Flags().DurationVar(&image.ScanTimeout, "scan-timeout", image.ScanTimeout, "maximum duration of the scan of an artifact.")
+	cmd.Flags().IntVar(&image.GzipLevel, "gzip-level", image.GzipLevel, "compression level of the tar.gz and zip artifacts, from 1 (fastest) to 9 (smallest), 0 for no compression, -1 for the default level and -2 for Huffman-only compression.")
+	cmd.Flags().IntVar(&image.ArtifactUID, "artifact-uid", image.ArtifactUID, "user id owning the files of the tar artifacts, whatever their owner in the image.")
+	cmd.Flags().IntVar(&image.ArtifactGID, "artifact-gid", image.ArtifactGID, "group id owning the files of the tar artifacts, whatever their owner in the image.")
+	cmd.Flags().StringVar(&image.ArtifactUname, "artifact-uname", image.ArtifactUname, "user name owning the files of the tar artifacts, empty by default so that it is not looked up on extraction.")
+	cmd.Flags().StringVar(&image.ArtifactGname, "artifact-gname", image.ArtifactGname, "group name owning the files of the tar artifacts, empty by default so that it is not looked up on extraction.")
+	cmd.Flags().BoolVar(&image.ZstdArtifacts, "zstd-artifacts", image.ZstdArtifacts, "write a tar.zst variant of the tar.gz artifacts, served to the clients accepting application/zstd. krew keeps downloading the tar.gz artifacts.")
+	cmd.Flags().BoolVar(&image.SBOMs, "extract-sboms", image.SBOMs, "extract the SPDX or CycloneDX SBOM of the plugin images, from their filesystem or their OCI referrers, and serve it alongside the artifacts.")
+	cmd.Flags().Int64Var(&image.MemoryBudget, "extraction-memory-budget", image.MemoryBudget, "memory in bytes the plugin extractions running at once may use, each extraction waits for its estimated share. The memory is not limited if 0.")
+	cmd.Flags().IntVar(&image.CircuitBreakerThreshold, "registry-circuit-breaker-threshold", image.CircuitBreakerThreshold, "number of consecutive failed pulls from a registry after which its pulls are short-circuited. The circuit breaker is disabled if 0.")
+	cmd.Flags().DurationVar(&image.CircuitBreakerCooldown, "registry-circuit-breaker-cooldown", image.CircuitBreakerCooldown, "how long the pulls from a tripped registry are short-circuited before a trial pull is let through.")
+	cmd.Flags().StringVar(&image.TarballPath, "artifacts-dir", image.TarballPath, "directory the artifacts are stored in and served from, i.e. a mounted PVC. Defaults to the ARTIFACTS_DIR environment variable if it is set.")
+	cmd.Flags().StringVar(&image.LocalImagesPath, "local-images-dir", image.LocalImagesPath, "directory pre-loaded oci-archive and docker-archive image tarballs are read from, i.e. a mounted PVC.")
+
 	if supportHttp {
 		cmd.Flags().BoolVar(&ServeArtifactAsHttp, "serve-artifacts-in-http", false, "serving artifact in HTTP instead of HTTPS. That is used for testing purposes only. Using the flag in production is at your own risk. This flag is not supported.")
 		cmd.Flags().MarkHidden("serve-artifacts-in-http")
@@ -0,0 +1,94 @@
+package fsck
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"github.com/openshift/cli-manager/pkg/cmd/adminclient"
+	"github.com/openshift/cli-manager/pkg/controller"
+)
+
+// Options holds the inputs of the fsck command.
+type Options struct {
+	adminclient.Options
+	// Repair repairs the inconsistencies in addition to reporting them.
+	Repair bool
+
+	Out io.Writer
+}
+
+// NewFsckCommand returns the command checking the consistency of the catalog
+// through the admin API of the running CLI manager.
+func NewFsckCommand(name string) *cobra.Command {
+	o := &Options{}
+	cmd := &cobra.Command{
+		Use:   name + " --server=https://<route host>",
+		Short: "Check the consistency of the plugins, artifacts and indexes, and optionally repair them",
+		Long: `Check the consistency of the plugins, artifacts and indexes, and optionally repair them.
+
+The Plugins, their published status, the artifacts and the checksums on disk and the index entries
+are cross-checked by the running CLI manager. With --repair, the plugins with missing or corrupted
+artifacts are re-extracted, the index entries are re-indexed and the orphaned ones are pruned.
+
+Checking requires the list permission on plugins, repairing requires the update permission.
+The token of the current kubeconfig context is used unless --token is set.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			o.Out = cmd.OutOrStdout()
+			return o.Run()
+		},
+		SilenceUsage: true,
+	}
+	o.AddFlags(cmd.Flags())
+	cmd.Flags().BoolVar(&o.Repair, "repair", o.Repair, "repair the inconsistencies by re-extracting, re-indexing and pruning.")
+	cmd.MarkFlagRequired("server")
+	return cmd
+}
+
+// Run requests the consistency check and prints the report.
+func (o *Options) Run() error {
+	method, path := http.MethodGet, "/api/v1alpha1/admin/fsck"
+	if o.Repair {
+		method = http.MethodPost
+		path += "?repair=true"
+	}
+	resp, err := o.Do(method, path, "", nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("fsck failed with %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	report := &controller.FsckReport{}
+	if err := json.NewDecoder(resp.Body).Decode(report); err != nil {
+		return fmt.Errorf("invalid fsck report: %w", err)
+	}
+	if len(report.Issues) == 0 {
+		fmt.Fprintln(o.Out, "no inconsistencies found")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(o.Out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "KIND\tPLUGIN\tPLATFORM\tINDEX\tREPAIRED\tMESSAGE")
+	unrepaired := 0
+	for _, issue := range report.Issues {
+		if !issue.Repaired {
+			unrepaired++
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%t\t%s\n", issue.Kind, issue.Plugin, issue.Platform, issue.Index, issue.Repaired, issue.Message)
+	}
+	w.Flush()
+	if unrepaired > 0 {
+		return fmt.Errorf("%d inconsistencies found", unrepaired)
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package generate
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/yaml"
+
+	"github.com/openshift/cli-manager/pkg/generate"
+	krew "github.com/openshift/cli-manager/pkg/krew/v1alpha2"
+)
+
+// Options holds the inputs of the generate command.
+type Options struct {
+	generate.Options
+	// ManifestPath is the krew plugin manifest, i.e. plugins/<name>.yaml of a krew index.
+	ManifestPath string
+
+	Out    io.Writer
+	ErrOut io.Writer
+}
+
+// NewGenerateCommand returns the command converting a krew plugin manifest into a Plugin
+// without cluster access.
+func NewGenerateCommand(name string) *cobra.Command {
+	o := &Options{}
+	cmd := &cobra.Command{
+		Use:   name + " --manifest=<plugin.yaml> [--image=<image>]",
+		Short: "Generate the Plugin equivalent to a krew plugin manifest",
+		Long: `Generate the Plugin equivalent to a krew plugin manifest, so that the plugins of a krew
+index are migrated to the CLI manager with "oc apply".
+
+The metadata, the version, the files and the bin of the platforms of the manifest are kept. The
+archives of the manifest are downloaded from their URIs and rehosted, unless --image is set, in which
+case the files are extracted from it instead. The ${os}, ${arch} and ${version} placeholders of
+--image are replaced by the ones of every platform, and the files of the archives are looked up in
+--root of the image. The platforms whose selectors do not match a single os and arch with matchLabels
+are skipped with a warning.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			o.Out = cmd.OutOrStdout()
+			o.ErrOut = cmd.ErrOrStderr()
+			return o.Run()
+		},
+		SilenceUsage: true,
+	}
+	cmd.Flags().StringVar(&o.ManifestPath, "manifest", o.ManifestPath, "krew plugin manifest to convert, - reads the standard input.")
+	cmd.Flags().StringVar(&o.Image, "image", o.Image, "image the files of the platforms are extracted from instead of the archives of the manifest, with the optional ${os}, ${arch} and ${version} placeholders, i.e. quay.io/org/tool:${version}.")
+	cmd.Flags().StringVar(&o.Root, "root", "/", "directory of the image holding the files of the archives of the manifest.")
+	cmd.Flags().StringVar(&o.Name, "name", o.Name, "name of the Plugin, the name of the manifest if not set.")
+	cmd.MarkFlagRequired("manifest")
+	return cmd
+}
+
+// Run writes the Plugin generated from the manifest.
+func (o *Options) Run() error {
+	var raw []byte
+	var err error
+	if o.ManifestPath == "-" {
+		raw, err = io.ReadAll(os.Stdin)
+	} else {
+		raw, err = os.ReadFile(o.ManifestPath)
+	}
+	if err != nil {
+		return err
+	}
+	k := &krew.Plugin{}
+	if err := yaml.Unmarshal(raw, k); err != nil {
+		return fmt.Errorf("invalid manifest %s: %w", o.ManifestPath, err)
+	}
+	plugin, skipped, err := generate.Plugin(k, o.Options)
+	for _, s := range skipped {
+		fmt.Fprintf(o.ErrOut, "warning: %s is skipped\n", s)
+	}
+	if err != nil {
+		return err
+	}
+
+	// the status and the server-side metadata are not written
+	u, err := runtime.DefaultUnstructuredConverter.ToUnstructured(plugin)
+	if err != nil {
+		return err
+	}
+	delete(u, "status")
+	unstructured.RemoveNestedField(u, "metadata", "creationTimestamp")
+	out, err := yaml.Marshal(u)
+	if err != nil {
+		return err
+	}
+	_, err = o.Out.Write(out)
+	return err
+}
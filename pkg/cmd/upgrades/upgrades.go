@@ -0,0 +1,89 @@
+package upgrades
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"github.com/openshift/cli-manager/pkg/cmd/adminclient"
+	"github.com/openshift/cli-manager/pkg/server"
+)
+
+// Options holds the inputs of the upgrades command.
+type Options struct {
+	adminclient.Options
+	// Output is the format of the report, a table if empty or json.
+	Output string
+
+	Out io.Writer
+}
+
+// NewUpgradesCommand returns the command reporting the mirrored plugins
+// that are older than in the upstream krew index.
+func NewUpgradesCommand(name string) *cobra.Command {
+	o := &Options{}
+	cmd := &cobra.Command{
+		Use:   name + " --server=https://<route host>",
+		Short: "Report the mirrored plugins that are older than in the upstream krew index",
+		Long: `Report the mirrored plugins that are older than in the upstream krew index.
+
+The plugins annotated with cli-manager.openshift.io/upstream-plugin are mirrored from the
+upstream krew index. The running CLI manager compares their versions against the manifests
+of the upstream index and reports the stale ones, which should be refreshed.
+
+Reporting requires the list permission on plugins.
+The token of the current kubeconfig context is used unless --token is set.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			o.Out = cmd.OutOrStdout()
+			return o.Run()
+		},
+		SilenceUsage: true,
+	}
+	o.AddFlags(cmd.Flags())
+	cmd.Flags().StringVarP(&o.Output, "output", "o", o.Output, "output format of the report, json prints the report of the API.")
+	cmd.MarkFlagRequired("server")
+	return cmd
+}
+
+// Run requests the upgrade report and prints it.
+func (o *Options) Run() error {
+	if len(o.Output) > 0 && o.Output != "json" {
+		return fmt.Errorf("unsupported output format %s", o.Output)
+	}
+	resp, err := o.Do(http.MethodGet, "/api/v1alpha1/admin/upgrades", "", nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("upgrade report failed with %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	report := &server.UpgradeReport{}
+	if err := json.NewDecoder(resp.Body).Decode(report); err != nil {
+		return fmt.Errorf("invalid upgrade report: %w", err)
+	}
+	if o.Output == "json" {
+		encoder := json.NewEncoder(o.Out)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(report)
+	}
+	if len(report.Plugins) == 0 {
+		fmt.Fprintln(o.Out, "no mirrored plugins found")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(o.Out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "PLUGIN\tUPSTREAM\tVERSION\tUPSTREAM VERSION\tSTALE\tERROR")
+	for _, p := range report.Plugins {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%t\t%s\n", p.Name, p.Upstream, p.Version, p.UpstreamVersion, p.Stale, p.Error)
+	}
+	return w.Flush()
+}
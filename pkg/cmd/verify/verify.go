@@ -0,0 +1,178 @@
+package verify
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"sigs.k8s.io/yaml"
+
+	krew "github.com/openshift/cli-manager/pkg/krew/v1alpha2"
+)
+
+// Options holds the inputs of the verify command.
+type Options struct {
+	// ManifestPath is the plugin manifest of the index, i.e. plugins/<name>.yaml.
+	ManifestPath string
+	// Platform is the os/arch the artifact is downloaded for.
+	Platform string
+	// ArtifactPath is the downloaded tar.gz or zip archive.
+	ArtifactPath string
+}
+
+// NewVerifyCommand returns the command verifying downloaded artifacts against
+// the checksums of the index without any cluster access.
+func NewVerifyCommand(name string) *cobra.Command {
+	o := &Options{
+		Platform: runtime.GOOS + "/" + runtime.GOARCH,
+	}
+	cmd := &cobra.Command{
+		Use:   name + " --manifest=<plugin.yaml> <artifact.tar.gz|artifact.zip>",
+		Short: "Verify a downloaded plugin artifact against its index manifest without cluster access",
+		Long: `Verify a downloaded plugin artifact against its index manifest without cluster access.
+
+The manifest is the plugin file of the index, i.e. plugins/<name>.yaml of the git repository
+served by the CLI manager, or ~/.krew/index/<index>/plugins/<name>.yaml after "kubectl krew update".
+The sha256 checksum of the artifact is compared against the one of the platform in the manifest,
+and the artifact is checked to contain the files the manifest installs.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			o.ArtifactPath = args[0]
+			if err := o.Run(); err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "%s is verified for platform %s\n", o.ArtifactPath, o.Platform)
+			return nil
+		},
+		SilenceUsage: true,
+	}
+	cmd.Flags().StringVar(&o.ManifestPath, "manifest", o.ManifestPath, "plugin manifest of the index the artifact is verified against.")
+	cmd.Flags().StringVar(&o.Platform, "platform", o.Platform, "os/arch platform the artifact is downloaded for.")
+	cmd.MarkFlagRequired("manifest")
+	return cmd
+}
+
+// Run verifies the artifact.
+func (o *Options) Run() error {
+	raw, err := os.ReadFile(o.ManifestPath)
+	if err != nil {
+		return err
+	}
+	plugin := &krew.Plugin{}
+	if err := yaml.Unmarshal(raw, plugin); err != nil {
+		return fmt.Errorf("invalid manifest %s: %w", o.ManifestPath, err)
+	}
+	platform, err := selectPlatform(plugin, o.Platform)
+	if err != nil {
+		return err
+	}
+	if len(platform.Sha256) == 0 {
+		return fmt.Errorf("manifest %s has no checksum for platform %s", o.ManifestPath, o.Platform)
+	}
+
+	checksum, err := fileChecksum(o.ArtifactPath)
+	if err != nil {
+		return err
+	}
+	if !strings.EqualFold(checksum, platform.Sha256) {
+		return fmt.Errorf("checksum mismatch of %s: expected %s, got %s", o.ArtifactPath, platform.Sha256, checksum)
+	}
+
+	entries, err := archiveEntries(o.ArtifactPath)
+	if err != nil {
+		return err
+	}
+	for _, f := range platform.Files {
+		if !matchesAny(entries, f.From) {
+			return fmt.Errorf("%s does not contain %s", o.ArtifactPath, f.From)
+		}
+	}
+	return nil
+}
+
+// selectPlatform returns the platform of the manifest whose selector matches os/arch.
+func selectPlatform(plugin *krew.Plugin, platform string) (*krew.Platform, error) {
+	goos, goarch, ok := strings.Cut(platform, "/")
+	if !ok {
+		return nil, fmt.Errorf("invalid platform %s, should be in os/arch format", platform)
+	}
+	for i, p := range plugin.Spec.Platforms {
+		if p.Selector == nil {
+			continue
+		}
+		if p.Selector.MatchLabels["os"] == goos && p.Selector.MatchLabels["arch"] == goarch {
+			return &plugin.Spec.Platforms[i], nil
+		}
+	}
+	return nil, fmt.Errorf("plugin %s has no artifact for platform %s", plugin.Name, platform)
+}
+
+func fileChecksum(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// archiveEntries returns the names of the files in the tar.gz or zip archive.
+func archiveEntries(path string) ([]string, error) {
+	if zr, err := zip.OpenReader(path); err == nil {
+		defer zr.Close()
+		var entries []string
+		for _, f := range zr.File {
+			entries = append(entries, filepath.Clean(f.Name))
+		}
+		return entries, nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	gr, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", path, err)
+	}
+	defer gr.Close()
+	var entries []string
+	tr := tar.NewReader(gr)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return entries, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reading %s: %w", path, err)
+		}
+		entries = append(entries, filepath.Clean(header.Name))
+	}
+}
+
+// matchesAny reports whether any of the entries matches the pattern, like krew matches the from fields.
+// Entries in a directory match the directory.
+func matchesAny(entries []string, pattern string) bool {
+	pattern = filepath.Clean(strings.TrimPrefix(pattern, "/"))
+	for _, entry := range entries {
+		for ; entry != "." && entry != "/"; entry = filepath.Dir(entry) {
+			if ok, _ := filepath.Match(pattern, entry); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
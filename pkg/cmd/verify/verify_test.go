@@ -0,0 +1,101 @@
+package verify
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+
+	krew "github.com/openshift/cli-manager/pkg/krew/v1alpha2"
+)
+
+// writeArtifact writes the tar.gz artifact of the files into the directory.
+func writeArtifact(t *testing.T, dir string, files ...string) string {
+	t.Helper()
+	path := filepath.Join(dir, "tool_linux_amd64.tar.gz")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	gw := gzip.NewWriter(f)
+	tw := tar.NewWriter(gw)
+	for _, name := range files {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0755, Size: int64(len(name))}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestRun(t *testing.T) {
+	artifact := writeArtifact(t, t.TempDir(), "tool", "share/tool/README.md")
+	checksum, err := fileChecksum(artifact)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// writeManifest writes the manifest of the linux/amd64 platform installing the files
+	writeManifest := func(sha256 string, files ...string) string {
+		platform := krew.Platform{
+			Sha256:   sha256,
+			Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"os": "linux", "arch": "amd64"}},
+			Bin:      "tool",
+		}
+		for _, from := range files {
+			platform.Files = append(platform.Files, krew.FileOperation{From: from, To: "."})
+		}
+		plugin := &krew.Plugin{Spec: krew.PluginSpec{Platforms: []krew.Platform{platform}}}
+		plugin.Name = "tool"
+		raw, err := yaml.Marshal(plugin)
+		if err != nil {
+			t.Fatal(err)
+		}
+		path := filepath.Join(t.TempDir(), "tool.yaml")
+		if err := os.WriteFile(path, raw, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	for name, tc := range map[string]struct {
+		manifest string
+		platform string
+		err      string
+	}{
+		"verified":          {manifest: writeManifest(strings.ToUpper(checksum), "/tool", "share/*")},
+		"checksum mismatch": {manifest: writeManifest(strings.Repeat("0", 64), "/tool"), err: "checksum mismatch"},
+		"missing checksum":  {manifest: writeManifest("", "/tool"), err: "has no checksum"},
+		"missing file":      {manifest: writeManifest(checksum, "/tool", "/LICENSE"), err: "does not contain /LICENSE"},
+		"other platform":    {manifest: writeManifest(checksum, "/tool"), platform: "darwin/arm64", err: "has no artifact for platform darwin/arm64"},
+		"invalid platform":  {manifest: writeManifest(checksum, "/tool"), platform: "linux", err: "invalid platform"},
+	} {
+		o := &Options{ManifestPath: tc.manifest, Platform: "linux/amd64", ArtifactPath: artifact}
+		if len(tc.platform) > 0 {
+			o.Platform = tc.platform
+		}
+		err := o.Run()
+		if len(tc.err) == 0 {
+			if err != nil {
+				t.Errorf("%s: unexpected error %v", name, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("%s: expected %q error, got %v", name, tc.err, err)
+		}
+	}
+}
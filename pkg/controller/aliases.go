@@ -0,0 +1,165 @@
+package controller
+
+import (
+	"fmt"
+	"maps"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/yaml"
+
+	"github.com/openshift/cli-manager/api/v1alpha1"
+	"github.com/openshift/cli-manager/pkg/git"
+	krew "github.com/openshift/cli-manager/pkg/krew/v1alpha2"
+)
+
+// AliasAnnotation is set to the name of the plugin on the krew manifests published under its aliases,
+// so that they are told apart from the plugins named after them.
+const AliasAnnotation = "cli-manager.openshift.io/alias-of"
+
+// aliasIndex indexes the plugins by their aliases, so that they are requeued to publish them once
+// the plugins named after them or declaring them as well are deleted.
+const aliasIndex = "alias"
+
+// pluginAliases is the index function of aliasIndex.
+func pluginAliases(obj interface{}) ([]string, error) {
+	plugin := toPlugin(obj)
+	if plugin == nil {
+		return nil, nil
+	}
+	return plugin.Spec.Aliases, nil
+}
+
+// validateAliases returns why the aliases of the plugin are invalid, if they are.
+func validateAliases(plugin *v1alpha1.Plugin) error {
+	var errs []error
+	seen := map[string]bool{}
+	for _, alias := range plugin.Spec.Aliases {
+		switch {
+		case !safePluginRegexp.MatchString(alias) || strings.Contains(alias, versionSeparator):
+			// the aliases do not collide with the names of the older versions
+			errs = append(errs, fmt.Errorf("invalid alias %s, should be a plugin name like %s", alias, plugin.Name))
+		case alias == plugin.Name:
+			errs = append(errs, fmt.Errorf("alias %s is the name of the plugin", alias))
+		case seen[alias]:
+			errs = append(errs, fmt.Errorf("alias %s is set more than once", alias))
+		}
+		seen[alias] = true
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+// aliasOwner returns the name of the plugin the alias is published for, or an empty string.
+func (c *Controller) aliasOwner(alias string) (string, error) {
+	if _, err := c.getIndexedPlugin(alias); !errors.IsNotFound(err) {
+		return "", err
+	}
+	var candidates []*v1alpha1.Plugin
+	for _, indexer := range []cache.Indexer{c.indexer, c.namespacedIndexer} {
+		if indexer == nil {
+			continue
+		}
+		objs, err := indexer.ByIndex(aliasIndex, alias)
+		if err != nil {
+			return "", err
+		}
+		for _, obj := range objs {
+			if plugin := toPlugin(obj); plugin != nil {
+				candidates = append(candidates, plugin)
+			}
+		}
+	}
+	var owner *v1alpha1.Plugin
+	for _, plugin := range candidates {
+		// the NamespacedPlugins not published under their names do not publish their aliases either
+		published, err := c.getIndexedPlugin(plugin.Name)
+		if err != nil {
+			continue
+		}
+		if p := toPlugin(published); p == nil || p.Namespace != plugin.Namespace {
+			continue
+		}
+		if owner == nil || plugin.CreationTimestamp.Before(&owner.CreationTimestamp) ||
+			(plugin.CreationTimestamp.Equal(&owner.CreationTimestamp) && plugin.Name < owner.Name) {
+			owner = plugin
+		}
+	}
+	if owner == nil {
+		return "", nil
+	}
+	return owner.Name, nil
+}
+
+// publishAliases publishes the krew manifest of the plugin under the aliases it owns.
+func (c *Controller) publishAliases(plugin *v1alpha1.Plugin, k *krew.Plugin) error {
+	if k == nil {
+		return nil
+	}
+	// the invalid aliases are reported by the sync of the shard owning the plugin
+	if err := validateAliases(plugin); err != nil {
+		klog.V(2).Infof("aliases of plugin %s are not published: %v", plugin.Name, err)
+		return nil
+	}
+	for _, alias := range plugin.Spec.Aliases {
+		owner, err := c.aliasOwner(alias)
+		if err != nil {
+			return err
+		}
+		if owner != plugin.Name {
+			klog.V(2).Infof("alias %s of plugin %s is not published, it is taken by %q", alias, plugin.Name, owner)
+			continue
+		}
+		aliased := *k
+		aliased.Name = alias
+		aliased.Annotations = maps.Clone(k.Annotations)
+		if aliased.Annotations == nil {
+			aliased.Annotations = map[string]string{}
+		}
+		aliased.Annotations[AliasAnnotation] = plugin.Name
+		p := &v1alpha1.Plugin{Spec: v1alpha1.PluginSpec{Preview: plugin.Spec.Preview}}
+		p.Name = alias
+		if err := c.publishPlugin(p, &aliased); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// unpublishAliases deletes the entries published under the aliases of the plugin from the index.
+func unpublishAliases(name string, repo *git.Repo) error {
+	names, err := repo.List()
+	if err != nil {
+		return err
+	}
+	for _, n := range names {
+		if aliasOf(repo, n) == name {
+			if err := repo.Delete(n); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// aliasOf returns the plugin the entry of the index is published for as an alias, or an empty string
+// if it is not an alias.
+func aliasOf(repo *git.Repo, name string) string {
+	return entryAnnotation(repo, name, AliasAnnotation)
+}
+
+// entryAnnotation returns the annotation of the krew manifest of the index entry, or an empty string
+// if it is not set or the entry does not exist.
+func entryAnnotation(repo *git.Repo, name, key string) string {
+	data, err := repo.Read(name)
+	if err != nil || data == nil {
+		return ""
+	}
+	k := &krew.Plugin{}
+	if err := yaml.Unmarshal(data, k); err != nil {
+		return ""
+	}
+	return k.Annotations[key]
+}
@@ -0,0 +1,131 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+
+	"github.com/openshift/cli-manager/api/v1alpha1"
+	"github.com/openshift/cli-manager/pkg/image"
+	krew "github.com/openshift/cli-manager/pkg/krew/v1alpha2"
+)
+
+// syncArchivePlatform rehosts the archive of the platform once its checksum is verified.
+func (c *Controller) syncArchivePlatform(ctx context.Context, plugin *v1alpha1.Plugin, version string, p v1alpha1.PluginPlatform, header http.Header) (platformResult, error) {
+	fields := strings.SplitN(p.Platform, "/", 2)
+	if len(p.Bin) == 0 {
+		p.Bin = plugin.Name
+	}
+	artifactName, published := plugin.Name, plugin
+	if len(version) > 0 {
+		published = versionPlugin(plugin, version)
+		artifactName = published.Name
+	}
+
+	// the archive is identified by its checksum, and is not downloaded again while it is stored
+	digest := "sha256:" + strings.ToLower(p.Sha256)
+	extractionHash := image.ExtractionHash(p)
+	var previous *v1alpha1.PluginPlatformStatus
+	for _, format := range []v1alpha1.ArchiveFormat{v1alpha1.ArchiveFormatTarGz, v1alpha1.ArchiveFormatZip} {
+		if previous = unchangedPlatform(published, p.Platform, digest, extractionHash, artifactPath(artifactName, p.Platform, format)); previous != nil {
+			break
+		}
+	}
+	var artifact string
+	var extractionDuration *metav1.Duration
+	var extractionTime *metav1.Time
+	if previous != nil {
+		klog.V(2).Infof("archive %s of platform %s of plugin %s is unchanged, skipping its download", p.URL, p.Platform, plugin.Name)
+		artifact = artifactPath(artifactName, p.Platform, previous.ArchiveFormat)
+		extractionDuration, extractionTime = previous.ExtractionDuration, previous.ExtractionTime
+	} else {
+		pullOptions, err := c.downloadOptions(ctx, p)
+		if err != nil {
+			newCondition := metav1.Condition{
+				Status:  metav1.ConditionFalse,
+				Reason:  "InvalidProxySecret",
+				Message: err.Error(),
+			}
+			return platformResult{condition: &newCondition}, nil
+		}
+		pullOptions.Header = header
+		start := time.Now()
+		artifact, err = image.DownloadArtifact(ctx, p.URL, p.Sha256, artifactName, p.Platform, pullOptions)
+		if err != nil {
+			newCondition := metav1.Condition{
+				Status:  metav1.ConditionFalse,
+				Reason:  "ArchiveDownloadError",
+				Message: fmt.Sprintf("failed to download the archive of platform %s error %s", p.Platform, err),
+			}
+			return platformResult{condition: &newCondition}, nil
+		}
+		extractionDuration = &metav1.Duration{Duration: time.Since(start).Round(time.Millisecond)}
+		extractionTime = &metav1.Time{Time: start}
+	}
+	if plugin.Spec.ValidateOnly {
+		return platformResult{validated: true}, nil
+	}
+
+	artifactURI, err := c.artifactURI(ctx, artifactName, p.Platform)
+	if err != nil {
+		return platformResult{}, err
+	}
+	kp := krew.Platform{
+		URI:    artifactURI,
+		Sha256: strings.ToLower(p.Sha256),
+		Selector: &metav1.LabelSelector{
+			MatchLabels: map[string]string{
+				"os":   fields[0],
+				"arch": fields[1],
+			},
+		},
+		Files: []krew.FileOperation{},
+		Bin:   p.Bin,
+	}
+	for _, f := range p.Files {
+		kp.Files = append(kp.Files, krew.FileOperation{From: f.From, To: f.To})
+	}
+	status := v1alpha1.PluginPlatformStatus{
+		Platform:           p.Platform,
+		URI:                kp.URI,
+		Sha256:             kp.Sha256,
+		URL:                p.URL,
+		Files:              p.Files,
+		Bin:                kp.Bin,
+		Digest:             digest,
+		ExtractionHash:     extractionHash,
+		ExtractionDuration: extractionDuration,
+		ExtractionTime:     extractionTime,
+	}
+	if info, err := os.Stat(artifact); err == nil {
+		status.Size = info.Size()
+	}
+	if strings.HasSuffix(artifact, "."+string(v1alpha1.ArchiveFormatZip)) {
+		status.ArchiveFormat = v1alpha1.ArchiveFormatZip
+	}
+	return platformResult{platform: &kp, status: status}, nil
+}
+
+// downloadOptions returns the options the archives of the platform are downloaded with, through the
+// proxy of the platform or of the controller.
+func (c *Controller) downloadOptions(ctx context.Context, p v1alpha1.PluginPlatform) (image.PullOptions, error) {
+	proxy, proxyUser, err := c.proxyCredentials(ctx, p)
+	if err != nil {
+		return image.PullOptions{}, err
+	}
+	opts := image.PullOptions{
+		Platform:  p.Platform,
+		Proxy:     p.Proxy,
+		ProxyUser: proxyUser,
+	}
+	if len(proxy) > 0 {
+		opts.Proxy = proxy
+	}
+	return opts, nil
+}
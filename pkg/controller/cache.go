@@ -0,0 +1,73 @@
+package controller
+
+import (
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/openshift/cli-manager/pkg/image"
+)
+
+// imageStreamIndex indexes the plugins by the namespace/name of the image streams their
+// platforms reference, so that image stream updates do not walk all the plugins.
+const imageStreamIndex = "imageStream"
+
+// maxConditionMessageLength bounds the size of the condition messages in the plugin status,
+// which is cached for every plugin.
+const maxConditionMessageLength = 1024
+
+// lastAppliedAnnotation is the copy of the applied object kubectl keeps in the annotations,
+// which is as large as the spec of the plugin.
+const lastAppliedAnnotation = "kubectl.kubernetes.io/last-applied-configuration"
+
+// stripPlugin drops the fields of the plugins the controller never reads from the informer cache.
+func stripPlugin(obj interface{}) (interface{}, error) {
+	u, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return obj, nil
+	}
+	u.SetManagedFields(nil)
+	if annotations := u.GetAnnotations(); len(annotations[lastAppliedAnnotation]) > 0 {
+		delete(annotations, lastAppliedAnnotation)
+		u.SetAnnotations(annotations)
+	}
+	unstructured.RemoveNestedField(u.Object, "status", "progress")
+	return u, nil
+}
+
+// stripImageStream keeps the type and the metadata of the image streams, since only their
+// names are used to requeue the plugins referencing them, and their tags can be numerous.
+func stripImageStream(obj interface{}) (interface{}, error) {
+	u, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return obj, nil
+	}
+	stripped := &unstructured.Unstructured{Object: map[string]interface{}{}}
+	stripped.SetAPIVersion(u.GetAPIVersion())
+	stripped.SetKind(u.GetKind())
+	stripped.SetNamespace(u.GetNamespace())
+	stripped.SetName(u.GetName())
+	stripped.SetUID(u.GetUID())
+	stripped.SetResourceVersion(u.GetResourceVersion())
+	stripped.SetGeneration(u.GetGeneration())
+	return stripped, nil
+}
+
+// pluginImageStreams is the index function of imageStreamIndex.
+func pluginImageStreams(obj interface{}) ([]string, error) {
+	plugin := toPlugin(obj)
+	if plugin == nil {
+		return nil, nil
+	}
+	inheritImages(plugin)
+	var keys []string
+	for _, p := range plugin.Spec.Platforms {
+		if !image.IsImageStreamTag(p.Image) {
+			continue
+		}
+		namespace, name, _, err := image.ParseImageStreamTag(p.Image)
+		if err != nil {
+			continue
+		}
+		keys = append(keys, namespace+"/"+name)
+	}
+	return keys, nil
+}
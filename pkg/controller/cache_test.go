@@ -0,0 +1,164 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/openshift/cli-manager/api/v1alpha1"
+)
+
+// scalePlugins is the number of plugins the controller is expected to cache.
+const scalePlugins = 5000
+
+func newScalePlugin(t *testing.T, i int) *unstructured.Unstructured {
+	t.Helper()
+	plugin := &v1alpha1.Plugin{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: v1alpha1.GroupVersion.String(),
+			Kind:       "Plugin",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            fmt.Sprintf("plugin-%d", i),
+			ResourceVersion: "1",
+		},
+		Spec: v1alpha1.PluginSpec{
+			ShortDescription: "scale test",
+			Description:      strings.Repeat("description ", 50),
+			Version:          "v1.0.0",
+			Platforms: []v1alpha1.PluginPlatform{{
+				Platform: "linux/amd64",
+				Image:    fmt.Sprintf("imagestreamtag://tools/stream-%d:latest", i%10),
+				Files:    []v1alpha1.FileLocation{{From: "/usr/bin/tool", To: "."}},
+				Bin:      "tool",
+			}},
+		},
+		Status: v1alpha1.PluginStatus{
+			Progress: &v1alpha1.PluginProgress{Phase: progressPhaseExtracting, Platform: "linux/amd64"},
+		},
+	}
+	spec, err := json.Marshal(plugin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plugin.Annotations = map[string]string{lastAppliedAnnotation: string(spec), "keep": "me"}
+	fields := metav1.FieldsV1{Raw: spec}
+	plugin.ManagedFields = []metav1.ManagedFieldsEntry{
+		{Manager: "kubectl", Operation: metav1.ManagedFieldsOperationApply, FieldsType: "FieldsV1", FieldsV1: &fields},
+		{Manager: "cli-manager", Operation: metav1.ManagedFieldsOperationUpdate, FieldsType: "FieldsV1", FieldsV1: &fields, Subresource: "status"},
+	}
+	u, err := runtime.DefaultUnstructuredConverter.ToUnstructured(plugin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &unstructured.Unstructured{Object: u}
+}
+
+func TestPluginCacheScale(t *testing.T) {
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{imageStreamIndex: pluginImageStreams})
+	var originalSize, cachedSize int
+	for i := 0; i < scalePlugins; i++ {
+		u := newScalePlugin(t, i)
+		data, err := json.Marshal(u)
+		if err != nil {
+			t.Fatal(err)
+		}
+		originalSize += len(data)
+
+		obj, err := stripPlugin(u)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err = json.Marshal(obj)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cachedSize += len(data)
+		if err := indexer.Add(obj); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	obj, ok, err := indexer.GetByKey("plugin-42")
+	if err != nil || !ok {
+		t.Fatalf("plugin-42 is not cached: %v", err)
+	}
+	plugin := obj.(*unstructured.Unstructured)
+	if len(plugin.GetManagedFields()) > 0 {
+		t.Fatalf("managed fields are cached")
+	}
+	if _, ok := plugin.GetAnnotations()[lastAppliedAnnotation]; ok {
+		t.Fatalf("last applied configuration is cached")
+	}
+	if plugin.GetAnnotations()["keep"] != "me" {
+		t.Fatalf("annotations are not kept: %v", plugin.GetAnnotations())
+	}
+	if _, found, _ := unstructured.NestedMap(plugin.Object, "status", "progress"); found {
+		t.Fatalf("progress is cached")
+	}
+	if cachedSize*2 > originalSize {
+		t.Fatalf("cache of %d plugins is %d bytes, more than half of the %d bytes of the plugins", scalePlugins, cachedSize, originalSize)
+	}
+	t.Logf("cache of %d plugins is %d bytes instead of %d bytes", scalePlugins, cachedSize, originalSize)
+
+	c := &Controller{indexer: indexer}
+	imageStream := &unstructured.Unstructured{}
+	imageStream.SetNamespace("tools")
+	imageStream.SetName("stream-3")
+	keys := c.imageStreamQueueKeys(imageStream)
+	if len(keys) != scalePlugins/10 {
+		t.Fatalf("%d plugins are requeued for the image stream instead of %d", len(keys), scalePlugins/10)
+	}
+	for _, key := range keys {
+		var i int
+		if _, err := fmt.Sscanf(key, "plugin-%d", &i); err != nil || i%10 != 3 {
+			t.Fatalf("plugin %s does not reference the image stream", key)
+		}
+	}
+}
+
+func TestStripImageStream(t *testing.T) {
+	u := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "image.openshift.io/v1",
+		"kind":       "ImageStream",
+		"metadata": map[string]interface{}{
+			"namespace":       "tools",
+			"name":            "stream",
+			"resourceVersion": "7",
+			"managedFields":   []interface{}{map[string]interface{}{"manager": "oc"}},
+		},
+		"status": map[string]interface{}{
+			"tags": []interface{}{map[string]interface{}{"tag": "latest"}},
+		},
+	}}
+	obj, err := stripImageStream(u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stripped := obj.(*unstructured.Unstructured)
+	if stripped.GetNamespace() != "tools" || stripped.GetName() != "stream" || stripped.GetResourceVersion() != "7" || stripped.GetKind() != "ImageStream" {
+		t.Fatalf("unexpected stripped image stream %v", stripped.Object)
+	}
+	if _, ok := stripped.Object["status"]; ok || len(stripped.GetManagedFields()) > 0 {
+		t.Fatalf("image stream is not stripped: %v", stripped.Object)
+	}
+}
+
+func TestConditionMessageIsTruncated(t *testing.T) {
+	plugin := &v1alpha1.Plugin{}
+	setStatusCondition(plugin, metav1.Condition{
+		Status:  metav1.ConditionFalse,
+		Reason:  "PullError",
+		Message: strings.Repeat("x", 10*maxConditionMessageLength),
+	})
+	message := plugin.Status.Conditions[0].Message
+	if len(message) != maxConditionMessageLength || !strings.HasSuffix(message, "...") {
+		t.Fatalf("condition message of %d bytes is not truncated", len(message))
+	}
+}
@@ -0,0 +1,69 @@
+package controller
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/openshift/cli-manager/api/v1alpha1"
+)
+
+// validateChannels returns why the release channels of the plugin can not be published, if they can not.
+func validateChannels(plugin *v1alpha1.Plugin) error {
+	seen := map[v1alpha1.ChannelName]bool{}
+	for _, ch := range plugin.Spec.Channels {
+		if !slices.Contains(v1alpha1.Channels, ch.Name) {
+			return fmt.Errorf("unknown channel %s, should be one of %v", ch.Name, v1alpha1.Channels)
+		}
+		if seen[ch.Name] {
+			return fmt.Errorf("channel %s is set more than once", ch.Name)
+		}
+		seen[ch.Name] = true
+		if ch.Version != plugin.Spec.Version && !isOlderVersion(plugin, ch.Version) {
+			return fmt.Errorf("version %s of channel %s is neither the version of the plugin nor one of its versions", ch.Version, ch.Name)
+		}
+	}
+	return nil
+}
+
+// isOlderVersion reports whether the version is one of the older versions of the plugin.
+func isOlderVersion(plugin *v1alpha1.Plugin, version string) bool {
+	return slices.ContainsFunc(plugin.Spec.Versions, func(v v1alpha1.PluginVersion) bool {
+		return v.Version == version
+	})
+}
+
+// publishChannels publishes the plugin to the indexes of its release channels.
+func (c *Controller) publishChannels(plugin *v1alpha1.Plugin) error {
+	if plugin.Spec.Preview {
+		return nil
+	}
+	for _, ch := range plugin.Spec.Channels {
+		repo, ok := c.channelRepos[string(ch.Name)]
+		if !ok {
+			continue
+		}
+		// the channels pointing at the version of the spec publish the resolved version, if any
+		k := newKrewPluginFromStatus(plugin)
+		if isOlderVersion(plugin, ch.Version) {
+			k = newKrewPluginFromStatus(versionPlugin(plugin, ch.Version))
+		}
+		if k == nil {
+			continue
+		}
+		k.Name = plugin.Name
+		if err := repo.Upsert(plugin.Name, k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// unpublishChannels deletes the plugin from the indexes of the release channels.
+func (c *Controller) unpublishChannels(name string) error {
+	for _, repo := range c.channelRepos {
+		if err := repo.Delete(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
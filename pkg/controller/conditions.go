@@ -0,0 +1,97 @@
+package controller
+
+import (
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/openshift/cli-manager/api/v1alpha1"
+)
+
+// setStandardConditions derives the standard conditions of the plugin and reports whether they are changed.
+func setStandardConditions(plugin *v1alpha1.Plugin) bool {
+	installed := meta.FindStatusCondition(plugin.Status.Conditions, v1alpha1.PluginInstalledCondition)
+	if installed == nil {
+		return false
+	}
+	changed := setCondition(plugin, metav1.Condition{
+		Type:    v1alpha1.ReadyCondition,
+		Status:  installed.Status,
+		Reason:  installed.Reason,
+		Message: installed.Message,
+	})
+	changed = setCondition(plugin, metav1.Condition{
+		Type:    v1alpha1.ProgressingCondition,
+		Status:  metav1.ConditionFalse,
+		Reason:  "SyncCompleted",
+		Message: fmt.Sprintf("sync of plugin %s is completed", plugin.Name),
+	}) || changed
+	if meta.FindStatusCondition(plugin.Status.Conditions, v1alpha1.DegradedCondition) == nil {
+		changed = setCondition(plugin, notDegradedCondition()) || changed
+	}
+	// the controller does not verify the signatures of the images yet
+	changed = setCondition(plugin, metav1.Condition{
+		Type:    v1alpha1.SignatureVerifiedCondition,
+		Status:  metav1.ConditionUnknown,
+		Reason:  "VerificationNotConfigured",
+		Message: "signatures of the images are not verified",
+	}) || changed
+	artifactAvailable := metav1.Condition{
+		Type:    v1alpha1.ArtifactAvailableCondition,
+		Status:  metav1.ConditionFalse,
+		Reason:  "NoArtifacts",
+		Message: fmt.Sprintf("no artifact of plugin %s is served", plugin.Name),
+	}
+	if installed.Status == metav1.ConditionTrue && len(plugin.Status.Platforms) > 0 {
+		platforms := make([]string, 0, len(plugin.Status.Platforms))
+		for _, p := range plugin.Status.Platforms {
+			platforms = append(platforms, p.Platform)
+		}
+		artifactAvailable.Status = metav1.ConditionTrue
+		artifactAvailable.Reason = "ArtifactsServed"
+		artifactAvailable.Message = fmt.Sprintf("artifacts of platforms %s are served", strings.Join(platforms, ", "))
+	}
+	changed = setCondition(plugin, artifactAvailable) || changed
+	return setPausedCondition(plugin) || changed
+}
+
+// setPausedCondition sets the Paused condition from the Paused field of the plugin, and reports
+// whether it is changed.
+func setPausedCondition(plugin *v1alpha1.Plugin) bool {
+	if plugin.Spec.Paused {
+		return setCondition(plugin, metav1.Condition{
+			Type:    v1alpha1.PausedCondition,
+			Status:  metav1.ConditionTrue,
+			Reason:  "Paused",
+			Message: fmt.Sprintf("sync of plugin %s is paused, the artifacts published last are served", plugin.Name),
+		})
+	}
+	return setCondition(plugin, metav1.Condition{
+		Type:    v1alpha1.PausedCondition,
+		Status:  metav1.ConditionFalse,
+		Reason:  "Syncing",
+		Message: fmt.Sprintf("plugin %s is synced", plugin.Name),
+	})
+}
+
+// notDegradedCondition is the Degraded condition of the plugins published as declared.
+func notDegradedCondition() metav1.Condition {
+	return metav1.Condition{
+		Type:    v1alpha1.DegradedCondition,
+		Status:  metav1.ConditionFalse,
+		Reason:  "AsExpected",
+		Message: "files of the spec are found in the images",
+	}
+}
+
+// setProgressingCondition marks the plugin progressing while the platform is synced.
+func setProgressingCondition(plugin *v1alpha1.Plugin, platform, phase string) bool {
+	return setCondition(plugin, metav1.Condition{
+		Type:    v1alpha1.ProgressingCondition,
+		Status:  metav1.ConditionTrue,
+		Reason:  phase,
+		Message: fmt.Sprintf("platform %s of plugin %s is being synced", platform, plugin.Name),
+	})
+}
@@ -2,32 +2,38 @@ package controller
 
 import (
 	"context"
-	"crypto/sha256"
-	"encoding/hex"
-	"encoding/json"
+	"encoding/base64"
+	goerrors "errors"
 	"fmt"
-	"io"
+	"hash/fnv"
+	"net/url"
 	"os"
 	"path/filepath"
 	"reflect"
-	"regexp"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
+	"unicode/utf8"
 
+	v1 "github.com/google/go-containerregistry/pkg/v1"
 	routeclient "github.com/openshift/client-go/route/clientset/versioned/typed/route/v1"
 	"github.com/openshift/library-go/pkg/controller/factory"
 	"github.com/openshift/library-go/pkg/operator/events"
-	corev1 "k8s.io/api/core/v1"
+	"golang.org/x/sync/errgroup"
+	"k8s.io/apimachinery/pkg/api/equality"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
-	k8sver "k8s.io/apimachinery/pkg/util/version"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
 	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/dynamic/dynamicinformer"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
 	"k8s.io/klog/v2"
 
 	"github.com/openshift/cli-manager/api/v1alpha1"
@@ -46,71 +52,313 @@ type DockerConfigEntry struct {
 	Auth string `json:"auth"`
 }
 
+var (
+	imageStreamsGVR = schema.GroupVersionResource{
+		Group:    "image.openshift.io",
+		Version:  "v1",
+		Resource: "imagestreams",
+	}
+	imageStreamTagsGVR = schema.GroupVersionResource{
+		Group:    "image.openshift.io",
+		Version:  "v1",
+		Resource: "imagestreamtags",
+	}
+)
+
+const (
+	// ShardLabel pins a plugin to the given shard instead of the one computed from its name hash.
+	ShardLabel = "cli-manager.openshift.io/shard"
+	// DemandedPlatformsAnnotation lists the on-demand platforms of the plugin that are requested
+	// by users and thus extracted and published, separated by commas.
+	DemandedPlatformsAnnotation = "cli-manager.openshift.io/demanded-platforms"
+	// CategoriesAnnotation lists the categories of the plugin on its krew manifests, separated by commas.
+	CategoriesAnnotation = "cli-manager.openshift.io/categories"
+	// TagsAnnotation lists the tags of the plugin on its krew manifests, separated by commas.
+	TagsAnnotation = "cli-manager.openshift.io/tags"
+
+	// maxShortDescriptionLength keeps the plugins listed by krew search on one line.
+	maxShortDescriptionLength = 50
+	// maxDescriptionLength bounds the description and the caveats shown by krew.
+	maxDescriptionLength = 4096
+	// maxHomepageLength bounds the homepage of the plugins.
+	maxHomepageLength = 2048
+)
+
+// Options holds the controller configuration set by command line flags.
+type Options struct {
+	// InsecureHTTP serves artifacts in HTTP instead of HTTPS.
+	InsecureHTTP bool
+	// RouteName is the route in the operator namespace the artifacts are served from.
+	RouteName string
+	// Shards is the total number of controller shards plugins are partitioned into.
+	Shards int
+	// ShardID is the shard this controller is responsible for, in [0, Shards).
+	ShardID int
+	// RegistryClientCertificateSecrets maps registry hosts to the kubernetes.io/tls Secrets
+	// presented to the registries requiring client certificate authentication.
+	RegistryClientCertificateSecrets map[string]string
+	// OnDemandPlatforms are the platforms (os/arch, or arch for any os) that are only
+	// extracted and published once they are demanded, see DemandedPlatformsAnnotation.
+	OnDemandPlatforms []string
+	// RegistryProxySecret is the Secret holding the credentials of the proxy registries are
+	// accessed through, see PluginPlatform.ProxySecret.
+	RegistryProxySecret string
+	// CredentialsExpiryWarning is how long before the expiry of the image pull
+	// credentials the CredentialsExpiring condition is raised.
+	CredentialsExpiryWarning time.Duration
+	// PlatformWorkers is the number of platforms of a plugin pulled and extracted concurrently.
+	PlatformWorkers int
+	// ResyncInterval is how often the plugins are synced again unless they set their own
+	// ResyncInterval, they are only synced once changed if 0.
+	ResyncInterval time.Duration
+	// MaxVersions is the number of older versions of the plugins published unless they set their
+	// own Retention, all of them if 0.
+	MaxVersions int
+	// MaxVersionAge is how long the older versions of the plugins are published unless they set
+	// their own Retention, without limit if 0.
+	MaxVersionAge time.Duration
+}
+
 type Controller struct {
 	factory.Controller
-	lister        cache.GenericLister
-	repo          *git.Repo
+	lister  cache.GenericLister
+	indexer cache.Indexer
+	// namespacedIndexer is the cache of the NamespacedPlugins, which are indexed by name
+	namespacedIndexer cache.Indexer
+	repo              *git.Repo
+	previewRepo       *git.Repo
+	// channelRepos are the indexes of the release channels by channel
+	channelRepos  map[string]*git.Repo
 	client        *kubernetes.Clientset
 	dynamicClient *dynamic.DynamicClient
 	route         routeclient.RouteV1Interface
+	queue         workqueue.RateLimitingInterface
+	// priorities are the priorities of the plugins queued by their events
+	priorities *syncPriorities
 
-	insecureHTTP bool
+	options Options
 }
 
 // NewCLISyncController creates CLI Sync Controller to react changes in Plugin resource
-func NewCLISyncController(repo *git.Repo, informers dynamicinformer.DynamicSharedInformerFactory, client *kubernetes.Clientset, dynamicClient *dynamic.DynamicClient, route routeclient.RouteV1Interface, insecureHTTP bool, eventRecorder events.Recorder) (*Controller, error) {
+func NewCLISyncController(repo, previewRepo *git.Repo, channelRepos map[string]*git.Repo, informers dynamicinformer.DynamicSharedInformerFactory, client *kubernetes.Clientset, dynamicClient *dynamic.DynamicClient, route routeclient.RouteV1Interface, options Options, eventRecorder events.Recorder) (*Controller, error) {
+	if options.Shards < 1 || options.ShardID < 0 || options.ShardID >= options.Shards {
+		return nil, fmt.Errorf("invalid shard %d of %d shards", options.ShardID, options.Shards)
+	}
+
 	informer := informers.ForResource(schema.GroupVersionResource{
 		Group:    v1alpha1.GroupVersion.Group,
 		Version:  v1alpha1.GroupVersion.Version,
 		Resource: "plugins",
 	})
 
+	// the transforms and the indexers are only accepted before the informers are started
+	if err := informer.Informer().SetTransform(stripPlugin); err != nil {
+		return nil, err
+	}
+	if err := informer.Informer().AddIndexers(cache.Indexers{imageStreamIndex: pluginImageStreams, dependencyIndex: pluginDependencies, aliasIndex: pluginAliases}); err != nil {
+		return nil, err
+	}
+
+	namespacedInformer := informers.ForResource(namespacedPluginsGVR)
+	if err := namespacedInformer.Informer().SetTransform(stripPlugin); err != nil {
+		return nil, err
+	}
+	if err := namespacedInformer.Informer().AddIndexers(cache.Indexers{imageStreamIndex: pluginImageStreams, dependencyIndex: pluginDependencies, aliasIndex: pluginAliases, nameIndex: pluginName}); err != nil {
+		return nil, err
+	}
+
 	c := &Controller{
-		lister:        informer.Lister(),
-		repo:          repo,
-		client:        client,
-		dynamicClient: dynamicClient,
-		route:         route,
-		insecureHTTP:  insecureHTTP,
+		lister:            informer.Lister(),
+		indexer:           informer.Informer().GetIndexer(),
+		namespacedIndexer: namespacedInformer.Informer().GetIndexer(),
+		repo:              repo,
+		previewRepo:       previewRepo,
+		channelRepos:      channelRepos,
+		client:            client,
+		dynamicClient:     dynamicClient,
+		route:             route,
+		options:           options,
+	}
+	c.priorities = newSyncPriorities(c.ownsPlugin)
+
+	imageStreamInformer := informers.ForResource(imageStreamsGVR)
+	if err := imageStreamInformer.Informer().SetTransform(stripImageStream); err != nil {
+		return nil, err
+	}
+
+	// plugin events are handled directly to ignore the status updates of the controller itself
+	syncCtx := factory.NewSyncContext("CLIManager", eventRecorder)
+	c.queue = syncCtx.Queue()
+	// the plugins are queued by the name they are published under, whether they are cluster Plugins
+	// or NamespacedPlugins, see reportNameConflicts
+	for _, i := range []cache.SharedIndexInformer{informer.Informer(), namespacedInformer.Informer()} {
+		if _, err := i.AddEventHandler(pluginEventHandler(syncCtx.Queue(), c.priorities, c.indexer, c.namespacedIndexer)); err != nil {
+			return nil, err
+		}
 	}
 
 	c.Controller = factory.New().
-		WithInformersQueueKeyFunc(func(obj runtime.Object) string {
-			klog.V(4).Infof("Plugin object cought by event %v", obj)
-			if obj == nil || reflect.ValueOf(obj).IsNil() {
-				return ""
-			}
+		WithSyncContext(syncCtx).
+		WithBareInformers(informer.Informer(), namespacedInformer.Informer()).
+		WithInformersQueueKeysFunc(c.imageStreamQueueKeys, imageStreamInformer.Informer()).
+		WithSync(c.sync).
+		ToController("CLIManager", eventRecorder)
+	return c, nil
+}
 
-			u, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+// pluginEventHandler enqueues the plugins on their events, along with the plugins depending on them.
+func pluginEventHandler(queue workqueue.RateLimitingInterface, priorities *syncPriorities, indexers ...cache.Indexer) cache.ResourceEventHandler {
+	enqueue := func(obj interface{}) {
+		if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+			obj = tombstone.Obj
+		}
+		plugin := toPlugin(obj)
+		if plugin == nil {
+			return
+		}
+		priorities.queued(plugin)
+		queue.Add(plugin.Name)
+		for _, indexer := range indexers {
+			dependents, err := indexer.ByIndex(dependencyIndex, plugin.Name)
 			if err != nil {
-				return ""
+				klog.Warningf("plugins depending on plugin %s can not be listed: %v", plugin.Name, err)
+				return
 			}
-			plugin := &v1alpha1.Plugin{}
-			err = runtime.DefaultUnstructuredConverter.FromUnstructured(u, plugin)
-			if err != nil {
-				klog.V(2).Infof("invalid object's %v key extraction is ignored", obj)
-				return ""
+			for _, o := range dependents {
+				if dependent, err := meta.Accessor(o); err == nil {
+					queue.Add(dependent.GetName())
+				}
 			}
-			return plugin.Name
-		}, informer.Informer()).
-		WithSync(c.sync).
-		ToController("CLIManager", eventRecorder)
-	return c, nil
+			for _, alias := range append([]string{plugin.Name}, plugin.Spec.Aliases...) {
+				aliased, err := indexer.ByIndex(aliasIndex, alias)
+				if err != nil {
+					klog.Warningf("plugins aliased as %s can not be listed: %v", alias, err)
+					return
+				}
+				for _, o := range aliased {
+					if a, err := meta.Accessor(o); err == nil && a.GetName() != plugin.Name {
+						queue.Add(a.GetName())
+					}
+				}
+			}
+		}
+	}
+	return cache.ResourceEventHandlerFuncs{
+		AddFunc: enqueue,
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			oldPlugin, newPlugin := toPlugin(oldObj), toPlugin(newObj)
+			if oldPlugin != nil && newPlugin != nil &&
+				equality.Semantic.DeepEqual(oldPlugin.Spec, newPlugin.Spec) &&
+				equality.Semantic.DeepEqual(oldPlugin.Labels, newPlugin.Labels) &&
+				equality.Semantic.DeepEqual(oldPlugin.Annotations, newPlugin.Annotations) &&
+				equality.Semantic.DeepEqual(oldPlugin.Status.Platforms, newPlugin.Status.Platforms) {
+				klog.V(4).Infof("Plugin %s status update is ignored", newPlugin.Name)
+				return
+			}
+			enqueue(newObj)
+		},
+		DeleteFunc: enqueue,
+	}
 }
 
-func (c *Controller) sync(ctx context.Context, syncCtx factory.SyncContext) error {
+// toPlugin converts the informer object to Plugin, or returns nil if it is invalid.
+func toPlugin(obj interface{}) *v1alpha1.Plugin {
+	klog.V(4).Infof("Plugin object cought by event %v", obj)
+	runtimeObj, ok := obj.(runtime.Object)
+	if !ok || runtimeObj == nil || reflect.ValueOf(runtimeObj).IsNil() {
+		return nil
+	}
+
+	u, err := runtime.DefaultUnstructuredConverter.ToUnstructured(runtimeObj)
+	if err != nil {
+		return nil
+	}
+	plugin := &v1alpha1.Plugin{}
+	err = runtime.DefaultUnstructuredConverter.FromUnstructured(u, plugin)
+	if err != nil {
+		klog.V(2).Infof("invalid object's %v key extraction is ignored", obj)
+		return nil
+	}
+	return plugin
+}
+
+// Lister returns the lister of the Plugins cache.
+func (c *Controller) Lister() cache.GenericLister {
+	return c.lister
+}
+
+// HoldIndex defers the index commits until the returned function is called, so that
+// a batch of plugin changes is published to the indexes, including the ones of the
+// release channels, with a single commit.
+func (c *Controller) HoldIndex() func() {
+	c.repo.Hold()
+	c.previewRepo.Hold()
+	for _, repo := range c.channelRepos {
+		repo.Hold()
+	}
+	return func() {
+		if err := c.repo.Release(); err != nil {
+			klog.Errorf("held index changes can not be committed: %v", err)
+		}
+		if err := c.previewRepo.Release(); err != nil {
+			klog.Errorf("held preview index changes can not be committed: %v", err)
+		}
+		for channel, repo := range c.channelRepos {
+			if err := repo.Release(); err != nil {
+				klog.Errorf("held %s channel index changes can not be committed: %v", channel, err)
+			}
+		}
+	}
+}
+
+func (c *Controller) sync(ctx context.Context, syncCtx factory.SyncContext) (err error) {
 	pluginName := syncCtx.QueueKey()
 	klog.V(4).Infof("CLI Manager sync is triggered for the key %s", pluginName)
+	if c.deferSync(pluginName) {
+		klog.V(4).Infof("sync of plugin %s is deferred for the plugins of a higher priority", pluginName)
+		syncCtx.Queue().AddAfter(pluginName, priorityDeferral)
+		return nil
+	}
+	defer c.priorities.synced(pluginName)
+	start := time.Now()
+	defer func() {
+		observePluginSync(pluginName, start, err)
+	}()
 	obj, err := c.dynamicClient.Resource(schema.GroupVersionResource{
 		Group:    "config.openshift.io",
 		Version:  "v1alpha1",
 		Resource: "plugins"}).Get(ctx, pluginName, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		// the NamespacedPlugins of the name are only published without cluster Plugin of the name
+		obj, err = c.getNamespacedPlugin(ctx, pluginName)
+	}
 	if err != nil {
 		if errors.IsNotFound(err) {
+			if repository := mirroredBy(c.repo, pluginName); len(repository) > 0 {
+				klog.V(4).Infof("plugin %s is mirrored from repository %s", pluginName, repository)
+				return nil
+			}
 			err = DeletePlugin(pluginName, c.repo)
 			if err != nil {
 				return err
 			}
+			err = deleteEntry(pluginName, c.previewRepo)
+			if err != nil {
+				return err
+			}
+			err = unpublishVersions(pluginName, c.previewRepo)
+			if err != nil {
+				return err
+			}
+			err = unpublishAliases(pluginName, c.previewRepo)
+			if err != nil {
+				return err
+			}
+			err = c.unpublishChannels(pluginName)
+			if err != nil {
+				return err
+			}
+			git.SetDeprecations(pluginName, nil)
 			klog.Infof("plugin %s is successfully deleted", pluginName)
 			return nil
 		} else {
@@ -136,13 +384,120 @@ func (c *Controller) sync(ctx context.Context, syncCtx factory.SyncContext) erro
 		klog.V(2).Infof("ignore unexpected types %+v for key %s", obj, pluginName)
 		return nil
 	}
+	if c.ownsPlugin(plugin) {
+		if err := c.reportNameConflicts(ctx, plugin); err != nil {
+			return err
+		}
+	}
+	qualifyReferences(plugin)
+	inheritImages(plugin)
 
-	err = DeletePlugin(pluginName, c.repo)
+	err = c.repo.Delete(pluginName)
 	if err != nil {
 		klog.V(2).Infof("plugin %s can not be deleted", pluginName)
 	}
+	err = c.previewRepo.Delete(pluginName)
+	if err != nil {
+		klog.V(2).Infof("plugin %s can not be deleted from preview index", pluginName)
+	}
+	for _, repo := range []*git.Repo{c.repo, c.previewRepo} {
+		if err := unpublishVersions(pluginName, repo); err != nil {
+			klog.V(2).Infof("versions of plugin %s can not be deleted error %v", pluginName, err)
+		}
+		if err := unpublishAliases(pluginName, repo); err != nil {
+			klog.V(2).Infof("aliases of plugin %s can not be deleted error %v", pluginName, err)
+		}
+	}
+	if err := c.unpublishChannels(pluginName); err != nil {
+		klog.V(2).Infof("plugin %s can not be deleted from channel indexes error %v", pluginName, err)
+	}
+	// the artifacts are kept across the syncs, so that the platforms whose image and files are
+	// unchanged are not extracted again, and the ones not published once synced are removed
+	defer func() {
+		if err := c.removeStaleArtifacts(plugin); err != nil {
+			klog.Errorf("removing the stale artifacts of plugin %s error %v", pluginName, err)
+		}
+	}()
+
+	setDeprecations(plugin)
+	owned := c.ownsPlugin(plugin)
+	if plugin.Spec.ExpiresAt != nil {
+		remaining := time.Until(plugin.Spec.ExpiresAt.Time)
+		if remaining <= 0 {
+			klog.Infof("plugin %s is expired at %s and unpublished", pluginName, plugin.Spec.ExpiresAt.Time)
+			if !owned {
+				return nil
+			}
+			newCondition := metav1.Condition{
+				Status:  metav1.ConditionFalse,
+				Reason:  "Expired",
+				Message: fmt.Sprintf("plugin %s is expired at %s", pluginName, plugin.Spec.ExpiresAt.Format(time.RFC3339)),
+			}
+			return updateStatusCondition(ctx, plugin, c.dynamicClient, newCondition)
+		}
+		// revisit the plugin once it expires to unpublish it
+		syncCtx.Queue().AddAfter(pluginName, remaining)
+	}
+
+	if !owned {
+		// the plugin is extracted by another shard, only the index entries
+		// published by that shard are merged into this shard's index.
+		k := newKrewPluginFromStatus(plugin)
+		if err := c.publishPlugin(plugin, k); err != nil {
+			return err
+		}
+		if err := c.publishAliases(plugin, k); err != nil {
+			return err
+		}
+		if err := c.publishVersions(plugin); err != nil {
+			return err
+		}
+		return c.publishChannels(plugin)
+	}
+
+	if plugin.Spec.Paused {
+		// the platforms published last are published again as is, without pulling their images
+		klog.Infof("sync of plugin %s is paused", pluginName)
+		if setPausedCondition(plugin) {
+			if err := updateStatus(ctx, plugin, c.dynamicClient); err != nil {
+				return err
+			}
+		}
+		if !isPublished(plugin) {
+			return nil
+		}
+		k := newKrewPluginFromStatus(plugin)
+		if err := c.publishPlugin(plugin, k); err != nil {
+			return err
+		}
+		if err := c.publishAliases(plugin, k); err != nil {
+			return err
+		}
+		if err := c.publishVersions(plugin); err != nil {
+			return err
+		}
+		return c.publishChannels(plugin)
+	}
+
+	if interval := resyncInterval(plugin, c.options.ResyncInterval); interval > 0 {
+		// revisit the plugin to track the tags of its images
+		syncCtx.Queue().AddAfter(pluginName, interval)
+	}
+	if plugin.Spec.Resolver != nil {
+		// revisit the plugin to publish the version the resolver returns next
+		syncCtx.Queue().AddAfter(pluginName, resolveInterval(plugin.Spec.Resolver))
+	}
+	if usesLatestRelease(plugin) {
+		// revisit the plugin to publish the next GitHub releases
+		syncCtx.Queue().AddAfter(pluginName, latestReleaseInterval)
+	}
+
+	err = c.checkCredentialsExpiry(ctx, plugin)
+	if err != nil {
+		return err
+	}
 
-	err = UpsertPlugin(plugin, c.repo, c.client, c.dynamicClient, c.route, c.insecureHTTP)
+	err = c.upsertPlugin(ctx, plugin)
 	if err != nil {
 		return err
 	}
@@ -150,107 +505,747 @@ func (c *Controller) sync(ctx context.Context, syncCtx factory.SyncContext) erro
 	return nil
 }
 
-// DeletePlugin deletes the plugin from git repository and removes
-// the actuall plugin tarball from local.
+// imageStreamQueueKeys returns the plugins referencing the image stream,
+// so that they are re-synced when one of its tags is updated.
+func (c *Controller) imageStreamQueueKeys(obj runtime.Object) []string {
+	imageStream, err := meta.Accessor(obj)
+	if err != nil {
+		return nil
+	}
+	var keys []string
+	for _, indexer := range []cache.Indexer{c.indexer, c.namespacedIndexer} {
+		if indexer == nil {
+			continue
+		}
+		objs, err := indexer.ByIndex(imageStreamIndex, imageStream.GetNamespace()+"/"+imageStream.GetName())
+		if err != nil {
+			klog.Warningf("plugins can not be listed for image stream %s/%s: %v", imageStream.GetNamespace(), imageStream.GetName(), err)
+			return nil
+		}
+		for _, o := range objs {
+			if plugin, err := meta.Accessor(o); err == nil {
+				keys = append(keys, plugin.GetName())
+			}
+		}
+	}
+	return keys
+}
+
+// resolveImageStreamTag returns the pull spec of the image the ImageStreamTag points to.
+func (c *Controller) resolveImageStreamTag(ctx context.Context, src string) (string, error) {
+	namespace, name, tag, err := image.ParseImageStreamTag(src)
+	if err != nil {
+		return "", err
+	}
+	istag, err := c.dynamicClient.Resource(imageStreamTagsGVR).Namespace(namespace).Get(ctx, name+":"+tag, metav1.GetOptions{})
+	if err != nil {
+		return "", err
+	}
+	ref, found, err := unstructured.NestedString(istag.Object, "image", "dockerImageReference")
+	if err != nil {
+		return "", err
+	}
+	if !found || len(ref) == 0 {
+		return "", fmt.Errorf("image stream tag %s/%s:%s has no image", namespace, name, tag)
+	}
+	return ref, nil
+}
+
+// fallbackCaveats appends a note to the caveats of the plugin for every platform the binaries
+// of another architecture are published for by the FallbackToAMD64 architecture fallback.
+func fallbackCaveats(caveats string, platforms []v1alpha1.PluginPlatformStatus) string {
+	for _, p := range platforms {
+		if len(p.Architecture) == 0 {
+			continue
+		}
+		note := fmt.Sprintf("The %s binaries are installed on %s, they run only if %s binaries can be run, i.e. with emulation.", p.Architecture, p.Platform, p.Architecture)
+		if len(caveats) > 0 {
+			caveats += "\n"
+		}
+		caveats += note
+	}
+	return caveats
+}
+
+// configMapImage returns an image of the files of the ConfigMap, which are the data and the
+// binary data keys of the ConfigMap.
+func (c *Controller) configMapImage(ctx context.Context, src string) (v1.Image, error) {
+	namespace, name, err := image.ParseConfigMap(src)
+	if err != nil {
+		return nil, err
+	}
+	configMap, err := c.client.CoreV1().ConfigMaps(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	files := map[string][]byte{}
+	for key, value := range configMap.Data {
+		files[key] = []byte(value)
+	}
+	for key, value := range configMap.BinaryData {
+		files[key] = value
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("config map %s/%s has no files", namespace, name)
+	}
+	return image.ImageFromFiles(files)
+}
+
+// resyncInterval returns how often the plugin is synced again, its own ResyncInterval or the
+// default one of the controller, 0 if it is only synced once changed.
+func resyncInterval(plugin *v1alpha1.Plugin, defaultInterval time.Duration) time.Duration {
+	if plugin.Spec.ResyncInterval != nil {
+		return plugin.Spec.ResyncInterval.Duration
+	}
+	return defaultInterval
+}
+
+// ownsPlugin reports whether the plugin belongs to the shard of this controller.
+func (c *Controller) ownsPlugin(plugin *v1alpha1.Plugin) bool {
+	if c.options.Shards <= 1 {
+		return true
+	}
+	if shard, ok := plugin.Labels[ShardLabel]; ok {
+		id, err := strconv.Atoi(shard)
+		if err == nil {
+			return id == c.options.ShardID
+		}
+		klog.Warningf("plugin %s has invalid shard label %q, falling back to name hash", plugin.Name, shard)
+	}
+	h := fnv.New32a()
+	h.Write([]byte(plugin.Name))
+	return int(h.Sum32()%uint32(c.options.Shards)) == c.options.ShardID
+}
+
+// DeletePlugin deletes the plugin, its older versions and its aliases from git repository and removes
+// the actuall plugin tarball from local, releasing their contents in the store.
 func DeletePlugin(name string, repo *git.Repo) error {
-	err := repo.Delete(name)
+	err := deleteEntry(name, repo)
 	if err != nil {
 		return err
 	}
+	err = unpublishVersions(name, repo)
+	if err != nil {
+		return err
+	}
+	err = unpublishAliases(name, repo)
+	if err != nil {
+		return err
+	}
+	return removeArtifacts(name, nil)
+}
+
+// deleteEntry deletes the entry of the deleted plugin from the index, unless another plugin already
+// publishes it as its alias.
+func deleteEntry(name string, repo *git.Repo) error {
+	if owner := aliasOf(repo, name); len(owner) > 0 {
+		klog.V(4).Infof("plugin %s is published as an alias of plugin %s", name, owner)
+		return nil
+	}
+	return repo.Delete(name)
+}
+
+// removeStaleArtifacts removes the artifacts of the plugin but the ones of the platforms it publishes.
+func (c *Controller) removeStaleArtifacts(plugin *v1alpha1.Plugin) error {
+	published := map[string]bool{}
+	if c.ownsPlugin(plugin) && isPublished(plugin) {
+		for _, p := range plugin.Status.Platforms {
+			addPublishedArtifacts(plugin.Name, p, published)
+		}
+		for _, v := range plugin.Status.Versions {
+			for _, p := range v.Platforms {
+				addPublishedArtifacts(v.Name, p, published)
+			}
+		}
+	}
+	return removeArtifacts(plugin.Name, published)
+}
+
+// addPublishedArtifacts records the artifact of the published platform and the files stored next to it
+// in artifacts, and returns the path of the artifact.
+func addPublishedArtifacts(name string, p v1alpha1.PluginPlatformStatus, artifacts map[string]bool) string {
+	path := filepath.Clean(artifactPath(name, p.Platform, p.ArchiveFormat))
+	artifacts[path] = true
+	artifacts[image.ZstdPath(path)] = image.ZstdArtifacts
+	if p.Binary != nil {
+		artifacts[image.RawBinaryPath(path)] = true
+	}
+	if p.SBOM != nil {
+		artifacts[image.SBOMPath(path, p.SBOM.Format)] = true
+	}
+	for _, completion := range p.Completions {
+		artifacts[image.CompletionPath(path, completion.Shell)] = true
+	}
+	if p.ManPages != nil {
+		artifacts[image.ManPagesPath(path)] = true
+	}
+	return path
+}
+
+// removeArtifacts removes the artifacts of the plugin but the kept ones, releasing their contents in the store.
+func removeArtifacts(name string, kept map[string]bool) error {
+	// the tar.zst variants of the tar.gz artifacts, the executables and the SBOMs are removed with them
+	for _, format := range artifactFormats() {
+		artifacts, err := filepath.Glob(fmt.Sprintf("%s/%s_*.%s", image.TarballPath, name, format))
+		if err != nil {
+			return err
+		}
+		for _, artifact := range artifacts {
+			if kept[filepath.Clean(artifact)] {
+				continue
+			}
+			if err := image.RemoveArtifact(artifact); err != nil {
+				klog.Errorf("removing artifact %s of plugin %s error %v", artifact, name, err)
+			}
+		}
+		// the checksums without artifacts and the partially written artifacts
+		leftovers, err := filepath.Glob(fmt.Sprintf("%s/%s_*.%s.*", image.TarballPath, name, format))
+		if err != nil {
+			return err
+		}
+		for _, file := range leftovers {
+			if kept[strings.TrimSuffix(filepath.Clean(file), ".sha256")] {
+				continue
+			}
+			os.Remove(file)
+		}
+	}
+	return nil
+}
+
+// IsOnDemandPlatform reports whether the platform is only published on demand.
+func IsOnDemandPlatform(platform string, onDemandPlatforms []string) bool {
+	_, arch, _ := strings.Cut(platform, "/")
+	for _, p := range onDemandPlatforms {
+		if p == platform || p == arch {
+			return true
+		}
+	}
+	return false
+}
+
+// IsDemandedPlatform reports whether the platform is demanded in the DemandedPlatformsAnnotation of the plugin.
+func IsDemandedPlatform(plugin *v1alpha1.Plugin, platform string) bool {
+	for _, p := range strings.Split(plugin.Annotations[DemandedPlatformsAnnotation], ",") {
+		if strings.TrimSpace(p) == platform {
+			return true
+		}
+	}
+	return false
+}
+
+// artifactFormats returns the formats of the artifacts and of the files stored next to them.
+func artifactFormats() []v1alpha1.ArchiveFormat {
+	formats := []v1alpha1.ArchiveFormat{v1alpha1.ArchiveFormatTarGz, v1alpha1.ArchiveFormatZip, "tar.zst", "bin", "man.tar"}
+	for _, suffix := range append(image.SBOMSuffixes(), image.CompletionSuffixes()...) {
+		formats = append(formats, v1alpha1.ArchiveFormat(suffix))
+	}
+	return formats
+}
+
+// artifactPath returns the location of the artifact of the plugin platform in the given format.
+func artifactPath(name, platform string, format v1alpha1.ArchiveFormat) string {
+	if len(format) == 0 {
+		format = v1alpha1.ArchiveFormatTarGz
+	}
+	return fmt.Sprintf("%s/%s_%s.%s", image.TarballPath, name, strings.ReplaceAll(platform, "/", "_"), format)
+}
 
-	files, err := filepath.Glob(fmt.Sprintf("%s/%s_*.tar.gz", image.TarballPath, name))
+func (c *Controller) upsertPlugin(ctx context.Context, plugin *v1alpha1.Plugin) error {
+	k, success, err := c.convertKrewPlugin(ctx, plugin)
 	if err != nil {
 		return err
 	}
+	if !success {
+		return nil
+	}
+	err = c.publishPlugin(plugin, k)
+	if err != nil {
+		return err
+	}
+	err = c.publishAliases(plugin, k)
+	if err != nil {
+		return err
+	}
+	err = c.publishVersions(plugin)
+	if err != nil {
+		return err
+	}
+	return c.publishChannels(plugin)
+}
 
-	for _, file := range files {
-		os.Remove(file)
+// publishPlugin publishes the krew plugin to the preview index, and to the main index unless staged.
+func (c *Controller) publishPlugin(plugin *v1alpha1.Plugin, k *krew.Plugin) error {
+	if k == nil {
+		return nil
+	}
+	err := c.previewRepo.Upsert(plugin.Name, k)
+	if err != nil {
+		return err
+	}
+	if plugin.Spec.Preview {
+		klog.V(2).Infof("plugin %s is staged for preview, skipping the main index", plugin.Name)
+		return nil
+	}
+	err = c.repo.Upsert(plugin.Name, k)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// newKrewPlugin returns the krew plugin manifest without platforms.
+func newKrewPlugin(plugin *v1alpha1.Plugin) *krew.Plugin {
+	k := &krew.Plugin{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: "krew.googlecontainertools.github.com/v1alpha2",
+			Kind:       "Plugin",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name: plugin.Name,
+		},
+		Spec: krew.PluginSpec{
+			Version:          plugin.Spec.Version,
+			ShortDescription: plugin.Spec.ShortDescription,
+			Description:      plugin.Spec.Description,
+			Caveats:          plugin.Spec.Caveats,
+			Homepage:         plugin.Spec.Homepage,
+		},
+	}
+	k.Spec.Caveats = dependencyCaveats(k.Spec.Caveats, plugin.Spec.Dependencies)
+	// krew ignores the annotations, the clients of the index filter the plugins with them
+	if len(plugin.Spec.Categories) > 0 || len(plugin.Spec.Tags) > 0 {
+		k.Annotations = map[string]string{}
+	}
+	if len(plugin.Spec.Categories) > 0 {
+		k.Annotations[CategoriesAnnotation] = strings.Join(plugin.Spec.Categories, ",")
+	}
+	if len(plugin.Spec.Tags) > 0 {
+		k.Annotations[TagsAnnotation] = strings.Join(plugin.Spec.Tags, ",")
+	}
+	if notice := deprecationNotice(plugin); len(notice) > 0 {
+		k.Spec.ShortDescription = "[deprecated] " + k.Spec.ShortDescription
+		k.Spec.Description = strings.TrimSpace(notice + "\n\n" + k.Spec.Description)
+		k.Spec.Caveats = strings.TrimSpace(notice + "\n" + k.Spec.Caveats)
+	}
+	return k
+}
+
+// newKrewPluginFromStatus returns the krew plugin manifest from the platforms
+// published by the controller into the status, or nil if nothing is published yet.
+func newKrewPluginFromStatus(plugin *v1alpha1.Plugin) *krew.Plugin {
+	if len(plugin.Status.Platforms) == 0 {
+		return nil
+	}
+	k := newKrewPlugin(plugin)
+	if len(plugin.Status.ResolvedVersion) > 0 {
+		k.Spec.Version = plugin.Status.ResolvedVersion
+	}
+	for _, p := range plugin.Status.Platforms {
+		fields := strings.SplitN(p.Platform, "/", 2)
+		if len(fields) < 2 {
+			continue
+		}
+		kp := krew.Platform{
+			URI:    p.URI,
+			Sha256: p.Sha256,
+			Selector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{
+					"os":   fields[0],
+					"arch": fields[1],
+				},
+			},
+			Files: []krew.FileOperation{},
+			Bin:   p.Bin,
+		}
+		for _, f := range image.InstallOrder(p.Files) {
+			from := image.ArchivePath(f)
+			if len(p.URL) > 0 {
+				// the files of the rehosted archives are the paths of the archive already
+				from = f.From
+			}
+			kp.Files = append(kp.Files, krew.FileOperation{
+				From: from,
+				To:   f.To,
+			})
+		}
+		k.Spec.Platforms = append(k.Spec.Platforms, kp)
+	}
+	k.Spec.Caveats = fallbackCaveats(k.Spec.Caveats, plugin.Status.Platforms)
+	return k
+}
+
+// validateMetadata returns why the metadata of the plugin shown by krew is invalid, if it is.
+func validateMetadata(plugin *v1alpha1.Plugin) error {
+	switch {
+	case len(strings.TrimSpace(plugin.Spec.ShortDescription)) == 0:
+		return fmt.Errorf("shortDescription of plugin %s is empty", plugin.Name)
+	case utf8.RuneCountInString(plugin.Spec.ShortDescription) > maxShortDescriptionLength:
+		return fmt.Errorf("shortDescription of plugin %s exceeds %d characters", plugin.Name, maxShortDescriptionLength)
+	case utf8.RuneCountInString(plugin.Spec.Description) > maxDescriptionLength:
+		return fmt.Errorf("description of plugin %s exceeds %d characters", plugin.Name, maxDescriptionLength)
+	case utf8.RuneCountInString(plugin.Spec.Caveats) > maxDescriptionLength:
+		return fmt.Errorf("caveats of plugin %s exceed %d characters", plugin.Name, maxDescriptionLength)
+	case utf8.RuneCountInString(plugin.Spec.Homepage) > maxHomepageLength:
+		return fmt.Errorf("homepage of plugin %s exceeds %d characters", plugin.Name, maxHomepageLength)
+	}
+	if len(plugin.Spec.Homepage) > 0 {
+		u, err := url.Parse(plugin.Spec.Homepage)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || len(u.Host) == 0 {
+			return fmt.Errorf("invalid homepage %s of plugin %s, should be an http or https URL", plugin.Spec.Homepage, plugin.Name)
+		}
+	}
+	return nil
+}
+
+func (c *Controller) convertKrewPlugin(ctx context.Context, plugin *v1alpha1.Plugin) (*krew.Plugin, bool, error) {
+	if plugin == nil {
+		return nil, false, nil
+	}
+	if !safePluginRegexp.MatchString(plugin.Name) {
+		newCondition := metav1.Condition{
+			Status:  metav1.ConditionFalse,
+			Reason:  "InvalidField",
+			Message: fmt.Sprintf("invalid plugin name %s", plugin.Name),
+		}
+		err := updateStatusCondition(ctx, plugin, c.dynamicClient, newCondition)
+		if err != nil {
+			return nil, false, err
+		}
+		return nil, false, nil
+	}
+
+	if err := utilerrors.NewAggregate([]error{validateMetadata(plugin), validateAliases(plugin), validateNamespace(plugin)}); err != nil {
+		newCondition := metav1.Condition{
+			Status:  metav1.ConditionFalse,
+			Reason:  "InvalidField",
+			Message: err.Error(),
+		}
+		err := updateStatusCondition(ctx, plugin, c.dynamicClient, newCondition)
+		if err != nil {
+			return nil, false, err
+		}
+		return nil, false, nil
 	}
-	return nil
-}
 
-func UpsertPlugin(plugin *v1alpha1.Plugin, repo *git.Repo, client *kubernetes.Clientset, dynamicClient *dynamic.DynamicClient, route routeclient.RouteV1Interface, insecureHTTP bool) error {
-	k, success, err := convertKrewPlugin(plugin, client, dynamicClient, route, insecureHTTP)
-	if err != nil {
-		return err
-	}
-	if !success {
-		return nil
-	}
-	err = repo.Upsert(plugin.Name, k)
+	dependencyCondition, err := c.checkDependencies(plugin)
 	if err != nil {
-		return err
+		return nil, false, err
 	}
-	return nil
-}
-
-func convertKrewPlugin(plugin *v1alpha1.Plugin, client *kubernetes.Clientset, dynamicClient *dynamic.DynamicClient, route routeclient.RouteV1Interface, insecureHTTP bool) (*krew.Plugin, bool, error) {
-	if plugin == nil {
+	if dependencyCondition != nil {
+		err := updateStatusCondition(ctx, plugin, c.dynamicClient, *dependencyCondition)
+		if err != nil {
+			return nil, false, err
+		}
 		return nil, false, nil
 	}
-	ctx := context.Background()
-	safePluginRegexp := regexp.MustCompile(`^[\w-]+$`)
-	if !safePluginRegexp.MatchString(plugin.Name) {
+
+	if err := validateChannels(plugin); err != nil {
 		newCondition := metav1.Condition{
 			Status:  metav1.ConditionFalse,
 			Reason:  "InvalidField",
-			Message: fmt.Sprintf("invalid plugin name %s", plugin.Name),
+			Message: err.Error(),
 		}
-		err := updateStatusCondition(ctx, plugin, dynamicClient, newCondition)
+		err := updateStatusCondition(ctx, plugin, c.dynamicClient, newCondition)
 		if err != nil {
 			return nil, false, err
 		}
 		return nil, false, nil
 	}
 
-	if !strings.HasPrefix(plugin.Spec.Version, "v") {
+	if plugin.Spec.Resolver != nil {
+		if err := c.resolve(ctx, plugin); err != nil {
+			newCondition := metav1.Condition{
+				Status:  metav1.ConditionFalse,
+				Reason:  "ResolverError",
+				Message: fmt.Sprintf("failed to resolve the version of plugin %s error %s", plugin.Name, err),
+			}
+			err := updateStatusCondition(ctx, plugin, c.dynamicClient, newCondition)
+			if err != nil {
+				return nil, false, err
+			}
+			return nil, false, nil
+		}
+	}
+
+	// the resolved version is validated like the one of the spec
+	if err := validateVersion(plugin); err != nil {
 		newCondition := metav1.Condition{
 			Status:  metav1.ConditionFalse,
 			Reason:  "InvalidField",
-			Message: fmt.Sprintf("invalid version %s, should start with v like v0.0.0", plugin.Spec.Version),
+			Message: err.Error(),
 		}
-		err := updateStatusCondition(ctx, plugin, dynamicClient, newCondition)
+		err := updateStatusCondition(ctx, plugin, c.dynamicClient, newCondition)
 		if err != nil {
 			return nil, false, err
 		}
 		return nil, false, nil
 	}
-	_, err := k8sver.ParseSemantic(plugin.Spec.Version)
-	if err != nil {
+	if err := validateVersions(plugin); err != nil {
 		newCondition := metav1.Condition{
 			Status:  metav1.ConditionFalse,
 			Reason:  "InvalidField",
-			Message: fmt.Sprintf("invalid version %s, should be in v0.0.0 format", plugin.Spec.Version),
+			Message: err.Error(),
 		}
-		err := updateStatusCondition(ctx, plugin, dynamicClient, newCondition)
+		err := updateStatusCondition(ctx, plugin, c.dynamicClient, newCondition)
 		if err != nil {
 			return nil, false, err
 		}
 		return nil, false, nil
 	}
-	k := &krew.Plugin{
-		TypeMeta: metav1.TypeMeta{
-			APIVersion: "krew.googlecontainertools.github.com/v1alpha2",
-			Kind:       "Plugin",
-		},
-		ObjectMeta: metav1.ObjectMeta{
-			Name: plugin.Name,
-		},
-		Spec: krew.PluginSpec{
-			Version:          plugin.Spec.Version,
-			ShortDescription: plugin.Spec.ShortDescription,
-			Description:      plugin.Spec.Description,
-			Caveats:          plugin.Spec.Caveats,
-			Homepage:         plugin.Spec.Homepage,
-		},
+	k := newKrewPlugin(plugin)
+	var publishedPlatforms []v1alpha1.PluginPlatformStatus
+	var skippedPlatforms, validatedPlatforms, disabledPlatforms []string
+	// the platforms of the older versions are synced with the ones of the current version
+	var platforms []versionPlatform
+	addPlatforms := func(version string, specPlatforms []v1alpha1.PluginPlatform) {
+		for _, p := range specPlatforms {
+			fields := strings.SplitN(p.Platform, "/", 2)
+			if len(fields) < 2 {
+				continue
+			}
+			// the artifacts of the disabled platforms are removed with the ones of the unpublished platforms
+			if p.Disabled {
+				klog.V(2).Infof("platform %s of plugin %s is disabled", p.Platform, plugin.Name)
+				disabledPlatforms = append(disabledPlatforms, versionPlatform{version: version, PluginPlatform: p}.String())
+				continue
+			}
+			if IsOnDemandPlatform(p.Platform, c.options.OnDemandPlatforms) && !IsDemandedPlatform(plugin, p.Platform) {
+				klog.V(2).Infof("platform %s of plugin %s is published on demand", p.Platform, plugin.Name)
+				continue
+			}
+			platforms = append(platforms, versionPlatform{version: version, PluginPlatform: p})
+		}
 	}
-	for _, p := range plugin.Spec.Platforms {
-		fields := strings.SplitN(p.Platform, "/", 2)
-		if len(fields) < 2 {
-			continue
+	addPlatforms("", plugin.Spec.Platforms)
+	// the versions retired by the retention are unpublished, and their artifacts removed once synced
+	maxVersions, maxAge := c.versionRetention(plugin)
+	retainedVersions, retiredVersions, expiry := retainVersions(plugin, maxVersions, maxAge, time.Now())
+	if expiry != nil {
+		// revisit the plugin once the next version is retired
+		c.queue.AddAfter(plugin.Name, time.Until(*expiry))
+	}
+	for _, v := range retainedVersions {
+		addPlatforms(v.Version, v.Platforms)
+	}
+
+	// the progress reporters of the platforms update the same plugin object
+	var progressLock sync.Mutex
+	results, err := syncPlatforms(c.options.PlatformWorkers, platforms, func(p versionPlatform) (platformResult, error) {
+		progress := newProgressReporter(ctx, plugin, c.dynamicClient, p.Platform, &progressLock)
+		return c.syncPlatform(ctx, plugin, p.version, p.PluginPlatform, progress)
+	})
+	if err != nil {
+		return nil, false, err
+	}
+
+	var failures, degradations []metav1.Condition
+	versionPlatforms := map[string][]v1alpha1.PluginPlatformStatus{}
+	for i, result := range results {
+		switch {
+		case result.skipped:
+			skippedPlatforms = append(skippedPlatforms, platforms[i].String())
+		case result.condition != nil:
+			failures = append(failures, *result.condition)
+			if result.degraded {
+				degradations = append(degradations, *result.condition)
+			}
+		case result.validated:
+			validatedPlatforms = append(validatedPlatforms, platforms[i].String())
+		case len(platforms[i].version) > 0:
+			versionPlatforms[platforms[i].version] = append(versionPlatforms[platforms[i].version], result.status)
+		default:
+			k.Spec.Platforms = append(k.Spec.Platforms, *result.platform)
+			publishedPlatforms = append(publishedPlatforms, result.status)
+		}
+	}
+	// the versions without published platforms are not published
+	var publishedVersions []v1alpha1.PluginVersionStatus
+	now := metav1.Now()
+	for _, v := range retainedVersions {
+		if len(versionPlatforms[v.Version]) > 0 {
+			// the age of the versions is counted from their first publication
+			publishedTime := now.DeepCopy()
+			for _, previous := range plugin.Status.Versions {
+				if previous.Version == v.Version && previous.PublishedTime != nil {
+					publishedTime = previous.PublishedTime
+				}
+			}
+			publishedVersions = append(publishedVersions, v1alpha1.PluginVersionStatus{
+				Version:       v.Version,
+				Name:          VersionedName(plugin.Name, v.Version),
+				Platforms:     versionPlatforms[v.Version],
+				PublishedTime: publishedTime,
+			})
+		}
+	}
+	if len(failures) > 0 {
+		if len(degradations) > 0 {
+			degraded := joinConditions(degradations)
+			degraded.Type = v1alpha1.DegradedCondition
+			degraded.Status = metav1.ConditionTrue
+			setCondition(plugin, degraded)
+		}
+		err := updateStatusCondition(ctx, plugin, c.dynamicClient, joinConditions(failures))
+		if err != nil {
+			return nil, false, err
+		}
+		return nil, false, nil
+	}
+	k.Spec.Caveats = fallbackCaveats(k.Spec.Caveats, publishedPlatforms)
+
+	var newCondition metav1.Condition
+	if plugin.Spec.ValidateOnly {
+		// nothing is published, the platforms published before are removed from the status
+		klog.Infof("plugin %s is validated", plugin.Name)
+		newCondition = metav1.Condition{
+			Status:  metav1.ConditionFalse,
+			Reason:  "Validated",
+			Message: fmt.Sprintf("files of plugin %s are found in the images of platforms %s, it is not published since validateOnly is set", plugin.Name, strings.Join(validatedPlatforms, ", ")),
+		}
+	} else {
+		klog.Infof("plugin %s is ready to be served", plugin.Name)
+		newCondition = metav1.Condition{
+			Status:  metav1.ConditionTrue,
+			Reason:  "Installed",
+			Message: fmt.Sprintf("plugin %s is ready to be served", plugin.Name),
+		}
+	}
+	if len(skippedPlatforms) > 0 {
+		newCondition.Message += fmt.Sprintf(", platforms %s are skipped since their images are not built for them", strings.Join(skippedPlatforms, ", "))
+	}
+	if len(disabledPlatforms) > 0 {
+		newCondition.Message += fmt.Sprintf(", platforms %s are disabled", strings.Join(disabledPlatforms, ", "))
+	}
+	if len(retiredVersions) > 0 {
+		newCondition.Message += fmt.Sprintf(", versions %s are retired by the retention", strings.Join(retiredVersions, ", "))
+	}
+	// the published platforms are merged into the index of the other shards
+	var resolvedVersion string
+	if plugin.Spec.Resolver != nil {
+		resolvedVersion = plugin.Spec.Version
+	}
+	plugin.Status.Platforms = publishedPlatforms
+	plugin.Status.SkippedPlatforms = skippedPlatforms
+	plugin.Status.ResolvedVersion = resolvedVersion
+	plugin.Status.Versions = publishedVersions
+	plugin.Status.Progress = nil
+	// the files missing from the images of the previous syncs are found
+	setCondition(plugin, notDegradedCondition())
+	setStatusCondition(plugin, newCondition)
+	// the status is updated on every successful sync with its time
+	plugin.Status.LastSyncTime = &now
+	if err := updateStatus(ctx, plugin, c.dynamicClient); err != nil {
+		return nil, false, err
+	}
+	return k, !plugin.Spec.ValidateOnly, nil
+}
+
+// versionPlatform is a platform of the current version of a plugin, or of one of its older versions.
+type versionPlatform struct {
+	// version is the older version of the platform, or empty for the current one
+	version string
+	v1alpha1.PluginPlatform
+}
+
+func (p versionPlatform) String() string {
+	if len(p.version) == 0 {
+		return p.Platform
+	}
+	return fmt.Sprintf("%s of version %s", p.Platform, p.version)
+}
+
+// syncPlatforms syncs up to workers platforms concurrently, and returns their results in the order of the platforms.
+func syncPlatforms(workers int, platforms []versionPlatform, syncPlatform func(versionPlatform) (platformResult, error)) ([]platformResult, error) {
+	results := make([]platformResult, len(platforms))
+	errs := make([]error, len(platforms))
+	var group errgroup.Group
+	group.SetLimit(max(workers, 1))
+	for i, p := range platforms {
+		group.Go(func() error {
+			results[i], errs[i] = syncPlatform(p)
+			return nil
+		})
+	}
+	group.Wait()
+	return results, utilerrors.NewAggregate(errs)
+}
+
+// platformResult is the outcome of the pull and extraction of a platform of a plugin.
+type platformResult struct {
+	// platform is the platform published in the index, with status in the plugin status.
+	platform *krew.Platform
+	status   v1alpha1.PluginPlatformStatus
+	// skipped reports whether the platform is skipped, since its image is not built for it.
+	skipped bool
+	// validated reports whether the files of the platform are found, for the ValidateOnly plugins.
+	validated bool
+	// condition is the PluginInstalled condition the platform failed with.
+	condition *metav1.Condition
+	// degraded reports whether the failure degrades the plugin, see v1alpha1.DegradedCondition.
+	degraded bool
+}
+
+// syncPlatform pulls the image of the platform of the version and extracts its artifact.
+func (c *Controller) syncPlatform(ctx context.Context, plugin *v1alpha1.Plugin, version string, p v1alpha1.PluginPlatform, progress *progressReporter) (platformResult, error) {
+	switch {
+	case p.GitHub != nil:
+		return c.syncGitHubPlatform(ctx, plugin, version, p)
+	case len(p.URL) > 0:
+		return c.syncArchivePlatform(ctx, plugin, version, p, nil)
+	}
+	fields := strings.SplitN(p.Platform, "/", 2)
+	var img v1.Image
+	var err error
+	// fallbackArchitecture is the architecture of the binaries published for the platform, if it is not its own
+	var fallbackArchitecture string
+	// credentialSource is the source of the credentials the image is pulled with
+	var credentialSource string
+	if image.IsConfigMap(p.Image) {
+		img, err = c.configMapImage(ctx, p.Image)
+		if err != nil {
+			newCondition := metav1.Condition{
+				Status:  metav1.ConditionFalse,
+				Reason:  "ConfigMapError",
+				Message: fmt.Sprintf("failed to read the files of platform %s from %s error %s", p.Platform, p.Image, err),
+			}
+			return platformResult{condition: &newCondition}, nil
+		}
+	} else {
+		imageRef := p.Image
+		pullOptions := image.PullOptions{
+			Platform: p.Platform,
+			Proxy:    p.Proxy,
+		}
+		if image.IsImageStreamTag(p.Image) {
+			imageRef, err = c.resolveImageStreamTag(ctx, p.Image)
+			if err != nil {
+				newCondition := metav1.Condition{
+					Status:  metav1.ConditionFalse,
+					Reason:  "ImageStreamTagError",
+					Message: fmt.Sprintf("failed to resolve the image stream tag %s error %s", p.Image, err),
+				}
+				return platformResult{condition: &newCondition}, nil
+			}
+			// images of the internal registry are pulled with the controller's service account
+			token, err := os.ReadFile(image.ServiceAccountTokenPath)
+			if err != nil {
+				return platformResult{}, fmt.Errorf("could not read the service account token err: %w", err)
+			}
+			pullOptions.Auth = base64.StdEncoding.EncodeToString([]byte("serviceaccount:" + strings.TrimSpace(string(token))))
+			pullOptions.CAFile = image.ServiceCAPath
+		}
+
+		if err := image.CheckRegistryPolicy(imageRef); err != nil {
+			newCondition := metav1.Condition{
+				Status:  metav1.ConditionFalse,
+				Reason:  "RegistryNotAllowed",
+				Message: fmt.Sprintf("image of platform %s violates the registry policy: %s", p.Platform, err),
+			}
+			return platformResult{condition: &newCondition}, nil
 		}
 
-		var imageAuth string
+		var credentials []credential
 		if len(p.ImagePullSecret) > 0 {
 			secrets := strings.SplitN(p.ImagePullSecret, "/", 2)
 			var namespace, secret string
@@ -261,7 +1256,7 @@ func convertKrewPlugin(plugin *v1alpha1.Plugin, client *kubernetes.Clientset, dy
 				secret = secrets[0]
 			}
 			// if an imagePullSecret is defined for the binary, retrieve the Secret for it
-			imagePullSecret, err := client.CoreV1().Secrets(namespace).Get(ctx, secret, metav1.GetOptions{})
+			imagePullSecret, err := c.client.CoreV1().Secrets(namespace).Get(ctx, secret, metav1.GetOptions{})
 			if err != nil {
 				newCondition := metav1.Condition{
 					Status:  metav1.ConditionFalse,
@@ -271,184 +1266,391 @@ func convertKrewPlugin(plugin *v1alpha1.Plugin, client *kubernetes.Clientset, dy
 				if errors.IsNotFound(err) {
 					newCondition.Message = fmt.Sprintf("secret %s is not found. If secret is in another namespace, please prepend namespace as anotherns/secret_name format", secret)
 				}
-				err := updateStatusCondition(ctx, plugin, dynamicClient, newCondition)
-				if err != nil {
-					return nil, false, err
-				}
-				return nil, false, nil
+				return platformResult{condition: &newCondition}, nil
 			}
 
-			// ensure the Secret is of the expected type
-			if imagePullSecret.Type != corev1.SecretTypeDockercfg && imagePullSecret.Type != corev1.SecretTypeDockerConfigJson {
+			imageAuth, err := pullSecretAuth(imagePullSecret, imageRef)
+			if err != nil {
 				newCondition := metav1.Condition{
 					Status:  metav1.ConditionFalse,
-					Reason:  "InvalidSecretType",
-					Message: fmt.Sprintf("image pull secret type %s is not supported, only kubernetes.io/dockercfg and kubernetes.io/dockerconfigjson are supported", imagePullSecret.Type),
-				}
-				err := updateStatusCondition(ctx, plugin, dynamicClient, newCondition)
-				if err != nil {
-					return nil, false, err
+					Reason:  "InvalidField",
+					Message: err.Error(),
 				}
-				return nil, false, nil
-			}
-
-			if imagePullSecret.Type == corev1.SecretTypeDockercfg {
-				// set the .dockercfg auth information for the image puller
-				imageAuth = string(imagePullSecret.Data[corev1.DockerConfigKey])
-			} else if imagePullSecret.Type == corev1.SecretTypeDockerConfigJson {
-				var dcr *DockerConfigJson
-				err = json.Unmarshal(imagePullSecret.Data[corev1.DockerConfigJsonKey], &dcr)
-				if err != nil || dcr == nil {
-					newCondition := metav1.Condition{
-						Status:  metav1.ConditionFalse,
-						Reason:  "InvalidField",
-						Message: fmt.Sprintf("unable to parse dockerjson %s to json", imagePullSecret.Name),
-					}
-					err := updateStatusCondition(ctx, plugin, dynamicClient, newCondition)
-					if err != nil {
-						return nil, false, err
-					}
-					return nil, false, nil
+				var typeErr *secretTypeError
+				if goerrors.As(err, &typeErr) {
+					newCondition.Reason = "InvalidSecretType"
 				}
-				for key, val := range dcr.Auths {
-					if strings.Contains(p.Image, key+"/") {
-						imageAuth = val.Auth
-					}
+				return platformResult{condition: &newCondition}, nil
+			}
+			credentials = append(credentials, credential{source: string(v1alpha1.CredentialSourceSecret) + " " + p.ImagePullSecret, auth: imageAuth})
+		}
+		if len(p.Credentials) > 0 {
+			chain, skipped := c.credentialChain(ctx, p.Credentials, imageRef)
+			credentials = append(credentials, chain...)
+			if len(credentials) == 0 {
+				newCondition := metav1.Condition{
+					Status:  metav1.ConditionFalse,
+					Reason:  "NoCredentials",
+					Message: fmt.Sprintf("none of the credentials of platform %s can be used: %s", p.Platform, strings.Join(skipped, ", ")),
 				}
+				return platformResult{condition: &newCondition}, nil
 			}
 		}
 
-		// attempt to pull the image down locally
-		img, err := image.Pull(p.Image, imageAuth)
+		pullOptions.ClientCertificate, err = c.clientCertificate(ctx, p, imageRef)
 		if err != nil {
 			newCondition := metav1.Condition{
 				Status:  metav1.ConditionFalse,
-				Reason:  "ImagePullError",
-				Message: fmt.Sprintf("failed to pull the image error %s", err),
-			}
-			err := updateStatusCondition(ctx, plugin, dynamicClient, newCondition)
-			if err != nil {
-				return nil, false, err
+				Reason:  "InvalidClientCertificate",
+				Message: err.Error(),
 			}
-			return nil, false, nil
+			return platformResult{condition: &newCondition}, nil
 		}
-
-		destinationFileName := fmt.Sprintf("%s/%s_%s.tar.gz", image.TarballPath, plugin.Name, strings.ReplaceAll(p.Platform, "/", "_"))
-		files, err := image.Extract(img, p, destinationFileName)
+		proxy, proxyUser, err := c.proxyCredentials(ctx, p)
 		if err != nil {
 			newCondition := metav1.Condition{
 				Status:  metav1.ConditionFalse,
-				Reason:  "ExtractFromImageError",
-				Message: fmt.Sprintf("failed to extract the binary from image error %s", err),
+				Reason:  "InvalidProxySecret",
+				Message: err.Error(),
 			}
-			err := updateStatusCondition(ctx, plugin, dynamicClient, newCondition)
-			if err != nil {
-				return nil, false, err
-			}
-			return nil, false, nil
+			return platformResult{condition: &newCondition}, nil
 		}
-
-		if len(files) == 0 {
-			newCondition := metav1.Condition{
-				Status:  metav1.ConditionFalse,
-				Reason:  "BinaryNotFound",
-				Message: fmt.Sprintf("failed to find the binary from image, path should not be directory, symlink"),
+		if len(proxy) > 0 {
+			pullOptions.Proxy = proxy
+		}
+		pullOptions.ProxyUser = proxyUser
+		pullOptions.BytesDownloaded = &progress.bytesDownloaded
+		// attempt to pull the image down locally, with the credentials in order until one is accepted
+		if len(credentials) == 0 {
+			img, err = image.Pull(imageRef, pullOptions)
+		}
+		defaultAuth := pullOptions.Auth
+		for i, cred := range credentials {
+			pullOptions.Auth = defaultAuth
+			if len(cred.auth) > 0 {
+				pullOptions.Auth = cred.auth
 			}
-			err := updateStatusCondition(ctx, plugin, dynamicClient, newCondition)
-			if err != nil {
-				return nil, false, err
+			img, err = image.Pull(imageRef, pullOptions)
+			credentialSource = cred.source
+			if !image.IsUnauthorized(err) || i == len(credentials)-1 {
+				break
+			}
+			klog.Infof("credentials of %s are rejected for image %s of plugin %s, the next ones are tried: %v", cred.source, imageRef, plugin.Name, err)
+		}
+		if image.IsPlatformMissing(err) {
+			switch plugin.Spec.ArchitectureFallback {
+			case v1alpha1.ArchitectureFallbackSkip:
+				klog.Infof("platform %s of plugin %s is skipped, its image is not built for it: %v", p.Platform, plugin.Name, err)
+				return platformResult{skipped: true}, nil
+			case v1alpha1.ArchitectureFallbackAMD64:
+				if !strings.HasPrefix(fields[1], "amd64") {
+					klog.Infof("platform %s of plugin %s falls back to amd64, its image is not built for it: %v", p.Platform, plugin.Name, err)
+					pullOptions.Platform = fields[0] + "/amd64"
+					fallbackArchitecture = "amd64"
+					img, err = image.Pull(imageRef, pullOptions)
+				}
 			}
-			return nil, false, nil
 		}
-
-		dest, err := os.Open(destinationFileName)
 		if err != nil {
 			newCondition := metav1.Condition{
 				Status:  metav1.ConditionFalse,
-				Reason:  "BinaryNotFound",
-				Message: fmt.Sprintf("failed to open the extracted binary %s", err),
+				Reason:  "ImagePullError",
+				Message: fmt.Sprintf("failed to pull the image error %s", err),
 			}
-			err := updateStatusCondition(ctx, plugin, dynamicClient, newCondition)
-			if err != nil {
-				return nil, false, err
+			if image.IsPlatformMissing(err) {
+				newCondition.Reason = "PlatformMismatch"
+				newCondition.Message = fmt.Sprintf("image %s does not match the platform %s: %s", p.Image, p.Platform, err)
 			}
-			return nil, false, nil
-		}
-		hash := sha256.New()
-		if _, err := io.Copy(hash, dest); err != nil {
-			dest.Close()
-			newCondition := metav1.Condition{
-				Status:  metav1.ConditionFalse,
-				Reason:  "Sha256ChecksumError",
-				Message: fmt.Sprintf("could not calculate sha256 checksum"),
+			var tooLargeErr *image.ImageTooLargeError
+			if goerrors.As(err, &tooLargeErr) {
+				newCondition.Reason = "ImageTooLarge"
+				newCondition.Message = fmt.Sprintf("image %s of platform %s is rejected: %s", p.Image, p.Platform, err)
 			}
-			err := updateStatusCondition(ctx, plugin, dynamicClient, newCondition)
-			if err != nil {
-				return nil, false, err
+			var unavailableErr *image.RegistryUnavailableError
+			if goerrors.As(err, &unavailableErr) {
+				newCondition.Reason = "RegistryUnavailable"
+				newCondition.Message = fmt.Sprintf("image %s of platform %s is not pulled: %s", p.Image, p.Platform, err)
+				// revisit the plugin once the trial pull is let through
+				c.queue.AddAfter(plugin.Name, time.Until(unavailableErr.RetryAfter))
 			}
-			return nil, false, nil
+			return platformResult{condition: &newCondition}, nil
 		}
+	}
 
-		checksum := hex.EncodeToString(hash.Sum(nil))
-
-		r, err := route.Routes("openshift-cli-manager-operator").Get(ctx, "openshift-cli-manager", metav1.GetOptions{})
-		if err != nil {
-			return nil, false, fmt.Errorf("could not get the route openshift-cli-manager in openshift-cli-manager-operator namespace err: %w", err)
+	// krew runs the binary named after the plugin if bin is not set, which is made executable in the artifact
+	if len(p.Bin) == 0 {
+		p.Bin = plugin.Name
+	}
+	if licenses := image.LicenseFiles(plugin.Name, plugin.Spec.Licenses); len(licenses) > 0 {
+		// the files of the spec are shared by the platforms synced concurrently
+		p.Files = append(append([]v1alpha1.FileLocation{}, p.Files...), licenses...)
+	}
+	// the older versions are stored and served under their versioned name
+	artifactName, published := plugin.Name, plugin
+	if len(version) > 0 {
+		published = versionPlugin(plugin, version)
+		artifactName = published.Name
+	}
+	archiveFormat := image.ArchiveFormat(p)
+	destinationFileName := artifactPath(artifactName, p.Platform, archiveFormat)
+	extractProgress := func(layersProcessed, layersTotal int) {
+		progress.report(progressPhaseExtracting, layersProcessed, layersTotal)
+	}
+	// the binary is checked against the platform of the image, which is amd64 on fallback
+	extracted := p
+	if len(fallbackArchitecture) > 0 {
+		extracted.Platform = fields[0] + "/" + fallbackArchitecture
+	}
+	var imageDigest string
+	if digest, err := img.Digest(); err == nil {
+		imageDigest = digest.String()
+	}
+	extractionHash := image.ExtractionHash(extracted)
+	var files []v1alpha1.FileLocation
+	var checksum string
+	// the unchanged artifacts keep the duration and the time of their extraction
+	var extractionDuration *metav1.Duration
+	var extractionTime *metav1.Time
+	if previous := unchangedPlatform(published, p.Platform, imageDigest, extractionHash, destinationFileName); previous != nil {
+		klog.V(2).Infof("image %s of platform %s of plugin %s is unchanged, skipping its extraction", imageDigest, p.Platform, plugin.Name)
+		files, checksum = previous.Files, previous.Sha256
+		extractionDuration, extractionTime = previous.ExtractionDuration, previous.ExtractionTime
+	} else if plugin.Spec.ValidateOnly {
+		// the files are looked up in the image without writing the artifact
+		files, err = image.Validate(ctx, img, extracted, extractProgress)
+	} else {
+		start := time.Now()
+		files, checksum, err = image.Extract(ctx, img, extracted, destinationFileName, extractProgress)
+		extractionDuration = &metav1.Duration{Duration: time.Since(start).Round(time.Millisecond)}
+		extractionTime = &metav1.Time{Time: start}
+	}
+	if err != nil {
+		newCondition := metav1.Condition{
+			Status:  metav1.ConditionFalse,
+			Reason:  "ExtractFromImageError",
+			Message: fmt.Sprintf("failed to extract the binary from image error %s", err),
+		}
+		var tooLargeErr *image.ArtifactTooLargeError
+		if goerrors.As(err, &tooLargeErr) {
+			newCondition.Reason = "ArtifactTooLarge"
+			newCondition.Message = fmt.Sprintf("artifact of platform %s is rejected: %s", p.Platform, err)
+		}
+		var rejectedErr *image.ArtifactRejectedError
+		if goerrors.As(err, &rejectedErr) {
+			newCondition.Reason = "ArtifactRejected"
+			newCondition.Message = fmt.Sprintf("artifact of platform %s is not published: %s", p.Platform, err)
+			return platformResult{condition: &newCondition, degraded: true}, nil
+		}
+		var corruptErr *image.CorruptArtifactError
+		if goerrors.As(err, &corruptErr) {
+			newCondition.Reason = "ArtifactCorrupted"
+			newCondition.Message = fmt.Sprintf("artifact of platform %s is not published: %s", p.Platform, err)
+		}
+		var privilegedErr *image.PrivilegedFileError
+		if goerrors.As(err, &privilegedErr) {
+			newCondition.Reason = "PrivilegedFileRejected"
+			newCondition.Message = fmt.Sprintf("artifact of platform %s in image %s is rejected: %s", p.Platform, p.Image, err)
+			return platformResult{condition: &newCondition, degraded: true}, nil
 		}
+		var platformErr *image.BinaryPlatformError
+		if goerrors.As(err, &platformErr) {
+			newCondition.Reason = "BinaryPlatformMismatch"
+			newCondition.Message = fmt.Sprintf("binary of platform %s in image %s is rejected: %s", p.Platform, p.Image, err)
+		}
+		var missingErr *image.MissingFilesError
+		if goerrors.As(err, &missingErr) {
+			newCondition.Reason = "FilesNotFound"
+			newCondition.Message = fmt.Sprintf("files %s of platform %s are not found in any layer of image %s", strings.Join(missingErr.Files, ", "), p.Platform, p.Image)
+			return platformResult{condition: &newCondition, degraded: true}, nil
+		}
+		return platformResult{condition: &newCondition}, nil
+	}
 
-		artifactURI := fmt.Sprintf("https://%s/cli-manager/plugins/download/?name=%s&platform=%s", r.Spec.Host, plugin.Name, strings.ReplaceAll(p.Platform, "/", "_"))
-		if insecureHTTP {
-			artifactURI = fmt.Sprintf("http://%s/cli-manager/plugins/download/?name=%s&platform=%s", r.Spec.Host, plugin.Name, strings.ReplaceAll(p.Platform, "/", "_"))
+	if len(files) == 0 {
+		newCondition := metav1.Condition{
+			Status:  metav1.ConditionFalse,
+			Reason:  "BinaryNotFound",
+			Message: fmt.Sprintf("failed to find the binary from image, path should not be directory, symlink"),
 		}
+		return platformResult{condition: &newCondition}, nil
+	}
+	if plugin.Spec.ValidateOnly {
+		return platformResult{validated: true}, nil
+	}
 
-		kp := krew.Platform{
-			URI:    artifactURI,
-			Sha256: checksum,
-			Selector: &metav1.LabelSelector{
-				MatchLabels: map[string]string{
-					"os":   fields[0],
-					"arch": fields[1],
-				},
+	artifactURI, err := c.artifactURI(ctx, artifactName, p.Platform)
+	if err != nil {
+		return platformResult{}, err
+	}
+
+	kp := krew.Platform{
+		URI:    artifactURI,
+		Sha256: checksum,
+		Selector: &metav1.LabelSelector{
+			MatchLabels: map[string]string{
+				"os":   fields[0],
+				"arch": fields[1],
 			},
-			Files: []krew.FileOperation{},
-			Bin:   p.Bin,
-		}
+		},
+		Files: []krew.FileOperation{},
+		Bin:   p.Bin,
+	}
 
-		for _, f := range files {
-			kp.Files = append(kp.Files, krew.FileOperation{
-				From: f.From,
-				To:   f.To,
+	for _, f := range image.InstallOrder(files) {
+		kp.Files = append(kp.Files, krew.FileOperation{
+			From: image.ArchivePath(f),
+			To:   f.To,
+		})
+	}
+	status := v1alpha1.PluginPlatformStatus{
+		Platform:           p.Platform,
+		URI:                kp.URI,
+		Sha256:             kp.Sha256,
+		Files:              files,
+		Bin:                kp.Bin,
+		Architecture:       fallbackArchitecture,
+		CredentialSource:   credentialSource,
+		Digest:             imageDigest,
+		ExtractionHash:     extractionHash,
+		ExtractionDuration: extractionDuration,
+		ExtractionTime:     extractionTime,
+	}
+	if info, err := os.Stat(destinationFileName); err == nil {
+		status.Size = info.Size()
+	}
+	if archiveFormat != v1alpha1.ArchiveFormatTarGz {
+		status.ArchiveFormat = archiveFormat
+	}
+	if plugin.Spec.Resolver != nil {
+		status.Image = p.Image
+	}
+	if p.RawBinary {
+		if checksum, err := os.ReadFile(image.ChecksumPath(image.RawBinaryPath(destinationFileName))); err == nil {
+			status.Binary = &v1alpha1.PlatformBinary{
+				URI:    artifactURI + "&binary=true",
+				Sha256: strings.TrimSpace(string(checksum)),
+			}
+		}
+	}
+	for _, shell := range image.CompletionShells {
+		if checksum, err := os.ReadFile(image.ChecksumPath(image.CompletionPath(destinationFileName, shell))); err == nil {
+			status.Completions = append(status.Completions, v1alpha1.PlatformCompletion{
+				Shell:  shell,
+				URI:    artifactURI + "&completion=" + shell,
+				Sha256: strings.TrimSpace(string(checksum)),
 			})
 		}
-		if len(kp.Bin) == 0 {
-			kp.Bin = plugin.Name
+	}
+	if len(p.ManPages) > 0 {
+		if checksum, err := os.ReadFile(image.ChecksumPath(image.ManPagesPath(destinationFileName))); err == nil {
+			status.ManPages = &v1alpha1.PlatformManPages{
+				URI:    artifactURI + "&man=true",
+				Sha256: strings.TrimSpace(string(checksum)),
+			}
+		}
+	}
+	sbom, err := image.FindSBOM(destinationFileName)
+	if err != nil {
+		klog.Errorf("reading the SBOM of platform %s of plugin %s error %v", p.Platform, plugin.Name, err)
+	} else if sbom != nil {
+		status.SBOM = &v1alpha1.PlatformSBOM{
+			Format: sbom.Format,
+			URI:    artifactURI + "&sbom=true",
+			Sha256: sbom.Sha256,
 		}
-		k.Spec.Platforms = append(k.Spec.Platforms, kp)
 	}
+	return platformResult{platform: &kp, status: status}, nil
+}
 
-	klog.Infof("plugin %s is ready to be served", plugin.Name)
-	newCondition := metav1.Condition{
-		Status:  metav1.ConditionTrue,
-		Reason:  "Installed",
-		Message: fmt.Sprintf("plugin %s is ready to be served", plugin.Name),
-	}
-	err = updateStatusCondition(ctx, plugin, dynamicClient, newCondition)
+// artifactURI returns the URI the artifact of the platform of the plugin is downloaded from through the route.
+func (c *Controller) artifactURI(ctx context.Context, name, platform string) (string, error) {
+	r, err := c.route.Routes(operatorNamespace).Get(ctx, c.options.RouteName, metav1.GetOptions{})
 	if err != nil {
-		return nil, false, err
+		return "", fmt.Errorf("could not get the route %s in %s namespace err: %w", c.options.RouteName, operatorNamespace, err)
 	}
-	return k, true, nil
+	scheme := "https"
+	if c.options.InsecureHTTP {
+		scheme = "http"
+	}
+	return fmt.Sprintf("%s://%s%s/plugins/download/?name=%s&platform=%s", scheme, r.Spec.Host, git.PathPrefix, name, strings.ReplaceAll(platform, "/", "_")), nil
 }
 
-func updateStatusCondition(ctx context.Context, plugin *v1alpha1.Plugin, dynamic *dynamic.DynamicClient, condition metav1.Condition) error {
-	condition.Type = "PluginInstalled"
-	condition.LastTransitionTime = metav1.NewTime(time.Now())
-	for _, conds := range plugin.Status.Conditions {
-		if conds.Reason == condition.Reason && conds.Status == condition.Status && conds.Message == condition.Message {
-			// No need to update again
+// unchangedPlatform returns the published status of the platform if its artifact is extracted from the
+// image of the digest with the extraction hash and is still stored, so that it is not extracted again.
+func unchangedPlatform(plugin *v1alpha1.Plugin, platform, digest, extractionHash, artifact string) *v1alpha1.PluginPlatformStatus {
+	if len(digest) == 0 || plugin.Spec.ValidateOnly {
+		return nil
+	}
+	for i := range plugin.Status.Platforms {
+		p := &plugin.Status.Platforms[i]
+		if p.Platform != platform {
+			continue
+		}
+		if p.Digest != digest || p.ExtractionHash != extractionHash || len(p.Files) == 0 {
+			return nil
+		}
+		checksum, err := os.ReadFile(image.ChecksumPath(artifact))
+		if err != nil || strings.TrimSpace(string(checksum)) != p.Sha256 {
+			return nil
+		}
+		if _, err := os.Stat(artifact); err != nil {
 			return nil
 		}
+		return p
+	}
+	return nil
+}
+
+// joinConditions returns the condition of the first failed platform, with the messages of all
+// the failed platforms, so that the failures of several platforms are reported at once.
+func joinConditions(conditions []metav1.Condition) metav1.Condition {
+	condition := conditions[0]
+	for _, c := range conditions[1:] {
+		condition.Message += "; " + c.Message
+	}
+	return condition
+}
+
+func updateStatusCondition(ctx context.Context, plugin *v1alpha1.Plugin, dynamic *dynamic.DynamicClient, condition metav1.Condition) error {
+	changed := setStatusCondition(plugin, condition)
+	if plugin.Status.Progress != nil {
+		// the sync is completed
+		plugin.Status.Progress = nil
+		changed = true
+	}
+	if !changed {
+		// No need to update again
+		return nil
+	}
+	return updateStatus(ctx, plugin, dynamic)
+}
+
+// setStatusCondition sets the PluginInstalled condition of the plugin, and the standard conditions
+// derived from it, and reports whether they are changed.
+func setStatusCondition(plugin *v1alpha1.Plugin, condition metav1.Condition) bool {
+	condition.Type = v1alpha1.PluginInstalledCondition
+	changed := setCondition(plugin, condition)
+	return setStandardConditions(plugin) || changed
+}
+
+// setCondition sets the condition of its type and reports whether it is changed.
+func setCondition(plugin *v1alpha1.Plugin, condition metav1.Condition) bool {
+	condition.ObservedGeneration = plugin.Generation
+	if len(condition.Message) > maxConditionMessageLength {
+		condition.Message = strings.ToValidUTF8(condition.Message[:maxConditionMessageLength-3], "") + "..."
 	}
-	plugin.Status.Conditions = []metav1.Condition{condition}
+	existing := meta.FindStatusCondition(plugin.Status.Conditions, condition.Type)
+	if existing != nil && existing.Reason == condition.Reason && existing.Status == condition.Status && existing.Message == condition.Message &&
+		existing.ObservedGeneration == condition.ObservedGeneration {
+		return false
+	}
+	condition.LastTransitionTime = metav1.NewTime(time.Now())
+	meta.RemoveStatusCondition(&plugin.Status.Conditions, condition.Type)
+	plugin.Status.Conditions = append(plugin.Status.Conditions, condition)
+	return true
+}
+
+func updateStatus(ctx context.Context, plugin *v1alpha1.Plugin, dynamic *dynamic.DynamicClient) error {
 	unstructuredMap, err := runtime.DefaultUnstructuredConverter.ToUnstructured(plugin)
 	unObj := &unstructured.Unstructured{
 		Object: unstructuredMap,
@@ -456,12 +1658,11 @@ func updateStatusCondition(ctx context.Context, plugin *v1alpha1.Plugin, dynamic
 	if err != nil {
 		return fmt.Errorf("unexpected object decoding error %w", err)
 	}
-	_, err = dynamic.Resource(schema.GroupVersionResource{
-		Group:    "config.openshift.io",
-		Version:  "v1alpha1",
-		Resource: "plugins"}).UpdateStatus(ctx, unObj, metav1.UpdateOptions{})
+	updated, err := pluginResource(dynamic, plugin).UpdateStatus(ctx, unObj, metav1.UpdateOptions{})
 	if err != nil {
 		return fmt.Errorf("plugin condition update error %w", err)
 	}
+	// the status may be updated several times within a sync
+	plugin.ResourceVersion = updated.GetResourceVersion()
 	return nil
 }
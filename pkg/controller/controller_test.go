@@ -0,0 +1,1215 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/openshift/library-go/pkg/operator/events"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+
+	"github.com/openshift/cli-manager/api/v1alpha1"
+	"github.com/openshift/cli-manager/api/v1beta1"
+	"github.com/openshift/cli-manager/pkg/git"
+	"github.com/openshift/cli-manager/pkg/image"
+	krew "github.com/openshift/cli-manager/pkg/krew/v1alpha2"
+)
+
+func TestUnchangedPlatform(t *testing.T) {
+	artifact := filepath.Join(t.TempDir(), "tool_linux_amd64.tar.gz")
+	if err := os.WriteFile(artifact, []byte("artifact"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(image.ChecksumPath(artifact), []byte("abc\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	plugin := &v1alpha1.Plugin{
+		Status: v1alpha1.PluginStatus{
+			Platforms: []v1alpha1.PluginPlatformStatus{{
+				Platform:           "linux/amd64",
+				Sha256:             "abc",
+				Files:              []v1alpha1.FileLocation{{From: "/usr/bin/tool", To: "."}},
+				Digest:             "sha256:1",
+				ExtractionHash:     "hash",
+				ExtractionDuration: &metav1.Duration{Duration: time.Second},
+				ExtractionTime:     &metav1.Time{Time: time.Now()},
+			}},
+		},
+	}
+
+	if p := unchangedPlatform(plugin, "linux/amd64", "sha256:1", "hash", artifact); p == nil || p.Sha256 != "abc" {
+		t.Fatalf("expected the unchanged platform, got %v", p)
+	} else if p.ExtractionDuration == nil || p.ExtractionTime == nil {
+		t.Fatalf("expected the unchanged platform to keep the details of its extraction, got %v", p)
+	}
+	for name, tc := range map[string]struct {
+		platform, digest, hash string
+	}{
+		"other platform":    {"linux/arm64", "sha256:1", "hash"},
+		"image changed":     {"linux/amd64", "sha256:2", "hash"},
+		"files changed":     {"linux/amd64", "sha256:1", "other"},
+		"digest is unknown": {"linux/amd64", "", "hash"},
+	} {
+		if p := unchangedPlatform(plugin, tc.platform, tc.digest, tc.hash, artifact); p != nil {
+			t.Errorf("%s: platform is not extracted again", name)
+		}
+	}
+
+	// the artifact is extracted again if it is not stored with the published checksum
+	if err := os.WriteFile(image.ChecksumPath(artifact), []byte("def\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if p := unchangedPlatform(plugin, "linux/amd64", "sha256:1", "hash", artifact); p != nil {
+		t.Fatal("platform with another checksum is not extracted again")
+	}
+	if err := os.WriteFile(image.ChecksumPath(artifact), []byte("abc\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(artifact); err != nil {
+		t.Fatal(err)
+	}
+	if p := unchangedPlatform(plugin, "linux/amd64", "sha256:1", "hash", artifact); p != nil {
+		t.Fatal("platform without artifact is not extracted again")
+	}
+}
+
+func TestVersionPlugin(t *testing.T) {
+	plugin := &v1alpha1.Plugin{
+		Spec: v1alpha1.PluginSpec{
+			Version:   "v1.3.0",
+			Platforms: []v1alpha1.PluginPlatform{{Platform: "linux/amd64", Image: "tool:v1.3.0"}},
+			Versions: []v1alpha1.PluginVersion{
+				{Version: "v1.2.0", Platforms: []v1alpha1.PluginPlatform{{Platform: "linux/amd64", Image: "tool:v1.2.0"}}},
+				{Version: "v1.1.0+build.1", Platforms: []v1alpha1.PluginPlatform{{Platform: "linux/arm64", Image: "tool:v1.1.0"}}},
+			},
+		},
+		Status: v1alpha1.PluginStatus{
+			Platforms: []v1alpha1.PluginPlatformStatus{{Platform: "linux/amd64", Sha256: "current"}},
+			Versions: []v1alpha1.PluginVersionStatus{{
+				Version:   "v1.2.0",
+				Name:      "tool_v1-2-0",
+				Platforms: []v1alpha1.PluginPlatformStatus{{Platform: "linux/amd64", Sha256: "pinned"}},
+			}},
+		},
+	}
+	plugin.Name = "tool"
+
+	if name := VersionedName("tool", "v1.1.0+build.1"); name != "tool_v1-1-0-build-1" {
+		t.Fatalf("unexpected versioned name %s", name)
+	}
+	p := versionPlugin(plugin, "v1.2.0")
+	if p.Name != "tool_v1-2-0" || p.Spec.Version != "v1.2.0" || len(p.Spec.Versions) > 0 || len(p.Status.Versions) > 0 {
+		t.Fatalf("unexpected version plugin %+v", p)
+	}
+	if len(p.Spec.Platforms) != 1 || p.Spec.Platforms[0].Image != "tool:v1.2.0" {
+		t.Fatalf("expected the platforms of the version, got %+v", p.Spec.Platforms)
+	}
+	if len(p.Status.Platforms) != 1 || p.Status.Platforms[0].Sha256 != "pinned" {
+		t.Fatalf("expected the platforms published for the version, got %+v", p.Status.Platforms)
+	}
+	if plugin.Name != "tool" || plugin.Status.Platforms[0].Sha256 != "current" {
+		t.Fatal("the plugin is modified")
+	}
+	if p := versionPlugin(plugin, "v1.1.0+build.1"); len(p.Status.Platforms) > 0 {
+		t.Fatalf("version is not published yet, got %+v", p.Status.Platforms)
+	}
+
+	if err := validateVersions(plugin); err != nil {
+		t.Fatal(err)
+	}
+	for name, version := range map[string]string{
+		"no v prefix":     "1.0.0",
+		"not semantic":    "v1.0",
+		"same name":       "v1.2.0",
+		"same as current": "v1.3.0",
+		"same sanitized":  "v1.1.0+build-1",
+	} {
+		invalid := plugin.DeepCopy()
+		invalid.Spec.Versions = append(invalid.Spec.Versions, v1alpha1.PluginVersion{Version: version})
+		if err := validateVersions(invalid); err == nil {
+			t.Errorf("%s: version %s is not rejected", name, version)
+		}
+	}
+}
+
+func TestValidateChannels(t *testing.T) {
+	plugin := &v1alpha1.Plugin{
+		Spec: v1alpha1.PluginSpec{
+			Version:  "v1.3.0",
+			Versions: []v1alpha1.PluginVersion{{Version: "v1.2.0"}},
+			Channels: []v1alpha1.PluginChannel{
+				{Name: v1alpha1.ChannelStable, Version: "v1.2.0"},
+				{Name: v1alpha1.ChannelEdge, Version: "v1.3.0"},
+			},
+		},
+	}
+	if err := validateChannels(plugin); err != nil {
+		t.Fatal(err)
+	}
+	for name, ch := range map[string]v1alpha1.PluginChannel{
+		"unknown channel": {Name: "beta", Version: "v1.3.0"},
+		"same channel":    {Name: v1alpha1.ChannelStable, Version: "v1.3.0"},
+		"unknown version": {Name: v1alpha1.ChannelCandidate, Version: "v1.1.0"},
+	} {
+		invalid := plugin.DeepCopy()
+		invalid.Spec.Channels = append(invalid.Spec.Channels, ch)
+		if err := validateChannels(invalid); err == nil {
+			t.Errorf("%s: channel %v is not rejected", name, ch)
+		}
+	}
+}
+
+func TestValidateMetadata(t *testing.T) {
+	plugin := &v1alpha1.Plugin{
+		Spec: v1alpha1.PluginSpec{
+			ShortDescription: "Inspect the cluster",
+			Description:      "Inspects the resources of the cluster.",
+			Homepage:         "https://example.com/tool",
+		},
+	}
+	plugin.Name = "tool"
+	if err := validateMetadata(plugin); err != nil {
+		t.Fatal(err)
+	}
+	// the lengths are counted in characters, like the CRD does
+	plugin.Spec.ShortDescription = strings.Repeat("é", maxShortDescriptionLength)
+	if err := validateMetadata(plugin); err != nil {
+		t.Fatal(err)
+	}
+	for name, modify := range map[string]func(*v1alpha1.PluginSpec){
+		"empty short description":    func(s *v1alpha1.PluginSpec) { s.ShortDescription = " " },
+		"long short description":     func(s *v1alpha1.PluginSpec) { s.ShortDescription = strings.Repeat("a", maxShortDescriptionLength+1) },
+		"long description":           func(s *v1alpha1.PluginSpec) { s.Description = strings.Repeat("a", maxDescriptionLength+1) },
+		"long caveats":               func(s *v1alpha1.PluginSpec) { s.Caveats = strings.Repeat("a", maxDescriptionLength+1) },
+		"homepage without scheme":    func(s *v1alpha1.PluginSpec) { s.Homepage = "example.com" },
+		"homepage with other scheme": func(s *v1alpha1.PluginSpec) { s.Homepage = "ftp://example.com" },
+	} {
+		invalid := plugin.DeepCopy()
+		modify(&invalid.Spec)
+		if err := validateMetadata(invalid); err == nil {
+			t.Errorf("%s: metadata is not rejected", name)
+		}
+	}
+}
+
+func TestDeprecationNotice(t *testing.T) {
+	expiresAt := metav1.NewTime(time.Date(2027, 1, 31, 12, 0, 0, 0, time.UTC))
+	plugin := &v1alpha1.Plugin{
+		Spec: v1alpha1.PluginSpec{
+			ShortDescription: "Inspect the cluster",
+			Caveats:          "Requires cluster-admin.",
+			Version:          "v1.3.0",
+			Versions: []v1alpha1.PluginVersion{
+				{Version: "v1.2.0"},
+				{Version: "v1.1.0", Deprecation: &v1alpha1.Deprecation{Message: "v1.1.0 leaks credentials"}},
+			},
+		},
+	}
+	plugin.Name = "tool"
+	if notice := deprecationNotice(plugin); len(notice) > 0 {
+		t.Fatalf("plugin is not deprecated, got %q", notice)
+	}
+	if p := versionPlugin(plugin, "v1.1.0"); deprecationNotice(p) != "Plugin tool_v1-1-0 is deprecated: v1.1.0 leaks credentials." {
+		t.Fatalf("unexpected notice of the deprecated version %q", deprecationNotice(p))
+	}
+
+	plugin.Spec.Deprecation = &v1alpha1.Deprecation{Message: "tool is unmaintained.", Replacement: "inspect"}
+	plugin.Spec.ExpiresAt = &expiresAt
+	notice := "Plugin tool is deprecated: tool is unmaintained. Use inspect instead. It is unpublished on 2027-01-31."
+	if deprecationNotice(plugin) != notice {
+		t.Fatalf("unexpected notice %q", deprecationNotice(plugin))
+	}
+	k := newKrewPlugin(plugin)
+	if k.Spec.ShortDescription != "[deprecated] Inspect the cluster" || k.Spec.Description != notice || k.Spec.Caveats != notice+"\nRequires cluster-admin." {
+		t.Fatalf("deprecation is not noted in the index, got %+v", k.Spec)
+	}
+	// the deprecation of the version is noted instead of the one of the plugin
+	if p := versionPlugin(plugin, "v1.1.0"); !strings.Contains(deprecationNotice(p), "leaks credentials") {
+		t.Fatalf("unexpected notice of the deprecated version %q", deprecationNotice(p))
+	}
+	if p := versionPlugin(plugin, "v1.2.0"); !strings.Contains(deprecationNotice(p), "unmaintained") {
+		t.Fatalf("unexpected notice of the version %q", deprecationNotice(p))
+	}
+}
+
+func TestCheckDependencies(t *testing.T) {
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{dependencyIndex: pluginDependencies})
+	newPlugin := func(name, version string, dependencies ...v1alpha1.PluginDependency) *v1alpha1.Plugin {
+		plugin := &v1alpha1.Plugin{Spec: v1alpha1.PluginSpec{Version: version, Dependencies: dependencies}}
+		plugin.Name = name
+		u, err := runtime.DefaultUnstructuredConverter.ToUnstructured(plugin)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := indexer.Add(&unstructured.Unstructured{Object: u}); err != nil {
+			t.Fatal(err)
+		}
+		return plugin
+	}
+	newPlugin("helper", "v1.2.0")
+	c := &Controller{lister: cache.NewGenericLister(indexer, v1alpha1.GroupVersion.WithResource("plugins").GroupResource())}
+
+	for name, tc := range map[string]struct {
+		dependency v1alpha1.PluginDependency
+		reason     string
+	}{
+		"satisfied":       {v1alpha1.PluginDependency{Name: "helper"}, ""},
+		"minimum version": {v1alpha1.PluginDependency{Name: "helper", MinVersion: "v1.2.0"}, ""},
+		"too old":         {v1alpha1.PluginDependency{Name: "helper", MinVersion: "v1.3.0"}, "DependencyNotSatisfied"},
+		"not found":       {v1alpha1.PluginDependency{Name: "other"}, "DependencyNotFound"},
+		"itself":          {v1alpha1.PluginDependency{Name: "wrapper"}, "InvalidField"},
+		"invalid minimum": {v1alpha1.PluginDependency{Name: "helper", MinVersion: "latest"}, "InvalidField"},
+	} {
+		plugin := newPlugin("wrapper", "v0.1.0", tc.dependency)
+		condition, err := c.checkDependencies(plugin)
+		if err != nil {
+			t.Fatal(err)
+		}
+		switch {
+		case len(tc.reason) == 0 && condition != nil:
+			t.Errorf("%s: dependency is not satisfied: %s", name, condition.Message)
+		case len(tc.reason) > 0 && (condition == nil || condition.Reason != tc.reason):
+			t.Errorf("%s: expected the %s reason, got %v", name, tc.reason, condition)
+		}
+	}
+
+	// the plugins depending on the updated plugin are requeued with it
+	newPlugin("wrapper", "v0.1.0", v1alpha1.PluginDependency{Name: "helper"})
+	objs, err := indexer.ByIndex(dependencyIndex, "helper")
+	if err != nil || len(objs) != 1 {
+		t.Fatalf("expected the dependent plugin, got %v %v", objs, err)
+	}
+	if caveats := dependencyCaveats("", []v1alpha1.PluginDependency{{Name: "helper", MinVersion: "v1.2.0"}}); !strings.Contains(caveats, "helper (v1.2.0 or later)") || !strings.Contains(caveats, "kubectl krew install <index>/helper") {
+		t.Fatalf("unexpected caveats %q", caveats)
+	}
+}
+
+func TestSetStandardConditions(t *testing.T) {
+	plugin := &v1alpha1.Plugin{}
+	plugin.Name = "tool"
+	plugin.Status.Platforms = []v1alpha1.PluginPlatformStatus{{Platform: "linux/amd64"}}
+
+	setStatusCondition(plugin, metav1.Condition{Status: metav1.ConditionFalse, Reason: "ImagePullError", Message: "pull failed"})
+	for conditionType, status := range map[string]metav1.ConditionStatus{
+		v1alpha1.ReadyCondition:             metav1.ConditionFalse,
+		v1alpha1.ProgressingCondition:       metav1.ConditionFalse,
+		v1alpha1.DegradedCondition:          metav1.ConditionFalse,
+		v1alpha1.SignatureVerifiedCondition: metav1.ConditionUnknown,
+		v1alpha1.ArtifactAvailableCondition: metav1.ConditionFalse,
+	} {
+		if condition := meta.FindStatusCondition(plugin.Status.Conditions, conditionType); condition == nil || condition.Status != status {
+			t.Errorf("expected %s condition %s, got %v", conditionType, status, condition)
+		}
+	}
+	if ready := meta.FindStatusCondition(plugin.Status.Conditions, v1alpha1.ReadyCondition); ready.Reason != "ImagePullError" {
+		t.Errorf("expected the reason of the PluginInstalled condition, got %s", ready.Reason)
+	}
+
+	setProgressingCondition(plugin, "linux/amd64", progressPhaseExtracting)
+	if !meta.IsStatusConditionTrue(plugin.Status.Conditions, v1alpha1.ProgressingCondition) {
+		t.Error("expected the plugin to be progressing")
+	}
+
+	if !setStatusCondition(plugin, metav1.Condition{Status: metav1.ConditionTrue, Reason: "Installed", Message: "plugin tool is ready to be served"}) {
+		t.Fatal("expected the conditions to change")
+	}
+	for _, conditionType := range []string{v1alpha1.ReadyCondition, v1alpha1.ArtifactAvailableCondition} {
+		if !meta.IsStatusConditionTrue(plugin.Status.Conditions, conditionType) {
+			t.Errorf("expected %s condition to be true", conditionType)
+		}
+	}
+	if meta.IsStatusConditionTrue(plugin.Status.Conditions, v1alpha1.ProgressingCondition) {
+		t.Error("expected the sync to be completed")
+	}
+	if setStatusCondition(plugin, metav1.Condition{Status: metav1.ConditionTrue, Reason: "Installed", Message: "plugin tool is ready to be served"}) {
+		t.Error("expected the conditions to be unchanged")
+	}
+	if meta.IsStatusConditionTrue(plugin.Status.Conditions, v1alpha1.PausedCondition) {
+		t.Error("expected the plugin not to be paused")
+	}
+
+	plugin.Spec.Paused = true
+	if !setPausedCondition(plugin) || !meta.IsStatusConditionTrue(plugin.Status.Conditions, v1alpha1.PausedCondition) {
+		t.Error("expected the plugin to be paused")
+	}
+	if !meta.IsStatusConditionTrue(plugin.Status.Conditions, v1alpha1.ArtifactAvailableCondition) {
+		t.Error("expected the artifacts of the paused plugin to be served")
+	}
+	plugin.Spec.Paused = false
+	if !setStatusCondition(plugin, metav1.Condition{Status: metav1.ConditionTrue, Reason: "Installed", Message: "plugin tool is ready to be served"}) {
+		t.Error("expected the plugin to be resumed")
+	}
+}
+
+func TestValidatePlugin(t *testing.T) {
+	newPlugin := func() *v1alpha1.Plugin {
+		plugin := &v1alpha1.Plugin{Spec: v1alpha1.PluginSpec{
+			ShortDescription: "tool",
+			Version:          "v1.2.0",
+			Platforms: []v1alpha1.PluginPlatform{
+				{Platform: "linux/amd64", Image: "quay.io/org/tool:v1.2.0", Files: []v1alpha1.FileLocation{{From: "/usr/bin/tool", To: "."}}},
+				{Platform: "linux/arm64", Image: "imagestreamtag://tools/tool:v1.2.0", Files: []v1alpha1.FileLocation{{From: "/usr/bin/tool", To: "."}}},
+			},
+		}}
+		plugin.Name = "tool"
+		return plugin
+	}
+	if err := ValidatePlugin(newPlugin()); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	// the bin is independent of the name of the plugin
+	renamed := newPlugin()
+	renamed.Spec.Platforms[0].Bin = "kubectl-acme_tool"
+	renamed.Spec.Platforms[1].Bin = "bin/oc-acme"
+	if err := ValidatePlugin(renamed); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	// the archives are published instead of the files of an image
+	archive := newPlugin()
+	archive.Spec.Platforms[0] = v1alpha1.PluginPlatform{
+		Platform: "linux/amd64",
+		URL:      "https://github.com/org/tool/releases/download/v1.2.0/tool_linux_amd64.tar.gz",
+		Sha256:   strings.Repeat("ab", 32),
+		Files:    []v1alpha1.FileLocation{{From: "tool", To: "."}},
+	}
+	if err := ValidatePlugin(archive); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	// the platforms without image inherit the image of the spec
+	inherited := newPlugin()
+	inherited.Spec.Image = "quay.io/org/tool:v1.2.0"
+	inherited.Spec.Platforms[0].Image = ""
+	if err := ValidatePlugin(inherited); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if len(inherited.Spec.Platforms[0].Image) > 0 {
+		t.Errorf("expected the image to be inherited without being set, got %s", inherited.Spec.Platforms[0].Image)
+	}
+	inheritImages(inherited)
+	if inherited.Spec.Platforms[0].Image != inherited.Spec.Image || inherited.Spec.Platforms[1].Image != "imagestreamtag://tools/tool:v1.2.0" {
+		t.Errorf("unexpected images %s and %s", inherited.Spec.Platforms[0].Image, inherited.Spec.Platforms[1].Image)
+	}
+
+	defer func(blocked []string) { image.BlockedRegistries = blocked }(image.BlockedRegistries)
+	image.BlockedRegistries = []string{"docker.io"}
+	for name, tc := range map[string]struct {
+		modify func(*v1alpha1.Plugin)
+		err    string
+	}{
+		"name":                {func(p *v1alpha1.Plugin) { p.Name = "tool.sh" }, "invalid plugin name"},
+		"version":             {func(p *v1alpha1.Plugin) { p.Spec.Version = "v1" }, "should be in v0.0.0 format"},
+		"malformed image":     {func(p *v1alpha1.Plugin) { p.Spec.Platforms[0].Image = "quay.io/org/Tool:v1.2.0" }, "invalid image"},
+		"image stream tag":    {func(p *v1alpha1.Plugin) { p.Spec.Platforms[1].Image = "imagestreamtag://tool" }, "invalid image stream tag"},
+		"disallowed registry": {func(p *v1alpha1.Plugin) { p.Spec.Platforms[0].Image = "docker.io/org/tool:v1.2.0" }, "registry docker.io is blocked"},
+		"duplicate platform":  {func(p *v1alpha1.Plugin) { p.Spec.Platforms[1].Platform = "linux/amd64" }, "platform linux/amd64 is set more than once"},
+		"platform":            {func(p *v1alpha1.Plugin) { p.Spec.Platforms[1].Platform = "linux" }, "invalid platform linux"},
+		"files":               {func(p *v1alpha1.Plugin) { p.Spec.Platforms[0].Files = nil }, "platform linux/amd64 has no files"},
+		"absolute bin":        {func(p *v1alpha1.Plugin) { p.Spec.Platforms[0].Bin = "/usr/bin/tool" }, "invalid bin /usr/bin/tool"},
+		"escaping bin":        {func(p *v1alpha1.Plugin) { p.Spec.Platforms[1].Bin = "../tool" }, "invalid bin ../tool"},
+		"archive url": {func(p *v1alpha1.Plugin) {
+			p.Spec.Platforms[0] = v1alpha1.PluginPlatform{Platform: "linux/amd64", URL: "http://example.com/tool.tar.gz", Sha256: strings.Repeat("ab", 32), Files: []v1alpha1.FileLocation{{From: "tool"}}}
+		}, "invalid url http://example.com/tool.tar.gz"},
+		"archive checksum": {func(p *v1alpha1.Plugin) {
+			p.Spec.Platforms[0] = v1alpha1.PluginPlatform{Platform: "linux/amd64", URL: "https://example.com/tool.tar.gz", Files: []v1alpha1.FileLocation{{From: "tool"}}}
+		}, "invalid sha256"},
+		"archive and image": {func(p *v1alpha1.Plugin) {
+			p.Spec.Platforms[0].URL = "https://example.com/tool.tar.gz"
+			p.Spec.Platforms[0].Sha256 = strings.Repeat("ab", 32)
+		}, "is set along with url"},
+		"archive files": {func(p *v1alpha1.Plugin) {
+			p.Spec.Platforms[0] = v1alpha1.PluginPlatform{Platform: "linux/amd64", URL: "https://example.com/tool.tar.gz", Sha256: strings.Repeat("ab", 32), Files: []v1alpha1.FileLocation{{From: "/usr/bin/tool"}}}
+		}, "invalid file /usr/bin/tool"},
+		"no image": {func(p *v1alpha1.Plugin) { p.Spec.Platforms[0].Image = "" }, "platform linux/amd64 has no image, url or github"},
+		"category": {func(p *v1alpha1.Plugin) { p.Spec.Categories = []string{"Networking"} }, "invalid category Networking"},
+		"retention": {func(p *v1alpha1.Plugin) {
+			p.Spec.Retention = &v1alpha1.VersionRetention{MaxAge: &metav1.Duration{Duration: -time.Hour}}
+		}, "invalid retention maxAge -1h0m0s"},
+		"resync interval": {func(p *v1alpha1.Plugin) {
+			p.Spec.ResyncInterval = &metav1.Duration{Duration: 10 * time.Second}
+		}, "invalid resyncInterval 10s"},
+		"inherited image": {func(p *v1alpha1.Plugin) {
+			p.Spec.Image = "docker.io/org/tool:v1.2.0"
+			p.Spec.Platforms[0].Image = ""
+		}, "registry docker.io is blocked"},
+		"github repository": {func(p *v1alpha1.Plugin) {
+			p.Spec.Platforms[0] = v1alpha1.PluginPlatform{Platform: "linux/amd64", GitHub: &v1alpha1.GitHubRelease{Repository: "kubectx", Asset: "kubectx_*_linux_x86_64.tar.gz"}, Files: []v1alpha1.FileLocation{{From: "kubectx"}}}
+		}, "invalid repository kubectx"},
+		"github asset": {func(p *v1alpha1.Plugin) {
+			p.Spec.Platforms[0] = v1alpha1.PluginPlatform{Platform: "linux/amd64", GitHub: &v1alpha1.GitHubRelease{Repository: "ahmetb/kubectx", Asset: "kubectx_[_linux"}, Files: []v1alpha1.FileLocation{{From: "kubectx"}}}
+		}, "invalid asset pattern"},
+		"github and image": {func(p *v1alpha1.Plugin) {
+			p.Spec.Platforms[0].GitHub = &v1alpha1.GitHubRelease{Repository: "ahmetb/kubectx", Asset: "kubectx_*_linux_x86_64.tar.gz"}
+		}, "image or url is set along with the release of ahmetb/kubectx"},
+		"version platform": {func(p *v1alpha1.Plugin) {
+			p.Spec.Versions = []v1alpha1.PluginVersion{{Version: "v1.1.0", Platforms: []v1alpha1.PluginPlatform{{Platform: "linux/amd64", Image: "quay.io/org/tool:v1.1.0"}}}}
+		}, "platform linux/amd64 of version v1.1.0 has no files"},
+	} {
+		plugin := newPlugin()
+		tc.modify(plugin)
+		if err := ValidatePlugin(plugin); err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("%s: expected %q error, got %v", name, tc.err, err)
+		}
+	}
+}
+
+func TestDefaultPlugin(t *testing.T) {
+	plugin := &v1alpha1.Plugin{Spec: v1alpha1.PluginSpec{
+		Version: "v1.2.0",
+		Platforms: []v1alpha1.PluginPlatform{{
+			Platform: "linux/amd64",
+			Image:    "docker.io/org/tool",
+			Files: []v1alpha1.FileLocation{
+				{From: "/usr/bin/tool", To: "."},
+				{From: "/usr/share/tool/*.md", To: "."},
+				{From: "/usr/share/tool/", To: "."},
+				{From: "/etc/tool.yaml", To: "config"},
+			},
+		}},
+		Versions: []v1alpha1.PluginVersion{{Version: "v1.1.0", Platforms: []v1alpha1.PluginPlatform{
+			{Platform: "linux/amd64", Image: "configmap://tools/tool", Files: []v1alpha1.FileLocation{{From: "/tool"}}, Bin: "kubectl-tool"},
+		}}},
+	}}
+	plugin.Name = "tool"
+	if err := DefaultPlugin(plugin); err != nil {
+		t.Fatal(err)
+	}
+	p := plugin.Spec.Platforms[0]
+	if p.Image != "index.docker.io/org/tool:latest" {
+		t.Errorf("expected the canonical image, got %s", p.Image)
+	}
+	if p.Bin != "tool" {
+		t.Errorf("expected the bin named after the plugin, got %s", p.Bin)
+	}
+	if to := []string{p.Files[0].To, p.Files[1].To, p.Files[2].To, p.Files[3].To}; !slices.Equal(to, []string{"tool", ".", ".", "config"}) {
+		t.Errorf("unexpected destinations %v", to)
+	}
+	v := plugin.Spec.Versions[0].Platforms[0]
+	if v.Image != "configmap://tools/tool" || v.Bin != "kubectl-tool" || v.Files[0].To != "tool" {
+		t.Errorf("unexpected defaults of the platform of the version %v", v)
+	}
+
+	// the platforms of the ConfigMaps can not be listed
+	plugin.Spec.Platforms = append(plugin.Spec.Platforms, v1alpha1.PluginPlatform{Image: "configmap://tools/tool", Files: []v1alpha1.FileLocation{{From: "/tool"}}})
+	if err := DefaultPlugin(plugin); err == nil || !strings.Contains(err.Error(), "set them explicitly") {
+		t.Fatalf("expected the platforms not to be listed, got %v", err)
+	}
+}
+
+// newFakeRegistry returns the reference of the manifest list of the platforms, pushed to a fake registry.
+func newFakeRegistry(t *testing.T, platforms ...v1.Platform) string {
+	t.Helper()
+	server := httptest.NewServer(registry.New(registry.Logger(log.New(io.Discard, "", 0))))
+	t.Cleanup(server.Close)
+	ref, err := name.ParseReference(strings.TrimPrefix(server.URL, "http://") + "/tools/tool:v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var index v1.ImageIndex = empty.Index
+	for i := range platforms {
+		index = mutate.AppendManifests(index, mutate.IndexAddendum{Add: empty.Image, Descriptor: v1.Descriptor{Platform: &platforms[i]}})
+	}
+	if err := remote.WriteIndex(ref, index); err != nil {
+		t.Fatal(err)
+	}
+	return ref.Name()
+}
+
+func TestDefaultPlatforms(t *testing.T) {
+	src := newFakeRegistry(t, v1.Platform{OS: "linux", Architecture: "amd64"}, v1.Platform{OS: "linux", Architecture: "arm64"})
+
+	platforms, err := defaultPlatforms("tool", src, []v1alpha1.PluginPlatform{
+		{Platform: "linux/arm64", Bin: "arm-tool", Files: []v1alpha1.FileLocation{{From: "/usr/bin/arm-tool"}}},
+		{Files: []v1alpha1.FileLocation{{From: "/usr/bin/tool", To: "."}, {From: "/usr/share/tool/*"}, {From: "/opt/tool/"}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the platforms set explicitly are not expanded again, and the expanded ones keep inheriting the image
+	expected := []v1alpha1.PluginPlatform{
+		{Platform: "linux/arm64", Bin: "arm-tool", Files: []v1alpha1.FileLocation{{From: "/usr/bin/arm-tool", To: "arm-tool"}}},
+		{Platform: "linux/amd64", Bin: "tool", Files: []v1alpha1.FileLocation{{From: "/usr/bin/tool", To: "tool"}, {From: "/usr/share/tool/*"}, {From: "/opt/tool/"}}},
+	}
+	if !reflect.DeepEqual(platforms, expected) {
+		t.Fatalf("expected platforms %v, got %v", expected, platforms)
+	}
+
+	// the platforms of the image of the platform take precedence over the inherited one
+	platforms, err = defaultPlatforms("tool", "quay.io/org/missing:v1", []v1alpha1.PluginPlatform{{Image: src, Files: []v1alpha1.FileLocation{{From: "/usr/bin/tool"}}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(platforms) != 2 || platforms[0].Platform != "linux/amd64" || platforms[1].Platform != "linux/arm64" || platforms[0].Image != src {
+		t.Fatalf("expected the platforms of the image %s, got %v", src, platforms)
+	}
+
+	for name, p := range map[string]v1alpha1.PluginPlatform{
+		"archive":       {URL: "https://example.com/tool.tar.gz"},
+		"missing image": {Image: strings.TrimSuffix(src, ":v1") + ":missing"},
+	} {
+		if _, err := defaultPlatforms("tool", "", []v1alpha1.PluginPlatform{p}); err == nil || !strings.Contains(err.Error(), "set them explicitly") {
+			t.Errorf("%s: expected the platforms not to be listed, got %v", name, err)
+		}
+	}
+}
+
+func TestCanonicalImage(t *testing.T) {
+	digest := "sha256:" + strings.Repeat("a", 64)
+	for src, expected := range map[string]string{
+		"docker.io/org/tool":            "index.docker.io/org/tool:latest",
+		"quay.io/org/tool:v1":           "quay.io/org/tool:v1",
+		"quay.io/org/tool:v1@" + digest: "quay.io/org/tool@" + digest,
+		"configmap://tools/tool":        "configmap://tools/tool",
+		"quay.io/org/Tool:v1":           "quay.io/org/Tool:v1",
+		"image-registry.openshift-image-registry.svc:5000/tools/tool": "image-registry.openshift-image-registry.svc:5000/tools/tool:latest",
+	} {
+		if got := canonicalImage(src); got != expected {
+			t.Errorf("expected %s for %s, got %s", expected, src, got)
+		}
+	}
+}
+
+func TestConvertPlugin(t *testing.T) {
+	plugin := &v1alpha1.Plugin{
+		TypeMeta: metav1.TypeMeta{APIVersion: v1alpha1.GroupVersion.String(), Kind: "Plugin"},
+		Spec: v1alpha1.PluginSpec{
+			Version:  "v1.2.0",
+			Channels: []v1alpha1.PluginChannel{{Name: v1alpha1.ChannelStable, Version: "v1.1.0"}},
+			Versions: []v1alpha1.PluginVersion{{Version: "v1.1.0", Platforms: []v1alpha1.PluginPlatform{
+				{Platform: "linux/amd64", Image: "configmap://tools/tool", Files: []v1alpha1.FileLocation{{From: "/tool"}}},
+			}}},
+		},
+		Status: v1alpha1.PluginStatus{
+			Conditions: []metav1.Condition{{Type: v1alpha1.ReadyCondition, Status: metav1.ConditionTrue, Reason: "Installed"}},
+		},
+	}
+	plugin.Name = "tool"
+	u, err := runtime.DefaultUnstructuredConverter.ToUnstructured(plugin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, err := (&unstructured.Unstructured{Object: u}).MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	beta, err := ConvertPlugin(raw, "config.openshift.io/v1beta1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	obj := &unstructured.Unstructured{}
+	if err := obj.UnmarshalJSON(beta); err != nil {
+		t.Fatal(err)
+	}
+	if obj.GetAPIVersion() != "config.openshift.io/v1beta1" || obj.GetName() != "tool" {
+		t.Errorf("unexpected converted plugin %s %s", obj.GetAPIVersion(), obj.GetName())
+	}
+	// the plugins of the storage version are read by the controller without losing any field
+	if err := verifyRoundTrip(obj); err != nil {
+		t.Errorf("expected the plugin to round-trip, got %v", err)
+	}
+
+	alpha, err := ConvertPlugin(beta, "config.openshift.io/v1alpha1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := obj.UnmarshalJSON(alpha); err != nil {
+		t.Fatal(err)
+	}
+	converted := toPlugin(obj)
+	if converted == nil {
+		t.Fatal("expected the plugin to be converted back")
+	}
+	if converted.APIVersion != v1alpha1.GroupVersion.String() || !reflect.DeepEqual(converted.Spec, plugin.Spec) || !reflect.DeepEqual(converted.Status, plugin.Status) {
+		t.Errorf("plugin does not round-trip, got %#v", converted)
+	}
+
+	if _, err := ConvertPlugin(raw, "config.openshift.io/v1"); err == nil {
+		t.Error("expected the conversion to an unknown version to fail")
+	}
+}
+
+func TestNamespacedPlugins(t *testing.T) {
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	namespacedIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{nameIndex: pluginName})
+	created := time.Now()
+	add := func(indexer cache.Indexer, namespace, name, version string, age time.Duration) {
+		plugin := &v1alpha1.Plugin{Spec: v1alpha1.PluginSpec{Version: version}}
+		plugin.Namespace, plugin.Name = namespace, name
+		plugin.CreationTimestamp = metav1.NewTime(created.Add(-age))
+		u, err := runtime.DefaultUnstructuredConverter.ToUnstructured(plugin)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := indexer.Add(&unstructured.Unstructured{Object: u}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	add(namespacedIndexer, "team-b", "tool", "v1.0.0", time.Hour)
+	add(namespacedIndexer, "team-a", "tool", "v2.0.0", time.Hour)
+	add(namespacedIndexer, "team-c", "tool", "v3.0.0", 2*time.Hour)
+	c := &Controller{
+		lister:            cache.NewGenericLister(indexer, v1alpha1.GroupVersion.WithResource("plugins").GroupResource()),
+		namespacedIndexer: namespacedIndexer,
+	}
+
+	// the oldest NamespacedPlugin takes precedence, then the namespaces in order
+	plugins, err := c.namespacedPlugins("tool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var namespaces []string
+	for _, p := range plugins {
+		namespaces = append(namespaces, p.Namespace)
+	}
+	if !slices.Equal(namespaces, []string{"team-c", "team-a", "team-b"}) {
+		t.Errorf("unexpected precedence %v", namespaces)
+	}
+	obj, err := c.getIndexedPlugin("tool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plugin := toPlugin(obj); plugin == nil || plugin.Namespace != "team-c" {
+		t.Errorf("expected the namespaced plugin of team-c, got %v", obj)
+	}
+
+	// the cluster Plugin takes precedence over the NamespacedPlugins
+	add(indexer, "", "tool", "v4.0.0", 0)
+	obj, err = c.getIndexedPlugin("tool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plugin := toPlugin(obj); plugin == nil || len(plugin.Namespace) > 0 || plugin.Spec.Version != "v4.0.0" {
+		t.Errorf("expected the cluster plugin, got %v", obj)
+	}
+	if _, err := c.getIndexedPlugin("other"); err == nil {
+		t.Error("expected the plugin not to be found")
+	}
+}
+
+func TestValidateNamespace(t *testing.T) {
+	plugin := &v1alpha1.Plugin{Spec: v1alpha1.PluginSpec{
+		Platforms: []v1alpha1.PluginPlatform{{
+			Platform:        "linux/amd64",
+			Image:           "imagestreamtag://team-a/tool:latest",
+			ImagePullSecret: "pull-secret",
+			Credentials:     []v1alpha1.CredentialSource{{Type: v1alpha1.CredentialSourceServiceAccount, ServiceAccount: "team-a/builder"}},
+		}},
+	}}
+	plugin.Namespace, plugin.Name = "team-a", "tool"
+	if err := validateNamespace(plugin); err != nil {
+		t.Errorf("expected the references of the namespace to be allowed, got %v", err)
+	}
+	qualifyReferences(plugin)
+	if p := plugin.Spec.Platforms[0]; p.ImagePullSecret != "team-a/pull-secret" || p.Credentials[0].ServiceAccount != "team-a/builder" {
+		t.Errorf("unexpected qualified references %v", p)
+	}
+
+	plugin.Spec.Versions = []v1alpha1.PluginVersion{{Version: "v1.0.0", Platforms: []v1alpha1.PluginPlatform{{
+		Platform:    "linux/amd64",
+		Image:       "configmap://team-b/tool",
+		ProxySecret: "openshift-cli-manager-operator/proxy",
+		Credentials: []v1alpha1.CredentialSource{{Type: v1alpha1.CredentialSourceGlobal}},
+	}}}}
+	err := validateNamespace(plugin)
+	for _, message := range []string{"config map configmap://team-b/tool", "secret openshift-cli-manager-operator/proxy", "global pull secret"} {
+		if err == nil || !strings.Contains(err.Error(), message) {
+			t.Errorf("expected %q to be rejected, got %v", message, err)
+		}
+	}
+
+	// the cluster Plugins are not restricted
+	plugin.Namespace = ""
+	if err := validateNamespace(plugin); err != nil {
+		t.Errorf("expected the cluster plugin to be allowed, got %v", err)
+	}
+}
+
+func TestMirrorPlugin(t *testing.T) {
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	plugin := &v1alpha1.Plugin{}
+	plugin.Name = "published"
+	u, err := runtime.DefaultUnstructuredConverter.ToUnstructured(plugin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := indexer.Add(&unstructured.Unstructured{Object: u}); err != nil {
+		t.Fatal(err)
+	}
+	repositories := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	created := time.Now()
+	older := &v1beta1.PluginRepository{}
+	older.Name = "older"
+	older.CreationTimestamp = metav1.NewTime(created.Add(-time.Hour))
+	if err := repositories.Add(older); err != nil {
+		t.Fatal(err)
+	}
+	repository := &v1beta1.PluginRepository{}
+	repository.Name = "upstream"
+	repository.CreationTimestamp = metav1.NewTime(created)
+	repo, err := git.PrepareLocalGit(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := &RepositoryController{
+		plugins: &Controller{
+			lister: cache.NewGenericLister(indexer, v1alpha1.GroupVersion.WithResource("plugins").GroupResource()),
+			repo:   repo,
+		},
+		indexer: repositories,
+	}
+
+	manifest := func(name string) []byte {
+		return []byte("apiVersion: krew.googlecontainertools.github.com/v1alpha2\nkind: Plugin\nmetadata:\n  name: " + name + "\nspec:\n  version: v1.0.0\n")
+	}
+	for _, test := range []struct {
+		name     string
+		manifest []byte
+		invalid  bool
+	}{
+		{name: "tool", manifest: manifest("tool")},
+		{name: "../tool", manifest: manifest("../tool"), invalid: true},
+		{name: "tool", manifest: manifest("other"), invalid: true},
+		{name: "tool", manifest: []byte("spec: ["), invalid: true},
+	} {
+		k, err := r.mirrorPlugin(context.Background(), repository, test.name, test.manifest)
+		if test.invalid {
+			if err == nil {
+				t.Errorf("expected manifest %q of %s to be skipped", test.manifest, test.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if k == nil || k.Annotations[RepositoryAnnotation] != repository.Name {
+			t.Errorf("expected plugin %s to be mirrored from %s, got %v", test.name, repository.Name, k)
+		}
+	}
+
+	// the Plugins take precedence over the mirrored plugins
+	k, err := r.mirrorPlugin(context.Background(), repository, "published", manifest("published"))
+	if err != nil || k != nil {
+		t.Errorf("expected plugin published not to be mirrored, got %v, %v", k, err)
+	}
+
+	// the repositories created first take precedence, the deleted ones do not
+	mirrored := &krew.Plugin{}
+	mirrored.Name = "mirrored"
+	mirrored.Annotations = map[string]string{RepositoryAnnotation: older.Name}
+	if err := repo.Upsert(mirrored.Name, mirrored); err != nil {
+		t.Fatal(err)
+	}
+	if owner := mirroredBy(repo, mirrored.Name); owner != older.Name {
+		t.Errorf("expected plugin mirrored from %s, got %q", older.Name, owner)
+	}
+	k, err = r.mirrorPlugin(context.Background(), repository, mirrored.Name, manifest(mirrored.Name))
+	if err != nil || k != nil {
+		t.Errorf("expected plugin mirrored not to be mirrored again, got %v, %v", k, err)
+	}
+	if !r.precedes("older", repository) {
+		t.Error("expected repository older to take precedence")
+	}
+	if r.precedes("deleted", repository) {
+		t.Error("expected deleted repository not to take precedence")
+	}
+
+	for selector, platform := range map[*metav1.LabelSelector]string{
+		{MatchLabels: map[string]string{"os": "linux", "arch": "amd64"}}: "linux/amd64",
+		{MatchLabels: map[string]string{"os": "darwin"}}:                 "",
+		nil: "",
+	} {
+		if actual := selectorPlatform(selector); actual != platform {
+			t.Errorf("expected platform %q of selector %v, got %q", platform, selector, actual)
+		}
+	}
+}
+
+func TestAliases(t *testing.T) {
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{aliasIndex: pluginAliases})
+	created := time.Now()
+	add := func(name string, age time.Duration, aliases ...string) {
+		plugin := &v1alpha1.Plugin{Spec: v1alpha1.PluginSpec{Aliases: aliases}}
+		plugin.Name = name
+		plugin.CreationTimestamp = metav1.NewTime(created.Add(-age))
+		u, err := runtime.DefaultUnstructuredConverter.ToUnstructured(plugin)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := indexer.Add(&unstructured.Unstructured{Object: u}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	add("tool", time.Hour, "t", "legacy-tool")
+	add("other", 2*time.Hour, "legacy-tool")
+	add("newer", 0, "t")
+	add("t2", 0)
+	add("shadowing", 0, "t2")
+	c := &Controller{
+		lister:  cache.NewGenericLister(indexer, v1alpha1.GroupVersion.WithResource("plugins").GroupResource()),
+		indexer: indexer,
+	}
+
+	// the oldest plugin declaring an alias takes precedence, the plugins named after it over all of them
+	for alias, owner := range map[string]string{"t": "tool", "legacy-tool": "other", "t2": "", "unknown": ""} {
+		actual, err := c.aliasOwner(alias)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if actual != owner {
+			t.Errorf("expected alias %s to be published for %q, got %q", alias, owner, actual)
+		}
+	}
+
+	for aliases, err := range map[string]string{
+		"t,legacy-tool": "",
+		"tool":          "alias tool is the name of the plugin",
+		"t,t":           "alias t is set more than once",
+		"tool_v1-0-0":   "invalid alias tool_v1-0-0",
+		"tool.sh":       "invalid alias tool.sh",
+	} {
+		plugin := &v1alpha1.Plugin{Spec: v1alpha1.PluginSpec{Aliases: strings.Split(aliases, ",")}}
+		plugin.Name = "tool"
+		actual := validateAliases(plugin)
+		if len(err) == 0 && actual != nil {
+			t.Errorf("aliases %s: unexpected error %v", aliases, actual)
+		}
+		if len(err) > 0 && (actual == nil || !strings.Contains(actual.Error(), err)) {
+			t.Errorf("aliases %s: expected %q error, got %v", aliases, err, actual)
+		}
+	}
+}
+
+func TestReleaseAsset(t *testing.T) {
+	release := &image.Release{Tag: "v0.9.5", Assets: []image.ReleaseAsset{
+		{Name: "checksums.txt"},
+		{Name: "kubectx_v0.9.5_linux_x86_64.tar.gz"},
+		{Name: "kubectx_v0.9.5_linux_arm64.tar.gz"},
+		{Name: "kubens_v0.9.5_linux_x86_64.tar.gz"},
+	}}
+	for pattern, expected := range map[string]string{
+		"kubectx_*_linux_x86_64.tar.gz": "kubectx_v0.9.5_linux_x86_64.tar.gz",
+		"kubectx_v0.9.5_linux_arm64.*":  "kubectx_v0.9.5_linux_arm64.tar.gz",
+		"kube*_linux_x86_64.tar.gz":     "",
+		"kubectx_*_darwin_*":            "",
+	} {
+		asset, err := releaseAsset(release, pattern)
+		switch {
+		case len(expected) == 0 && err == nil:
+			t.Errorf("%s: expected an error, got asset %s", pattern, asset.Name)
+		case len(expected) > 0 && (err != nil || asset.Name != expected):
+			t.Errorf("%s: expected asset %s, got %v %v", pattern, expected, asset, err)
+		}
+	}
+
+	checksum := strings.Repeat("ab", 32)
+	checksums := []byte(strings.Repeat("cd", 32) + "  kubens_v0.9.5_linux_x86_64.tar.gz\n" + checksum + " *kubectx_v0.9.5_linux_x86_64.tar.gz\n")
+	if actual := assetChecksum(checksums, "kubectx_v0.9.5_linux_x86_64.tar.gz"); actual != checksum {
+		t.Errorf("expected checksum %s, got %q", checksum, actual)
+	}
+	if actual := assetChecksum(checksums, "kubectx_v0.9.5_linux_arm64.tar.gz"); len(actual) > 0 {
+		t.Errorf("expected no checksum, got %q", actual)
+	}
+}
+
+func TestRetainVersions(t *testing.T) {
+	now := time.Now()
+	plugin := &v1alpha1.Plugin{}
+	plugin.Spec.Version = "v1.3.0"
+	for _, version := range []string{"v1.0.0", "v1.2.0", "v1.1.0", "v1.4.0-rc.0"} {
+		plugin.Spec.Versions = append(plugin.Spec.Versions, v1alpha1.PluginVersion{Version: version})
+	}
+	published := metav1.NewTime(now.Add(-48 * time.Hour))
+	recent := metav1.NewTime(now.Add(-time.Hour))
+	plugin.Status.Versions = []v1alpha1.PluginVersionStatus{
+		{Version: "v1.0.0", PublishedTime: &published},
+		{Version: "v1.1.0", PublishedTime: &published},
+		{Version: "v1.2.0", PublishedTime: &recent},
+	}
+	versions := func(versions []v1alpha1.PluginVersion) []string {
+		var names []string
+		for _, v := range versions {
+			names = append(names, v.Version)
+		}
+		return names
+	}
+
+	retained, retired, expiry := retainVersions(plugin, -1, 0, now)
+	if len(retained) != 4 || len(retired) > 0 || expiry != nil {
+		t.Errorf("expected all the versions to be kept without retention, got %v and %v", versions(retained), retired)
+	}
+	// the newest superseded versions are kept, and the newer versions are never retired
+	retained, retired, _ = retainVersions(plugin, 1, 0, now)
+	if !reflect.DeepEqual(versions(retained), []string{"v1.2.0", "v1.4.0-rc.0"}) || !reflect.DeepEqual(retired, []string{"v1.0.0", "v1.1.0"}) {
+		t.Errorf("unexpected retained versions %v and retired versions %v", versions(retained), retired)
+	}
+	// the versions published for longer than the max age are retired, the plugin is revisited for the next one
+	retained, retired, expiry = retainVersions(plugin, -1, 24*time.Hour, now)
+	if !reflect.DeepEqual(versions(retained), []string{"v1.2.0", "v1.4.0-rc.0"}) || !reflect.DeepEqual(retired, []string{"v1.0.0", "v1.1.0"}) {
+		t.Errorf("unexpected retained versions %v and retired versions %v", versions(retained), retired)
+	}
+	if expiry == nil || !expiry.Equal(recent.Add(24*time.Hour)) {
+		t.Errorf("expected the plugin to be revisited once v1.2.0 is retired, got %v", expiry)
+	}
+	// the versions the channels point at are kept
+	plugin.Spec.Channels = []v1alpha1.PluginChannel{{Name: v1alpha1.ChannelStable, Version: "v1.0.0"}}
+	retained, retired, _ = retainVersions(plugin, 0, 0, now)
+	if !reflect.DeepEqual(versions(retained), []string{"v1.0.0", "v1.4.0-rc.0"}) || !reflect.DeepEqual(retired, []string{"v1.2.0", "v1.1.0"}) {
+		t.Errorf("unexpected retained versions %v and retired versions %v", versions(retained), retired)
+	}
+}
+
+// newPrioritizedPlugin returns the plugin with the priority, labeled with the shard if set.
+func newPrioritizedPlugin(name string, priority int32, shard string) *v1alpha1.Plugin {
+	plugin := &v1alpha1.Plugin{Spec: v1alpha1.PluginSpec{Priority: priority}}
+	plugin.Name = name
+	if len(shard) > 0 {
+		plugin.Labels = map[string]string{ShardLabel: shard}
+	}
+	return plugin
+}
+
+func TestSyncPlatforms(t *testing.T) {
+	var platforms []versionPlatform
+	order := map[string]int{}
+	for i, arch := range []string{"amd64", "arm64", "ppc64le", "s390x", "riscv64"} {
+		platforms = append(platforms, versionPlatform{PluginPlatform: v1alpha1.PluginPlatform{Platform: "linux/" + arch}})
+		order["linux/"+arch] = i
+	}
+	var lock sync.Mutex
+	running, maxRunning := 0, 0
+	results, err := syncPlatforms(2, platforms, func(p versionPlatform) (platformResult, error) {
+		lock.Lock()
+		running++
+		maxRunning = max(maxRunning, running)
+		lock.Unlock()
+		// the first platforms finish last
+		time.Sleep(time.Duration(len(platforms)-order[p.Platform]) * 5 * time.Millisecond)
+		lock.Lock()
+		running--
+		lock.Unlock()
+		if p.Platform == "linux/ppc64le" || p.Platform == "linux/riscv64" {
+			return platformResult{}, fmt.Errorf("pulling %s failed", p.Platform)
+		}
+		return platformResult{platform: &krew.Platform{Bin: p.Platform}}, nil
+	})
+	if maxRunning != 2 {
+		t.Errorf("expected 2 platforms to be synced at once, got %d", maxRunning)
+	}
+	if err == nil || !strings.Contains(err.Error(), "pulling linux/ppc64le failed") || !strings.Contains(err.Error(), "pulling linux/riscv64 failed") {
+		t.Fatalf("expected the errors of both platforms, got %v", err)
+	}
+	// the results are kept in the order of the platforms, whatever order they are synced in
+	for i, result := range results {
+		if expected := platforms[i].Platform; result.platform != nil && result.platform.Bin != expected {
+			t.Errorf("%d: expected the result of %s, got %s", i, expected, result.platform.Bin)
+		}
+	}
+	if results[0].platform == nil || results[1].platform == nil || results[3].platform == nil {
+		t.Fatalf("expected the results of the synced platforms, got %v", results)
+	}
+
+	// the platforms are synced one at a time without workers
+	running, maxRunning = 0, 0
+	if _, err := syncPlatforms(0, platforms, func(p versionPlatform) (platformResult, error) {
+		lock.Lock()
+		running++
+		maxRunning = max(maxRunning, running)
+		lock.Unlock()
+		time.Sleep(time.Millisecond)
+		lock.Lock()
+		running--
+		lock.Unlock()
+		return platformResult{}, nil
+	}); err != nil || maxRunning != 1 {
+		t.Fatalf("expected a single platform to be synced at once, got %d %v", maxRunning, err)
+	}
+}
+
+func TestPluginLabel(t *testing.T) {
+	defer func(maxLabels int, labels map[string]struct{}) {
+		MaxPluginMetricLabels, pluginLabels = maxLabels, labels
+	}(MaxPluginMetricLabels, pluginLabels)
+	MaxPluginMetricLabels, pluginLabels = 2, map[string]struct{}{}
+
+	for _, tc := range []struct {
+		plugin string
+		label  string
+	}{
+		{"first", "first"},
+		{"second", "second"},
+		{"third", otherPluginsLabel},
+		// the plugins keep their label once it is given
+		{"first", "first"},
+		{"fourth", otherPluginsLabel},
+	} {
+		if label := pluginLabel(tc.plugin); label != tc.label {
+			t.Errorf("expected label %s for plugin %s, got %s", tc.label, tc.plugin, label)
+		}
+	}
+}
+
+func TestOwnsPlugin(t *testing.T) {
+	shards := make([]*Controller, 3)
+	for i := range shards {
+		shards[i] = &Controller{options: Options{Shards: len(shards), ShardID: i}}
+	}
+	// owners returns the shards owning the plugin
+	owners := func(plugin *v1alpha1.Plugin) []int {
+		var ids []int
+		for i, c := range shards {
+			if c.ownsPlugin(plugin) {
+				ids = append(ids, i)
+			}
+		}
+		return ids
+	}
+
+	counts := make([]int, len(shards))
+	for i := 0; i < 30; i++ {
+		plugin := newPrioritizedPlugin(fmt.Sprintf("tool-%d", i), 0, "")
+		ids := owners(plugin)
+		if len(ids) != 1 {
+			t.Fatalf("expected plugin %s to be owned by a single shard, got %v", plugin.Name, ids)
+		}
+		counts[ids[0]]++
+		// the invalid shard labels fall back to the name hash
+		if invalid := owners(newPrioritizedPlugin(plugin.Name, 0, "first")); !slices.Equal(invalid, ids) {
+			t.Errorf("expected plugin %s with an invalid shard label to be owned by shard %v, got %v", plugin.Name, ids, invalid)
+		}
+	}
+	for i, count := range counts {
+		if count == 0 {
+			t.Errorf("expected shard %d to own some of the plugins, got %v", i, counts)
+		}
+	}
+
+	if ids := owners(newPrioritizedPlugin("tool-0", 0, "2")); !slices.Equal(ids, []int{2}) {
+		t.Errorf("expected the plugin to be pinned to shard 2, got %v", ids)
+	}
+	if ids := owners(newPrioritizedPlugin("tool-0", 0, "3")); len(ids) != 0 {
+		t.Errorf("expected the plugin pinned to a missing shard not to be owned, got %v", ids)
+	}
+	if !(&Controller{options: Options{Shards: 1}}).ownsPlugin(newPrioritizedPlugin("tool-0", 0, "2")) {
+		t.Error("expected the single shard to own all the plugins")
+	}
+}
+
+func TestSyncPriorities(t *testing.T) {
+	c := &Controller{options: Options{Shards: 2, ShardID: 0}}
+	priorities := newSyncPriorities(c.ownsPlugin)
+	priorities.queued(newPrioritizedPlugin("tool", 0, "0"))
+	priorities.queued(newPrioritizedPlugin("oc-mirror", 100, "0"))
+	priorities.queued(newPrioritizedPlugin("oc-debug", 100, "0"))
+	// the plugins of the other shards are not synced by the shard
+	priorities.queued(newPrioritizedPlugin("oc-other", 1000, "1"))
+
+	if !priorities.outranked("tool", 0) {
+		t.Error("expected tool to be deferred for the plugins of a higher priority")
+	}
+	if priorities.outranked("oc-mirror", 100) {
+		t.Error("expected oc-mirror not to be deferred for the plugins of the same priority or of other shards")
+	}
+	priorities.synced("oc-mirror")
+	if !priorities.outranked("tool", 0) {
+		t.Error("expected tool to be deferred until every plugin of a higher priority is synced")
+	}
+	// the plugins queued again are counted once, with their last priority
+	priorities.queued(newPrioritizedPlugin("oc-debug", 0, "0"))
+	if priorities.outranked("tool", 0) {
+		t.Error("expected tool to be synced once the plugins of a higher priority are synced")
+	}
+	if priority, ok := priorities.priority("tool"); !ok || priority != 0 {
+		t.Errorf("expected tool to be queued with priority 0, got %d", priority)
+	}
+	if _, ok := priorities.priority("oc-other"); ok {
+		t.Error("expected the plugin of another shard not to be tracked")
+	}
+	priorities.synced("tool")
+	priorities.synced("oc-debug")
+	if len(priorities.pending) != 0 || len(priorities.counts) != 0 {
+		t.Errorf("expected no pending plugins once synced, got %v %v", priorities.pending, priorities.counts)
+	}
+}
+
+// delayingQueue records the plugins queued after a delay.
+type delayingQueue struct {
+	workqueue.RateLimitingInterface
+	delayed map[string]time.Duration
+}
+
+func (q *delayingQueue) AddAfter(item interface{}, duration time.Duration) {
+	q.delayed[item.(string)] = duration
+}
+
+// queueSyncContext is the sync context of the queue key.
+type queueSyncContext struct {
+	queue workqueue.RateLimitingInterface
+	key   string
+}
+
+func (s *queueSyncContext) Queue() workqueue.RateLimitingInterface { return s.queue }
+func (s *queueSyncContext) QueueKey() string                       { return s.key }
+func (s *queueSyncContext) Recorder() events.Recorder              { return events.NewInMemoryRecorder("test") }
+
+func TestSyncIsDeferred(t *testing.T) {
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	for _, plugin := range []*v1alpha1.Plugin{
+		newPrioritizedPlugin("tool", 0, ""),
+		newPrioritizedPlugin("oc-mirror", 100, ""),
+	} {
+		u, err := runtime.DefaultUnstructuredConverter.ToUnstructured(plugin)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := indexer.Add(&unstructured.Unstructured{Object: u}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	c := &Controller{
+		lister:  cache.NewGenericLister(indexer, v1alpha1.GroupVersion.WithResource("plugins").GroupResource()),
+		indexer: indexer,
+	}
+	c.priorities = newSyncPriorities(c.ownsPlugin)
+	c.priorities.queued(newPrioritizedPlugin("oc-mirror", 100, ""))
+	queue := &delayingQueue{RateLimitingInterface: workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter()), delayed: map[string]time.Duration{}}
+
+	// tool is resynced without event, so its priority is looked up in the cache
+	if err := c.sync(context.Background(), &queueSyncContext{queue: queue, key: "tool"}); err != nil {
+		t.Fatal(err)
+	}
+	if delay, ok := queue.delayed["tool"]; !ok || delay != priorityDeferral {
+		t.Fatalf("expected tool to be requeued after %s, got %v", priorityDeferral, queue.delayed)
+	}
+	if _, ok := c.priorities.priority("oc-mirror"); !ok {
+		t.Fatal("expected oc-mirror to stay queued")
+	}
+
+	c.priorities.synced("oc-mirror")
+	if c.deferSync("tool") {
+		t.Error("expected tool to be synced once oc-mirror is synced")
+	}
+	if c.deferSync("deleted") {
+		t.Error("expected the deleted plugins not to be deferred")
+	}
+}
@@ -0,0 +1,43 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/openshift/cli-manager/api/v1alpha1"
+	"github.com/openshift/cli-manager/api/v1beta1"
+)
+
+// ConvertPlugin converts the JSON Plugin to the API version.
+func ConvertPlugin(raw []byte, apiVersion string) ([]byte, error) {
+	typeMeta := metav1.TypeMeta{}
+	if err := json.Unmarshal(raw, &typeMeta); err != nil {
+		return nil, fmt.Errorf("invalid plugin: %w", err)
+	}
+	if typeMeta.APIVersion == apiVersion {
+		return raw, nil
+	}
+	switch {
+	case typeMeta.APIVersion == v1alpha1.GroupVersion.String() && apiVersion == v1beta1.GroupVersion.String():
+		src, dst := &v1alpha1.Plugin{}, &v1beta1.Plugin{}
+		if err := json.Unmarshal(raw, src); err != nil {
+			return nil, fmt.Errorf("invalid plugin: %w", err)
+		}
+		if err := src.ConvertTo(dst); err != nil {
+			return nil, err
+		}
+		return json.Marshal(dst)
+	case typeMeta.APIVersion == v1beta1.GroupVersion.String() && apiVersion == v1alpha1.GroupVersion.String():
+		src, dst := &v1beta1.Plugin{}, &v1alpha1.Plugin{}
+		if err := json.Unmarshal(raw, src); err != nil {
+			return nil, fmt.Errorf("invalid plugin: %w", err)
+		}
+		if err := dst.ConvertFrom(src); err != nil {
+			return nil, err
+		}
+		return json.Marshal(dst)
+	}
+	return nil, fmt.Errorf("conversion of plugins from %s to %s is not supported", typeMeta.APIVersion, apiVersion)
+}
@@ -0,0 +1,359 @@
+package controller
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/openshift/cli-manager/api/v1alpha1"
+	"github.com/openshift/cli-manager/pkg/image"
+)
+
+const (
+	// operatorNamespace is the namespace the controller is deployed to.
+	operatorNamespace = "openshift-cli-manager-operator"
+
+	// CredentialsExpiryAnnotation is the RFC 3339 time the credentials of an image pull Secret expire at.
+	CredentialsExpiryAnnotation = "cli-manager.openshift.io/credentials-expire-at"
+
+	// credentialsExpiringCondition reports whether the image pull credentials of the plugin are expiring.
+	credentialsExpiringCondition = "CredentialsExpiring"
+
+	// globalPullSecret is the global pull secret of the cluster, see v1alpha1.CredentialSourceGlobal.
+	globalPullSecret = "openshift-config/pull-secret"
+)
+
+// credential is a source of the registry credentials an image is pulled with.
+type credential struct {
+	// source describes the source in the status of the plugin, i.e. Secret namespace/name
+	source string
+	// auth is the base64 encoded "user:password" of the registry, or empty to pull without credentials
+	auth string
+}
+
+// secretTypeError is returned for the Secrets that are not image pull Secrets.
+type secretTypeError struct {
+	secretType corev1.SecretType
+}
+
+func (e *secretTypeError) Error() string {
+	return fmt.Sprintf("image pull secret type %s is not supported, only kubernetes.io/dockercfg and kubernetes.io/dockerconfigjson are supported", e.secretType)
+}
+
+// pullSecretAuth returns the auth of the registry of the image in the image pull Secret,
+// which is empty if the Secret has no credentials for the registry.
+func pullSecretAuth(secret *corev1.Secret, imageRef string) (string, error) {
+	switch secret.Type {
+	case corev1.SecretTypeDockercfg:
+		// set the .dockercfg auth information for the image puller
+		return string(secret.Data[corev1.DockerConfigKey]), nil
+	case corev1.SecretTypeDockerConfigJson:
+		var dcr *DockerConfigJson
+		err := json.Unmarshal(secret.Data[corev1.DockerConfigJsonKey], &dcr)
+		if err != nil || dcr == nil {
+			return "", fmt.Errorf("unable to parse dockerjson %s to json", secret.Name)
+		}
+		var auth string
+		for key, val := range dcr.Auths {
+			if strings.Contains(imageRef, key+"/") {
+				auth = val.Auth
+			}
+		}
+		return auth, nil
+	default:
+		return "", &secretTypeError{secretType: secret.Type}
+	}
+}
+
+// credentialChain returns the credentials of the sources for the registry of the image in order.
+func (c *Controller) credentialChain(ctx context.Context, sources []v1alpha1.CredentialSource, imageRef string) ([]credential, []string) {
+	var chain []credential
+	var skipped []string
+	for _, source := range sources {
+		var refs []string
+		description := string(source.Type)
+		switch source.Type {
+		case v1alpha1.CredentialSourceSecret:
+			description += " " + source.SecretRef
+			if len(source.SecretRef) > 0 {
+				refs = []string{source.SecretRef}
+			}
+		case v1alpha1.CredentialSourceServiceAccount:
+			description += " " + source.ServiceAccount
+			var err error
+			refs, err = c.serviceAccountPullSecrets(ctx, source.ServiceAccount)
+			if err != nil {
+				skipped = append(skipped, fmt.Sprintf("%s: %v", description, err))
+				continue
+			}
+		case v1alpha1.CredentialSourceGlobal:
+			refs = []string{globalPullSecret}
+		default:
+			skipped = append(skipped, fmt.Sprintf("unknown credential source %q", source.Type))
+			continue
+		}
+
+		var auth string
+		var errs []string
+		for _, ref := range refs {
+			secret, err := c.getSecret(ctx, ref)
+			if err == nil {
+				auth, err = pullSecretAuth(secret, imageRef)
+			}
+			if err != nil {
+				errs = append(errs, fmt.Sprintf("secret %s: %v", ref, err))
+			}
+			if len(auth) > 0 {
+				break
+			}
+		}
+		if len(auth) == 0 {
+			reason := fmt.Sprintf("%s: no credentials for the registry of %s", description, imageRef)
+			if len(errs) > 0 {
+				reason += " (" + strings.Join(errs, ", ") + ")"
+			}
+			skipped = append(skipped, reason)
+			continue
+		}
+		chain = append(chain, credential{source: description, auth: auth})
+	}
+	return chain, skipped
+}
+
+// serviceAccountPullSecrets returns the image pull Secrets of the service account in namespace/name format.
+func (c *Controller) serviceAccountPullSecrets(ctx context.Context, ref string) ([]string, error) {
+	namespace, name, ok := strings.Cut(ref, "/")
+	if !ok {
+		namespace, name = operatorNamespace, ref
+	}
+	if len(name) == 0 {
+		return nil, fmt.Errorf("service account is not set")
+	}
+	serviceAccount, err := c.client.CoreV1().ServiceAccounts(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	var refs []string
+	for _, secret := range serviceAccount.ImagePullSecrets {
+		refs = append(refs, namespace+"/"+secret.Name)
+	}
+	return refs, nil
+}
+
+// getSecret returns the Secret referenced in namespace/name format.
+func (c *Controller) getSecret(ctx context.Context, ref string) (*corev1.Secret, error) {
+	namespace, secretName, ok := strings.Cut(ref, "/")
+	if !ok {
+		namespace, secretName = operatorNamespace, ref
+	}
+	return c.client.CoreV1().Secrets(namespace).Get(ctx, secretName, metav1.GetOptions{})
+}
+
+// registryHost returns the registry host of the image reference, or an empty
+// string for images that are not pulled from a registry.
+func registryHost(imageRef string) string {
+	if image.IsLocal(imageRef) {
+		return ""
+	}
+	ref, err := name.ParseReference(imageRef)
+	if err != nil {
+		return ""
+	}
+	return ref.Context().RegistryStr()
+}
+
+// clientCertificate returns the client certificate presented to the registry of the image.
+func (c *Controller) clientCertificate(ctx context.Context, p v1alpha1.PluginPlatform, imageRef string) (*tls.Certificate, error) {
+	ref := p.ClientCertificateSecret
+	if len(ref) == 0 {
+		ref = c.options.RegistryClientCertificateSecrets[registryHost(imageRef)]
+	}
+	if len(ref) == 0 {
+		return nil, nil
+	}
+	secret, err := c.getSecret(ctx, ref)
+	if err != nil {
+		return nil, fmt.Errorf("getting client certificate secret %s: %w", ref, err)
+	}
+	cert, err := tls.X509KeyPair(secret.Data[corev1.TLSCertKey], secret.Data[corev1.TLSPrivateKeyKey])
+	if err != nil {
+		return nil, fmt.Errorf("invalid client certificate in secret %s: %w", ref, err)
+	}
+	return &cert, nil
+}
+
+// proxyCredentials returns the proxy URL and the proxy credentials of the platform.
+func (c *Controller) proxyCredentials(ctx context.Context, p v1alpha1.PluginPlatform) (string, *url.Userinfo, error) {
+	ref := p.ProxySecret
+	if len(ref) == 0 && len(p.Proxy) == 0 {
+		ref = c.options.RegistryProxySecret
+	}
+	if len(ref) == 0 {
+		return "", nil, nil
+	}
+	secret, err := c.getSecret(ctx, ref)
+	if err != nil {
+		return "", nil, fmt.Errorf("getting proxy secret %s: %w", ref, err)
+	}
+	if proxyURL, ok := secret.Data["proxyURL"]; ok {
+		if _, err := image.ParseProxy(strings.TrimSpace(string(proxyURL))); err != nil {
+			return "", nil, fmt.Errorf("invalid proxyURL in proxy secret %s: %w", ref, err)
+		}
+		return strings.TrimSpace(string(proxyURL)), nil, nil
+	}
+	username, ok := secret.Data["username"]
+	if !ok {
+		return "", nil, fmt.Errorf("proxy secret %s has neither proxyURL nor username key", ref)
+	}
+	if len(p.Proxy) == 0 && len(image.RegistryProxy) == 0 {
+		return "", nil, fmt.Errorf("proxy secret %s has credentials, but no proxy is configured", ref)
+	}
+	return "", url.UserPassword(string(username), string(secret.Data["password"])), nil
+}
+
+// credentialsExpiry returns the earliest expiry of the registry credentials in the image pull Secret.
+func credentialsExpiry(secret *corev1.Secret) (*time.Time, error) {
+	var earliest *time.Time
+	observe := func(t time.Time) {
+		if earliest == nil || t.Before(*earliest) {
+			earliest = &t
+		}
+	}
+	if value, ok := secret.Annotations[CredentialsExpiryAnnotation]; ok {
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s annotation of secret %s/%s: %w", CredentialsExpiryAnnotation, secret.Namespace, secret.Name, err)
+		}
+		observe(t)
+	}
+
+	auths := DockerConfig{}
+	switch secret.Type {
+	case corev1.SecretTypeDockercfg:
+		_ = json.Unmarshal(secret.Data[corev1.DockerConfigKey], &auths)
+	case corev1.SecretTypeDockerConfigJson:
+		dcr := &DockerConfigJson{}
+		if err := json.Unmarshal(secret.Data[corev1.DockerConfigJsonKey], dcr); err == nil {
+			auths = dcr.Auths
+		}
+	}
+	for _, entry := range auths {
+		if t := tokenExpiry(entry.Auth); t != nil {
+			observe(*t)
+		}
+	}
+	return earliest, nil
+}
+
+// tokenExpiry returns the exp claim of the password of the base64 encoded "user:password" if it is a JWT.
+func tokenExpiry(auth string) *time.Time {
+	decoded, err := base64.StdEncoding.DecodeString(auth)
+	if err != nil {
+		return nil
+	}
+	_, password, ok := strings.Cut(string(decoded), ":")
+	if !ok {
+		return nil
+	}
+	parts := strings.Split(password, ".")
+	if len(parts) != 3 {
+		return nil
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil
+	}
+	claims := struct {
+		Exp *int64 `json:"exp"`
+	}{}
+	if err := json.Unmarshal(payload, &claims); err != nil || claims.Exp == nil {
+		return nil
+	}
+	t := time.Unix(*claims.Exp, 0)
+	return &t
+}
+
+// checkCredentialsExpiry reports the expiry of the image pull Secrets of the plugin.
+func (c *Controller) checkCredentialsExpiry(ctx context.Context, plugin *v1alpha1.Plugin) error {
+	var earliest *time.Time
+	var earliestSecret string
+	var invalid []string
+	for _, p := range plugin.Spec.Platforms {
+		if len(p.ImagePullSecret) == 0 {
+			continue
+		}
+		secret, err := c.getSecret(ctx, p.ImagePullSecret)
+		if err != nil {
+			// reported by the sync of the platform
+			continue
+		}
+		expiry, err := credentialsExpiry(secret)
+		if err != nil {
+			invalid = append(invalid, err.Error())
+			continue
+		}
+		if expiry == nil {
+			continue
+		}
+		observeCredentialsExpiry(secret.Namespace+"/"+secret.Name, *expiry)
+		if earliest == nil || expiry.Before(*earliest) {
+			earliest, earliestSecret = expiry, p.ImagePullSecret
+		}
+	}
+
+	var condition *metav1.Condition
+	switch {
+	case len(invalid) > 0:
+		condition = &metav1.Condition{
+			Status:  metav1.ConditionUnknown,
+			Reason:  "InvalidExpiry",
+			Message: strings.Join(invalid, ", "),
+		}
+	case earliest == nil:
+		// the expiry of the credentials is unknown
+	case !time.Now().Before(*earliest):
+		condition = &metav1.Condition{
+			Status:  metav1.ConditionTrue,
+			Reason:  "CredentialsExpired",
+			Message: fmt.Sprintf("credentials of image pull secret %s expired at %s", earliestSecret, earliest.Format(time.RFC3339)),
+		}
+	case time.Until(*earliest) <= c.options.CredentialsExpiryWarning:
+		condition = &metav1.Condition{
+			Status:  metav1.ConditionTrue,
+			Reason:  "CredentialsExpiringSoon",
+			Message: fmt.Sprintf("credentials of image pull secret %s expire at %s", earliestSecret, earliest.Format(time.RFC3339)),
+		}
+		// revisit the plugin once the credentials expire
+		c.queue.AddAfter(plugin.Name, time.Until(*earliest))
+	default:
+		condition = &metav1.Condition{
+			Status:  metav1.ConditionFalse,
+			Reason:  "CredentialsValid",
+			Message: fmt.Sprintf("credentials of image pull secret %s expire at %s", earliestSecret, earliest.Format(time.RFC3339)),
+		}
+		// revisit the plugin once the expiry is within the warning period
+		c.queue.AddAfter(plugin.Name, time.Until(*earliest)-c.options.CredentialsExpiryWarning)
+	}
+
+	var changed bool
+	if condition == nil {
+		changed = meta.RemoveStatusCondition(&plugin.Status.Conditions, credentialsExpiringCondition)
+	} else {
+		condition.Type = credentialsExpiringCondition
+		changed = setCondition(plugin, *condition)
+	}
+	if !changed {
+		return nil
+	}
+	return updateStatus(ctx, plugin, c.dynamicClient)
+}
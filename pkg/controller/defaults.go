@@ -0,0 +1,113 @@
+package controller
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+
+	"github.com/openshift/cli-manager/api/v1alpha1"
+	"github.com/openshift/cli-manager/pkg/image"
+)
+
+// DefaultPlugin sets the defaults of the platforms of the plugin and of its older versions.
+func DefaultPlugin(plugin *v1alpha1.Plugin) error {
+	platforms, err := defaultPlatforms(plugin.Name, plugin.Spec.Image, plugin.Spec.Platforms)
+	if err != nil {
+		return err
+	}
+	plugin.Spec.Platforms = platforms
+	for i, v := range plugin.Spec.Versions {
+		platforms, err := defaultPlatforms(plugin.Name, v.Image, v.Platforms)
+		if err != nil {
+			return fmt.Errorf("version %s: %w", v.Version, err)
+		}
+		plugin.Spec.Versions[i].Platforms = platforms
+	}
+	return nil
+}
+
+// defaultPlatforms returns the platforms defaulted from the inherited image.
+func defaultPlatforms(pluginName, inheritedImage string, platforms []v1alpha1.PluginPlatform) ([]v1alpha1.PluginPlatform, error) {
+	explicit := map[string]bool{}
+	for _, p := range platforms {
+		explicit[p.Platform] = true
+	}
+	var defaulted []v1alpha1.PluginPlatform
+	for _, p := range platforms {
+		p.Image = canonicalImage(p.Image)
+		if len(p.Bin) == 0 {
+			p.Bin = pluginName
+		}
+		files := make([]v1alpha1.FileLocation, 0, len(p.Files))
+		for _, f := range p.Files {
+			// krew installs the files to their base name in the root, like the ones of a glob or a directory
+			// stripped of leading components, the others are installed to it explicitly
+			if (len(f.To) == 0 || f.To == ".") && f.StripComponents == 0 && !strings.ContainsAny(f.From, "*?[") && !strings.HasSuffix(f.From, "/") {
+				f.To = path.Base(f.From)
+			}
+			files = append(files, f)
+		}
+		p.Files = files
+		if len(p.Platform) > 0 {
+			defaulted = append(defaulted, p)
+			continue
+		}
+		if len(p.URL) > 0 || p.GitHub != nil {
+			return nil, fmt.Errorf("platforms of the archives can not be listed, set them explicitly")
+		}
+		src := p.Image
+		if len(src) == 0 {
+			src = canonicalImage(inheritedImage)
+		}
+		// the webhook has no client to read the imagePullSecret of the platform, so the manifests are fetched
+		// with the registry credentials of the controller. The lookup is not cancelled with the admission
+		// request either, the API server rejects the Plugin once the webhook times out.
+		imagePlatforms, err := image.Platforms(src, image.PullOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("platforms of image %s can not be listed, set them explicitly: %w", src, err)
+		}
+		for _, platform := range imagePlatforms {
+			if explicit[platform] {
+				continue
+			}
+			explicit[platform] = true
+			p.Platform = platform
+			defaulted = append(defaulted, p)
+		}
+	}
+	return defaulted, nil
+}
+
+// canonicalImage returns the fully qualified reference of the image, or the image itself.
+func canonicalImage(src string) string {
+	if image.IsImageStreamTag(src) || image.IsLocal(src) || image.IsConfigMap(src) {
+		return src
+	}
+	ref, err := name.ParseReference(src)
+	if err != nil {
+		return src
+	}
+	return ref.Name()
+}
+
+// inheritImages sets the image of the platforms without image, URL or GitHub release of their own to the
+// image of the spec, or to the image of their version for the older versions.
+func inheritImages(plugin *v1alpha1.Plugin) {
+	inherit := func(src string, platforms []v1alpha1.PluginPlatform) {
+		if len(src) == 0 {
+			return
+		}
+		for i := range platforms {
+			p := &platforms[i]
+			if len(p.Image) == 0 && len(p.URL) == 0 && p.GitHub == nil {
+				p.Image = src
+			}
+		}
+	}
+	inherit(plugin.Spec.Image, plugin.Spec.Platforms)
+	for i := range plugin.Spec.Versions {
+		inherit(plugin.Spec.Versions[i].Image, plugin.Spec.Versions[i].Platforms)
+	}
+}
@@ -0,0 +1,120 @@
+package controller
+
+import (
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8sver "k8s.io/apimachinery/pkg/util/version"
+
+	"github.com/openshift/cli-manager/api/v1alpha1"
+)
+
+// dependencyIndex indexes the plugins by the names of the plugins they depend on, so that
+// they are requeued once their dependencies are created, updated or deleted.
+const dependencyIndex = "dependency"
+
+// pluginDependencies is the index function of dependencyIndex.
+func pluginDependencies(obj interface{}) ([]string, error) {
+	plugin := toPlugin(obj)
+	if plugin == nil {
+		return nil, nil
+	}
+	var keys []string
+	for _, d := range plugin.Spec.Dependencies {
+		keys = append(keys, d.Name)
+	}
+	return keys, nil
+}
+
+// checkDependencies returns the condition the plugin fails with if one of its dependencies is
+// not found or is older than the version it requires, or nil if they are all satisfied.
+func (c *Controller) checkDependencies(plugin *v1alpha1.Plugin) (*metav1.Condition, error) {
+	var missing, unsatisfied []string
+	for _, d := range plugin.Spec.Dependencies {
+		if d.Name == plugin.Name {
+			return &metav1.Condition{
+				Status:  metav1.ConditionFalse,
+				Reason:  "InvalidField",
+				Message: fmt.Sprintf("plugin %s depends on itself", plugin.Name),
+			}, nil
+		}
+		var minVersion *k8sver.Version
+		if len(d.MinVersion) > 0 {
+			var err error
+			minVersion, err = k8sver.ParseSemantic(d.MinVersion)
+			if err != nil {
+				return &metav1.Condition{
+					Status:  metav1.ConditionFalse,
+					Reason:  "InvalidField",
+					Message: fmt.Sprintf("invalid minimum version %s of dependency %s, should be in v0.0.0 format", d.MinVersion, d.Name),
+				}, nil
+			}
+		}
+		obj, err := c.getIndexedPlugin(d.Name)
+		if errors.IsNotFound(err) {
+			missing = append(missing, d.Name)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if minVersion == nil {
+			continue
+		}
+		u, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+		if err != nil {
+			return nil, err
+		}
+		dependency := &v1alpha1.Plugin{}
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(u, dependency); err != nil {
+			return nil, err
+		}
+		version := dependency.Spec.Version
+		if len(dependency.Status.ResolvedVersion) > 0 {
+			version = dependency.Status.ResolvedVersion
+		}
+		if v, err := k8sver.ParseSemantic(version); err != nil || v.LessThan(minVersion) {
+			unsatisfied = append(unsatisfied, fmt.Sprintf("%s %s (%s or later is required)", d.Name, version, d.MinVersion))
+		}
+	}
+	switch {
+	case len(missing) > 0:
+		return &metav1.Condition{
+			Status:  metav1.ConditionFalse,
+			Reason:  "DependencyNotFound",
+			Message: fmt.Sprintf("plugins %s required by plugin %s are not found", strings.Join(missing, ", "), plugin.Name),
+		}, nil
+	case len(unsatisfied) > 0:
+		return &metav1.Condition{
+			Status:  metav1.ConditionFalse,
+			Reason:  "DependencyNotSatisfied",
+			Message: fmt.Sprintf("plugins %s required by plugin %s are too old", strings.Join(unsatisfied, ", "), plugin.Name),
+		}, nil
+	}
+	return nil, nil
+}
+
+// dependencyCaveats appends a note listing the plugins the plugin requires to its caveats,
+// since krew does not install them.
+func dependencyCaveats(caveats string, dependencies []v1alpha1.PluginDependency) string {
+	if len(dependencies) == 0 {
+		return caveats
+	}
+	var names, install []string
+	for _, d := range dependencies {
+		name := d.Name
+		if len(d.MinVersion) > 0 {
+			name += fmt.Sprintf(" (%s or later)", d.MinVersion)
+		}
+		names = append(names, name)
+		install = append(install, "<index>/"+d.Name)
+	}
+	note := fmt.Sprintf("This plugin requires the plugins %s of the same index: kubectl krew install %s", strings.Join(names, ", "), strings.Join(install, " "))
+	if len(caveats) > 0 {
+		caveats += "\n"
+	}
+	return caveats + note
+}
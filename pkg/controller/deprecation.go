@@ -0,0 +1,43 @@
+package controller
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/openshift/cli-manager/api/v1alpha1"
+	"github.com/openshift/cli-manager/pkg/git"
+)
+
+// deprecationNotice returns the notice of the plugin published in the index and sent with the
+// downloads of its artifacts, or empty if it is not deprecated.
+func deprecationNotice(plugin *v1alpha1.Plugin) string {
+	d := plugin.Spec.Deprecation
+	if d == nil {
+		return ""
+	}
+	notice := fmt.Sprintf("Plugin %s is deprecated: %s.", plugin.Name, strings.TrimSuffix(d.Message, "."))
+	if len(d.Replacement) > 0 {
+		notice += fmt.Sprintf(" Use %s instead.", d.Replacement)
+	}
+	if plugin.Spec.ExpiresAt != nil {
+		notice += fmt.Sprintf(" It is unpublished on %s.", plugin.Spec.ExpiresAt.UTC().Format(time.DateOnly))
+	}
+	return notice
+}
+
+// setDeprecations sets the warnings sent with the downloads of the artifacts of the plugin
+// and of its older versions.
+func setDeprecations(plugin *v1alpha1.Plugin) {
+	warnings := map[string]string{}
+	if notice := deprecationNotice(plugin); len(notice) > 0 {
+		warnings[plugin.Name] = notice
+	}
+	for _, v := range plugin.Spec.Versions {
+		p := versionPlugin(plugin, v.Version)
+		if notice := deprecationNotice(p); len(notice) > 0 {
+			warnings[p.Name] = notice
+		}
+	}
+	git.SetDeprecations(plugin.Name, warnings)
+}
@@ -0,0 +1,363 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/yaml"
+
+	"github.com/openshift/cli-manager/api/v1alpha1"
+	"github.com/openshift/cli-manager/pkg/git"
+	"github.com/openshift/cli-manager/pkg/image"
+)
+
+// Kinds of the inconsistencies found by fsck.
+const (
+	// FsckMissingArtifact is a published platform whose artifact is missing on disk.
+	FsckMissingArtifact = "MissingArtifact"
+	// FsckChecksumMismatch is an artifact whose checksum differs from the published one.
+	FsckChecksumMismatch = "ChecksumMismatch"
+	// FsckStalePlatform is a published platform that is removed from the spec or disabled.
+	FsckStalePlatform = "StalePlatform"
+	// FsckMissingIndexEntry is a published plugin missing in an index.
+	FsckMissingIndexEntry = "MissingIndexEntry"
+	// FsckStaleIndexEntry is an index entry that differs from the published plugin.
+	FsckStaleIndexEntry = "StaleIndexEntry"
+	// FsckOrphanedIndexEntry is an index entry without a published plugin.
+	FsckOrphanedIndexEntry = "OrphanedIndexEntry"
+	// FsckOrphanedArtifact is an artifact on disk without a published platform.
+	FsckOrphanedArtifact = "OrphanedArtifact"
+	// FsckOrphanedContent is a content of the artifact store no artifact links to.
+	FsckOrphanedContent = "OrphanedContent"
+)
+
+// fsckGracePeriod is how long before the snapshot of the Plugins the artifacts and the contents of
+// the artifact store are not pruned, since the running syncs may write them before their plugins
+// are published in the snapshot.
+const fsckGracePeriod = 10 * time.Minute
+
+// FsckIssue is an inconsistency between the Plugins, their status, the artifacts and the indexes.
+type FsckIssue struct {
+	Kind     string `json:"kind"`
+	Plugin   string `json:"plugin,omitempty"`
+	Platform string `json:"platform,omitempty"`
+	Index    string `json:"index,omitempty"`
+	Message  string `json:"message"`
+	// Repaired is set if the issue is repaired, or its plugin is requeued to be repaired by the next sync.
+	Repaired bool `json:"repaired"`
+}
+
+// FsckReport is the result of the consistency check.
+type FsckReport struct {
+	Issues []FsckIssue `json:"issues"`
+}
+
+// Fsck cross-checks the Plugins, the artifacts on disk and the index entries, and repairs them if set.
+func (c *Controller) Fsck(ctx context.Context, repair bool) (*FsckReport, error) {
+	snapshot := time.Now()
+	objs, err := c.lister.List(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+	plugins := map[string]*v1alpha1.Plugin{}
+	for _, obj := range objs {
+		u, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+		if err != nil {
+			continue
+		}
+		plugin := &v1alpha1.Plugin{}
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(u, plugin); err != nil {
+			continue
+		}
+		plugins[plugin.Name] = plugin
+	}
+	// the NamespacedPlugins taking precedence are published like the cluster Plugins
+	if c.namespacedIndexer != nil {
+		for _, obj := range c.namespacedIndexer.List() {
+			plugin := toPlugin(obj)
+			if plugin == nil || plugins[plugin.Name] != nil {
+				continue
+			}
+			if candidates, err := c.namespacedPlugins(plugin.Name); err == nil && len(candidates) > 0 {
+				plugins[plugin.Name] = candidates[0]
+			}
+		}
+	}
+
+	report := &FsckReport{Issues: []FsckIssue{}}
+	requeue := map[string]bool{}
+	artifacts := map[string]bool{}
+	for _, plugin := range plugins {
+		if isPublished(plugin) && c.ownsPlugin(plugin) {
+			for _, issue := range c.checkArtifacts(plugin, artifacts, repair) {
+				issue.Repaired = repair
+				requeue[plugin.Name] = repair
+				report.Issues = append(report.Issues, issue)
+			}
+		}
+		report.Issues = append(report.Issues, c.checkIndexEntries(plugin, repair)...)
+	}
+
+	for _, r := range []struct {
+		name string
+		repo *git.Repo
+	}{{"main", c.repo}, {"preview", c.previewRepo}} {
+		names, err := r.repo.List()
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range names {
+			if _, ok := plugins[name]; ok {
+				continue
+			}
+			// the plugins mirrored from the PluginRepositories are published by their syncs
+			if len(mirroredBy(r.repo, name)) > 0 {
+				addMirroredArtifacts(name, artifacts)
+				continue
+			}
+			// the older versions and the aliases of the plugins are republished by their syncs
+			if plugin, _, ok := strings.Cut(name, versionSeparator); ok && plugins[plugin] != nil {
+				continue
+			}
+			if plugin := aliasOf(r.repo, name); len(plugin) > 0 && plugins[plugin] != nil {
+				continue
+			}
+			// the plugins created since the snapshot are published by their syncs
+			if _, err := c.lister.Get(name); err == nil {
+				continue
+			}
+			issue := FsckIssue{
+				Kind:    FsckOrphanedIndexEntry,
+				Plugin:  name,
+				Index:   r.name,
+				Message: fmt.Sprintf("plugin %s is in the %s index, but it does not exist", name, r.name),
+			}
+			if repair {
+				if err := r.repo.Delete(name); err != nil {
+					issue.Message += fmt.Sprintf(", pruning failed: %v", err)
+				} else {
+					issue.Repaired = true
+				}
+			}
+			report.Issues = append(report.Issues, issue)
+		}
+	}
+
+	var files []string
+	for _, format := range artifactFormats() {
+		matches, err := filepath.Glob(filepath.Join(image.TarballPath, "*."+string(format)))
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, matches...)
+	}
+	for _, file := range files {
+		if artifacts[filepath.Clean(file)] || modifiedSince(file, snapshot.Add(-fsckGracePeriod)) {
+			continue
+		}
+		issue := FsckIssue{
+			Kind:    FsckOrphanedArtifact,
+			Message: fmt.Sprintf("artifact %s does not belong to any published platform", filepath.Base(file)),
+		}
+		if repair {
+			if err := image.RemoveArtifact(file); err != nil {
+				issue.Message += fmt.Sprintf(", pruning failed: %v", err)
+			} else {
+				issue.Repaired = true
+			}
+		}
+		report.Issues = append(report.Issues, issue)
+	}
+
+	contents, err := image.UnreferencedContents(image.TarballPath)
+	if err != nil {
+		return nil, err
+	}
+	for _, content := range contents {
+		if modifiedSince(content, snapshot.Add(-fsckGracePeriod)) {
+			continue
+		}
+		issue := FsckIssue{
+			Kind:    FsckOrphanedContent,
+			Message: fmt.Sprintf("content %s of the artifact store is not linked to any artifact", filepath.Base(content)),
+		}
+		if repair {
+			if err := image.PruneContent(content); err != nil {
+				issue.Message += fmt.Sprintf(", pruning failed: %v", err)
+			} else {
+				issue.Repaired = true
+			}
+		}
+		report.Issues = append(report.Issues, issue)
+	}
+
+	for name, ok := range requeue {
+		if ok {
+			klog.Infof("plugin %s is requeued by fsck", name)
+			c.queue.Add(name)
+		}
+	}
+	sort.SliceStable(report.Issues, func(i, j int) bool {
+		return report.Issues[i].Plugin < report.Issues[j].Plugin
+	})
+	return report, nil
+}
+
+// checkArtifacts checks the artifacts of the published platforms of the plugin.
+func (c *Controller) checkArtifacts(plugin *v1alpha1.Plugin, artifacts map[string]bool, repair bool) []FsckIssue {
+	var issues []FsckIssue
+	specPlatforms := map[string]bool{}
+	for _, p := range plugin.Spec.Platforms {
+		specPlatforms[p.Platform] = !p.Disabled
+	}
+	for _, p := range plugin.Status.Platforms {
+		path := addPublishedArtifacts(plugin.Name, p, artifacts)
+		if !specPlatforms[p.Platform] {
+			issues = append(issues, FsckIssue{
+				Kind:     FsckStalePlatform,
+				Plugin:   plugin.Name,
+				Platform: p.Platform,
+				Message:  fmt.Sprintf("platform %s is published, but it is removed from the spec or disabled", p.Platform),
+			})
+			continue
+		}
+		checksum, err := fileChecksum(path)
+		if os.IsNotExist(err) {
+			issues = append(issues, FsckIssue{
+				Kind:     FsckMissingArtifact,
+				Plugin:   plugin.Name,
+				Platform: p.Platform,
+				Message:  fmt.Sprintf("artifact %s is missing", filepath.Base(path)),
+			})
+			continue
+		}
+		if err != nil || checksum != p.Sha256 {
+			issues = append(issues, FsckIssue{
+				Kind:     FsckChecksumMismatch,
+				Plugin:   plugin.Name,
+				Platform: p.Platform,
+				Message:  fmt.Sprintf("artifact %s checksum %s does not match the published %s %v", filepath.Base(path), checksum, p.Sha256, err),
+			})
+			if repair {
+				if err := image.RemoveArtifact(path); err != nil {
+					klog.Errorf("removing corrupted artifact %s error %v", path, err)
+				}
+			}
+		}
+	}
+	for _, v := range plugin.Status.Versions {
+		for _, p := range v.Platforms {
+			addPublishedArtifacts(v.Name, p, artifacts)
+		}
+	}
+	return issues
+}
+
+// checkIndexEntries compares the index entries of the plugin against the ones published from its status.
+func (c *Controller) checkIndexEntries(plugin *v1alpha1.Plugin, repair bool) []FsckIssue {
+	var expected []byte
+	if k := newKrewPluginFromStatus(plugin); k != nil && isPublished(plugin) {
+		var err error
+		expected, err = yaml.Marshal(k)
+		if err != nil {
+			return nil
+		}
+	}
+
+	var issues []FsckIssue
+	for _, r := range []struct {
+		name     string
+		repo     *git.Repo
+		expected []byte
+	}{
+		{"main", c.repo, expected},
+		{"preview", c.previewRepo, expected},
+	} {
+		if r.name == "main" && plugin.Spec.Preview {
+			r.expected = nil
+		}
+		actual, err := r.repo.Read(plugin.Name)
+		if err != nil {
+			issues = append(issues, FsckIssue{
+				Kind:    FsckStaleIndexEntry,
+				Plugin:  plugin.Name,
+				Index:   r.name,
+				Message: fmt.Sprintf("reading the index entry failed: %v", err),
+			})
+			continue
+		}
+		if bytes.Equal(actual, r.expected) {
+			continue
+		}
+
+		issue := FsckIssue{
+			Plugin: plugin.Name,
+			Index:  r.name,
+		}
+		switch {
+		case r.expected == nil:
+			issue.Kind = FsckOrphanedIndexEntry
+			issue.Message = fmt.Sprintf("plugin %s is not published to the %s index, but it has an entry", plugin.Name, r.name)
+		case actual == nil:
+			issue.Kind = FsckMissingIndexEntry
+			issue.Message = fmt.Sprintf("plugin %s is published, but it is missing in the %s index", plugin.Name, r.name)
+		default:
+			issue.Kind = FsckStaleIndexEntry
+			issue.Message = fmt.Sprintf("the %s index entry of plugin %s differs from the published one", r.name, plugin.Name)
+		}
+		if repair {
+			if r.expected == nil {
+				err = r.repo.Delete(plugin.Name)
+			} else {
+				err = c.publishPlugin(plugin, newKrewPluginFromStatus(plugin))
+			}
+			if err != nil {
+				issue.Message += fmt.Sprintf(", repair failed: %v", err)
+			} else {
+				issue.Repaired = true
+			}
+		}
+		issues = append(issues, issue)
+	}
+	return issues
+}
+
+// isPublished reports whether the plugin is installed and served from the indexes.
+func isPublished(plugin *v1alpha1.Plugin) bool {
+	if plugin.Spec.ExpiresAt != nil && !time.Now().Before(plugin.Spec.ExpiresAt.Time) {
+		return false
+	}
+	return meta.IsStatusConditionTrue(plugin.Status.Conditions, v1alpha1.PluginInstalledCondition)
+}
+
+// modifiedSince reports whether the file is modified after the time, or no longer exists.
+func modifiedSince(path string, t time.Time) bool {
+	info, err := os.Lstat(path)
+	return err != nil || info.ModTime().After(t)
+}
+
+func fileChecksum(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
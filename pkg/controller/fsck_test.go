@@ -0,0 +1,248 @@
+package controller
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+
+	"github.com/openshift/cli-manager/api/v1alpha1"
+	"github.com/openshift/cli-manager/pkg/git"
+	"github.com/openshift/cli-manager/pkg/image"
+	krew "github.com/openshift/cli-manager/pkg/krew/v1alpha2"
+)
+
+// newFsckController returns the controller of the plugins, with empty indexes and artifact store.
+func newFsckController(t *testing.T, plugins ...*v1alpha1.Plugin) *Controller {
+	t.Helper()
+	tarballPath := image.TarballPath
+	image.TarballPath = t.TempDir()
+	t.Cleanup(func() {
+		image.TarballPath = tarballPath
+	})
+
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	for _, plugin := range plugins {
+		u, err := runtime.DefaultUnstructuredConverter.ToUnstructured(plugin)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := indexer.Add(&unstructured.Unstructured{Object: u}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	repo, err := git.PrepareLocalGit(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	previewRepo, err := git.PrepareLocalGit(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &Controller{
+		lister:      cache.NewGenericLister(indexer, v1alpha1.GroupVersion.WithResource("plugins").GroupResource()),
+		indexer:     indexer,
+		repo:        repo,
+		previewRepo: previewRepo,
+		queue:       workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter()),
+	}
+}
+
+// newPublishedPlugin returns the plugin installed for linux/amd64 with the checksum.
+func newPublishedPlugin(name, checksum string) *v1alpha1.Plugin {
+	plugin := &v1alpha1.Plugin{
+		Spec: v1alpha1.PluginSpec{
+			Version:          "v1.0.0",
+			ShortDescription: name,
+			Platforms:        []v1alpha1.PluginPlatform{{Platform: "linux/amd64"}},
+		},
+		Status: v1alpha1.PluginStatus{
+			Conditions: []metav1.Condition{{Type: v1alpha1.PluginInstalledCondition, Status: metav1.ConditionTrue}},
+			Platforms: []v1alpha1.PluginPlatformStatus{{
+				Platform: "linux/amd64",
+				Sha256:   checksum,
+				URI:      "https://example.com/cli-manager/" + name + "_linux_amd64.tar.gz",
+				Bin:      name,
+			}},
+		},
+	}
+	plugin.Name = name
+	return plugin
+}
+
+func writeArtifact(t *testing.T, name string, age time.Duration) string {
+	t.Helper()
+	path := filepath.Join(image.TarballPath, name)
+	if err := os.WriteFile(path, []byte("artifact"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	modified := time.Now().Add(-age)
+	if err := os.Chtimes(path, modified, modified); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestFsck(t *testing.T) {
+	published := newPublishedPlugin("published", "")
+	missing := newPublishedPlugin("missing", "abc")
+	c := newFsckController(t, published, missing)
+
+	artifact := writeArtifact(t, "published_linux_amd64.tar.gz", time.Hour)
+	sum, err := fileChecksum(artifact)
+	if err != nil {
+		t.Fatal(err)
+	}
+	published.Status.Platforms[0].Sha256 = sum
+	u, err := runtime.DefaultUnstructuredConverter.ToUnstructured(published)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.indexer.Update(&unstructured.Unstructured{Object: u}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.publishPlugin(published, newKrewPluginFromStatus(published)); err != nil {
+		t.Fatal(err)
+	}
+	orphan := &krew.Plugin{}
+	orphan.Name = "orphan"
+	if err := c.repo.Upsert(orphan.Name, orphan); err != nil {
+		t.Fatal(err)
+	}
+	orphanedArtifact := writeArtifact(t, "orphan_linux_amd64.tar.gz", time.Hour)
+	// the artifacts written by the running syncs are not pruned
+	recentArtifact := writeArtifact(t, "recent_linux_amd64.tar.gz", 0)
+
+	report, err := c.Fsck(context.Background(), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]int{
+		FsckMissingArtifact:    1,
+		FsckMissingIndexEntry:  2,
+		FsckOrphanedIndexEntry: 1,
+		FsckOrphanedArtifact:   1,
+	}
+	kinds := map[string]int{}
+	for _, issue := range report.Issues {
+		kinds[issue.Kind]++
+		if issue.Repaired {
+			t.Errorf("issue %v is repaired without repair", issue)
+		}
+		if issue.Kind == FsckOrphanedArtifact && issue.Message != "artifact orphan_linux_amd64.tar.gz does not belong to any published platform" {
+			t.Errorf("unexpected orphaned artifact %s", issue.Message)
+		}
+	}
+	if len(kinds) != len(expected) {
+		t.Fatalf("expected issues %v, got %v", expected, report.Issues)
+	}
+	for kind, count := range expected {
+		if kinds[kind] != count {
+			t.Errorf("expected %d %s issues, got %v", count, kind, report.Issues)
+		}
+	}
+
+	report, err = c.Fsck(context.Background(), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, issue := range report.Issues {
+		if !issue.Repaired {
+			t.Errorf("issue %v is not repaired", issue)
+		}
+	}
+	if _, err := os.Stat(orphanedArtifact); !os.IsNotExist(err) {
+		t.Error("expected the orphaned artifact to be pruned")
+	}
+	if _, err := os.Stat(recentArtifact); err != nil {
+		t.Errorf("expected the recent artifact to be kept, got %v", err)
+	}
+	if _, err := os.Stat(artifact); err != nil {
+		t.Errorf("expected the published artifact to be kept, got %v", err)
+	}
+	if data, err := c.repo.Read(orphan.Name); err != nil || data != nil {
+		t.Errorf("expected the orphaned index entry to be pruned, got %s %v", data, err)
+	}
+	if c.queue.Len() != 1 {
+		t.Errorf("expected the plugin with a missing artifact to be requeued, got %d plugins", c.queue.Len())
+	}
+
+	report, err = c.Fsck(context.Background(), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, issue := range report.Issues {
+		if issue.Kind != FsckMissingArtifact {
+			t.Errorf("unexpected issue %v after the repair", issue)
+		}
+	}
+}
+
+func TestModifiedSince(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tool_linux_amd64.tar.gz")
+	if !modifiedSince(path, time.Now()) {
+		t.Error("expected the removed artifact to be modified")
+	}
+	if err := os.WriteFile(path, []byte("artifact"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if !modifiedSince(path, time.Now().Add(-fsckGracePeriod)) {
+		t.Error("expected the artifact written by a running sync to be modified")
+	}
+	modified := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(path, modified, modified); err != nil {
+		t.Fatal(err)
+	}
+	if modifiedSince(path, time.Now().Add(-fsckGracePeriod)) {
+		t.Error("expected the old artifact not to be modified")
+	}
+}
+
+func TestCheckIndexEntries(t *testing.T) {
+	plugin := newPublishedPlugin("tool", "abc")
+	c := newFsckController(t, plugin)
+	if issues := c.checkIndexEntries(plugin, false); len(issues) != 2 || issues[0].Kind != FsckMissingIndexEntry || issues[1].Kind != FsckMissingIndexEntry {
+		t.Fatalf("expected the index entries to be missing, got %v", issues)
+	}
+	// both entries are republished by the repair of the main one
+	if issues := c.checkIndexEntries(plugin, true); len(issues) != 1 || !issues[0].Repaired {
+		t.Fatalf("expected the index entries to be republished, got %v", issues)
+	}
+	if issues := c.checkIndexEntries(plugin, false); len(issues) != 0 {
+		t.Fatalf("expected the index entries to be published, got %v", issues)
+	}
+
+	// the entries differing from the status are republished from it
+	changed := plugin.DeepCopy()
+	changed.Status.Platforms[0].Sha256 = "def"
+	issues := c.checkIndexEntries(changed, true)
+	if len(issues) != 1 || issues[0].Kind != FsckStaleIndexEntry || !issues[0].Repaired {
+		t.Fatalf("expected the index entries to be stale, got %v", issues)
+	}
+
+	// the preview plugins are not published to the main index
+	preview := changed.DeepCopy()
+	preview.Spec.Preview = true
+	issues = c.checkIndexEntries(preview, true)
+	if len(issues) != 1 || issues[0].Kind != FsckOrphanedIndexEntry || issues[0].Index != "main" || !issues[0].Repaired {
+		t.Fatalf("expected the main index entry to be orphaned, got %v", issues)
+	}
+	if data, err := c.repo.Read(plugin.Name); err != nil || data != nil {
+		t.Fatalf("expected the main index entry to be pruned, got %s %v", data, err)
+	}
+
+	// the entries of the plugins not published are orphaned
+	failed := changed.DeepCopy()
+	failed.Status.Conditions[0].Status = metav1.ConditionFalse
+	issues = c.checkIndexEntries(failed, false)
+	if len(issues) != 1 || issues[0].Kind != FsckOrphanedIndexEntry || issues[0].Index != "preview" {
+		t.Fatalf("expected the preview index entry to be orphaned, got %v", issues)
+	}
+}
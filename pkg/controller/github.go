@@ -0,0 +1,145 @@
+package controller
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/openshift/cli-manager/api/v1alpha1"
+	"github.com/openshift/cli-manager/pkg/image"
+)
+
+const (
+	// latestReleaseInterval is the interval the plugins published from the latest GitHub releases are
+	// synced at, so that the next releases are published.
+	latestReleaseInterval = time.Hour
+	// releaseVersionPlaceholder is replaced by the version of the plugin without its v prefix in the
+	// tags and the asset patterns of the GitHub releases.
+	releaseVersionPlaceholder = "${version}"
+)
+
+// syncGitHubPlatform looks up the asset of the platform in its GitHub release and its checksum, then
+// downloads and rehosts it like the archives of the platforms published from a URL.
+func (c *Controller) syncGitHubPlatform(ctx context.Context, plugin *v1alpha1.Plugin, version string, p v1alpha1.PluginPlatform) (platformResult, error) {
+	source := p.GitHub
+	// the older versions are looked up with their own version
+	releaseVersion := plugin.Spec.Version
+	if len(version) > 0 {
+		releaseVersion = version
+	}
+	replacer := strings.NewReplacer(releaseVersionPlaceholder, strings.TrimPrefix(releaseVersion, "v"))
+	failed := func(reason string, err error) (platformResult, error) {
+		newCondition := metav1.Condition{
+			Status:  metav1.ConditionFalse,
+			Reason:  reason,
+			Message: fmt.Sprintf("failed to find the release asset of platform %s in %s error %s", p.Platform, source.Repository, err),
+		}
+		return platformResult{condition: &newCondition}, nil
+	}
+
+	var token string
+	if len(source.TokenSecret) > 0 {
+		secret, err := c.getSecret(ctx, source.TokenSecret)
+		if err != nil {
+			return failed("InvalidField", fmt.Errorf("getting token secret %s: %w", source.TokenSecret, err))
+		}
+		token = strings.TrimSpace(string(secret.Data["token"]))
+		if len(token) == 0 {
+			return failed("InvalidField", fmt.Errorf("token secret %s has no token", source.TokenSecret))
+		}
+	}
+	opts, err := c.downloadOptions(ctx, p)
+	if err != nil {
+		return failed("InvalidProxySecret", err)
+	}
+	release, err := image.GitHubRelease(ctx, source.Repository, replacer.Replace(source.Tag), token, opts)
+	if err != nil {
+		return failed("GitHubReleaseError", err)
+	}
+	asset, err := releaseAsset(release, replacer.Replace(source.Asset))
+	if err != nil {
+		return failed("AssetNotFound", err)
+	}
+	checksum := strings.TrimPrefix(asset.Digest, "sha256:")
+	if len(source.Checksums) > 0 {
+		checksums, err := releaseAsset(release, replacer.Replace(source.Checksums))
+		if err != nil {
+			return failed("AssetNotFound", err)
+		}
+		data, err := image.ReadReleaseAsset(ctx, *checksums, token, opts)
+		if err != nil {
+			return failed("GitHubReleaseError", err)
+		}
+		checksum = assetChecksum(data, asset.Name)
+	}
+	if !sha256Regexp.MatchString(checksum) {
+		return failed("ChecksumNotFound", fmt.Errorf("no sha256 checksum of asset %s of release %s, set the checksums asset", asset.Name, release.Tag))
+	}
+
+	// the assets of the private repositories are downloaded through the API
+	var header http.Header
+	p.URL = asset.BrowserDownloadURL
+	if len(token) > 0 {
+		p.URL = asset.URL
+		header = http.Header{"Authorization": {"Bearer " + token}, "Accept": {"application/octet-stream"}}
+	}
+	p.Sha256 = checksum
+	result, err := c.syncArchivePlatform(ctx, plugin, version, p, header)
+	if result.platform != nil {
+		result.status.Release = release.Tag
+	}
+	return result, err
+}
+
+// releaseAsset returns the single asset of the release whose name matches the glob pattern.
+func releaseAsset(release *image.Release, pattern string) (*image.ReleaseAsset, error) {
+	var matched []image.ReleaseAsset
+	for _, asset := range release.Assets {
+		if ok, _ := path.Match(pattern, asset.Name); ok {
+			matched = append(matched, asset)
+		}
+	}
+	switch len(matched) {
+	case 0:
+		return nil, fmt.Errorf("no asset of release %s matches %s", release.Tag, pattern)
+	case 1:
+		return &matched[0], nil
+	}
+	names := make([]string, 0, len(matched))
+	for _, asset := range matched {
+		names = append(names, asset.Name)
+	}
+	return nil, fmt.Errorf("assets %s of release %s match %s, it should match a single asset", strings.Join(names, ", "), release.Tag, pattern)
+}
+
+// assetChecksum returns the checksum of the asset in the checksums in sha256sum format, or an empty
+// string if it is not listed.
+func assetChecksum(checksums []byte, name string) string {
+	scanner := bufio.NewScanner(bytes.NewReader(checksums))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		// the binary mode of sha256sum prefixes the names with *
+		if len(fields) == 2 && strings.TrimPrefix(fields[1], "*") == name {
+			return fields[0]
+		}
+	}
+	return ""
+}
+
+// usesLatestRelease reports whether a platform of the current version of the plugin is published
+// from the latest release of a GitHub repository.
+func usesLatestRelease(plugin *v1alpha1.Plugin) bool {
+	for _, p := range plugin.Spec.Platforms {
+		if p.GitHub != nil && len(p.GitHub.Tag) == 0 && !p.Disabled {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,108 @@
+package controller
+
+import (
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/component-base/metrics"
+	"k8s.io/component-base/metrics/legacyregistry"
+	// registers the metrics of the controller workqueue (depth, latency, work duration, retries)
+	_ "k8s.io/component-base/metrics/prometheus/workqueue"
+)
+
+// otherPluginsLabel aggregates the plugins exceeding MaxPluginMetricLabels.
+const otherPluginsLabel = "_other"
+
+var (
+	// MaxPluginMetricLabels bounds the cardinality of the per-plugin metrics.
+	MaxPluginMetricLabels = 100
+
+	registerMetrics sync.Once
+
+	pluginSyncDuration = metrics.NewHistogramVec(
+		&metrics.HistogramOpts{
+			Name:           "cli_manager_plugin_sync_duration_seconds",
+			Help:           "Duration of the plugin reconciliations",
+			Buckets:        []float64{0.1, 0.5, 1, 5, 10, 30, 60, 120, 300, 600},
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{"plugin", "result"},
+	)
+	informerCacheSynced = metrics.NewGaugeVec(
+		&metrics.GaugeOpts{
+			Name:           "cli_manager_informer_cache_synced",
+			Help:           "Whether the informer cache of the resource is synced",
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{"resource"},
+	)
+	informerCacheSyncDuration = metrics.NewGaugeVec(
+		&metrics.GaugeOpts{
+			Name:           "cli_manager_informer_cache_sync_duration_seconds",
+			Help:           "Duration of the initial informer cache sync",
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{"resource"},
+	)
+	pullCredentialsExpiry = metrics.NewGaugeVec(
+		&metrics.GaugeOpts{
+			Name:           "cli_manager_pull_credentials_expiry_timestamp_seconds",
+			Help:           "Unix time the credentials of the image pull Secret expire at",
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{"secret"},
+	)
+
+	pluginLabelsLock sync.Mutex
+	pluginLabels     = map[string]struct{}{}
+)
+
+func init() {
+	registerMetrics.Do(func() {
+		legacyregistry.MustRegister(pluginSyncDuration)
+		legacyregistry.MustRegister(informerCacheSynced)
+		legacyregistry.MustRegister(informerCacheSyncDuration)
+		legacyregistry.MustRegister(pullCredentialsExpiry)
+	})
+}
+
+// pluginLabel returns the metric label of the plugin.
+func pluginLabel(name string) string {
+	pluginLabelsLock.Lock()
+	defer pluginLabelsLock.Unlock()
+	if _, ok := pluginLabels[name]; ok {
+		return name
+	}
+	if len(pluginLabels) >= MaxPluginMetricLabels {
+		return otherPluginsLabel
+	}
+	pluginLabels[name] = struct{}{}
+	return name
+}
+
+// observePluginSync records the duration of the plugin reconciliation.
+func observePluginSync(name string, start time.Time, err error) {
+	result := "success"
+	if err != nil {
+		result = "error"
+	}
+	pluginSyncDuration.WithLabelValues(pluginLabel(name), result).Observe(time.Since(start).Seconds())
+}
+
+// ObserveInformerCacheSync records the result of the initial informer cache sync.
+func ObserveInformerCacheSync(synced map[schema.GroupVersionResource]bool, duration time.Duration) {
+	for gvr, ok := range synced {
+		value := 0.0
+		if ok {
+			value = 1
+		}
+		informerCacheSynced.WithLabelValues(gvr.String()).Set(value)
+		informerCacheSyncDuration.WithLabelValues(gvr.String()).Set(duration.Seconds())
+	}
+}
+
+// observeCredentialsExpiry records the expiry of the credentials of the image pull Secret.
+func observeCredentialsExpiry(secret string, expiry time.Time) {
+	pullCredentialsExpiry.WithLabelValues(secret).Set(float64(expiry.Unix()))
+}
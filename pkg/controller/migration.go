@@ -0,0 +1,138 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	apiextensionsclient "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/util/retry"
+	"k8s.io/klog/v2"
+
+	"github.com/openshift/cli-manager/api/v1alpha1"
+	"github.com/openshift/cli-manager/api/v1beta1"
+)
+
+// PluginsCRD is the name of the Plugin CustomResourceDefinition.
+const PluginsCRD = "plugins.config.openshift.io"
+
+// MigrateStorageVersion rewrites the Plugins in the storage version and prunes the stored versions.
+func MigrateStorageVersion(ctx context.Context, crdClient apiextensionsclient.Interface, dynamicClient dynamic.Interface) error {
+	crd, err := crdClient.ApiextensionsV1().CustomResourceDefinitions().Get(ctx, PluginsCRD, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	var storageVersion string
+	for _, v := range crd.Spec.Versions {
+		if v.Storage {
+			storageVersion = v.Name
+		}
+	}
+	if len(crd.Status.StoredVersions) == 1 && crd.Status.StoredVersions[0] == storageVersion {
+		klog.V(2).Infof("plugins are stored in %s, no storage version migration is needed", storageVersion)
+		return nil
+	}
+	if storageVersion != v1beta1.GroupVersion.Version {
+		klog.Warningf("storage version %s of plugins is not %s, the storage version migration is left to the controller serving it", storageVersion, v1beta1.GroupVersion.Version)
+		return nil
+	}
+
+	klog.Infof("migrating plugins stored in %v to %s", crd.Status.StoredVersions, storageVersion)
+	resource := dynamicClient.Resource(schema.GroupVersionResource{
+		Group:    v1beta1.GroupVersion.Group,
+		Version:  storageVersion,
+		Resource: "plugins",
+	})
+	var migrated int
+	var failed []string
+	options := metav1.ListOptions{Limit: 500}
+	for {
+		list, err := resource.List(ctx, options)
+		if err != nil {
+			return err
+		}
+		for i := range list.Items {
+			obj := &list.Items[i]
+			if err := migratePlugin(ctx, resource, obj); err != nil {
+				klog.Errorf("plugin %s can not be migrated to %s: %v", obj.GetName(), storageVersion, err)
+				failed = append(failed, obj.GetName())
+				continue
+			}
+			migrated++
+		}
+		if len(list.GetContinue()) == 0 {
+			break
+		}
+		options.Continue = list.GetContinue()
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("%d plugins are not migrated to %s, the stored versions %v are kept: %v", len(failed), storageVersion, crd.Status.StoredVersions, failed)
+	}
+
+	err = retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		crd, err := crdClient.ApiextensionsV1().CustomResourceDefinitions().Get(ctx, PluginsCRD, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		crd.Status.StoredVersions = []string{storageVersion}
+		_, err = crdClient.ApiextensionsV1().CustomResourceDefinitions().UpdateStatus(ctx, crd, metav1.UpdateOptions{})
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("updating stored versions of %s: %w", PluginsCRD, err)
+	}
+	klog.Infof("%d plugins are migrated to %s", migrated, storageVersion)
+	return nil
+}
+
+// migratePlugin verifies that the plugin round-trips through the types of the storage version,
+// and rewrites it in the storage version with a no-op update.
+func migratePlugin(ctx context.Context, resource dynamic.ResourceInterface, obj *unstructured.Unstructured) error {
+	if err := verifyRoundTrip(obj); err != nil {
+		return err
+	}
+	_, err := resource.Update(ctx, obj, metav1.UpdateOptions{})
+	if errors.IsConflict(err) || errors.IsNotFound(err) {
+		// updated or deleted in the meantime, which rewrote it in the storage version
+		return nil
+	}
+	return err
+}
+
+// verifyRoundTrip returns an error if the plugin of the storage version loses any field through
+// the v1beta1 types, or through the conversion to the v1alpha1 types the controller reads and back.
+func verifyRoundTrip(obj *unstructured.Unstructured) error {
+	plugin := &v1beta1.Plugin{}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructuredWithValidation(obj.Object, plugin, true); err != nil {
+		return fmt.Errorf("converting to %s: %w", v1beta1.GroupVersion, err)
+	}
+	u, err := runtime.DefaultUnstructuredConverter.ToUnstructured(plugin)
+	if err != nil {
+		return err
+	}
+	roundTripped := &v1beta1.Plugin{}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(u, roundTripped); err != nil {
+		return err
+	}
+	if !equality.Semantic.DeepEqual(plugin, roundTripped) {
+		return fmt.Errorf("plugin does not round-trip through %s", v1beta1.GroupVersion)
+	}
+
+	converted, roundTripped2 := &v1alpha1.Plugin{}, &v1beta1.Plugin{}
+	if err := converted.ConvertFrom(plugin); err != nil {
+		return fmt.Errorf("converting to %s: %w", v1alpha1.GroupVersion, err)
+	}
+	if err := converted.ConvertTo(roundTripped2); err != nil {
+		return fmt.Errorf("converting to %s: %w", v1beta1.GroupVersion, err)
+	}
+	if !equality.Semantic.DeepEqual(plugin.Spec, roundTripped2.Spec) || !equality.Semantic.DeepEqual(plugin.Status, roundTripped2.Status) {
+		return fmt.Errorf("plugin does not round-trip through %s", v1alpha1.GroupVersion)
+	}
+	return nil
+}
@@ -0,0 +1,230 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/klog/v2"
+
+	"github.com/openshift/cli-manager/api/v1alpha1"
+	"github.com/openshift/cli-manager/api/v1beta1"
+	"github.com/openshift/cli-manager/pkg/image"
+)
+
+// namespacedPluginsGVR are the NamespacedPlugins, which are only served in v1beta1.
+var namespacedPluginsGVR = schema.GroupVersionResource{
+	Group:    v1beta1.GroupVersion.Group,
+	Version:  v1beta1.GroupVersion.Version,
+	Resource: "namespacedplugins",
+}
+
+// nameIndex indexes the NamespacedPlugins by their names, which are the names they are published
+// under in the index, whatever their namespace.
+const nameIndex = "name"
+
+// pluginName is the index function of nameIndex.
+func pluginName(obj interface{}) ([]string, error) {
+	accessor, err := meta.Accessor(obj)
+	if err != nil {
+		return nil, nil
+	}
+	return []string{accessor.GetName()}, nil
+}
+
+// namespacedPlugins returns the NamespacedPlugins of the name in the order of their precedence.
+func (c *Controller) namespacedPlugins(name string) ([]*v1alpha1.Plugin, error) {
+	if c.namespacedIndexer == nil {
+		return nil, nil
+	}
+	objs, err := c.namespacedIndexer.ByIndex(nameIndex, name)
+	if err != nil {
+		return nil, err
+	}
+	var plugins []*v1alpha1.Plugin
+	for _, obj := range objs {
+		if plugin := toPlugin(obj); plugin != nil {
+			plugins = append(plugins, plugin)
+		}
+	}
+	sortByPrecedence(plugins)
+	return plugins, nil
+}
+
+// sortByPrecedence sorts the NamespacedPlugins of the same name in the order of their precedence.
+func sortByPrecedence(plugins []*v1alpha1.Plugin) {
+	sort.SliceStable(plugins, func(i, j int) bool {
+		if !plugins[i].CreationTimestamp.Equal(&plugins[j].CreationTimestamp) {
+			return plugins[i].CreationTimestamp.Before(&plugins[j].CreationTimestamp)
+		}
+		return plugins[i].Namespace < plugins[j].Namespace
+	})
+}
+
+// pluginResource returns the resource of the plugin, the cluster Plugins or the NamespacedPlugins
+// of its namespace.
+func pluginResource(client *dynamic.DynamicClient, plugin *v1alpha1.Plugin) dynamic.ResourceInterface {
+	if len(plugin.Namespace) > 0 {
+		return client.Resource(namespacedPluginsGVR).Namespace(plugin.Namespace)
+	}
+	return client.Resource(schema.GroupVersionResource{
+		Group:    v1alpha1.GroupVersion.Group,
+		Version:  v1alpha1.GroupVersion.Version,
+		Resource: "plugins",
+	})
+}
+
+// getNamespacedPlugin returns the NamespacedPlugin published under the name, which is read from the
+// API server like the cluster Plugins, or a NotFound error if there is none.
+func (c *Controller) getNamespacedPlugin(ctx context.Context, name string) (*unstructured.Unstructured, error) {
+	plugins, err := c.namespacedPlugins(name)
+	if err != nil {
+		return nil, err
+	}
+	if len(plugins) == 0 {
+		return nil, errors.NewNotFound(namespacedPluginsGVR.GroupResource(), name)
+	}
+	return c.dynamicClient.Resource(namespacedPluginsGVR).Namespace(plugins[0].Namespace).Get(ctx, name, metav1.GetOptions{})
+}
+
+// getIndexedPlugin returns the plugin of the cache published under the name, the cluster Plugin or
+// the NamespacedPlugin taking precedence, or a NotFound error if there is none.
+func (c *Controller) getIndexedPlugin(name string) (runtime.Object, error) {
+	obj, err := c.lister.Get(name)
+	if !errors.IsNotFound(err) {
+		return obj, err
+	}
+	plugins, err := c.namespacedPlugins(name)
+	if err != nil {
+		return nil, err
+	}
+	if len(plugins) == 0 {
+		return nil, errors.NewNotFound(namespacedPluginsGVR.GroupResource(), name)
+	}
+	return plugins[0], nil
+}
+
+// reportNameConflicts marks the NamespacedPlugins of the name of the published plugin not installed,
+// since the plugin takes precedence over them, but the published plugin itself.
+func (c *Controller) reportNameConflicts(ctx context.Context, published *v1alpha1.Plugin) error {
+	plugins, err := c.namespacedPlugins(published.Name)
+	if err != nil {
+		return err
+	}
+	publisher := "cluster plugin " + published.Name
+	if len(published.Namespace) > 0 {
+		publisher = "namespaced plugin " + published.Namespace + "/" + published.Name
+	}
+	var errs []error
+	for _, plugin := range plugins {
+		if plugin.Namespace == published.Namespace {
+			continue
+		}
+		klog.V(2).Infof("namespaced plugin %s/%s conflicts with %s", plugin.Namespace, plugin.Name, publisher)
+		err := updateStatusCondition(ctx, plugin, c.dynamicClient, metav1.Condition{
+			Status:  metav1.ConditionFalse,
+			Reason:  "NameConflict",
+			Message: fmt.Sprintf("plugin %s is published by %s, which takes precedence", plugin.Name, publisher),
+		})
+		if err != nil && !errors.IsNotFound(err) && !errors.IsConflict(err) {
+			errs = append(errs, err)
+		}
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+// validateNamespace returns why the NamespacedPlugin references resources out of its namespace, if it does.
+func validateNamespace(plugin *v1alpha1.Plugin) error {
+	if len(plugin.Namespace) == 0 {
+		return nil
+	}
+	var errs []error
+	check := func(kind, ref string) {
+		if namespace, _, ok := strings.Cut(ref, "/"); ok && namespace != plugin.Namespace {
+			errs = append(errs, fmt.Errorf("%s %s is not in namespace %s", kind, ref, plugin.Namespace))
+		}
+	}
+	if plugin.Spec.Resolver != nil {
+		errs = append(errs, fmt.Errorf("resolver is only supported by the cluster plugins"))
+	}
+	validate := func(version string, platforms []v1alpha1.PluginPlatform) {
+		for _, p := range platforms {
+			platform := versionPlatform{version: version, PluginPlatform: p}
+			switch {
+			case image.IsLocal(p.Image):
+				errs = append(errs, fmt.Errorf("platform %s: local image %s is only supported by the cluster plugins", platform, p.Image))
+			case image.IsConfigMap(p.Image):
+				if namespace, _, err := image.ParseConfigMap(p.Image); err == nil && namespace != plugin.Namespace {
+					errs = append(errs, fmt.Errorf("platform %s: config map %s is not in namespace %s", platform, p.Image, plugin.Namespace))
+				}
+			case image.IsImageStreamTag(p.Image):
+				if namespace, _, _, err := image.ParseImageStreamTag(p.Image); err == nil && namespace != plugin.Namespace {
+					errs = append(errs, fmt.Errorf("platform %s: image stream tag %s is not in namespace %s", platform, p.Image, plugin.Namespace))
+				}
+			}
+			check("secret", p.ImagePullSecret)
+			check("secret", p.ClientCertificateSecret)
+			check("secret", p.ProxySecret)
+			if p.GitHub != nil {
+				check("secret", p.GitHub.TokenSecret)
+			}
+			for _, source := range p.Credentials {
+				switch source.Type {
+				case v1alpha1.CredentialSourceSecret:
+					check("secret", source.SecretRef)
+				case v1alpha1.CredentialSourceServiceAccount:
+					check("service account", source.ServiceAccount)
+				case v1alpha1.CredentialSourceGlobal:
+					errs = append(errs, fmt.Errorf("platform %s: global pull secret is only supported by the cluster plugins", platform))
+				}
+			}
+		}
+	}
+	validate("", plugin.Spec.Platforms)
+	for _, v := range plugin.Spec.Versions {
+		validate(v.Version, v.Platforms)
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+// qualifyReferences qualifies the references of the NamespacedPlugin without namespace with its
+// namespace, so that they are not looked up in the namespace of the controller.
+func qualifyReferences(plugin *v1alpha1.Plugin) {
+	if len(plugin.Namespace) == 0 {
+		return
+	}
+	qualify := func(ref string) string {
+		if len(ref) == 0 || strings.Contains(ref, "/") {
+			return ref
+		}
+		return plugin.Namespace + "/" + ref
+	}
+	platforms := func(platforms []v1alpha1.PluginPlatform) {
+		for i := range platforms {
+			p := &platforms[i]
+			p.ImagePullSecret = qualify(p.ImagePullSecret)
+			p.ClientCertificateSecret = qualify(p.ClientCertificateSecret)
+			p.ProxySecret = qualify(p.ProxySecret)
+			if p.GitHub != nil {
+				p.GitHub.TokenSecret = qualify(p.GitHub.TokenSecret)
+			}
+			for j := range p.Credentials {
+				p.Credentials[j].SecretRef = qualify(p.Credentials[j].SecretRef)
+				p.Credentials[j].ServiceAccount = qualify(p.Credentials[j].ServiceAccount)
+			}
+		}
+	}
+	platforms(plugin.Spec.Platforms)
+	for i := range plugin.Spec.Versions {
+		platforms(plugin.Spec.Versions[i].Platforms)
+	}
+}
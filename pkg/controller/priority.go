@@ -0,0 +1,98 @@
+package controller
+
+import (
+	"sync"
+	"time"
+
+	"github.com/openshift/cli-manager/api/v1alpha1"
+)
+
+// priorityDeferral is how long the sync of a plugin is deferred for plugins of a higher priority.
+const priorityDeferral = 2 * time.Second
+
+// syncPriorities tracks the priorities of the queued plugins of the shard until they are synced.
+type syncPriorities struct {
+	lock sync.Mutex
+	// owns reports whether the plugin is synced by the shard
+	owns    func(*v1alpha1.Plugin) bool
+	pending map[string]int32
+	// counts are the numbers of pending plugins by priority
+	counts map[int32]int
+}
+
+func newSyncPriorities(owns func(*v1alpha1.Plugin) bool) *syncPriorities {
+	return &syncPriorities{owns: owns, pending: map[string]int32{}, counts: map[int32]int{}}
+}
+
+// queued records the plugin queued with its priority, if it is synced by the shard.
+func (p *syncPriorities) queued(plugin *v1alpha1.Plugin) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.forget(plugin.Name)
+	if p.owns(plugin) {
+		p.pending[plugin.Name] = plugin.Spec.Priority
+		p.counts[plugin.Spec.Priority]++
+	}
+}
+
+// synced forgets the plugin once it is synced.
+func (p *syncPriorities) synced(name string) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.forget(name)
+}
+
+// forget forgets the plugin. The caller must hold lock.
+func (p *syncPriorities) forget(name string) {
+	priority, ok := p.pending[name]
+	if !ok {
+		return
+	}
+	delete(p.pending, name)
+	if p.counts[priority]--; p.counts[priority] == 0 {
+		delete(p.counts, priority)
+	}
+}
+
+// priority returns the priority the plugin is queued with, if it is queued by its events.
+func (p *syncPriorities) priority(name string) (int32, bool) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	priority, ok := p.pending[name]
+	return priority, ok
+}
+
+// outranked reports whether plugins of a higher priority are queued and not synced yet.
+func (p *syncPriorities) outranked(name string, priority int32) bool {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	for other, count := range p.counts {
+		if other <= priority {
+			continue
+		}
+		if own, ok := p.pending[name]; ok && own == other {
+			count--
+		}
+		if count > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// deferSync reports whether the sync of the plugin is deferred for the plugins of a higher priority.
+func (c *Controller) deferSync(name string) bool {
+	priority, ok := c.priorities.priority(name)
+	if !ok {
+		obj, err := c.getIndexedPlugin(name)
+		if err != nil {
+			return false
+		}
+		plugin := toPlugin(obj)
+		if plugin == nil || !c.ownsPlugin(plugin) {
+			return false
+		}
+		priority = plugin.Spec.Priority
+	}
+	return c.priorities.outranked(name, priority)
+}
@@ -0,0 +1,73 @@
+package controller
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/klog/v2"
+
+	"github.com/openshift/cli-manager/api/v1alpha1"
+)
+
+const (
+	// progressPhaseExtracting is reported while the layers are downloaded and extracted.
+	progressPhaseExtracting = "Extracting"
+
+	// progressUpdateInterval is how often the progress of a running sync is written into
+	// the plugin status. Syncs completing within the interval never report progress.
+	progressUpdateInterval = 10 * time.Second
+)
+
+// progressReporter writes the progress of the pull and extraction of a platform
+// into the plugin status, so that a slow sync can be told apart from a hung one.
+type progressReporter struct {
+	ctx           context.Context
+	plugin        *v1alpha1.Plugin
+	dynamicClient *dynamic.DynamicClient
+	platform      string
+	// lock serializes the updates of the plugin object by the reporters of its platforms
+	lock *sync.Mutex
+
+	bytesDownloaded atomic.Int64
+	lastUpdate      time.Time
+}
+
+func newProgressReporter(ctx context.Context, plugin *v1alpha1.Plugin, dynamicClient *dynamic.DynamicClient, platform string, lock *sync.Mutex) *progressReporter {
+	return &progressReporter{
+		ctx:           ctx,
+		plugin:        plugin,
+		dynamicClient: dynamicClient,
+		platform:      platform,
+		lock:          lock,
+		lastUpdate:    time.Now(),
+	}
+}
+
+// report updates the progress in the status at most once per progressUpdateInterval.
+func (r *progressReporter) report(phase string, layersProcessed, layersTotal int) {
+	now := time.Now()
+	if now.Sub(r.lastUpdate) < progressUpdateInterval {
+		return
+	}
+	r.lastUpdate = now
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.plugin.Status.Progress = &v1alpha1.PluginProgress{
+		Phase:           phase,
+		Platform:        r.platform,
+		LayersProcessed: int32(layersProcessed),
+		LayersTotal:     int32(layersTotal),
+		BytesDownloaded: r.bytesDownloaded.Load(),
+		LastUpdateTime:  metav1.NewTime(now),
+	}
+	setProgressingCondition(r.plugin, r.platform, phase)
+	if err := updateStatus(r.ctx, r.plugin, r.dynamicClient); err != nil {
+		// progress is informational, the sync goes on
+		klog.V(2).Infof("plugin %s progress update error %v", r.plugin.Name, err)
+	}
+}
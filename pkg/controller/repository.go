@@ -0,0 +1,327 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/openshift/library-go/pkg/controller/factory"
+	"github.com/openshift/library-go/pkg/operator/events"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/yaml"
+
+	"github.com/openshift/cli-manager/api/v1alpha1"
+	"github.com/openshift/cli-manager/api/v1beta1"
+	"github.com/openshift/cli-manager/pkg/git"
+	"github.com/openshift/cli-manager/pkg/image"
+	krew "github.com/openshift/cli-manager/pkg/krew/v1alpha2"
+)
+
+// RepositoryAnnotation is set to the name of the PluginRepository on the krew manifests mirrored
+// from its index, so that they are told apart from the ones of the Plugins.
+const RepositoryAnnotation = "cli-manager.openshift.io/repository"
+
+// defaultRepositoryInterval is the interval the PluginRepositories are synced at by default.
+const defaultRepositoryInterval = time.Hour
+
+var pluginRepositoriesGVR = schema.GroupVersionResource{
+	Group:    v1beta1.GroupVersion.Group,
+	Version:  v1beta1.GroupVersion.Version,
+	Resource: "pluginrepositories",
+}
+
+// RepositoryController mirrors the plugins of the external krew indexes of the PluginRepositories.
+type RepositoryController struct {
+	factory.Controller
+	plugins *Controller
+	indexer cache.Indexer
+}
+
+// NewRepositoryController creates the controller of the PluginRepositories publishing into the
+// indexes of the plugin controller.
+func NewRepositoryController(plugins *Controller, informers dynamicinformer.DynamicSharedInformerFactory, eventRecorder events.Recorder) (*RepositoryController, error) {
+	informer := informers.ForResource(pluginRepositoriesGVR)
+	r := &RepositoryController{
+		plugins: plugins,
+		indexer: informer.Informer().GetIndexer(),
+	}
+
+	// the status updates of the controller itself do not change the generation
+	syncCtx := factory.NewSyncContext("PluginRepositories", eventRecorder)
+	enqueue := func(obj interface{}) {
+		if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+			obj = tombstone.Obj
+		}
+		if accessor, err := meta.Accessor(obj); err == nil {
+			syncCtx.Queue().Add(accessor.GetName())
+		}
+	}
+	_, err := informer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: enqueue,
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			oldAccessor, err := meta.Accessor(oldObj)
+			if err != nil {
+				return
+			}
+			newAccessor, err := meta.Accessor(newObj)
+			if err != nil || oldAccessor.GetGeneration() == newAccessor.GetGeneration() {
+				return
+			}
+			enqueue(newObj)
+		},
+		DeleteFunc: enqueue,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	r.Controller = factory.New().
+		WithSyncContext(syncCtx).
+		WithBareInformers(informer.Informer()).
+		WithSync(r.sync).
+		ToController("PluginRepositories", eventRecorder)
+	return r, nil
+}
+
+func (r *RepositoryController) sync(ctx context.Context, syncCtx factory.SyncContext) error {
+	name := syncCtx.QueueKey()
+	obj, err := r.plugins.dynamicClient.Resource(pluginRepositoriesGVR).Get(ctx, name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		klog.Infof("plugin repository %s is deleted, its plugins are unpublished", name)
+		return r.unpublish(name, nil)
+	}
+	if err != nil {
+		return err
+	}
+	repository := &v1beta1.PluginRepository{}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, repository); err != nil {
+		klog.V(2).Infof("invalid plugin repository %s is ignored: %v", name, err)
+		return nil
+	}
+
+	interval := defaultRepositoryInterval
+	if repository.Spec.Interval != nil && repository.Spec.Interval.Duration > 0 {
+		interval = repository.Spec.Interval.Duration
+	}
+	// revisit the repository to mirror the changes of its index
+	syncCtx.Queue().AddAfter(name, interval)
+
+	var manifests map[string][]byte
+	var revision string
+	switch repository.Spec.Type {
+	case v1beta1.PluginRepositoryHTTP:
+		manifests, revision, err = git.FetchIndexArchive(ctx, repository.Spec.URL)
+	default:
+		manifests, revision, err = git.FetchIndex(ctx, repository.Spec.URL, repository.Spec.Ref)
+	}
+	if err != nil {
+		return r.updateStatus(ctx, repository, metav1.Condition{
+			Status:  metav1.ConditionFalse,
+			Reason:  "FetchFailed",
+			Message: fmt.Sprintf("index %s can not be fetched: %v", repository.Spec.URL, err),
+		})
+	}
+
+	names := make([]string, 0, len(manifests))
+	for plugin := range manifests {
+		if len(repository.Spec.Plugins) == 0 || slices.Contains(repository.Spec.Plugins, plugin) {
+			names = append(names, plugin)
+		}
+	}
+	sort.Strings(names)
+
+	release := r.plugins.HoldIndex()
+	defer release()
+	var published, skipped []string
+	for _, plugin := range names {
+		k, err := r.mirrorPlugin(ctx, repository, plugin, manifests[plugin])
+		if err != nil {
+			skipped = append(skipped, fmt.Sprintf("%s: %v", plugin, err))
+			continue
+		}
+		if k == nil {
+			continue
+		}
+		for _, repo := range []*git.Repo{r.plugins.repo, r.plugins.previewRepo} {
+			if err := repo.Upsert(plugin, k); err != nil {
+				return err
+			}
+		}
+		published = append(published, plugin)
+	}
+	keep := map[string]bool{}
+	for _, plugin := range published {
+		keep[plugin] = true
+	}
+	if err := r.unpublish(repository.Name, keep); err != nil {
+		return err
+	}
+
+	repository.Status.Plugins = published
+	repository.Status.Revision = revision
+	now := metav1.Now()
+	repository.Status.LastSyncTime = &now
+	condition := metav1.Condition{
+		Status:  metav1.ConditionTrue,
+		Reason:  "Mirrored",
+		Message: fmt.Sprintf("%d plugins of index %s are mirrored", len(published), repository.Spec.URL),
+	}
+	if len(skipped) > 0 {
+		condition.Reason = "PartiallyMirrored"
+		condition.Message += fmt.Sprintf(", %d plugins are skipped: %s", len(skipped), strings.Join(skipped, "; "))
+	}
+	klog.Infof("plugin repository %s is synced at %s: %s", name, revision, condition.Message)
+	return r.updateStatus(ctx, repository, condition)
+}
+
+// mirrorPlugin returns the krew manifest of the plugin of the index, or nil if it is published otherwise.
+func (r *RepositoryController) mirrorPlugin(ctx context.Context, repository *v1beta1.PluginRepository, name string, manifest []byte) (*krew.Plugin, error) {
+	if !safePluginRegexp.MatchString(name) {
+		return nil, fmt.Errorf("invalid plugin name")
+	}
+	k := &krew.Plugin{}
+	if err := yaml.Unmarshal(manifest, k); err != nil {
+		return nil, fmt.Errorf("invalid manifest: %w", err)
+	}
+	if k.Name != name {
+		return nil, fmt.Errorf("manifest is named %s", k.Name)
+	}
+	if _, err := r.plugins.getIndexedPlugin(name); err == nil {
+		klog.V(2).Infof("plugin %s of repository %s is published by a plugin, which takes precedence", name, repository.Name)
+		return nil, nil
+	}
+	if owner := aliasOf(r.plugins.repo, name); len(owner) > 0 {
+		klog.V(2).Infof("plugin %s of repository %s is published as an alias of plugin %s, which takes precedence", name, repository.Name, owner)
+		return nil, nil
+	}
+	if owner := r.mirroredBy(name); len(owner) > 0 && owner != repository.Name && r.precedes(owner, repository) {
+		klog.V(2).Infof("plugin %s of repository %s is published by repository %s, which takes precedence", name, repository.Name, owner)
+		return nil, nil
+	}
+
+	if repository.Spec.Rehost {
+		for i, p := range k.Spec.Platforms {
+			platform := selectorPlatform(p.Selector)
+			if len(platform) == 0 {
+				return nil, fmt.Errorf("platform %d can not be rehosted, its selector does not match os and arch labels", i)
+			}
+			if _, err := image.DownloadArtifact(ctx, p.URI, p.Sha256, name, platform, image.PullOptions{}); err != nil {
+				return nil, err
+			}
+			uri, err := r.plugins.artifactURI(ctx, name, platform)
+			if err != nil {
+				return nil, err
+			}
+			k.Spec.Platforms[i].URI = uri
+		}
+	}
+	if k.Annotations == nil {
+		k.Annotations = map[string]string{}
+	}
+	k.Annotations[RepositoryAnnotation] = repository.Name
+	return k, nil
+}
+
+// precedes reports whether the PluginRepository of the name takes precedence over the repository.
+func (r *RepositoryController) precedes(name string, repository *v1beta1.PluginRepository) bool {
+	obj, exists, err := r.indexer.GetByKey(name)
+	if err != nil || !exists {
+		return false
+	}
+	other, err := meta.Accessor(obj)
+	if err != nil {
+		return false
+	}
+	created := other.GetCreationTimestamp()
+	if !created.Equal(&repository.CreationTimestamp) {
+		return created.Before(&repository.CreationTimestamp)
+	}
+	return name < repository.Name
+}
+
+// mirroredBy returns the PluginRepository the plugin of the main index is mirrored from, or an empty
+// string if it is not mirrored.
+func (r *RepositoryController) mirroredBy(name string) string {
+	return mirroredBy(r.plugins.repo, name)
+}
+
+// mirroredBy returns the PluginRepository the plugin of the index is mirrored from, or an empty
+// string if it is not mirrored.
+func mirroredBy(repo *git.Repo, name string) string {
+	return entryAnnotation(repo, name, RepositoryAnnotation)
+}
+
+// unpublish deletes the plugins mirrored from the PluginRepository from the indexes, but the kept ones,
+// along with their rehosted archives.
+func (r *RepositoryController) unpublish(repository string, keep map[string]bool) error {
+	names, err := r.plugins.repo.List()
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		if keep[name] || mirroredBy(r.plugins.repo, name) != repository {
+			continue
+		}
+		klog.Infof("plugin %s mirrored from repository %s is unpublished", name, repository)
+		for _, repo := range []*git.Repo{r.plugins.repo, r.plugins.previewRepo} {
+			if err := repo.Delete(name); err != nil {
+				return err
+			}
+		}
+		if err := removeArtifacts(name, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// updateStatus sets the Ready condition of the PluginRepository and updates its status.
+func (r *RepositoryController) updateStatus(ctx context.Context, repository *v1beta1.PluginRepository, condition metav1.Condition) error {
+	if r.plugins.options.ShardID != 0 {
+		return nil
+	}
+	condition.Type = v1beta1.ReadyCondition
+	condition.ObservedGeneration = repository.Generation
+	meta.SetStatusCondition(&repository.Status.Conditions, condition)
+	u, err := runtime.DefaultUnstructuredConverter.ToUnstructured(repository)
+	if err != nil {
+		return err
+	}
+	_, err = r.plugins.dynamicClient.Resource(pluginRepositoriesGVR).UpdateStatus(ctx, &unstructured.Unstructured{Object: u}, metav1.UpdateOptions{})
+	if errors.IsNotFound(err) || errors.IsConflict(err) {
+		// deleted or updated in the meantime, which syncs it again
+		return nil
+	}
+	return err
+}
+
+// selectorPlatform returns the os/arch platform the selector of a krew platform matches with its os
+// and arch labels, or an empty string if it does not match a single platform.
+func selectorPlatform(selector *metav1.LabelSelector) string {
+	if selector == nil || len(selector.MatchLabels["os"]) == 0 || len(selector.MatchLabels["arch"]) == 0 {
+		return ""
+	}
+	return selector.MatchLabels["os"] + "/" + selector.MatchLabels["arch"]
+}
+
+// addMirroredArtifacts records the rehosted archives of the mirrored plugin as known artifacts.
+func addMirroredArtifacts(name string, artifacts map[string]bool) {
+	for _, format := range []v1alpha1.ArchiveFormat{v1alpha1.ArchiveFormatTarGz, v1alpha1.ArchiveFormatZip} {
+		matches, _ := filepath.Glob(fmt.Sprintf("%s/%s_*.%s", image.TarballPath, name, format))
+		for _, match := range matches {
+			artifacts[filepath.Clean(match)] = true
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/openshift/cli-manager/api/v1alpha1"
+	"github.com/openshift/cli-manager/pkg/image"
+)
+
+const (
+	// defaultResolveInterval is the interval between the resolutions of a plugin if it is not set.
+	defaultResolveInterval = 10 * time.Minute
+	// resolverTimeout bounds the calls of the resolver webhooks.
+	resolverTimeout = 30 * time.Second
+	// maxResolverResponseSize bounds the size of the responses of the resolver webhooks.
+	maxResolverResponseSize = 1 << 20
+)
+
+// ResolverRequest is sent to the resolver webhook of a plugin.
+type ResolverRequest struct {
+	// Plugin is the name of the plugin.
+	Plugin string `json:"plugin"`
+	// Version is the version in the spec of the plugin.
+	Version string `json:"version"`
+	// Platforms are the platforms of the plugin with the images in its spec.
+	Platforms []ResolverPlatform `json:"platforms"`
+}
+
+// ResolverPlatform is a platform of the plugin and its image.
+type ResolverPlatform struct {
+	Platform string `json:"platform"`
+	Image    string `json:"image"`
+}
+
+// ResolverResponse is the version and the images of the plugin returned by the resolver webhook.
+type ResolverResponse struct {
+	// Version to publish, in v0.0.0 format.
+	Version string `json:"version"`
+	// Image of all the platforms, unless it is overridden in Platforms. The images of the spec are kept if empty.
+	Image string `json:"image,omitempty"`
+	// Platforms are the images of the platforms.
+	Platforms []ResolverPlatform `json:"platforms,omitempty"`
+}
+
+// resolveInterval returns the interval between the resolutions of the plugin.
+func resolveInterval(resolver *v1alpha1.VersionResolver) time.Duration {
+	if resolver.Interval != nil && resolver.Interval.Duration > 0 {
+		return resolver.Interval.Duration
+	}
+	return defaultResolveInterval
+}
+
+// resolve calls the resolver webhook of the plugin and replaces the version and the images of its
+// spec with the resolved ones, so that they are published instead.
+func (c *Controller) resolve(ctx context.Context, plugin *v1alpha1.Plugin) error {
+	resolver := plugin.Spec.Resolver
+	request := ResolverRequest{
+		Plugin:    plugin.Name,
+		Version:   plugin.Spec.Version,
+		Platforms: []ResolverPlatform{},
+	}
+	for _, p := range plugin.Spec.Platforms {
+		request.Platforms = append(request.Platforms, ResolverPlatform{Platform: p.Platform, Image: p.Image})
+	}
+	body, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion:   image.TLSMinVersion,
+		CipherSuites: image.TLSCipherSuites,
+	}
+	if len(resolver.CABundle) > 0 {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(resolver.CABundle) {
+			return fmt.Errorf("no certificates found in the CA bundle of the resolver")
+		}
+		tlsConfig.RootCAs = pool
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	client := &http.Client{Transport: transport, Timeout: resolverTimeout}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, resolver.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if len(resolver.TokenSecret) > 0 {
+		secret, err := c.getSecret(ctx, resolver.TokenSecret)
+		if err != nil {
+			return fmt.Errorf("getting resolver token secret %s: %w", resolver.TokenSecret, err)
+		}
+		token := strings.TrimSpace(string(secret.Data["token"]))
+		if len(token) == 0 {
+			return fmt.Errorf("resolver token secret %s has no token", resolver.TokenSecret)
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxResolverResponseSize))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("resolver returned %s: %s", resp.Status, strings.TrimSpace(string(data)))
+	}
+	response := &ResolverResponse{}
+	if err := json.Unmarshal(data, response); err != nil {
+		return fmt.Errorf("invalid resolver response: %w", err)
+	}
+	if len(response.Version) == 0 {
+		return fmt.Errorf("resolver returned no version")
+	}
+
+	images := map[string]string{}
+	for _, p := range response.Platforms {
+		images[p.Platform] = p.Image
+	}
+	plugin.Spec.Version = response.Version
+	for i, p := range plugin.Spec.Platforms {
+		img := response.Image
+		if platformImage, ok := images[p.Platform]; ok && len(platformImage) > 0 {
+			img = platformImage
+		}
+		// the platforms published from archive URLs and GitHub releases are kept as is
+		if len(img) > 0 && len(p.URL) == 0 && p.GitHub == nil {
+			plugin.Spec.Platforms[i].Image = img
+		}
+	}
+	return nil
+}
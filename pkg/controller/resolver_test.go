@@ -0,0 +1,58 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/openshift/cli-manager/api/v1alpha1"
+)
+
+func TestResolve(t *testing.T) {
+	resolver := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		request := &ResolverRequest{}
+		if err := json.NewDecoder(r.Body).Decode(request); err != nil || request.Plugin != "tool" || len(request.Platforms) != 2 {
+			http.Error(w, "unexpected request", http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(ResolverResponse{
+			Version:   "v1.2.0",
+			Image:     "quay.io/org/tool:v1.2.0",
+			Platforms: []ResolverPlatform{{Platform: "darwin/arm64", Image: "quay.io/org/tool-darwin:v1.2.0"}},
+		})
+	}))
+	defer resolver.Close()
+
+	plugin := &v1alpha1.Plugin{
+		Spec: v1alpha1.PluginSpec{
+			Version: "v1.0.0",
+			Platforms: []v1alpha1.PluginPlatform{
+				{Platform: "linux/amd64", Image: "quay.io/org/tool:v1.0.0"},
+				{Platform: "darwin/arm64", Image: "quay.io/org/tool-darwin:v1.0.0"},
+			},
+			Resolver: &v1alpha1.VersionResolver{
+				URL:      resolver.URL,
+				CABundle: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: resolver.Certificate().Raw}),
+			},
+		},
+	}
+	plugin.Name = "tool"
+	c := &Controller{}
+	if err := c.resolve(context.Background(), plugin); err != nil {
+		t.Fatal(err)
+	}
+	if plugin.Spec.Version != "v1.2.0" {
+		t.Fatalf("version %s is not resolved", plugin.Spec.Version)
+	}
+	if plugin.Spec.Platforms[0].Image != "quay.io/org/tool:v1.2.0" || plugin.Spec.Platforms[1].Image != "quay.io/org/tool-darwin:v1.2.0" {
+		t.Fatalf("images are not resolved: %v", plugin.Spec.Platforms)
+	}
+
+	plugin.Spec.Resolver.CABundle = nil
+	if err := c.resolve(context.Background(), plugin); err == nil {
+		t.Fatalf("untrusted resolver is called")
+	}
+}
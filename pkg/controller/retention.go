@@ -0,0 +1,91 @@
+package controller
+
+import (
+	"sort"
+	"time"
+
+	k8sver "k8s.io/apimachinery/pkg/util/version"
+
+	"github.com/openshift/cli-manager/api/v1alpha1"
+)
+
+// versionRetention returns how many older versions of the plugin are published, and for how long.
+func (c *Controller) versionRetention(plugin *v1alpha1.Plugin) (int, time.Duration) {
+	maxVersions, maxAge := -1, c.options.MaxVersionAge
+	if c.options.MaxVersions > 0 {
+		maxVersions = c.options.MaxVersions
+	}
+	if r := plugin.Spec.Retention; r != nil {
+		if r.MaxVersions != nil {
+			maxVersions = int(*r.MaxVersions)
+		}
+		if r.MaxAge != nil {
+			maxAge = r.MaxAge.Duration
+		}
+	}
+	return maxVersions, maxAge
+}
+
+// retainVersions returns the older versions kept, the versions retired and when the next one is retired.
+func retainVersions(plugin *v1alpha1.Plugin, maxVersions int, maxAge time.Duration, now time.Time) ([]v1alpha1.PluginVersion, []string, *time.Time) {
+	current, err := k8sver.ParseSemantic(plugin.Spec.Version)
+	if err != nil || (maxVersions < 0 && maxAge <= 0) {
+		return plugin.Spec.Versions, nil, nil
+	}
+	pinned := map[string]bool{}
+	for _, ch := range plugin.Spec.Channels {
+		pinned[ch.Version] = true
+	}
+	published := map[string]time.Time{}
+	for _, v := range plugin.Status.Versions {
+		if v.PublishedTime != nil {
+			published[v.Version] = v.PublishedTime.Time
+		}
+	}
+
+	type superseded struct {
+		name    string
+		version *k8sver.Version
+	}
+	var candidates []superseded
+	for _, v := range plugin.Spec.Versions {
+		version, err := k8sver.ParseSemantic(v.Version)
+		if err != nil || !version.LessThan(current) || pinned[v.Version] {
+			continue
+		}
+		candidates = append(candidates, superseded{name: v.Version, version: version})
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[j].version.LessThan(candidates[i].version)
+	})
+
+	retired := map[string]bool{}
+	var expiry *time.Time
+	for i, v := range candidates {
+		if maxVersions >= 0 && i >= maxVersions {
+			retired[v.name] = true
+			continue
+		}
+		publishedTime, ok := published[v.name]
+		if maxAge <= 0 || !ok {
+			continue
+		}
+		expiresAt := publishedTime.Add(maxAge)
+		if !now.Before(expiresAt) {
+			retired[v.name] = true
+		} else if expiry == nil || expiresAt.Before(*expiry) {
+			expiry = &expiresAt
+		}
+	}
+
+	var retained []v1alpha1.PluginVersion
+	var retiredVersions []string
+	for _, v := range plugin.Spec.Versions {
+		if retired[v.Version] {
+			retiredVersions = append(retiredVersions, v.Version)
+			continue
+		}
+		retained = append(retained, v)
+	}
+	return retained, retiredVersions, expiry
+}
@@ -0,0 +1,221 @@
+package controller
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/validation"
+	k8sver "k8s.io/apimachinery/pkg/util/version"
+
+	"github.com/openshift/cli-manager/api/v1alpha1"
+	"github.com/openshift/cli-manager/pkg/image"
+)
+
+// sha256Regexp matches the sha256 checksums in hex format.
+var sha256Regexp = regexp.MustCompile(`^[a-fA-F0-9]{64}$`)
+
+// gitHubRepositoryRegexp matches the GitHub repositories in owner/name format.
+var gitHubRepositoryRegexp = regexp.MustCompile(`^[A-Za-z0-9_.-]+/[A-Za-z0-9_.-]+$`)
+
+// minResyncInterval is the shortest resync interval of the plugins, so that the registries are not
+// polled in a loop.
+const minResyncInterval = time.Minute
+
+// safePluginRegexp matches the names of the plugins, which krew installs as file names.
+var safePluginRegexp = regexp.MustCompile(`^[\w-]+$`)
+
+// ValidatePlugin returns why the spec of the plugin is invalid, if it is.
+func ValidatePlugin(plugin *v1alpha1.Plugin) error {
+	// the inherited images are validated as the images of the platforms
+	plugin = plugin.DeepCopy()
+	inheritImages(plugin)
+	var errs []error
+	if !safePluginRegexp.MatchString(plugin.Name) {
+		errs = append(errs, fmt.Errorf("invalid plugin name %s", plugin.Name))
+	}
+	for _, validate := range []func(*v1alpha1.Plugin) error{validateMetadata, validateVersion, validateVersions, validateChannels, validatePlatforms, validateAliases, validateNamespace, validateResyncInterval, validateRetention, validateCategories} {
+		if err := validate(plugin); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+// validateVersion returns why the version of the spec is invalid, if it is.
+func validateVersion(plugin *v1alpha1.Plugin) error {
+	if !strings.HasPrefix(plugin.Spec.Version, "v") {
+		return fmt.Errorf("invalid version %s, should start with v like v0.0.0", plugin.Spec.Version)
+	}
+	if _, err := k8sver.ParseSemantic(plugin.Spec.Version); err != nil {
+		return fmt.Errorf("invalid version %s, should be in v0.0.0 format", plugin.Spec.Version)
+	}
+	return nil
+}
+
+// validateResyncInterval returns why the resync interval of the plugin is invalid, if it is.
+func validateResyncInterval(plugin *v1alpha1.Plugin) error {
+	interval := plugin.Spec.ResyncInterval
+	if interval == nil || interval.Duration == 0 || interval.Duration >= minResyncInterval {
+		return nil
+	}
+	return fmt.Errorf("invalid resyncInterval %s, should be 0s or at least %s", interval.Duration, minResyncInterval)
+}
+
+// validateRetention returns why the retention of the older versions of the plugin is invalid, if it is.
+func validateRetention(plugin *v1alpha1.Plugin) error {
+	r := plugin.Spec.Retention
+	if r == nil {
+		return nil
+	}
+	if r.MaxVersions != nil && *r.MaxVersions < 0 {
+		return fmt.Errorf("invalid retention maxVersions %d, should not be negative", *r.MaxVersions)
+	}
+	if r.MaxAge != nil && r.MaxAge.Duration < 0 {
+		return fmt.Errorf("invalid retention maxAge %s, should not be negative", r.MaxAge.Duration)
+	}
+	return nil
+}
+
+// validateCategories returns why the categories and the tags of the plugin are invalid, if they are.
+func validateCategories(plugin *v1alpha1.Plugin) error {
+	var errs []error
+	validate := func(field string, values []string) {
+		for _, value := range values {
+			if msgs := validation.IsDNS1123Label(value); len(msgs) > 0 {
+				errs = append(errs, fmt.Errorf("invalid %s %s: %s", field, value, strings.Join(msgs, ", ")))
+			}
+		}
+	}
+	validate("category", plugin.Spec.Categories)
+	validate("tag", plugin.Spec.Tags)
+	return utilerrors.NewAggregate(errs)
+}
+
+// validatePlatforms returns why the platforms of the plugin and of its older versions are invalid, if they are.
+func validatePlatforms(plugin *v1alpha1.Plugin) error {
+	var errs []error
+	validate := func(version string, platforms []v1alpha1.PluginPlatform) {
+		seen := map[string]bool{}
+		for _, p := range platforms {
+			platform := versionPlatform{version: version, PluginPlatform: p}
+			if fields := strings.SplitN(p.Platform, "/", 2); len(fields) < 2 || len(fields[0]) == 0 || len(fields[1]) == 0 {
+				errs = append(errs, fmt.Errorf("invalid platform %s, should be in os/arch format like linux/amd64", platform))
+			}
+			if seen[p.Platform] {
+				errs = append(errs, fmt.Errorf("platform %s is set more than once", platform))
+			}
+			seen[p.Platform] = true
+			if len(p.Files) == 0 {
+				errs = append(errs, fmt.Errorf("platform %s has no files", platform))
+			}
+			switch {
+			case p.GitHub != nil:
+				if err := validateGitHub(p); err != nil {
+					errs = append(errs, fmt.Errorf("platform %s: %w", platform, err))
+				}
+			case len(p.URL) > 0:
+				if err := validateArchive(p); err != nil {
+					errs = append(errs, fmt.Errorf("platform %s: %w", platform, err))
+				}
+			case len(p.Image) == 0:
+				errs = append(errs, fmt.Errorf("platform %s has no image, url or github, and no image to inherit", platform))
+			default:
+				if err := validateImage(p.Image); err != nil {
+					errs = append(errs, fmt.Errorf("platform %s: %w", platform, err))
+				}
+			}
+			if err := validateBin(p.Bin); err != nil {
+				errs = append(errs, fmt.Errorf("platform %s: %w", platform, err))
+			}
+		}
+	}
+	validate("", plugin.Spec.Platforms)
+	for _, v := range plugin.Spec.Versions {
+		validate(v.Version, v.Platforms)
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+// validateBin returns why the bin of a platform is invalid, if it is.
+func validateBin(bin string) error {
+	if len(bin) == 0 {
+		return nil
+	}
+	if path.IsAbs(bin) || strings.Contains(bin, "\\") || path.Clean(bin) != bin || bin == "." || strings.HasPrefix(bin, "../") || bin == ".." {
+		return fmt.Errorf("invalid bin %s, should be a clean path relative to the installation directory", bin)
+	}
+	return nil
+}
+
+// validateArchive returns why the archive URL of a platform is invalid, if it is.
+func validateArchive(p v1alpha1.PluginPlatform) error {
+	var errs []error
+	if u, err := url.Parse(p.URL); err != nil || u.Scheme != "https" || len(u.Host) == 0 {
+		errs = append(errs, fmt.Errorf("invalid url %s, only https URLs are downloaded", p.URL))
+	}
+	if len(p.Image) > 0 {
+		errs = append(errs, fmt.Errorf("image %s is set along with url %s", p.Image, p.URL))
+	}
+	if !sha256Regexp.MatchString(p.Sha256) {
+		errs = append(errs, fmt.Errorf("invalid sha256 %q of url %s, should be 64 hexadecimal characters", p.Sha256, p.URL))
+	}
+	errs = append(errs, validateRehostedFiles(p)...)
+	return utilerrors.NewAggregate(errs)
+}
+
+// validateGitHub returns why the GitHub release of a platform is invalid, if it is.
+func validateGitHub(p v1alpha1.PluginPlatform) error {
+	var errs []error
+	source := p.GitHub
+	if !gitHubRepositoryRegexp.MatchString(source.Repository) {
+		errs = append(errs, fmt.Errorf("invalid repository %s, should be in owner/name format", source.Repository))
+	}
+	if len(p.Image) > 0 || len(p.URL) > 0 {
+		errs = append(errs, fmt.Errorf("image or url is set along with the release of %s", source.Repository))
+	}
+	for _, pattern := range []string{source.Asset, source.Checksums} {
+		if _, err := path.Match(pattern, ""); err != nil {
+			errs = append(errs, fmt.Errorf("invalid asset pattern %s: %w", pattern, err))
+		}
+	}
+	if len(source.Asset) == 0 {
+		errs = append(errs, fmt.Errorf("asset of the release of %s is not set", source.Repository))
+	}
+	errs = append(errs, validateRehostedFiles(p)...)
+	return utilerrors.NewAggregate(errs)
+}
+
+// validateRehostedFiles returns why the files of a rehosted archive are invalid, if they are.
+func validateRehostedFiles(p v1alpha1.PluginPlatform) []error {
+	var errs []error
+	if len(p.ArchiveFormat) > 0 || p.RawBinary || p.Completions != nil || len(p.ManPages) > 0 {
+		errs = append(errs, fmt.Errorf("archiveFormat, rawBinary, completions and manPages are only supported with image"))
+	}
+	for _, f := range p.Files {
+		if path.IsAbs(f.From) || f.StripComponents > 0 || len(f.Exclude) > 0 || len(f.Transforms) > 0 {
+			errs = append(errs, fmt.Errorf("invalid file %s, should be a path of the archive without stripComponents, exclude or transforms", f.From))
+		}
+	}
+	return errs
+}
+
+// validateImage returns why the image reference is invalid or not allowed by the registry policy, if it is.
+func validateImage(src string) error {
+	switch {
+	case image.IsImageStreamTag(src):
+		_, _, _, err := image.ParseImageStreamTag(src)
+		return err
+	case image.IsLocal(src) || image.IsConfigMap(src):
+		return nil
+	}
+	if _, err := name.ParseReference(src); err != nil {
+		return fmt.Errorf("invalid image %s: %w", src, err)
+	}
+	return image.CheckRegistryPolicy(src)
+}
@@ -0,0 +1,97 @@
+package controller
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	k8sver "k8s.io/apimachinery/pkg/util/version"
+
+	"github.com/openshift/cli-manager/api/v1alpha1"
+	"github.com/openshift/cli-manager/pkg/git"
+)
+
+// versionSeparator separates the name of the plugin from its version in the names of the older versions.
+const versionSeparator = "_"
+
+var unsafeVersionRegexp = regexp.MustCompile(`[^\w-]`)
+
+// VersionedName returns the name the version of the plugin is published with, i.e. tool_v1-2-0.
+func VersionedName(name, version string) string {
+	return name + versionSeparator + unsafeVersionRegexp.ReplaceAllString(version, "-")
+}
+
+// validateVersions returns why the older versions of the plugin can not be published, if they can not.
+func validateVersions(plugin *v1alpha1.Plugin) error {
+	names := map[string]string{VersionedName(plugin.Name, plugin.Spec.Version): plugin.Spec.Version}
+	for _, v := range plugin.Spec.Versions {
+		if !strings.HasPrefix(v.Version, "v") {
+			return fmt.Errorf("invalid version %s, should start with v like v0.0.0", v.Version)
+		}
+		if _, err := k8sver.ParseSemantic(v.Version); err != nil {
+			return fmt.Errorf("invalid version %s, should be in v0.0.0 format", v.Version)
+		}
+		name := VersionedName(plugin.Name, v.Version)
+		if other, ok := names[name]; ok {
+			return fmt.Errorf("version %s is published as %s like version %s", v.Version, name, other)
+		}
+		names[name] = v.Version
+	}
+	return nil
+}
+
+// versionPlugin returns the plugin publishing the older version, named after VersionedName, with
+// the platforms of the version in its spec and the ones published for it in its status.
+func versionPlugin(plugin *v1alpha1.Plugin, version string) *v1alpha1.Plugin {
+	p := plugin.DeepCopy()
+	p.Name = VersionedName(plugin.Name, version)
+	p.Spec.Version = version
+	p.Spec.Platforms = nil
+	p.Spec.Resolver = nil
+	p.Spec.Versions = nil
+	for _, v := range plugin.Spec.Versions {
+		if v.Version == version {
+			p.Spec.Platforms = v.Platforms
+			if v.Deprecation != nil {
+				p.Spec.Deprecation = v.Deprecation
+			}
+		}
+	}
+	p.Status.Platforms = nil
+	p.Status.SkippedPlatforms = nil
+	p.Status.ResolvedVersion = ""
+	p.Status.Versions = nil
+	for _, v := range plugin.Status.Versions {
+		if v.Version == version {
+			p.Status.Platforms = v.Platforms
+		}
+	}
+	return p
+}
+
+// publishVersions publishes the older versions of the plugin from its status.
+func (c *Controller) publishVersions(plugin *v1alpha1.Plugin) error {
+	for _, v := range plugin.Status.Versions {
+		p := versionPlugin(plugin, v.Version)
+		if err := c.publishPlugin(p, newKrewPluginFromStatus(p)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// unpublishVersions deletes the older versions of the plugin from the index.
+func unpublishVersions(name string, repo *git.Repo) error {
+	names, err := repo.List()
+	if err != nil {
+		return err
+	}
+	for _, n := range names {
+		if strings.HasPrefix(n, name+versionSeparator) {
+			if err := repo.Delete(n); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+package generate
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/openshift/cli-manager/api/v1alpha1"
+	krew "github.com/openshift/cli-manager/pkg/krew/v1alpha2"
+)
+
+// Options are how the platforms of a krew manifest are mapped to the platforms of a Plugin.
+type Options struct {
+	// Name of the Plugin, the name of the krew manifest if empty.
+	Name string
+	// Image the files of every platform are extracted from, whose ${os}, ${arch} and ${version}
+	// placeholders are replaced by the ones of the platform, i.e. quay.io/org/tool:${version}.
+	// The archives of the krew manifest are downloaded from their URIs instead if it is empty. The image
+	// without ${os} and ${arch} is set in the spec, and inherited by the platforms.
+	Image string
+	// Root is the directory of the image holding the files of the archives of the krew manifest,
+	// which are relative to the root of the archives.
+	Root string
+}
+
+// Placeholders of Options.Image.
+const (
+	OSPlaceholder      = "${os}"
+	ArchPlaceholder    = "${arch}"
+	VersionPlaceholder = "${version}"
+)
+
+// Plugin returns the Plugin equivalent to the krew manifest, publishing the files of its platforms
+// from the image of the options, or from the archives of the manifest if it is not set, along with the
+// platforms of the manifest that can not be converted. The platforms are skipped if their selectors do
+// not match a single os/arch with matchLabels, or if their archives are not downloaded over HTTPS.
+func Plugin(k *krew.Plugin, o Options) (*v1alpha1.Plugin, []string, error) {
+	root := o.Root
+	if len(root) == 0 {
+		root = "/"
+	}
+	if !path.IsAbs(root) {
+		return nil, nil, fmt.Errorf("invalid root %s, should be an absolute path of the image", root)
+	}
+
+	plugin := &v1alpha1.Plugin{
+		Spec: v1alpha1.PluginSpec{
+			ShortDescription: k.Spec.ShortDescription,
+			Description:      k.Spec.Description,
+			Caveats:          k.Spec.Caveats,
+			Homepage:         k.Spec.Homepage,
+			Version:          k.Spec.Version,
+			Platforms:        []v1alpha1.PluginPlatform{},
+		},
+	}
+	plugin.APIVersion = v1alpha1.GroupVersion.String()
+	plugin.Kind = "Plugin"
+	plugin.Name = k.Name
+	if len(o.Name) > 0 {
+		plugin.Name = o.Name
+	}
+
+	var skipped []string
+	seen := map[string]bool{}
+	for i, p := range k.Spec.Platforms {
+		goos, goarch := platformOf(p)
+		if len(goos) == 0 || len(goarch) == 0 {
+			skipped = append(skipped, fmt.Sprintf("platform %d: selector does not match a single os and arch with matchLabels", i))
+			continue
+		}
+		platform := goos + "/" + goarch
+		if seen[platform] {
+			skipped = append(skipped, fmt.Sprintf("platform %d: %s is matched by an earlier platform", i, platform))
+			continue
+		}
+		seen[platform] = true
+
+		if len(o.Image) == 0 && !strings.HasPrefix(p.URI, "https://") {
+			skipped = append(skipped, fmt.Sprintf("platform %d: archive %s is not downloaded over https", i, p.URI))
+			continue
+		}
+
+		files := make([]v1alpha1.FileLocation, 0, len(p.Files))
+		for _, f := range p.Files {
+			to := f.To
+			if len(to) == 0 {
+				to = "."
+			}
+			from := f.From
+			if len(o.Image) > 0 {
+				from = path.Join(root, f.From)
+			}
+			files = append(files, v1alpha1.FileLocation{From: from, To: to})
+		}
+		pluginPlatform := v1alpha1.PluginPlatform{
+			Platform: platform,
+			Files:    files,
+			Bin:      p.Bin,
+		}
+		switch {
+		case len(o.Image) == 0:
+			pluginPlatform.URL = p.URI
+			pluginPlatform.Sha256 = p.Sha256
+		case !strings.Contains(o.Image, OSPlaceholder) && !strings.Contains(o.Image, ArchPlaceholder):
+			// the platforms of a manifest list inherit the image of the spec
+			plugin.Spec.Image = strings.NewReplacer(VersionPlaceholder, k.Spec.Version).Replace(o.Image)
+		default:
+			pluginPlatform.Image = strings.NewReplacer(OSPlaceholder, goos, ArchPlaceholder, goarch, VersionPlaceholder, k.Spec.Version).Replace(o.Image)
+		}
+		plugin.Spec.Platforms = append(plugin.Spec.Platforms, pluginPlatform)
+	}
+	if len(plugin.Spec.Platforms) == 0 {
+		return nil, skipped, fmt.Errorf("plugin %s has no platform matching a single os and arch", k.Name)
+	}
+	return plugin, skipped, nil
+}
+
+// platformOf returns the os and the arch the selector of the krew platform matches, or empty
+// strings if it does not match a single os and arch with its matchLabels.
+func platformOf(p krew.Platform) (string, string) {
+	if p.Selector == nil || len(p.Selector.MatchExpressions) > 0 {
+		return "", ""
+	}
+	return p.Selector.MatchLabels["os"], p.Selector.MatchLabels["arch"]
+}
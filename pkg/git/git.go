@@ -1,6 +1,7 @@
 package git
 
 import (
+	"bufio"
 	"bytes"
 	"context"
 	"fmt"
@@ -9,6 +10,7 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
@@ -28,9 +30,27 @@ import (
 	krew "github.com/openshift/cli-manager/pkg/krew/v1alpha2"
 )
 
-const GitRepoPath = "/var/run/git/cli-manager"
+const (
+	GitRepoPath = "/var/run/git/cli-manager"
+	// PreviewGitRepoPath is the location of the preview index that contains
+	// every published plugin in addition to the ones staged for preview.
+	PreviewGitRepoPath = "/var/run/git/cli-manager-preview"
+	// ChannelsGitRepoPath is the directory of the indexes of the release channels, which
+	// publish every plugin with the version its channel points at.
+	ChannelsGitRepoPath = "/var/run/git/cli-manager-channels"
+	// ChecksumHeader is the header the sha256 checksum of the downloaded artifacts is sent in, in hex format.
+	ChecksumHeader = "X-Checksum-Sha256"
+
+	// zstdMediaType is accepted by the clients downloading the tar.zst variants of the artifacts.
+	zstdMediaType = "application/zstd"
+)
 
 var (
+	// PathPrefix is the URL path the indexes, the artifacts and the JSON API are served under.
+	// The preview index is served under PathPrefix followed by -preview, and the index of
+	// every release channel under PathPrefix followed by - and the channel, i.e. -stable.
+	PathPrefix = "/cli-manager"
+
 	registerControllerMetrics sync.Once
 	gitAPIRequestCounts       = metrics.NewCounterVec(
 		&metrics.CounterOpts{
@@ -50,11 +70,72 @@ func init() {
 
 type Repo struct {
 	repo *git.Repository
+	path string
+
+	// mu serializes the changes of the controller and the repairs of fsck
+	mu sync.Mutex
+	// held counts the holders deferring the commits, see Hold
+	held int
+	// pending are the messages of the changes not committed while held
+	pending []string
+}
+
+// Hold defers the commits of the plugin changes until Release is called by every
+// holder, so that a batch of changes is published to the index in a single commit.
+func (r *Repo) Hold() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.held++
+}
+
+// Release commits the changes deferred by Hold once the last holder releases the repository.
+func (r *Repo) Release() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.held > 0 {
+		r.held--
+	}
+	if r.held > 0 || len(r.pending) == 0 {
+		return nil
+	}
+	tree, err := r.repo.Worktree()
+	if err != nil {
+		return err
+	}
+	message := fmt.Sprintf("apply %d plugin changes\n\n%s", len(r.pending), strings.Join(r.pending, "\n"))
+	r.pending = nil
+	if err := commit(tree, message); err != nil && err != git.ErrEmptyCommit {
+		// the deferred changes may cancel each other out
+		return err
+	}
+	return nil
+}
+
+// commit commits the staged change, or defers it while the repository is held.
+// The caller must hold mu.
+func (r *Repo) commit(tree *git.Worktree, message string) error {
+	if r.held > 0 {
+		r.pending = append(r.pending, message)
+		return nil
+	}
+	return commit(tree, message)
+}
+
+func commit(tree *git.Worktree, message string) error {
+	_, err := tree.Commit(message, &git.CommitOptions{
+		Author: &object.Signature{
+			Name:  "OpenShift CLI Manager",
+			Email: "info@redhat.com",
+			When:  time.Now(),
+		}})
+	return err
 }
 
 // Delete deletes the plugin yaml from the git repository
 // and commits.
 func (r *Repo) Delete(name string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
 	fileName := fmt.Sprintf("plugins/%s.yaml", name)
 	tree, err := r.repo.Worktree()
 	if err != nil {
@@ -73,17 +154,7 @@ func (r *Repo) Delete(name string) error {
 	if err != nil {
 		return err
 	}
-	_, err = tree.Commit(fmt.Sprintf("remove plugin %s", name), &git.CommitOptions{
-		Author: &object.Signature{
-			Name:  "OpenShift CLI Manager",
-			Email: "info@redhat.com",
-			When:  time.Now(),
-		}})
-	if err != nil {
-		return err
-	}
-
-	return nil
+	return r.commit(tree, fmt.Sprintf("remove plugin %s", name))
 }
 
 // Upsert adds new plugin yaml if currently it doesn't exist,
@@ -92,6 +163,8 @@ func (r *Repo) Upsert(name string, plugin *krew.Plugin) error {
 	if plugin == nil {
 		return nil
 	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
 	fileName := fmt.Sprintf("plugins/%s.yaml", name)
 	tree, err := r.repo.Worktree()
 	if err != nil {
@@ -121,24 +194,54 @@ func (r *Repo) Upsert(name string, plugin *krew.Plugin) error {
 		return err
 	}
 
-	_, err = tree.Commit(fmt.Sprintf("add plugin %s", name), &git.CommitOptions{
-		Author: &object.Signature{
-			Name:  "OpenShift CLI Manager",
-			Email: "info@redhat.com",
-			When:  time.Now(),
-		}})
+	return r.commit(tree, fmt.Sprintf("add plugin %s", name))
+}
+
+// List returns the names of the plugins in the git repository.
+func (r *Repo) List() ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	tree, err := r.repo.Worktree()
 	if err != nil {
-		return err
+		return nil, err
+	}
+	files, err := tree.Filesystem.ReadDir("plugins")
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, f := range files {
+		if name, ok := strings.CutSuffix(f.Name(), ".yaml"); ok && !f.IsDir() {
+			names = append(names, name)
+		}
 	}
+	return names, nil
+}
 
-	return nil
+// Read returns the plugin yaml in the git repository, or nil if it does not exist.
+func (r *Repo) Read(name string) ([]byte, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	tree, err := r.repo.Worktree()
+	if err != nil {
+		return nil, err
+	}
+	f, err := tree.Filesystem.Open(fmt.Sprintf("plugins/%s.yaml", name))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+	return io.ReadAll(f)
 }
 
-// PrepareLocalGit creates a git directory and applies first commit
-// to make it ready consumed by Krew.
-func PrepareLocalGit() (*Repo, error) {
-	os.RemoveAll(GitRepoPath)
-	r, err := git.PlainInit(GitRepoPath, false)
+// PrepareLocalGit creates a git directory in the given path and applies
+// first commit to make it ready consumed by Krew.
+func PrepareLocalGit(path string) (*Repo, error) {
+	os.RemoveAll(path)
+	r, err := git.PlainInit(path, false)
 	if err != nil {
 		return nil, err
 	}
@@ -186,25 +289,48 @@ func PrepareLocalGit() (*Repo, error) {
 	}
 	return &Repo{
 		repo: r,
+		path: path,
 	}, nil
 }
 
 // PrepareGitServer creates a http server mux to support git compatible
 // endpoints in addition to plugin download mechanism.
-func PrepareGitServer() *http.ServeMux {
+// The preview index is served under PathPrefix-preview so that admins
+// can point a test krew at it before promoting plugins to the main index,
+// and the indexes of the release channels under PathPrefix-<channel>.
+func PrepareGitServer(repo, previewRepo *Repo, channelRepos map[string]*Repo) *http.ServeMux {
 	mux := http.NewServeMux()
-	mux.HandleFunc("/cli-manager/plugins/download/", func(writer http.ResponseWriter, request *http.Request) {
-		gitAPIRequestCounts.WithLabelValues("/cli-manager/plugins/download/").Inc()
+	mux.HandleFunc(PathPrefix+"/plugins/download/", func(writer http.ResponseWriter, request *http.Request) {
+		gitAPIRequestCounts.WithLabelValues(PathPrefix + "/plugins/download/").Inc()
 		HandleDownloadPlugin(writer, request)
 	})
-	mux.HandleFunc("/cli-manager/info/refs", func(writer http.ResponseWriter, request *http.Request) {
-		gitAPIRequestCounts.WithLabelValues("/cli-manager/info/refs").Inc()
-		HandleGitAdversitement(writer, request)
+	mux.HandleFunc(PathPrefix+"/info/refs", func(writer http.ResponseWriter, request *http.Request) {
+		gitAPIRequestCounts.WithLabelValues(PathPrefix + "/info/refs").Inc()
+		HandleGitAdversitement(writer, request, repo.path)
+	})
+	mux.HandleFunc(PathPrefix+"/git-upload-pack", func(writer http.ResponseWriter, request *http.Request) {
+		gitAPIRequestCounts.WithLabelValues(PathPrefix + "/git-upload-pack").Inc()
+		HandleGitUploadPack(writer, request, repo.path)
 	})
-	mux.HandleFunc("/cli-manager/git-upload-pack", func(writer http.ResponseWriter, request *http.Request) {
-		gitAPIRequestCounts.WithLabelValues("/cli-manager/git-upload-pack").Inc()
-		HandleGitUploadPack(writer, request)
+	mux.HandleFunc(PathPrefix+"-preview/info/refs", func(writer http.ResponseWriter, request *http.Request) {
+		gitAPIRequestCounts.WithLabelValues(PathPrefix + "-preview/info/refs").Inc()
+		HandleGitAdversitement(writer, request, previewRepo.path)
 	})
+	mux.HandleFunc(PathPrefix+"-preview/git-upload-pack", func(writer http.ResponseWriter, request *http.Request) {
+		gitAPIRequestCounts.WithLabelValues(PathPrefix + "-preview/git-upload-pack").Inc()
+		HandleGitUploadPack(writer, request, previewRepo.path)
+	})
+	for channel, channelRepo := range channelRepos {
+		prefix := PathPrefix + "-" + channel
+		mux.HandleFunc(prefix+"/info/refs", func(writer http.ResponseWriter, request *http.Request) {
+			gitAPIRequestCounts.WithLabelValues(prefix + "/info/refs").Inc()
+			HandleGitAdversitement(writer, request, channelRepo.path)
+		})
+		mux.HandleFunc(prefix+"/git-upload-pack", func(writer http.ResponseWriter, request *http.Request) {
+			gitAPIRequestCounts.WithLabelValues(prefix + "/git-upload-pack").Inc()
+			HandleGitUploadPack(writer, request, channelRepo.path)
+		})
+	}
 	mux.HandleFunc("/healthz", func(writer http.ResponseWriter, request *http.Request) {
 		writer.WriteHeader(http.StatusOK)
 	})
@@ -214,7 +340,7 @@ func PrepareGitServer() *http.ServeMux {
 // HandleGitAdversitement handles the git advertisement requests done by client tools
 // relying on git compatibility. This function only supports upload-pack requests to limit
 // the supported functionality only to git fetch and git clone.
-func HandleGitAdversitement(w http.ResponseWriter, r *http.Request) {
+func HandleGitAdversitement(w http.ResponseWriter, r *http.Request, repoPath string) {
 	klog.Infof("plugin git advertisement request")
 	if r.Method != http.MethodGet {
 		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
@@ -243,7 +369,7 @@ func HandleGitAdversitement(w http.ResponseWriter, r *http.Request) {
 	// Because go-git does not properly work on some git requests (especially git fetch).
 	// Besides, relying on git tool for such a simple but crucial functionality for our case
 	// would be better for long term.
-	cmd := exec.CommandContext(context.TODO(), "git", "upload-pack", "--stateless-rpc", "--advertise-refs", GitRepoPath)
+	cmd := exec.CommandContext(context.TODO(), "git", "upload-pack", "--stateless-rpc", "--advertise-refs", repoPath)
 	errbuf, outbuf := &bytes.Buffer{}, &bytes.Buffer{}
 	cmd.Stdin, cmd.Stdout, cmd.Stderr = r.Body, outbuf, io.MultiWriter(errbuf, os.Stderr)
 	if err := cmd.Run(); err != nil {
@@ -266,7 +392,7 @@ func HandleGitAdversitement(w http.ResponseWriter, r *http.Request) {
 	w.Write(outbuf.Bytes())
 }
 
-func HandleGitUploadPack(w http.ResponseWriter, r *http.Request) {
+func HandleGitUploadPack(w http.ResponseWriter, r *http.Request, repoPath string) {
 	klog.Infof("plugin git upload pack request")
 	if r.Method != http.MethodPost {
 		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
@@ -277,7 +403,7 @@ func HandleGitUploadPack(w http.ResponseWriter, r *http.Request) {
 	// Because go-git does not properly work on some git requests (especially git fetch).
 	// Besides, relying on git tool for such a simple but crucial functionality for our case
 	// would be better for long term.
-	cmd := exec.CommandContext(context.TODO(), "git", "upload-pack", "--stateless-rpc", GitRepoPath)
+	cmd := exec.CommandContext(context.TODO(), "git", "upload-pack", "--stateless-rpc", repoPath)
 	errbuf, outbuf := &bytes.Buffer{}, &bytes.Buffer{}
 	cmd.Stdin, cmd.Stdout, cmd.Stderr = r.Body, outbuf, io.MultiWriter(errbuf, os.Stderr)
 	if err := cmd.Run(); err != nil {
@@ -291,6 +417,45 @@ func HandleGitUploadPack(w http.ResponseWriter, r *http.Request) {
 	w.Write(outbuf.Bytes())
 }
 
+// acceptsZstd reports whether the client accepts the tar.zst variants of the artifacts.
+func acceptsZstd(r *http.Request) bool {
+	for _, accept := range r.Header.Values("Accept") {
+		for _, mediaType := range strings.Split(accept, ",") {
+			mediaType, params, _ := strings.Cut(strings.TrimSpace(mediaType), ";")
+			if strings.TrimSpace(mediaType) == zstdMediaType && strings.ReplaceAll(params, " ", "") != "q=0" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// deprecations are the warnings sent with the downloads of the artifacts of the deprecated plugins,
+// by plugin, and by the names the plugin and its older versions are published under.
+var deprecations sync.Map
+
+// SetDeprecations sets the warnings sent with the downloads of the artifacts of the plugin by the
+// names they are published under, replacing the ones set before for the plugin.
+func SetDeprecations(plugin string, warnings map[string]string) {
+	if len(warnings) == 0 {
+		deprecations.Delete(plugin)
+		return
+	}
+	deprecations.Store(plugin, warnings)
+}
+
+// deprecationWarning returns the warning sent with the downloads of the artifacts published under
+// the name, or empty if they are not deprecated.
+func deprecationWarning(name string) string {
+	// the older versions of the plugins are published as <plugin>_<version>
+	plugin, _, _ := strings.Cut(name, "_")
+	warnings, ok := deprecations.Load(plugin)
+	if !ok {
+		return ""
+	}
+	return warnings.(map[string]string)[name]
+}
+
 func HandleDownloadPlugin(w http.ResponseWriter, r *http.Request) {
 	if r.Method != "GET" {
 		w.WriteHeader(http.StatusMethodNotAllowed)
@@ -319,9 +484,45 @@ func HandleDownloadPlugin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	fileName := fmt.Sprintf("%s_%s.tar.gz", name, platform)
-	filePath := fmt.Sprintf("%s/%s", image.TarballPath, fileName)
-	f, err := os.Open(filepath.Clean(filePath))
+	if warning := deprecationWarning(name); len(warning) > 0 {
+		w.Header().Set("Warning", "299 - "+strconv.Quote(warning))
+	}
+
+	if r.URL.Query().Get("sbom") == "true" {
+		handleDownloadSBOM(w, name, platform)
+		return
+	}
+	if r.URL.Query().Get("binary") == "true" {
+		handleDownloadBinary(w, name, platform)
+		return
+	}
+	if shell := r.URL.Query().Get("completion"); len(shell) > 0 {
+		handleDownloadCompletion(w, name, platform, shell)
+		return
+	}
+	if r.URL.Query().Get("man") == "true" {
+		handleDownloadManPages(w, name, platform)
+		return
+	}
+
+	// the artifacts of the windows platforms are usually zip archives, and the clients accepting
+	// zstd are served the tar.zst variant of the tar.gz artifacts if there is one
+	formats := []string{"tar.gz", "zip"}
+	if acceptsZstd(r) {
+		formats = append([]string{"tar.zst"}, formats...)
+	}
+	w.Header().Set("Vary", "Accept")
+	var fileName, filePath string
+	var f *os.File
+	var err error
+	for _, format := range formats {
+		fileName = fmt.Sprintf("%s_%s.%s", name, platform, format)
+		filePath = fmt.Sprintf("%s/%s", image.TarballPath, fileName)
+		f, err = os.Open(filepath.Clean(filePath))
+		if !os.IsNotExist(err) {
+			break
+		}
+	}
 	if err != nil {
 		if os.IsNotExist(err) {
 			http.Error(w, err.Error(), http.StatusNotFound)
@@ -333,7 +534,14 @@ func HandleDownloadPlugin(w http.ResponseWriter, r *http.Request) {
 	defer f.Close()
 
 	w.Header().Set("Content-Type", "application/octet-stream")
+	if strings.HasSuffix(fileName, ".tar.zst") {
+		w.Header().Set("Content-Type", zstdMediaType)
+	}
 	w.Header().Set("Content-Disposition", "attachment; filename="+fileName)
+	if checksum, err := os.ReadFile(image.ChecksumPath(filepath.Clean(filePath))); err == nil {
+		// clients can verify the download without the krew manifest
+		w.Header().Set(ChecksumHeader, strings.TrimSpace(string(checksum)))
+	}
 	w.Header().Set("Content-Transfer-Encoding", "binary")
 
 	if _, err = io.Copy(w, f); err != nil {
@@ -341,3 +549,130 @@ func HandleDownloadPlugin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 }
+
+// handleDownloadSBOM serves the SBOM of the image of the plugin platform, extracted next to its artifact.
+func handleDownloadSBOM(w http.ResponseWriter, name, platform string) {
+	sbom, err := image.FindSBOM(filepath.Clean(fmt.Sprintf("%s/%s_%s.tar.gz", image.TarballPath, name, platform)))
+	if err != nil {
+		http.Error(w, fmt.Errorf("getting SBOM: name: %s, platform: %s err: %w", name, platform, err).Error(), http.StatusInternalServerError)
+		return
+	}
+	if sbom == nil {
+		http.Error(w, fmt.Sprintf("plugin %s has no SBOM for platform %s", name, platform), http.StatusNotFound)
+		return
+	}
+	f, err := os.Open(sbom.Path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		http.Error(w, fmt.Errorf("getting SBOM: name: %s, platform: %s err: %w", name, platform, err).Error(), http.StatusInternalServerError)
+		return
+	}
+	defer f.Close()
+
+	w.Header().Set("Content-Type", image.SBOMMediaType(sbom.Format))
+	w.Header().Set("Content-Disposition", "attachment; filename="+filepath.Base(sbom.Path))
+	w.Header().Set(ChecksumHeader, sbom.Sha256)
+	if _, err = io.Copy(w, f); err != nil {
+		http.Error(w, fmt.Errorf("getting SBOM: name: %s, platform: %s err: %w", name, platform, err).Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// handleDownloadCompletion serves the completion script of the shell of the plugin platform, so that
+// users can source it without installing the plugin with krew.
+func handleDownloadCompletion(w http.ResponseWriter, name, platform, shell string) {
+	if !slices.Contains(image.CompletionShells, shell) {
+		http.Error(w, fmt.Sprintf("invalid completion shell %s, should be one of %s", shell, strings.Join(image.CompletionShells, ", ")), http.StatusBadRequest)
+		return
+	}
+	filePath := image.CompletionPath(filepath.Clean(fmt.Sprintf("%s/%s_%s.tar.gz", image.TarballPath, name, platform)), shell)
+	f, err := os.Open(filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			http.Error(w, fmt.Sprintf("plugin %s has no %s completion for platform %s", name, shell, platform), http.StatusNotFound)
+			return
+		}
+		http.Error(w, fmt.Errorf("getting completion: name: %s, platform: %s err: %w", name, platform, err).Error(), http.StatusInternalServerError)
+		return
+	}
+	defer f.Close()
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s.%s", commandName(name), shell))
+	if checksum, err := os.ReadFile(image.ChecksumPath(filePath)); err == nil {
+		w.Header().Set(ChecksumHeader, strings.TrimSpace(string(checksum)))
+	}
+	if _, err = io.Copy(w, f); err != nil {
+		http.Error(w, fmt.Errorf("getting completion: name: %s, platform: %s err: %w", name, platform, err).Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// handleDownloadManPages serves the tar archive of the man pages of the plugin platform, for offline viewing.
+func handleDownloadManPages(w http.ResponseWriter, name, platform string) {
+	filePath := image.ManPagesPath(filepath.Clean(fmt.Sprintf("%s/%s_%s.tar.gz", image.TarballPath, name, platform)))
+	f, err := os.Open(filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			http.Error(w, fmt.Sprintf("plugin %s has no man pages for platform %s", name, platform), http.StatusNotFound)
+			return
+		}
+		http.Error(w, fmt.Errorf("getting man pages: name: %s, platform: %s err: %w", name, platform, err).Error(), http.StatusInternalServerError)
+		return
+	}
+	defer f.Close()
+
+	w.Header().Set("Content-Type", "application/x-tar")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s.man.tar", commandName(name)))
+	if checksum, err := os.ReadFile(image.ChecksumPath(filePath)); err == nil {
+		w.Header().Set(ChecksumHeader, strings.TrimSpace(string(checksum)))
+	}
+	w.Header().Set("Content-Transfer-Encoding", "binary")
+	if _, err = io.Copy(w, f); err != nil {
+		http.Error(w, fmt.Errorf("getting man pages: name: %s, platform: %s err: %w", name, platform, err).Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// commandName returns the name of the command krew links the executable of the plugin as, whatever its bin,
+// i.e. kubectl-acme_tool for the acme-tool plugin.
+func commandName(name string) string {
+	return "kubectl-" + strings.ReplaceAll(name, "-", "_")
+}
+
+// handleDownloadBinary serves the plugin executable of the platform published uncompressed, named
+// like krew installs it.
+func handleDownloadBinary(w http.ResponseWriter, name, platform string) {
+	filePath := image.RawBinaryPath(filepath.Clean(fmt.Sprintf("%s/%s_%s.tar.gz", image.TarballPath, name, platform)))
+	f, err := os.Open(filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			http.Error(w, fmt.Sprintf("plugin %s has no executable published for platform %s", name, platform), http.StatusNotFound)
+			return
+		}
+		http.Error(w, fmt.Errorf("getting executable: name: %s, platform: %s err: %w", name, platform, err).Error(), http.StatusInternalServerError)
+		return
+	}
+	defer f.Close()
+
+	// the media type is sniffed from the start of the executable
+	r := bufio.NewReader(f)
+	prefix, _ := r.Peek(4096)
+	fileName := commandName(name)
+	if strings.HasPrefix(platform, "windows_") {
+		fileName += ".exe"
+	}
+	w.Header().Set("Content-Type", image.ExecutableMediaType(prefix))
+	w.Header().Set("Content-Disposition", "attachment; filename="+fileName)
+	if checksum, err := os.ReadFile(image.ChecksumPath(filePath)); err == nil {
+		w.Header().Set(ChecksumHeader, strings.TrimSpace(string(checksum)))
+	}
+	w.Header().Set("Content-Transfer-Encoding", "binary")
+	if _, err = io.Copy(w, r); err != nil {
+		http.Error(w, fmt.Errorf("getting executable: name: %s, platform: %s err: %w", name, platform, err).Error(), http.StatusInternalServerError)
+		return
+	}
+}
@@ -0,0 +1,137 @@
+package git
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/storage/memory"
+)
+
+// maxIndexSize bounds the size of the archives of the mirrored indexes, and of their manifests.
+const maxIndexSize = 256 << 20
+
+// FetchIndex returns the krew manifests of the plugins of the git index by plugin name, read from
+// the plugins directory of the ref, the default branch if empty, and the commit they are read from.
+// The index is cloned in memory without history.
+func FetchIndex(ctx context.Context, url, ref string) (map[string][]byte, string, error) {
+	options := &git.CloneOptions{URL: url, Depth: 1, SingleBranch: true, Tags: git.NoTags}
+	if len(ref) > 0 {
+		options.ReferenceName = plumbing.NewBranchReferenceName(ref)
+	}
+	r, err := git.CloneContext(ctx, memory.NewStorage(), nil, options)
+	if err != nil && len(ref) > 0 {
+		// the ref is a tag
+		options.ReferenceName = plumbing.NewTagReferenceName(ref)
+		r, err = git.CloneContext(ctx, memory.NewStorage(), nil, options)
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("cloning %s: %w", url, err)
+	}
+	head, err := r.Head()
+	if err != nil {
+		return nil, "", err
+	}
+	commit, err := r.CommitObject(head.Hash())
+	if err != nil {
+		return nil, "", err
+	}
+	tree, err := commit.Tree()
+	if err != nil {
+		return nil, "", err
+	}
+	manifests := map[string][]byte{}
+	err = tree.Files().ForEach(func(f *object.File) error {
+		name, ok := manifestName(f.Name)
+		if !ok {
+			return nil
+		}
+		if f.Size > maxIndexSize {
+			return fmt.Errorf("manifest %s exceeds %d bytes", f.Name, maxIndexSize)
+		}
+		contents, err := f.Contents()
+		if err != nil {
+			return err
+		}
+		manifests[name] = []byte(contents)
+		return nil
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	return manifests, head.Hash().String(), nil
+}
+
+// FetchIndexArchive returns the krew manifests of the plugins of the index in the tar.gz archive of
+// the URL by plugin name, and the sha256 checksum of the archive. The archive holds the plugins
+// directory of the index at its root, or in a single top directory like the archives of the git forges.
+func FetchIndexArchive(ctx context.Context, url string) (map[string][]byte, string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("downloading %s: unexpected status %s", url, resp.Status)
+	}
+	hash := sha256.New()
+	gz, err := gzip.NewReader(io.TeeReader(io.LimitReader(resp.Body, maxIndexSize), hash))
+	if err != nil {
+		return nil, "", fmt.Errorf("reading %s: %w", url, err)
+	}
+	manifests := map[string][]byte{}
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, "", fmt.Errorf("reading %s: %w", url, err)
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		name := strings.TrimPrefix(header.Name, "./")
+		if _, rest, ok := strings.Cut(name, "/"); ok && !strings.HasPrefix(name, "plugins/") {
+			name = rest
+		}
+		plugin, ok := manifestName(name)
+		if !ok {
+			continue
+		}
+		contents, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, "", fmt.Errorf("reading %s: %w", url, err)
+		}
+		manifests[plugin] = contents
+	}
+	// the checksum covers the whole archive
+	if _, err := io.Copy(io.Discard, gz); err != nil {
+		return nil, "", fmt.Errorf("reading %s: %w", url, err)
+	}
+	return manifests, hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// manifestName returns the name of the plugin of the manifest file of the index, i.e. plugins/tool.yaml.
+func manifestName(file string) (string, bool) {
+	dir, base := path.Split(file)
+	if dir != "plugins/" || path.Ext(base) != ".yaml" {
+		return "", false
+	}
+	return strings.TrimSuffix(base, ".yaml"), true
+}
@@ -0,0 +1,336 @@
+package image
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/flate"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+
+	"github.com/openshift/cli-manager/api/v1alpha1"
+)
+
+// GzipLevel is the compression level of the tar.gz and zip artifacts.
+var GzipLevel = gzip.DefaultCompression
+
+// artifactModTime is the modification time of the files of the artifacts, the earliest zip supports.
+var artifactModTime = time.Date(1980, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+var (
+	// ArtifactUID and ArtifactGID are the owner of the files of the tar artifacts, whatever their owner
+	// in the image. The files are owned by root by default, which the tools extracting them as another
+	// user ignore.
+	ArtifactUID, ArtifactGID int
+	// ArtifactUname and ArtifactGname are the names of the owner of the files of the tar artifacts,
+	// left empty by default so that the tools extracting them do not look them up.
+	ArtifactUname, ArtifactGname string
+)
+
+// maxUstarID and maxUstarName bound the owners written in the USTAR headers, so that the owners
+// never need PAX records.
+const (
+	maxUstarID   = 1<<21 - 1
+	maxUstarName = 32
+)
+
+// ValidateArtifactOwner checks that the owner of the files of the artifacts fits in USTAR headers.
+func ValidateArtifactOwner(uid, gid int, uname, gname string) error {
+	for _, id := range []int{uid, gid} {
+		if id < 0 || id > maxUstarID {
+			return fmt.Errorf("invalid artifact owner id %d, should be in [0, %d]", id, maxUstarID)
+		}
+	}
+	for _, name := range []string{uname, gname} {
+		if len(name) > maxUstarName {
+			return fmt.Errorf("invalid artifact owner name %s, should be at most %d bytes", name, maxUstarName)
+		}
+	}
+	return nil
+}
+
+// ValidateGzipLevel checks that the compression level is supported by gzip.
+func ValidateGzipLevel(level int) error {
+	if level < gzip.HuffmanOnly || level > gzip.BestCompression {
+		return fmt.Errorf("invalid gzip level %d, should be in [%d, %d]", level, gzip.HuffmanOnly, gzip.BestCompression)
+	}
+	return nil
+}
+
+// ZstdArtifacts writes a tar.zst variant next to the tar.gz artifacts.
+var ZstdArtifacts bool
+
+// ZstdPath returns the path of the tar.zst variant of the tar.gz artifact.
+func ZstdPath(artifact string) string {
+	return strings.TrimSuffix(artifact, "."+string(v1alpha1.ArchiveFormatTarGz)) + ".tar.zst"
+}
+
+// artifactBase returns the path of the artifact without the suffix of its format, which the files
+// stored next to the artifact are named after.
+func artifactBase(artifact string) string {
+	return strings.TrimSuffix(strings.TrimSuffix(artifact, "."+string(v1alpha1.ArchiveFormatTarGz)), "."+string(v1alpha1.ArchiveFormatZip))
+}
+
+// ArchiveFormat returns the format of the artifact of the platform, which is zip
+// for the windows platforms and tar.gz for the others unless it is set.
+func ArchiveFormat(platform v1alpha1.PluginPlatform) v1alpha1.ArchiveFormat {
+	if len(platform.ArchiveFormat) > 0 {
+		return platform.ArchiveFormat
+	}
+	if strings.HasPrefix(platform.Platform, "windows/") {
+		return v1alpha1.ArchiveFormatZip
+	}
+	return v1alpha1.ArchiveFormatTarGz
+}
+
+// archiveWriter writes the files extracted from the image to the artifact.
+type archiveWriter interface {
+	// writeFile writes the regular file of the header with its contents.
+	writeFile(header *tar.Header, contents io.Reader) error
+	// Close writes the end of the archive, without closing the underlying writer.
+	Close() error
+}
+
+// newArchiveWriter returns the writer of the artifact in the format.
+func newArchiveWriter(format v1alpha1.ArchiveFormat, w, zstdW io.Writer) (archiveWriter, error) {
+	if err := ValidateGzipLevel(GzipLevel); err != nil {
+		return nil, err
+	}
+	if format == v1alpha1.ArchiveFormatZip {
+		zw := zip.NewWriter(w)
+		zw.RegisterCompressor(zip.Deflate, func(out io.Writer) (io.WriteCloser, error) {
+			return flate.NewWriter(out, GzipLevel)
+		})
+		return &zipWriter{zw: zw}, nil
+	}
+	// the gzip header is left without name nor modification time
+	gw, err := gzip.NewWriterLevel(w, GzipLevel)
+	if err != nil {
+		return nil, err
+	}
+	if zstdW == nil {
+		return &tarGzWriter{gw: gw, tw: tar.NewWriter(gw)}, nil
+	}
+	zw, err := zstd.NewWriter(zstdW, zstd.WithEncoderConcurrency(1), zstd.WithLowerEncoderMem(true))
+	if err != nil {
+		return nil, err
+	}
+	return &tarGzWriter{gw: gw, zw: zw, tw: tar.NewWriter(io.MultiWriter(gw, zw))}, nil
+}
+
+type tarGzWriter struct {
+	gw *gzip.Writer
+	// zw compresses the same tarball with zstd, if set
+	zw *zstd.Encoder
+	tw *tar.Writer
+}
+
+func (w *tarGzWriter) writeFile(header *tar.Header, contents io.Reader) error {
+	if err := w.tw.WriteHeader(header); err != nil {
+		return err
+	}
+	return copyBuffered(w.tw, contents)
+}
+
+func (w *tarGzWriter) Close() error {
+	if err := w.tw.Close(); err != nil {
+		return err
+	}
+	if w.zw != nil {
+		if err := w.zw.Close(); err != nil {
+			return err
+		}
+	}
+	return w.gw.Close()
+}
+
+type zipWriter struct {
+	zw *zip.Writer
+}
+
+func (w *zipWriter) writeFile(header *tar.Header, contents io.Reader) error {
+	zipHeader := &zip.FileHeader{
+		Name:     header.Name,
+		Method:   zip.Deflate,
+		Modified: header.ModTime,
+	}
+	zipHeader.SetMode(fs.FileMode(header.Mode).Perm())
+	f, err := w.zw.CreateHeader(zipHeader)
+	if err != nil {
+		return err
+	}
+	return copyBuffered(f, contents)
+}
+
+func (w *zipWriter) Close() error {
+	return w.zw.Close()
+}
+
+// sortedWriter spools the files written to the archive, and writes them sorted by name on Close, so
+// that the artifact does not depend on the order the files are found in the layers.
+type sortedWriter struct {
+	archive archiveWriter
+	spool   *os.File
+	offset  int64
+	entries []spooledEntry
+}
+
+type spooledEntry struct {
+	header *tar.Header
+	offset int64
+	size   int64
+}
+
+func newSortedWriter(archive archiveWriter, spool *os.File) *sortedWriter {
+	return &sortedWriter{archive: archive, spool: spool}
+}
+
+func (w *sortedWriter) writeFile(header *tar.Header, contents io.Reader) error {
+	n, err := io.Copy(w.spool, contents)
+	if err != nil {
+		return err
+	}
+	w.entries = append(w.entries, spooledEntry{header: header, offset: w.offset, size: n})
+	w.offset += n
+	return nil
+}
+
+func (w *sortedWriter) Close() error {
+	entries := w.entries
+	w.entries = nil
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].header.Name < entries[j].header.Name
+	})
+	for _, entry := range entries {
+		if err := w.archive.writeFile(entry.header, io.NewSectionReader(w.spool, entry.offset, entry.size)); err != nil {
+			return err
+		}
+	}
+	return w.archive.Close()
+}
+
+// CorruptArtifactError is returned by Extract when the artifact written can not be read back whole.
+type CorruptArtifactError struct {
+	Reason string
+}
+
+func (e *CorruptArtifactError) Error() string {
+	return fmt.Sprintf("artifact is corrupted: %s", e.Reason)
+}
+
+// verifyArtifact reads the written artifact in the format back whole, checking the checksums of its
+// compressed streams, and checks that it holds the files expected and no others.
+func verifyArtifact(written string, format v1alpha1.ArchiveFormat, expected []string) error {
+	var names []string
+	err := forEachArtifactFile(written, format, func(header *tar.Header, contents io.Reader) error {
+		names = append(names, header.Name)
+		return nil
+	})
+	if err != nil {
+		return &CorruptArtifactError{Reason: err.Error()}
+	}
+	sort.Strings(names)
+	expected = slices.Clone(expected)
+	sort.Strings(expected)
+	if !slices.Equal(names, expected) {
+		return &CorruptArtifactError{Reason: fmt.Sprintf("holds %s instead of %s", strings.Join(names, ", "), strings.Join(expected, ", "))}
+	}
+	return nil
+}
+
+// forEachArtifactFile reads the written artifact in the format and calls visit for its files in order.
+func forEachArtifactFile(written string, format v1alpha1.ArchiveFormat, visit func(header *tar.Header, contents io.Reader) error) error {
+	if format == v1alpha1.ArchiveFormatZip {
+		return forEachZipFile(written, visit)
+	}
+	f, err := os.Open(written)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if strings.HasSuffix(strings.TrimSuffix(written, partialSuffix), ".tar.zst") {
+		zr, err := zstd.NewReader(f, zstd.WithDecoderConcurrency(1), zstd.WithDecoderLowmem(true))
+		if err != nil {
+			return err
+		}
+		defer zr.Close()
+		return forEachTarFile(zr, visit)
+	}
+	gr, err := gzip.NewReader(f)
+	if err != nil {
+		return err
+	}
+	return forEachTarFile(gr, visit)
+}
+
+func forEachTarFile(r io.Reader, visit func(header *tar.Header, contents io.Reader) error) error {
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if err := visit(header, tr); err != nil {
+			return err
+		}
+		if _, err := io.Copy(io.Discard, tr); err != nil {
+			return err
+		}
+	}
+	// the checksum of the compressed stream is checked once it is read
+	_, err := io.Copy(io.Discard, r)
+	return err
+}
+
+func forEachZipFile(written string, visit func(header *tar.Header, contents io.Reader) error) error {
+	zr, err := zip.OpenReader(written)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+	for _, f := range zr.File {
+		r, err := f.Open()
+		if err != nil {
+			return err
+		}
+		header := &tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     f.Name,
+			Size:     int64(f.UncompressedSize64),
+			Mode:     int64(f.Mode().Perm()),
+			ModTime:  f.Modified,
+		}
+		err = visit(header, r)
+		if err == nil {
+			// the CRC-32 of the file is checked once it is read
+			_, err = io.Copy(io.Discard, r)
+		}
+		r.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %w", f.Name, err)
+		}
+	}
+	return nil
+}
+
+// discardWriter drops the files without reading their contents.
+type discardWriter struct{}
+
+func (discardWriter) writeFile(*tar.Header, io.Reader) error {
+	return nil
+}
+
+func (discardWriter) Close() error {
+	return nil
+}
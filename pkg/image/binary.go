@@ -0,0 +1,241 @@
+package image
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"debug/elf"
+	"debug/macho"
+	"debug/pe"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"slices"
+	"strings"
+)
+
+const (
+	formatELF   = "ELF"
+	formatPE    = "PE"
+	formatMachO = "Mach-O"
+
+	// sniffSize is the size of the start of the plugin executable its format is sniffed from.
+	sniffSize = 4096
+	// maxFatArches bounds the architectures of the Mach-O universal binaries, whose magic is
+	// shared with the Java class files.
+	maxFatArches = 20
+)
+
+// BinaryPlatformError is returned by Extract when the plugin executable is not built for the platform.
+type BinaryPlatformError struct {
+	Bin      string
+	Platform string
+	// Format is the executable format of the binary, ELF, PE or Mach-O
+	Format string
+	// Architectures are the architectures the binary is built for, if they are known
+	Architectures []string
+}
+
+func (e *BinaryPlatformError) Error() string {
+	if len(e.Architectures) == 0 {
+		return fmt.Sprintf("%s is a %s executable, which does not run on %s", e.Bin, e.Format, e.Platform)
+	}
+	return fmt.Sprintf("%s is a %s executable for %s, which does not run on %s", e.Bin, e.Format, strings.Join(e.Architectures, ", "), e.Platform)
+}
+
+// platformFormat returns the executable format of the operating system of the platform, or an
+// empty string if it is not known.
+func platformFormat(platform string) string {
+	os, _, _ := strings.Cut(platform, "/")
+	switch os {
+	case "linux", "freebsd", "openbsd", "netbsd", "dragonfly", "solaris", "illumos":
+		return formatELF
+	case "windows":
+		return formatPE
+	case "darwin":
+		return formatMachO
+	}
+	return ""
+}
+
+// checkBinary returns a BinaryPlatformError if the plugin executable does not run on the platform.
+func checkBinary(name, platform string, contents io.Reader) (io.Reader, error) {
+	expected := platformFormat(platform)
+	if len(expected) == 0 {
+		return contents, nil
+	}
+	r := bufio.NewReaderSize(contents, sniffSize)
+	prefix, err := r.Peek(sniffSize)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return nil, err
+	}
+	format, archs := sniffBinary(prefix)
+	if len(format) == 0 {
+		return r, nil
+	}
+	_, arch, _ := strings.Cut(platform, "/")
+	arch, _, _ = strings.Cut(arch, "/")
+	if format != expected || (len(archs) > 0 && !slices.Contains(archs, arch)) {
+		return nil, &BinaryPlatformError{Bin: name, Platform: platform, Format: format, Architectures: archs}
+	}
+	return r, nil
+}
+
+// sniffBinary returns the executable format of the start of the file, and the architectures it is
+// built for in GOARCH format if they are known, or an empty format if it is not an executable.
+func sniffBinary(prefix []byte) (string, []string) {
+	switch {
+	case bytes.HasPrefix(prefix, []byte(elf.ELFMAG)):
+		return formatELF, elfArchitectures(prefix)
+	case bytes.HasPrefix(prefix, []byte("MZ")):
+		return formatPE, peArchitectures(prefix)
+	case len(prefix) >= 8 && (binary.LittleEndian.Uint32(prefix) == macho.Magic64 || binary.LittleEndian.Uint32(prefix) == macho.Magic32):
+		return formatMachO, machoArchitectures(macho.Cpu(binary.LittleEndian.Uint32(prefix[4:])))
+	case len(prefix) >= 8 && binary.BigEndian.Uint32(prefix) == macho.MagicFat:
+		n := binary.BigEndian.Uint32(prefix[4:])
+		if n == 0 || n > maxFatArches {
+			return "", nil
+		}
+		var archs []string
+		for i := 0; i < int(n) && 8+20*i+4 <= len(prefix); i++ {
+			archs = append(archs, machoArchitectures(macho.Cpu(binary.BigEndian.Uint32(prefix[8+20*i:])))...)
+		}
+		return formatMachO, archs
+	}
+	return "", nil
+}
+
+func elfArchitectures(prefix []byte) []string {
+	if len(prefix) < 20 {
+		return nil
+	}
+	var order binary.ByteOrder = binary.LittleEndian
+	if elf.Data(prefix[elf.EI_DATA]) == elf.ELFDATA2MSB {
+		order = binary.BigEndian
+	}
+	class64 := elf.Class(prefix[elf.EI_CLASS]) == elf.ELFCLASS64
+	switch elf.Machine(order.Uint16(prefix[18:])) {
+	case elf.EM_X86_64:
+		return []string{"amd64"}
+	case elf.EM_386:
+		return []string{"386"}
+	case elf.EM_AARCH64:
+		return []string{"arm64"}
+	case elf.EM_ARM:
+		return []string{"arm"}
+	case elf.EM_PPC64:
+		if order == binary.LittleEndian {
+			return []string{"ppc64le"}
+		}
+		return []string{"ppc64"}
+	case elf.EM_S390:
+		if class64 {
+			return []string{"s390x"}
+		}
+	case elf.EM_RISCV:
+		if class64 {
+			return []string{"riscv64"}
+		}
+	}
+	return nil
+}
+
+func peArchitectures(prefix []byte) []string {
+	if len(prefix) < 0x40 {
+		return nil
+	}
+	offset := int(binary.LittleEndian.Uint32(prefix[0x3c:]))
+	if offset+6 > len(prefix) || !bytes.Equal(prefix[offset:offset+4], []byte("PE\x00\x00")) {
+		return nil
+	}
+	switch binary.LittleEndian.Uint16(prefix[offset+4:]) {
+	case pe.IMAGE_FILE_MACHINE_AMD64:
+		return []string{"amd64"}
+	case pe.IMAGE_FILE_MACHINE_I386:
+		return []string{"386"}
+	case pe.IMAGE_FILE_MACHINE_ARM64:
+		return []string{"arm64"}
+	case pe.IMAGE_FILE_MACHINE_ARMNT:
+		return []string{"arm"}
+	}
+	return nil
+}
+
+func machoArchitectures(cpu macho.Cpu) []string {
+	switch cpu {
+	case macho.CpuAmd64:
+		return []string{"amd64"}
+	case macho.Cpu386:
+		return []string{"386"}
+	case macho.CpuArm64:
+		return []string{"arm64"}
+	case macho.CpuArm:
+		return []string{"arm"}
+	}
+	return nil
+}
+
+// RawBinaryPath returns the path of the plugin executable published uncompressed next to the artifact.
+func RawBinaryPath(artifact string) string {
+	return artifactBase(artifact) + ".bin"
+}
+
+// ExecutableMediaType returns the media type of the executable sniffed from the start of its contents.
+func ExecutableMediaType(prefix []byte) string {
+	switch format, _ := sniffBinary(prefix); format {
+	case formatELF:
+		return "application/x-executable"
+	case formatPE:
+		return "application/vnd.microsoft.portable-executable"
+	case formatMachO:
+		return "application/x-mach-binary"
+	}
+	return "application/octet-stream"
+}
+
+// rawFile writes a file of the artifact aside as it is written to the artifact, to store it
+// uncompressed next to the artifact, see RawBinaryPath and CompletionPath.
+type rawFile struct {
+	// name is the path the file is stored at
+	name    string
+	written string
+	file    *os.File
+	hash    hash.Hash
+	// found reports whether the file is written
+	found bool
+}
+
+func newRawFile(name string) (*rawFile, error) {
+	written := name + partialSuffix
+	f, err := os.Create(written)
+	if err != nil {
+		return nil, err
+	}
+	return &rawFile{name: name, written: written, file: f, hash: sha256.New()}, nil
+}
+
+// tee returns the reader of the contents of the file, writing them aside as they are read.
+func (f *rawFile) tee(contents io.Reader) io.Reader {
+	f.found = true
+	return io.TeeReader(contents, io.MultiWriter(f.file, f.hash))
+}
+
+// store stores the file written aside, or removes the file of the previous extraction if it is not found.
+func (f *rawFile) store() error {
+	if !f.found {
+		return RemoveArtifact(f.name)
+	}
+	if err := syncClose(f.file); err != nil {
+		return err
+	}
+	return storeArtifact(f.written, f.name, hex.EncodeToString(f.hash.Sum(nil)))
+}
+
+// close closes the file written aside, and removes it unless it is stored.
+func (f *rawFile) close() {
+	f.file.Close()
+	os.Remove(f.written)
+}
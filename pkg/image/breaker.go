@@ -0,0 +1,144 @@
+package image
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+	"k8s.io/component-base/metrics"
+	"k8s.io/component-base/metrics/legacyregistry"
+)
+
+// States of the registry circuit breakers, as exported by the state metric.
+const (
+	breakerClosed   = 0
+	breakerOpen     = 1
+	breakerHalfOpen = 2
+)
+
+var (
+	// CircuitBreakerThreshold is the number of consecutive failed pulls from a registry
+	// after which its pulls are short-circuited. The breaker is disabled if zero.
+	CircuitBreakerThreshold = 5
+	// CircuitBreakerCooldown is how long the pulls from a tripped registry are short-circuited
+	// before a single trial pull is let through.
+	CircuitBreakerCooldown = 5 * time.Minute
+
+	breakers   = map[string]*breaker{}
+	breakersMu sync.Mutex
+
+	registerMetrics sync.Once
+	breakerState    = metrics.NewGaugeVec(
+		&metrics.GaugeOpts{
+			Name:           "cli_manager_registry_circuit_breaker_state",
+			Help:           "State of the registry circuit breaker, 0 closed, 1 open, 2 half-open",
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{"registry"},
+	)
+	breakerShortCircuits = metrics.NewCounterVec(
+		&metrics.CounterOpts{
+			Name:           "cli_manager_registry_circuit_breaker_short_circuits_total",
+			Help:           "Total counts of the pulls short-circuited by the open registry circuit breaker",
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{"registry"},
+	)
+)
+
+func init() {
+	registerMetrics.Do(func() {
+		legacyregistry.MustRegister(breakerState)
+		legacyregistry.MustRegister(breakerShortCircuits)
+	})
+}
+
+// RegistryUnavailableError is returned for the pulls short-circuited by the open circuit breaker of the registry.
+type RegistryUnavailableError struct {
+	Registry string
+	// RetryAfter is the time the next trial pull is let through.
+	RetryAfter time.Time
+}
+
+func (e *RegistryUnavailableError) Error() string {
+	return fmt.Sprintf("registry %s is unavailable after repeated pull failures, retrying after %s", e.Registry, e.RetryAfter.Format(time.RFC3339))
+}
+
+// breaker is the circuit breaker of a registry host.
+type breaker struct {
+	registry string
+	state    int
+	failures int
+	openedAt time.Time
+}
+
+func getBreaker(registry string) *breaker {
+	b, ok := breakers[registry]
+	if !ok {
+		b = &breaker{registry: registry}
+		breakers[registry] = b
+	}
+	return b
+}
+
+// allowPull returns a RegistryUnavailableError if the pull from the registry is short-circuited,
+// or the done func the result of the pull must be recorded with otherwise.
+func allowPull(registry string) (func(err error), error) {
+	if CircuitBreakerThreshold <= 0 {
+		return func(error) {}, nil
+	}
+	breakersMu.Lock()
+	defer breakersMu.Unlock()
+	b := getBreaker(registry)
+	switch b.state {
+	case breakerOpen:
+		retryAfter := b.openedAt.Add(CircuitBreakerCooldown)
+		if time.Now().Before(retryAfter) {
+			breakerShortCircuits.WithLabelValues(registry).Inc()
+			return nil, &RegistryUnavailableError{Registry: registry, RetryAfter: retryAfter}
+		}
+		b.setState(breakerHalfOpen)
+	case breakerHalfOpen:
+		// the trial pull is in progress
+		breakerShortCircuits.WithLabelValues(registry).Inc()
+		return nil, &RegistryUnavailableError{Registry: registry, RetryAfter: time.Now().Add(CircuitBreakerCooldown)}
+	}
+	return b.record, nil
+}
+
+// record records the result of the pull from the registry.
+func (b *breaker) record(err error) {
+	breakersMu.Lock()
+	defer breakersMu.Unlock()
+	if !isRegistryFailure(err) {
+		b.failures = 0
+		b.setState(breakerClosed)
+		return
+	}
+	b.failures++
+	if b.state == breakerHalfOpen || b.failures >= CircuitBreakerThreshold {
+		b.openedAt = time.Now()
+		b.setState(breakerOpen)
+	}
+}
+
+func (b *breaker) setState(state int) {
+	b.state = state
+	breakerState.WithLabelValues(b.registry).Set(float64(state))
+}
+
+// isRegistryFailure reports whether the pull error is caused by an unavailable registry.
+func isRegistryFailure(err error) bool {
+	if err == nil || IsPlatformMissing(err) {
+		return false
+	}
+	var transportErr *transport.Error
+	if errors.As(err, &transportErr) {
+		return transportErr.StatusCode >= http.StatusInternalServerError || transportErr.StatusCode == http.StatusTooManyRequests
+	}
+	// connection failures
+	return true
+}
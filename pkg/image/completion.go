@@ -0,0 +1,96 @@
+package image
+
+import (
+	"path"
+
+	"github.com/openshift/cli-manager/api/v1alpha1"
+)
+
+// The shells whose completion scripts are bundled in the artifacts, see v1alpha1.Completions.
+const (
+	CompletionBash = "bash"
+	CompletionZsh  = "zsh"
+	CompletionFish = "fish"
+)
+
+// CompletionShells are the shells whose completion scripts are bundled in the artifacts.
+var CompletionShells = []string{CompletionBash, CompletionZsh, CompletionFish}
+
+// completionDir is the directory of the artifacts the completion scripts are bundled in.
+const completionDir = "completions"
+
+// CompletionPath returns the path of the completion script of the shell stored next to the artifact.
+func CompletionPath(artifact, shell string) string {
+	return artifactBase(artifact) + ".completion." + shell
+}
+
+// CompletionSuffixes returns the suffixes of the completion scripts next to the artifacts, without the leading dot.
+func CompletionSuffixes() []string {
+	var suffixes []string
+	for _, shell := range CompletionShells {
+		suffixes = append(suffixes, "completion."+shell)
+	}
+	return suffixes
+}
+
+// completionScripts returns the paths of the completion scripts in the image by shell.
+func completionScripts(completions *v1alpha1.Completions) map[string]string {
+	scripts := map[string]string{}
+	if completions == nil {
+		return scripts
+	}
+	for shell, script := range map[string]string{CompletionBash: completions.Bash, CompletionZsh: completions.Zsh, CompletionFish: completions.Fish} {
+		if len(script) > 0 {
+			scripts[shell] = script
+		}
+	}
+	return scripts
+}
+
+// withCompletions returns the platform with the file locations of its completion scripts appended.
+func withCompletions(platform v1alpha1.PluginPlatform) v1alpha1.PluginPlatform {
+	scripts := completionScripts(platform.Completions)
+	if len(scripts) == 0 {
+		return platform
+	}
+	files := append([]v1alpha1.FileLocation{}, platform.Files...)
+	for _, shell := range CompletionShells {
+		if script, ok := scripts[shell]; ok {
+			files = append(files, v1alpha1.FileLocation{From: script, To: path.Join(completionDir, shell), Optional: true})
+		}
+	}
+	platform.Files = files
+	return platform
+}
+
+// newCompletionFiles returns the files the completion scripts of the platform are written aside to by
+// their paths in the artifact, see CompletionPath.
+func newCompletionFiles(platform v1alpha1.PluginPlatform, artifact string) (map[string]*rawFile, error) {
+	completions := map[string]*rawFile{}
+	for shell := range completionScripts(platform.Completions) {
+		completion, err := newRawFile(CompletionPath(artifact, shell))
+		if err != nil {
+			for _, completion := range completions {
+				completion.close()
+			}
+			return nil, err
+		}
+		completions[path.Join(completionDir, shell)] = completion
+	}
+	return completions, nil
+}
+
+// storeCompletions stores the completion scripts written aside next to the artifact, and removes the
+// scripts of the previous extraction which are not found anymore.
+func storeCompletions(artifact string, completions map[string]*rawFile) error {
+	for _, shell := range CompletionShells {
+		completion, ok := completions[path.Join(completionDir, shell)]
+		if !ok {
+			completion = &rawFile{name: CompletionPath(artifact, shell)}
+		}
+		if err := completion.store(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
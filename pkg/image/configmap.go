@@ -0,0 +1,68 @@
+package image
+
+import (
+	"archive/tar"
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+// ConfigMapPrefix references a ConfigMap in the format configmap://namespace/name.
+const ConfigMapPrefix = "configmap://"
+
+// IsConfigMap reports whether the image reference points to a ConfigMap.
+func IsConfigMap(src string) bool {
+	return strings.HasPrefix(src, ConfigMapPrefix)
+}
+
+// ParseConfigMap splits the ConfigMap reference into its namespace and name.
+func ParseConfigMap(src string) (namespace, name string, err error) {
+	namespace, name, ok := strings.Cut(strings.TrimPrefix(src, ConfigMapPrefix), "/")
+	if !ok || len(namespace) == 0 || len(name) == 0 || strings.Contains(name, "/") {
+		return "", "", fmt.Errorf("invalid config map %s, should be in %snamespace/name format", src, ConfigMapPrefix)
+	}
+	return namespace, name, nil
+}
+
+// ImageFromFiles returns an image of a single layer holding the executable files.
+func ImageFromFiles(files map[string][]byte) (v1.Image, error) {
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, name := range names {
+		if err := tw.WriteHeader(&tar.Header{
+			Name:     name,
+			Mode:     0755,
+			Size:     int64(len(files[name])),
+			Typeflag: tar.TypeReg,
+		}); err != nil {
+			return nil, err
+		}
+		if _, err := tw.Write(files[name]); err != nil {
+			return nil, err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	layer, err := tarball.LayerFromOpener(func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(buf.Bytes())), nil
+	}, tarball.WithMediaType(types.OCILayer))
+	if err != nil {
+		return nil, err
+	}
+	return mutate.AppendLayers(empty.Image, layer)
+}
@@ -0,0 +1,97 @@
+package image
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/openshift/cli-manager/api/v1alpha1"
+)
+
+// zipMagic are the first bytes of the zip archives.
+var zipMagic = []byte("PK\x03\x04")
+
+// DownloadArtifact downloads the archive of the URI into the artifact of the plugin platform.
+func DownloadArtifact(ctx context.Context, uri, checksum, name, platform string, opts PullOptions) (string, error) {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme != "https" || len(u.Host) == 0 {
+		return "", fmt.Errorf("invalid archive URI %s, only https URIs are downloaded", uri)
+	}
+	transport, err := newTransport(opts)
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, uri, nil)
+	if err != nil {
+		return "", err
+	}
+	for key, values := range opts.Header {
+		req.Header[key] = values
+	}
+	resp, err := (&http.Client{Transport: transport}).Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("downloading %s: unexpected status %s", uri, resp.Status)
+	}
+
+	written, err := os.CreateTemp(TarballPath, name+"_*"+partialSuffix)
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(written.Name())
+	var body io.Reader = resp.Body
+	if MaxArtifactSize > 0 {
+		body = io.LimitReader(resp.Body, MaxArtifactSize+1)
+	}
+	hash := sha256.New()
+	n, err := io.Copy(io.MultiWriter(written, hash), body)
+	if err == nil {
+		err = syncClose(written)
+	} else {
+		written.Close()
+	}
+	if err != nil {
+		return "", fmt.Errorf("downloading %s: %w", uri, err)
+	}
+	if MaxArtifactSize > 0 && n > MaxArtifactSize {
+		return "", fmt.Errorf("archive %s exceeds %d bytes", uri, MaxArtifactSize)
+	}
+	if actual := hex.EncodeToString(hash.Sum(nil)); !strings.EqualFold(actual, checksum) {
+		return "", fmt.Errorf("checksum %s of archive %s does not match %s", actual, uri, checksum)
+	}
+
+	format := v1alpha1.ArchiveFormatTarGz
+	if isZip(written.Name()) {
+		format = v1alpha1.ArchiveFormatZip
+	}
+	artifact := filepath.Join(TarballPath, fmt.Sprintf("%s_%s.%s", name, strings.ReplaceAll(platform, "/", "_"), format))
+	if err := storeArtifact(written.Name(), artifact, strings.ToLower(checksum)); err != nil {
+		return "", err
+	}
+	return artifact, nil
+}
+
+// isZip reports whether the file is a zip archive.
+func isZip(name string) bool {
+	f, err := os.Open(name)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	magic := make([]byte, len(zipMagic))
+	if _, err := io.ReadFull(f, magic); err != nil {
+		return false
+	}
+	return bytes.Equal(magic, zipMagic)
+}
@@ -0,0 +1,230 @@
+package image
+
+import (
+	"archive/tar"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"sort"
+	"sync"
+
+	"github.com/containerd/stargz-snapshotter/estargz"
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+	"github.com/opencontainers/go-digest"
+)
+
+// LazyPull fetches only the chunks of the target files from the eStargz layers
+// instead of downloading the whole layers.
+var LazyPull = true
+
+// remoteImage is an image pulled from a registry whose blobs can be read in ranges.
+type remoteImage struct {
+	v1.Image
+	repository name.Repository
+	auth       authn.Authenticator
+	inner      http.RoundTripper
+	// lazy reads the eStargz layers in ranges, see LazyPull
+	lazy bool
+
+	once      sync.Once
+	client    *http.Client
+	clientErr error
+}
+
+// httpClient returns the client authenticated to the repository.
+func (i *remoteImage) httpClient() (*http.Client, error) {
+	i.once.Do(func() {
+		rt, err := transport.NewWithContext(context.Background(), i.repository.Registry, i.auth, i.inner, []string{i.repository.Scope(transport.PullScope)})
+		if err != nil {
+			i.clientErr = err
+			return
+		}
+		i.client = &http.Client{Transport: rt}
+	})
+	return i.client, i.clientErr
+}
+
+// blobReaderAt reads ranges of a blob with HTTP range requests.
+type blobReaderAt struct {
+	client *http.Client
+	url    string
+}
+
+func (r *blobReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	req, err := http.NewRequest(http.MethodGet, r.url, nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", off, off+int64(len(p))-1))
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusPartialContent {
+		return 0, fmt.Errorf("range request of blob failed: %s", resp.Status)
+	}
+	return io.ReadFull(resp.Body, p)
+}
+
+// forEachEStargzEntry calls visit for the entries of the eStargz layer, fetching only the chunks read.
+func (i *remoteImage) forEachEStargzEntry(layer v1.Descriptor, progress func(), visit visitFunc) (bool, error) {
+	tocDigest, err := digest.Parse(layer.Annotations[estargz.TOCJSONDigestAnnotation])
+	if err != nil {
+		return false, fmt.Errorf("invalid eStargz TOC digest: %w", err)
+	}
+	client, err := i.httpClient()
+	if err != nil {
+		return false, err
+	}
+	blob := &blobReaderAt{
+		client: client,
+		url:    fmt.Sprintf("%s://%s/v2/%s/blobs/%s", i.repository.Registry.Scheme(), i.repository.RegistryStr(), i.repository.RepositoryStr(), layer.Digest),
+	}
+	r, err := estargz.Open(io.NewSectionReader(blob, 0, layer.Size))
+	if err != nil {
+		return false, fmt.Errorf("opening eStargz layer %s: %w", layer.Digest, err)
+	}
+	verifier, err := r.VerifyTOC(tocDigest)
+	if err != nil {
+		return false, fmt.Errorf("verifying eStargz TOC of layer %s: %w", layer.Digest, err)
+	}
+	root, ok := r.Lookup("")
+	if !ok {
+		return false, fmt.Errorf("eStargz layer %s has no root directory", layer.Digest)
+	}
+
+	// the entries are visited in a stable order, so that the artifacts are reproducible
+	var names []string
+	walkEntries(root, "", func(name string, entry *estargz.TOCEntry) {
+		names = append(names, name)
+	})
+	sort.Strings(names)
+
+	for _, name := range names {
+		entry, _ := r.Lookup(name)
+		header := &tar.Header{
+			Name:    name,
+			Mode:    entry.Mode,
+			ModTime: entry.ModTime(),
+			Uid:     entry.UID,
+			Gid:     entry.GID,
+			Uname:   entry.Uname,
+			Gname:   entry.Gname,
+		}
+		var contents io.Reader
+		switch entry.Type {
+		case "reg":
+			header.Typeflag = tar.TypeReg
+			header.Size = entry.Size
+			contents = &chunkReader{reader: r, verifier: verifier, layer: layer.Digest, name: name, size: entry.Size, progress: progress}
+		case "symlink":
+			header.Typeflag = tar.TypeSymlink
+			header.Linkname = entry.LinkName
+		case "hardlink":
+			header.Typeflag = tar.TypeLink
+			header.Linkname = entry.LinkName
+		case "dir":
+			header.Typeflag = tar.TypeDir
+		default:
+			continue
+		}
+		next, err := visit(header, contents)
+		if err != nil || !next {
+			return true, err
+		}
+	}
+	return true, nil
+}
+
+// chunkReader reads a file of the eStargz layer chunk by chunk, verifying every chunk.
+type chunkReader struct {
+	reader   *estargz.Reader
+	verifier estargz.TOCEntryVerifier
+	layer    v1.Hash
+	name     string
+	size     int64
+	progress func()
+
+	file   *io.SectionReader
+	offset int64
+	// chunk is the chunk read last, and buf its unread part
+	chunk []byte
+	buf   []byte
+}
+
+func (c *chunkReader) Read(p []byte) (int, error) {
+	if len(c.buf) == 0 {
+		if c.offset >= c.size {
+			return 0, io.EOF
+		}
+		if err := c.next(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, c.buf)
+	c.buf = c.buf[n:]
+	return n, nil
+}
+
+// next fetches and verifies the chunk at the current offset.
+func (c *chunkReader) next() error {
+	if c.file == nil {
+		file, err := c.reader.OpenFile(c.name)
+		if err != nil {
+			return err
+		}
+		c.file = file
+	}
+	chunk, ok := c.reader.ChunkEntryForOffset(c.name, c.offset)
+	if !ok {
+		return fmt.Errorf("chunk of %s at offset %d is not found in layer %s", c.name, c.offset, c.layer)
+	}
+	v, err := c.verifier.Verifier(chunk)
+	if err != nil {
+		return err
+	}
+	if chunk.ChunkSize > maxChunkSize {
+		return fmt.Errorf("chunk of %s at offset %d exceeds the maximum chunk size of %d bytes", c.name, c.offset, maxChunkSize)
+	}
+	// the buffer of the previous chunk is reused, since the chunks are read one at a time
+	buf := c.chunk[:0]
+	if int64(cap(buf)) < chunk.ChunkSize {
+		buf = make([]byte, chunk.ChunkSize)
+	}
+	buf = buf[:chunk.ChunkSize]
+	c.chunk = buf
+	if _, err := c.file.ReadAt(buf, chunk.ChunkOffset); err != nil && err != io.EOF {
+		return fmt.Errorf("reading chunk of %s at offset %d: %w", c.name, c.offset, err)
+	}
+	if _, err := v.Write(buf); err != nil {
+		return err
+	}
+	if !v.Verified() {
+		return fmt.Errorf("chunk of %s at offset %d does not match its digest in layer %s", c.name, c.offset, c.layer)
+	}
+	c.buf = buf
+	c.offset = chunk.ChunkOffset + chunk.ChunkSize
+	c.progress()
+	return nil
+}
+
+// walkEntries calls fn for the entries below the directory entry with the given name, recursively.
+func walkEntries(dir *estargz.TOCEntry, dirName string, fn func(name string, entry *estargz.TOCEntry)) {
+	dir.ForeachChild(func(baseName string, child *estargz.TOCEntry) bool {
+		name := path.Join(dirName, baseName)
+		fn(name, child)
+		if child.Type == "dir" {
+			walkEntries(child, name, fn)
+		}
+		return true
+	})
+}
@@ -2,132 +2,1294 @@ package image
 
 import (
 	"archive/tar"
-	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"net/http"
+	"net/url"
 	"os"
+	"path"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
+	"sync/atomic"
 
+	"github.com/containerd/stargz-snapshotter/estargz"
 	"github.com/google/go-containerregistry/pkg/authn"
 	"github.com/google/go-containerregistry/pkg/crane"
+	"github.com/google/go-containerregistry/pkg/name"
 	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+	"k8s.io/klog/v2"
 
 	"github.com/openshift/cli-manager/api/v1alpha1"
 )
 
-const TarballPath = "/var/run/plugins/"
+// TarballPath is the directory the artifacts are stored in and served from.
+var TarballPath = "/var/run/plugins/"
+
+var (
+	// UserAgent replaces the User-Agent header of the requests sent to registries if set.
+	UserAgent string
+	// RegistryHeaders are static headers added to every request sent to registries,
+	// i.e. for corporate registries and WAFs filtering traffic by headers.
+	RegistryHeaders map[string]string
+	// MaxImageSize is the maximum total compressed size in bytes of the images pulled.
+	// The size is not limited if zero.
+	MaxImageSize int64
+	// MaxFileSize is the maximum size in bytes of the files written to the artifacts.
+	// The size is not limited if zero.
+	MaxFileSize int64
+	// MaxArtifactSize is the maximum total size in bytes of the files written to an artifact,
+	// before compression. The size is not limited if zero.
+	MaxArtifactSize int64
+	// RejectPrivilegedFiles fails the extraction of the platforms with setuid or setgid files, or
+	// device files, instead of dropping their bits and skipping the devices, so that the plugins
+	// never distribute files meant to escalate privileges.
+	RejectPrivilegedFiles = true
+	// RegistryProxy is the URL of the proxy registries are accessed through. The proxy
+	// environment variables are used if empty.
+	RegistryProxy string
+	// TLSMinVersion is the minimum TLS version negotiated with registries.
+	TLSMinVersion uint16 = tls.VersionTLS12
+	// TLSCipherSuites are the cipher suites offered to registries up to TLS 1.2.
+	// The Go defaults are offered if empty.
+	TLSCipherSuites []uint16
+)
+
+// PullOptions configures how an image is pulled from its registry.
+type PullOptions struct {
+	// Auth is the base64 encoded "user:password" used to authenticate to the registry.
+	Auth string
+	// Platform is the os/arch[/variant] the image is pulled for.
+	Platform string
+	// CAFile is a PEM bundle trusted in addition to the system roots when connecting to the registry.
+	CAFile string
+	// ClientCertificate is presented to registries requiring client certificate authentication.
+	ClientCertificate *tls.Certificate
+	// Proxy is the URL of the proxy the registry is accessed through, overriding RegistryProxy.
+	Proxy string
+	// ProxyUser replaces the credentials of the proxy URL, they are sent in the Proxy-Authorization
+	// header to HTTP proxies and in the username/password authentication to SOCKS5 proxies.
+	ProxyUser *url.Userinfo
+	// BytesDownloaded counts the bytes downloaded from the registry if set,
+	// including the layers downloaded lazily while extracting.
+	BytesDownloaded *atomic.Int64
+	// Header is added to the requests of the archives downloaded by DownloadArtifact, i.e. the
+	// authorization of the assets of private GitHub releases.
+	Header http.Header
+}
+
+// ProgressFunc is called while the layers of the image are extracted.
+type ProgressFunc func(layersProcessed, layersTotal int)
+
+// PlatformMismatchError is returned when the pulled image is built for
+// a different platform than the one requested.
+type PlatformMismatchError struct {
+	Requested string
+	Actual    string
+}
+
+func (e *PlatformMismatchError) Error() string {
+	return fmt.Sprintf("image is built for %s, but %s is requested", e.Actual, e.Requested)
+}
+
+// PlatformNotFoundError is returned when the image index has no image
+// built for the requested platform.
+type PlatformNotFoundError struct {
+	Requested string
+}
+
+func (e *PlatformNotFoundError) Error() string {
+	return fmt.Sprintf("image index has no image built for %s", e.Requested)
+}
+
+// IsPlatformMissing reports whether the image is not built for the requested platform,
+// either with a PlatformMismatchError or a PlatformNotFoundError.
+func IsPlatformMissing(err error) bool {
+	var mismatchErr *PlatformMismatchError
+	var notFoundErr *PlatformNotFoundError
+	return errors.As(err, &mismatchErr) || errors.As(err, &notFoundErr)
+}
+
+// IsUnauthorized reports whether the registry rejected the credentials the image is pulled with.
+func IsUnauthorized(err error) bool {
+	var transportErr *transport.Error
+	if !errors.As(err, &transportErr) {
+		return false
+	}
+	return transportErr.StatusCode == http.StatusUnauthorized || transportErr.StatusCode == http.StatusForbidden
+}
+
+// ImageTooLargeError is returned when the total compressed size of the image exceeds MaxImageSize.
+type ImageTooLargeError struct {
+	Size  int64
+	Limit int64
+}
+
+func (e *ImageTooLargeError) Error() string {
+	return fmt.Sprintf("image size %d bytes exceeds the limit of %d bytes", e.Size, e.Limit)
+}
+
+// MissingFilesError is returned by Extract when files that are not optional are not found in any layer of the image.
+type MissingFilesError struct {
+	Files []string
+}
+
+func (e *MissingFilesError) Error() string {
+	return fmt.Sprintf("files %s are not found in any layer of the image", strings.Join(e.Files, ", "))
+}
+
+// PrivilegedFileError is returned by Extract when a file of the platform is setuid, setgid or a
+// device, see RejectPrivilegedFiles.
+type PrivilegedFileError struct {
+	File string
+	// Reason is setuid, setgid, a character device or a block device
+	Reason string
+}
+
+func (e *PrivilegedFileError) Error() string {
+	return fmt.Sprintf("%s is %s", e.File, e.Reason)
+}
+
+// ArtifactTooLargeError is returned by Extract when a file exceeds MaxFileSize, or the files
+// written to the artifact exceed MaxArtifactSize in total.
+type ArtifactTooLargeError struct {
+	// File is the file exceeding MaxFileSize, or empty if the artifact exceeds MaxArtifactSize.
+	File  string
+	Size  int64
+	Limit int64
+}
+
+func (e *ArtifactTooLargeError) Error() string {
+	if len(e.File) > 0 {
+		return fmt.Sprintf("file %s of %d bytes exceeds the limit of %d bytes", e.File, e.Size, e.Limit)
+	}
+	return fmt.Sprintf("artifact size %d bytes exceeds the limit of %d bytes", e.Size, e.Limit)
+}
 
 // Pull an image down to the local filesystem.
-func Pull(src string, auth string) (v1.Image, error) {
+func Pull(src string, opts PullOptions) (v1.Image, error) {
 	craneOptions := []crane.Option{}
-	if len(auth) > 0 {
+	if len(opts.Auth) > 0 {
 		auth := authn.FromConfig(authn.AuthConfig{
-			Auth: auth,
+			Auth: opts.Auth,
 		})
 		craneOptions = append(craneOptions, crane.WithAuth(auth))
 	}
 
-	return crane.Pull(src, craneOptions...)
+	transport, err := newTransport(opts)
+	if err != nil {
+		return nil, err
+	}
+	craneOptions = append(craneOptions, crane.WithTransport(transport))
+
+	var platform *v1.Platform
+	if len(opts.Platform) > 0 {
+		parsed, err := v1.ParsePlatform(opts.Platform)
+		if err != nil {
+			return nil, fmt.Errorf("invalid platform %s: %w", opts.Platform, err)
+		}
+		platform = parsed
+		craneOptions = append(craneOptions, crane.WithPlatform(platform))
+	}
+
+	var img v1.Image
+	var ref name.Reference
+	if IsLocal(src) {
+		img, err = pullLocal(src, platform)
+	} else {
+		ref, err = name.ParseReference(src)
+		if err != nil {
+			return nil, err
+		}
+		var done func(error)
+		done, err = allowPull(ref.Context().RegistryStr())
+		if err != nil {
+			return nil, err
+		}
+		img, err = crane.Pull(src, craneOptions...)
+		if err != nil && platform != nil && strings.Contains(err.Error(), "no child with platform") {
+			// the index is pulled, but it has no image of the platform
+			err = &PlatformNotFoundError{Requested: platform.String()}
+		}
+		done(err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	// the SBOMs are looked up in the referrers of the image with the same credentials
+	if ref != nil && (LazyPull || SBOMs) {
+		var auth authn.Authenticator = authn.FromConfig(authn.AuthConfig{Auth: opts.Auth})
+		if len(opts.Auth) == 0 {
+			// crane.Pull falls back to the default keychain as well
+			auth, err = authn.DefaultKeychain.Resolve(ref.Context())
+			if err != nil {
+				return nil, err
+			}
+		}
+		img = &remoteImage{
+			Image:      img,
+			repository: ref.Context(),
+			auth:       auth,
+			inner:      transport,
+			lazy:       LazyPull,
+		}
+	}
+
+	// only the manifest is fetched so far, the blobs are downloaded lazily
+	if err := validateSize(img); err != nil {
+		return nil, err
+	}
+
+	if platform != nil {
+		if err := validatePlatform(img, platform); err != nil {
+			return nil, err
+		}
+	}
+	return img, nil
 }
 
-// Extract an image's filesystem as a tarball, or individual files from the image.
-func Extract(img v1.Image, platform v1alpha1.PluginPlatform, destinationName string) ([]v1alpha1.FileLocation, error) {
-	layers, err := img.Layers()
+// headerTransport sets the configured User-Agent and static headers on the registry requests.
+type headerTransport struct {
+	inner     http.RoundTripper
+	userAgent string
+	headers   map[string]string
+}
+
+func (t *headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	for key, value := range t.headers {
+		req.Header.Set(key, value)
+	}
+	if len(t.userAgent) > 0 {
+		req.Header.Set("User-Agent", t.userAgent)
+	}
+	return t.inner.RoundTrip(req)
+}
+
+// ParseProxy parses the HTTP or SOCKS5 proxy URL.
+func ParseProxy(proxy string) (*url.URL, error) {
+	u, err := url.Parse(proxy)
 	if err != nil {
-		return nil, fmt.Errorf("retrieving image layers: %v", err)
+		return nil, fmt.Errorf("invalid proxy URL: %w", err)
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return nil, fmt.Errorf("unsupported proxy scheme %q, should be one of http, https, socks5, socks5h", u.Scheme)
+	}
+	if len(u.Host) == 0 {
+		return nil, fmt.Errorf("invalid proxy URL %s: missing host", u.Redacted())
 	}
+	return u, nil
+}
 
-	processedTargets := make(map[string]struct{})
+// countingTransport counts the bytes of the response bodies read from the registry.
+type countingTransport struct {
+	inner   http.RoundTripper
+	counter *atomic.Int64
+}
 
-	file, err := os.Create(destinationName)
+func (t *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.inner.RoundTrip(req)
 	if err != nil {
 		return nil, err
 	}
-	defer file.Close()
-	gw := gzip.NewWriter(file)
-	defer gw.Close()
-	tw := tar.NewWriter(gw)
-	defer tw.Close()
+	resp.Body = &countingReadCloser{ReadCloser: resp.Body, counter: t.counter}
+	return resp, nil
+}
 
-	foundLen := 0
-	// we iterate through the layers in reverse order because it makes handling
-	// whiteout layers more efficient, since we can just keep track of the removed
-	// files as we see .wh. layers and ignore those in previous layers.
-	for i := len(layers) - 1; i >= 0; i-- {
-		if foundLen == len(platform.Files) {
-			break
+type countingReadCloser struct {
+	io.ReadCloser
+	counter *atomic.Int64
+}
+
+func (r *countingReadCloser) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.counter.Add(int64(n))
+	return n, err
+}
+
+// progressReader calls the progress function on every read of the layer.
+type progressReader struct {
+	io.Reader
+	progress func()
+}
+
+func (r *progressReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	r.progress()
+	return n, err
+}
+
+// newTransport returns the transport used to connect to the registry.
+func newTransport(opts PullOptions) (http.RoundTripper, error) {
+	transport := remote.DefaultTransport.(*http.Transport).Clone()
+	tlsConfig := &tls.Config{
+		MinVersion:   TLSMinVersion,
+		CipherSuites: TLSCipherSuites,
+	}
+	if len(opts.CAFile) > 0 {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
 		}
-		layer := layers[i]
-		layerReader, err := layer.Uncompressed()
+		ca, err := os.ReadFile(opts.CAFile)
 		if err != nil {
-			return nil, fmt.Errorf("reading layer contents: %v", err)
+			return nil, fmt.Errorf("reading CA bundle: %w", err)
+		}
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("no certificates found in %s", opts.CAFile)
 		}
+		tlsConfig.RootCAs = pool
+	}
+	if opts.ClientCertificate != nil {
+		tlsConfig.Certificates = []tls.Certificate{*opts.ClientCertificate}
+	}
+	transport.TLSClientConfig = tlsConfig
 
-		tarReader := tar.NewReader(layerReader)
-		for {
-			header, err := tarReader.Next()
-			if err == io.EOF {
-				break
-			}
-			if err != nil {
-				layerReader.Close()
-				return nil, fmt.Errorf("reading tar: %v", err)
+	proxy := RegistryProxy
+	if len(opts.Proxy) > 0 {
+		proxy = opts.Proxy
+	}
+	if len(proxy) > 0 {
+		proxyURL, err := ParseProxy(proxy)
+		if err != nil {
+			return nil, err
+		}
+		if opts.ProxyUser != nil {
+			proxyURL.User = opts.ProxyUser
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+
+	var roundTripper http.RoundTripper = transport
+	if len(UserAgent) > 0 || len(RegistryHeaders) > 0 {
+		roundTripper = &headerTransport{
+			inner:     roundTripper,
+			userAgent: UserAgent,
+			headers:   RegistryHeaders,
+		}
+	}
+	if opts.BytesDownloaded != nil {
+		roundTripper = &countingTransport{
+			inner:   roundTripper,
+			counter: opts.BytesDownloaded,
+		}
+	}
+	return roundTripper, nil
+}
+
+// validateSize compares the total compressed size of the image in its manifest against MaxImageSize.
+func validateSize(img v1.Image) error {
+	if MaxImageSize <= 0 {
+		return nil
+	}
+	manifest, err := img.Manifest()
+	if err != nil {
+		return fmt.Errorf("retrieving image manifest: %w", err)
+	}
+	size := manifest.Config.Size
+	for _, layer := range manifest.Layers {
+		size += layer.Size
+	}
+	if size > MaxImageSize {
+		return &ImageTooLargeError{
+			Size:  size,
+			Limit: MaxImageSize,
+		}
+	}
+	return nil
+}
+
+// validatePlatform compares the image config against the requested platform.
+func validatePlatform(img v1.Image, platform *v1.Platform) error {
+	cfg, err := img.ConfigFile()
+	if err != nil {
+		return fmt.Errorf("retrieving image config: %w", err)
+	}
+
+	actual := cfg.Platform()
+	if actual == nil || (len(actual.OS) == 0 && len(actual.Architecture) == 0) {
+		// nothing to compare against
+		return nil
+	}
+	if actual.OS != platform.OS || actual.Architecture != platform.Architecture ||
+		(len(platform.Variant) > 0 && len(actual.Variant) > 0 && actual.Variant != platform.Variant) {
+		return &PlatformMismatchError{
+			Requested: platform.String(),
+			Actual:    actual.String(),
+		}
+	}
+	return nil
+}
+
+// ArchivePath returns the path of the file in the artifact, so that krew installs it to To.
+func ArchivePath(f v1alpha1.FileLocation) string {
+	if f.StripComponents > 0 {
+		return path.Join(f.To, "*")
+	}
+	return archivePath(f, f.From)
+}
+
+// InstallOrder returns the files in the order krew should install them, which puts the directories
+// stripped of leading components last, so that their patterns only match the files left by the others.
+func InstallOrder(files []v1alpha1.FileLocation) []v1alpha1.FileLocation {
+	ordered := append([]v1alpha1.FileLocation{}, files...)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return ordered[i].StripComponents == 0 && ordered[j].StripComponents > 0
+	})
+	return ordered
+}
+
+// archivePath returns the path in the artifact of the file or directory of the image matching f.
+func archivePath(f v1alpha1.FileLocation, name string) string {
+	if len(f.To) == 0 || f.To == "." || strings.HasSuffix(f.To, "/") {
+		return rename(f, path.Join(f.To, path.Base(name)))
+	}
+	return rename(f, path.Clean(f.To))
+}
+
+// contentPath returns the path in the artifact of the file of the image in the directory root matching f,
+// with the leading components of its path below To stripped.
+func contentPath(f v1alpha1.FileLocation, root, name string) string {
+	p := path.Join(archivePath(f, root), strings.TrimPrefix(name, root+"/"))
+	if f.StripComponents <= 0 {
+		return p
+	}
+	to := path.Clean(f.To)
+	components := strings.Split(strings.TrimPrefix(p, to+"/"), "/")
+	if to == "." {
+		components = strings.Split(p, "/")
+	}
+	strip := min(int(f.StripComponents), len(components)-1)
+	return path.Join(to, path.Join(components[strip:]...))
+}
+
+// isGlob reports whether From is a pattern matching any number of files, like /usr/local/bin/tool-v*.
+func isGlob(from string) bool {
+	return strings.ContainsAny(from, "*?[")
+}
+
+// matchFile returns the file or the directory matching From of the target the file of the image is
+// in, which is the file itself unless From is a directory, and whether the file is not excluded.
+func matchFile(f v1alpha1.FileLocation, name string) (string, bool) {
+	pattern := strings.Trim(f.From, "/")
+	for root := name; root != "." && root != "/"; root = path.Dir(root) {
+		if !isGlob(pattern) {
+			if root == pattern {
+				return root, !excluded(f, root, name)
 			}
+			continue
+		}
+		if ok, _ := path.Match(pattern, root); ok {
+			return root, !excluded(f, root, name)
+		}
+	}
+	return "", false
+}
+
+// excluded reports whether the file of the image in the directory root matching f is excluded,
+// by its path relative to root, or by its base name if it is root.
+func excluded(f v1alpha1.FileLocation, root, name string) bool {
+	rel := path.Base(name)
+	if root != name {
+		rel = strings.TrimPrefix(name, root+"/")
+	}
+	for _, pattern := range f.Exclude {
+		if matchSegments(strings.Split(pattern, "/"), strings.Split(rel, "/")) {
+			return true
+		}
+	}
+	return false
+}
 
-			// skip directories
-			if header.Typeflag == tar.TypeDir {
-				continue
+// matchSegments reports whether the segments of the path match the segments of the pattern,
+// where a ** segment matches any number of segments.
+func matchSegments(pattern, segments []string) bool {
+	if len(pattern) == 0 {
+		return len(segments) == 0
+	}
+	if pattern[0] == "**" {
+		for i := 0; i <= len(segments); i++ {
+			if matchSegments(pattern[1:], segments[i:]) {
+				return true
 			}
+		}
+		return false
+	}
+	if len(segments) == 0 {
+		return false
+	}
+	if ok, _ := path.Match(pattern[0], segments[0]); !ok {
+		return false
+	}
+	return matchSegments(pattern[1:], segments[1:])
+}
 
-			// skip empty file contents
-			if header.Size == 0 {
-				continue
+// validateExclude rejects the exclude patterns that are invalid or not relative to the directories.
+func validateExclude(f v1alpha1.FileLocation) error {
+	for _, pattern := range f.Exclude {
+		if len(pattern) == 0 || path.IsAbs(pattern) {
+			return fmt.Errorf("invalid exclude pattern %q of %s, should be relative to the directory", pattern, f.From)
+		}
+		for _, segment := range strings.Split(pattern, "/") {
+			if segment == ".." {
+				return fmt.Errorf("invalid exclude pattern %q of %s, should be relative to the directory", pattern, f.From)
 			}
+			if _, err := path.Match(segment, ""); err != nil {
+				return fmt.Errorf("invalid exclude pattern %q of %s: %w", pattern, f.From, err)
+			}
+		}
+	}
+	return nil
+}
 
-			// some tools prepend everything with "./", so if we don't Clean the
-			// name, we may have duplicate entries, which angers tar-split.
-			header.Name = filepath.Clean(header.Name)
+// the setuid and setgid bits of the modes of the tar headers
+const (
+	modeSetuid = 0o4000
+	modeSetgid = 0o2000
+)
 
-			// skip empty file names
-			if len(header.Name) == 0 {
-				continue
-			}
+// checkPrivileged returns a PrivilegedFileError if the file of the image is setuid, setgid or a device,
+// and RejectPrivilegedFiles is set.
+func checkPrivileged(name string, header *tar.Header) error {
+	if !RejectPrivilegedFiles {
+		return nil
+	}
+	switch {
+	case header.Typeflag == tar.TypeChar:
+		return &PrivilegedFileError{File: name, Reason: "a character device"}
+	case header.Typeflag == tar.TypeBlock:
+		return &PrivilegedFileError{File: name, Reason: "a block device"}
+	case header.Mode&modeSetuid != 0:
+		return &PrivilegedFileError{File: name, Reason: "setuid"}
+	case header.Mode&modeSetgid != 0:
+		return &PrivilegedFileError{File: name, Reason: "setgid"}
+	}
+	return nil
+}
+
+// normalizeMode returns 0755 for the files executable by anyone in the image, and 0644 for the others,
+// dropping the setuid, setgid and sticky bits and the odd permissions of the image.
+func normalizeMode(mode int64) int64 {
+	if mode&0o111 != 0 {
+		return 0o755
+	}
+	return 0o644
+}
+
+// opaqueWhiteout is the whiteout file deleting the contents of its directory in the lower layers.
+const opaqueWhiteout = ".wh..wh..opq"
+
+// isWhiteout reports whether the file of the layer deletes files of the lower layers.
+func isWhiteout(name string) bool {
+	return strings.HasPrefix(path.Base(name), ".wh.")
+}
+
+// whiteouts are the files and directories deleted by the upper layers.
+type whiteouts struct {
+	deleted map[string]struct{}
+	opaque  map[string]struct{}
+}
+
+func newWhiteouts() whiteouts {
+	return whiteouts{deleted: map[string]struct{}{}, opaque: map[string]struct{}{}}
+}
+
+// add records the whiteout file.
+func (w whiteouts) add(name string) {
+	dir, base := path.Dir(name), path.Base(name)
+	if base == opaqueWhiteout {
+		w.opaque[dir] = struct{}{}
+		return
+	}
+	w.deleted[path.Join(dir, strings.TrimPrefix(base, ".wh."))] = struct{}{}
+}
+
+// merge records the whiteouts of the upper layer.
+func (w whiteouts) merge(layer whiteouts) {
+	for name := range layer.deleted {
+		w.deleted[name] = struct{}{}
+	}
+	for dir := range layer.opaque {
+		w.opaque[dir] = struct{}{}
+	}
+}
+
+// isDeleted reports whether the file, or a directory it is in, is deleted, or whether it is in an opaque directory.
+func (w whiteouts) isDeleted(name string) bool {
+	for p := name; ; p = path.Dir(p) {
+		if _, ok := w.opaque[p]; ok && p != name {
+			return true
+		}
+		if p == "." || p == "/" {
+			return false
+		}
+		if _, ok := w.deleted[p]; ok {
+			return true
+		}
+	}
+}
+
+// validateFiles rejects the invalid patterns and the files that would be written outside of the installation folder.
+func validateFiles(files []v1alpha1.FileLocation) error {
+	for _, f := range files {
+		if _, err := path.Match(f.From, ""); err != nil {
+			return fmt.Errorf("invalid pattern %s: %w", f.From, err)
+		}
+		if err := validateExclude(f); err != nil {
+			return err
+		}
+		if err := validateTransforms(f); err != nil {
+			return err
+		}
+		if f.StripComponents < 0 {
+			return fmt.Errorf("invalid number %d of components to strip from %s", f.StripComponents, f.From)
+		}
+		if f.StripComponents > 0 && len(f.To) > 0 && f.To != "." && !strings.HasSuffix(f.To, "/") {
+			return fmt.Errorf("components of %s can only be stripped to a directory, %s should be . or end with /", f.From, f.To)
+		}
+		p := archivePath(f, f.From)
+		if path.IsAbs(p) || p == ".." || strings.HasPrefix(p, "../") {
+			return fmt.Errorf("invalid destination %s of file %s, should be relative to the installation folder", f.To, f.From)
+		}
+	}
+	return nil
+}
+
+// extraction tracks the files written to the artifact across the layers.
+type extraction struct {
+	files   []v1alpha1.FileLocation
+	archive archiveWriter
+	// found are the From of the files found so far
+	found map[string]struct{}
+	// linked are the From of the files found as links, which are found once resolved
+	linked map[string]struct{}
+	// open are the From of the directories and glob patterns, whose files may be found in any layer
+	open map[string]struct{}
+	// sources are the files of the image written so far, the ones in the lower layers are shadowed
+	sources map[string]struct{}
+	// written maps the paths in the artifact to the files of the image they are written from
+	written map[string]string
+	// archived are the paths of the files written to the artifact
+	archived []string
+	// whiteouts are the files and directories deleted by the layers read so far,
+	// and layerWhiteouts the ones deleted by the current layer
+	whiteouts      whiteouts
+	layerWhiteouts whiteouts
+	// links are the links found for the targets, resolved once all the layers are read
+	links []*link
+	// layer is the layer visited, and top the top layer of the image
+	layer, top int
+	// bin is the path of the plugin executable in the artifact, which must run on platform
+	bin      string
+	platform string
+	// sbom captures the SBOM of the image, if it is looked up
+	sbom *sbomCapture
+	// raw writes the plugin executable aside, if it is published uncompressed
+	raw *rawFile
+	// completions write the completion scripts aside by path in the artifact, see CompletionPath
+	completions map[string]*rawFile
+	// size is the total size of the files written to the artifact
+	size int64
+}
+
+func newExtraction(platform v1alpha1.PluginPlatform, archive archiveWriter, layers int) *extraction {
+	e := &extraction{
+		platform:       platform.Platform,
+		top:            layers - 1,
+		files:          platform.Files,
+		archive:        archive,
+		found:          map[string]struct{}{},
+		linked:         map[string]struct{}{},
+		open:           map[string]struct{}{},
+		sources:        map[string]struct{}{},
+		written:        map[string]string{},
+		whiteouts:      newWhiteouts(),
+		layerWhiteouts: newWhiteouts(),
+	}
+	if len(platform.Bin) > 0 {
+		e.bin = path.Clean(platform.Bin)
+	}
+	for _, f := range e.files {
+		if isGlob(f.From) {
+			e.open[f.From] = struct{}{}
+		}
+	}
+	return e
+}
+
+// done reports whether every file is found.
+func (e *extraction) done() bool {
+	if len(e.open) > 0 || (e.sbom != nil && !e.sbom.found()) {
+		return false
+	}
+	for _, f := range e.files {
+		_, found := e.found[f.From]
+		_, linked := e.linked[f.From]
+		if !found && !linked {
+			return false
+		}
+	}
+	return true
+}
+
+// whiteout records the file or directory deleted by the whiteout file of the current layer.
+func (e *extraction) whiteout(name string) {
+	e.layerWhiteouts.add(name)
+}
+
+// nextLayer applies the whiteouts of the current layer to the lower layers.
+func (e *extraction) nextLayer() {
+	e.whiteouts.merge(e.layerWhiteouts)
+	e.layerWhiteouts = newWhiteouts()
+}
+
+// deleted reports whether the file, or a directory it is in, is deleted by an upper layer.
+func (e *extraction) deleted(name string) bool {
+	return e.whiteouts.isDeleted(name)
+}
+
+// target returns the file location the file of the image is written for, if any,
+// and its path in the artifact.
+func (e *extraction) target(name string) (v1alpha1.FileLocation, string, bool) {
+	if _, ok := e.sources[name]; ok || e.deleted(name) {
+		return v1alpha1.FileLocation{}, "", false
+	}
+	for _, f := range e.files {
+		_, found := e.found[f.From]
+		_, linked := e.linked[f.From]
+		_, open := e.open[f.From]
+		if (found || linked) && !open {
+			continue
+		}
+		root, ok := matchFile(f, name)
+		if !ok {
+			continue
+		}
+		if root == name {
+			return f, archivePath(f, name), true
+		}
+		return f, contentPath(f, root, name), true
+	}
+	return v1alpha1.FileLocation{}, "", false
+}
+
+// reserve records the file of the image for the target, shadowing the lower layers.
+func (e *extraction) reserve(f v1alpha1.FileLocation, name, archiveName string) error {
+	if source, ok := e.written[archiveName]; ok {
+		return fmt.Errorf("both %s and %s are written to %s, %s should be a directory", source, name, archiveName, f.To)
+	}
+	if root, _ := matchFile(f, name); root != name {
+		e.open[f.From] = struct{}{}
+	}
+	e.sources[name] = struct{}{}
+	e.written[archiveName] = name
+	return nil
+}
+
+// add writes the file of the image for the target to the artifact.
+func (e *extraction) add(f v1alpha1.FileLocation, name, archiveName string, header *tar.Header, contents io.Reader) error {
+	if err := e.reserve(f, name, archiveName); err != nil {
+		return err
+	}
+	if err := e.write(f, name, archiveName, header, contents); err != nil {
+		return err
+	}
+	e.found[f.From] = struct{}{}
+	return nil
+}
+
+// write writes the file of the image to the artifact with the transforms of the target applied.
+func (e *extraction) write(f v1alpha1.FileLocation, name, archiveName string, header *tar.Header, contents io.Reader) error {
+	if err := checkPrivileged(name, header); err != nil {
+		return err
+	}
+	header = &tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     archiveName,
+		Size:     header.Size,
+		Mode:     normalizeMode(header.Mode),
+		ModTime:  artifactModTime,
+		Uid:      ArtifactUID,
+		Gid:      ArtifactGID,
+		Uname:    ArtifactUname,
+		Gname:    ArtifactGname,
+	}
+	if archiveName == e.bin {
+		var err error
+		if contents, err = checkBinary(name, e.platform, contents); err != nil {
+			return err
+		}
+	}
+	contents, err := transform(f, header, contents)
+	if err != nil {
+		return err
+	}
+	if archiveName == e.bin {
+		header.Mode = 0o755
+		if e.raw != nil {
+			contents = e.raw.tee(contents)
+		}
+	}
+	if completion, ok := e.completions[archiveName]; ok {
+		contents = completion.tee(contents)
+	}
+	// the sizes are checked before writing, the contents of the layer entries are bounded by their headers
+	if MaxFileSize > 0 && header.Size > MaxFileSize {
+		return &ArtifactTooLargeError{File: name, Size: header.Size, Limit: MaxFileSize}
+	}
+	e.size += header.Size
+	if MaxArtifactSize > 0 && e.size > MaxArtifactSize {
+		return &ArtifactTooLargeError{Size: e.size, Limit: MaxArtifactSize}
+	}
+	if err := e.archive.writeFile(header, contents); err != nil {
+		return fmt.Errorf("writing %s: %v", name, err)
+	}
+	e.archived = append(e.archived, archiveName)
+	return nil
+}
+
+// visit copies the entry of the layer to the artifact if it is a target, and reports
+// whether the next entries should be visited.
+func (e *extraction) visit(header *tar.Header, contents io.Reader) (bool, error) {
+	name := header.Name
+	// the deleted files are ignored in the lower layers
+	if isWhiteout(name) {
+		e.whiteout(name)
+		return true, nil
+	}
+	switch header.Typeflag {
+	case tar.TypeSymlink, tar.TypeLink:
+		if err := e.addLink(name, header); err != nil {
+			return false, err
+		}
+		return !e.done(), nil
+	case tar.TypeReg:
+	case tar.TypeChar, tar.TypeBlock:
+		// the devices are skipped, unless they are rejected
+		if _, _, ok := e.target(name); ok {
+			return true, checkPrivileged(name, header)
+		}
+		return true, nil
+	default:
+		// skip directories and special files
+		return true, nil
+	}
+
+	// skip empty file contents
+	if header.Size == 0 {
+		return true, nil
+	}
 
-			// skip the file if it was already found and processed in a previous/more recent layer
-			if _, ok := processedTargets[header.Name]; ok {
-				continue
+	// determine if we care about the given file, skipping the files already
+	// found and processed in a previous/more recent layer
+	target, archiveName, ok := e.target(name)
+	if !ok {
+		return true, e.captureSBOM(header, contents)
+	}
+	if err := e.add(target, name, archiveName, header, contents); err != nil {
+		return false, err
+	}
+	return !e.done(), nil
+}
+
+// wants reports whether the regular file of the image is a target or the SBOM looked up.
+func (e *extraction) wants(name string) bool {
+	if _, _, ok := e.target(name); ok {
+		return true
+	}
+	_, ok := e.sbomFormat(name)
+	return ok
+}
+
+// sbomFormat returns the format of the file of the image if it is the SBOM looked up, see sbomDirs.
+func (e *extraction) sbomFormat(name string) (string, bool) {
+	if e.sbom == nil || e.sbom.found() || e.deleted(name) {
+		return "", false
+	}
+	return sbomFormat(name)
+}
+
+// captureSBOM writes the file of the image aside if it is the SBOM looked up.
+func (e *extraction) captureSBOM(header *tar.Header, contents io.Reader) error {
+	format, ok := e.sbomFormat(header.Name)
+	if !ok {
+		return nil
+	}
+	if header.Size > maxSBOMSize {
+		klog.V(2).Infof("SBOM %s of %d bytes is skipped", header.Name, header.Size)
+		return nil
+	}
+	return e.sbom.write(format, contents)
+}
+
+// visitFunc is called for the entries of a layer, with their names cleaned, until it returns false.
+type visitFunc func(header *tar.Header, contents io.Reader) (bool, error)
+
+// forEachEntry calls visit for the entries of the layer tarball.
+func forEachEntry(layer v1.Layer, progress func(), visit visitFunc) error {
+	layerReader, err := layer.Uncompressed()
+	if err != nil {
+		return fmt.Errorf("reading layer contents: %v", err)
+	}
+	defer layerReader.Close()
+
+	tarReader := tar.NewReader(&progressReader{
+		Reader:   layerReader,
+		progress: progress,
+	})
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("reading tar: %v", err)
+		}
+
+		// some tools prepend everything with "./", so if we don't Clean the
+		// name, we may have duplicate entries, which angers tar-split.
+		header.Name = strings.TrimPrefix(filepath.Clean(header.Name), "/")
+
+		// skip empty file names
+		if len(header.Name) == 0 || header.Name == "." {
+			continue
+		}
+		next, err := visit(header, tarReader)
+		if err != nil || !next {
+			return err
+		}
+	}
+}
+
+// Extract an image's filesystem as a tarball, or individual files from the image.
+func Extract(ctx context.Context, img v1.Image, platform v1alpha1.PluginPlatform, destinationName string, progress ProgressFunc) (_ []v1alpha1.FileLocation, _ string, err error) {
+	layers, err := img.Layers()
+	if err != nil {
+		return nil, "", fmt.Errorf("retrieving image layers: %v", err)
+	}
+	if progress == nil {
+		progress = func(int, int) {}
+	}
+	platform = withBundledFiles(platform)
+	if err := validateFiles(platform.Files); err != nil {
+		return nil, "", err
+	}
+
+	// the artifact is written aside, so that the previous one is served until it is replaced
+	written := destinationName + partialSuffix
+	file, err := os.Create(written)
+	if err != nil {
+		return nil, "", err
+	}
+	defer file.Close()
+	defer func() {
+		if err != nil {
+			os.Remove(written)
+		}
+	}()
+	hash := sha256.New()
+
+	// the zstd variant is compressed from the same tarball as it is written
+	var zstdFile *os.File
+	var zstdWriter io.Writer
+	zstdHash := sha256.New()
+	zstdWritten := ZstdPath(destinationName) + partialSuffix
+	tarGz := ArchiveFormat(platform) == v1alpha1.ArchiveFormatTarGz
+	if ZstdArtifacts && tarGz {
+		zstdFile, err = os.Create(zstdWritten)
+		if err != nil {
+			return nil, "", err
+		}
+		defer zstdFile.Close()
+		defer func() {
+			if err != nil {
+				os.Remove(zstdWritten)
+			}
+		}()
+		zstdWriter = io.MultiWriter(zstdFile, zstdHash)
+	}
+	compressed, err := newArchiveWriter(ArchiveFormat(platform), io.MultiWriter(file, hash), zstdWriter)
+	if err != nil {
+		return nil, "", err
+	}
+	defer compressed.Close()
+	// the files are spooled aside and written sorted by name, so that the same files always yield
+	// the same artifact and checksum
+	spool, err := os.Create(destinationName + spoolSuffix + partialSuffix)
+	if err != nil {
+		return nil, "", err
+	}
+	defer os.Remove(spool.Name())
+	defer spool.Close()
+	archive := newSortedWriter(compressed, spool)
+	e := newExtraction(platform, archive, len(layers))
+	var sbom *sbomCapture
+	if SBOMs {
+		sbom = &sbomCapture{artifact: destinationName}
+		defer func() {
+			if err != nil {
+				sbom.discard()
 			}
+		}()
+		e.sbom = sbom
+	}
+	// the executable and the completion scripts are stored next to the artifact once it is stored,
+	// and the ones of the previous extraction are removed if they are not published anymore
+	raw := &rawFile{name: RawBinaryPath(destinationName)}
+	if platform.RawBinary {
+		raw, err = newRawFile(RawBinaryPath(destinationName))
+		if err != nil {
+			return nil, "", err
+		}
+		defer raw.close()
+		e.raw = raw
+	}
+	completions, err := newCompletionFiles(platform, destinationName)
+	if err != nil {
+		return nil, "", err
+	}
+	for _, completion := range completions {
+		defer completion.close()
+	}
+	e.completions = completions
+	fileLocation, err := extractFiles(ctx, img, layers, platform, e, progress)
+	if err != nil {
+		return nil, "", err
+	}
+	if registryImage, ok := img.(*remoteImage); ok && sbom != nil && !sbom.found() {
+		if err := registryImage.referrerSBOM(sbom); err != nil {
+			klog.Warningf("looking up the SBOM of %s in its referrers error %v", registryImage.repository, err)
+		}
+	}
 
-			// determine if we care about the given file
-			for _, target := range platform.Files {
-				if header.Name == strings.TrimPrefix(target.From, "/") {
-					processedTargets[target.From] = struct{}{}
-					// TODO: Should we write it to target.To?
-					if err := tw.WriteHeader(header); err != nil {
-						continue
-					}
-
-					if _, err := io.Copy(tw, tarReader); err != nil {
-						continue
-					}
-					foundLen++
-					break
+	if err := archive.Close(); err != nil {
+		return nil, "", err
+	}
+	// the artifacts are flushed before they are renamed, so that a crash does not leave them truncated
+	if err := syncClose(file); err != nil {
+		return nil, "", err
+	}
+	// the artifact is read back, so that an artifact corrupted on disk is never served
+	if err := verifyArtifact(written, ArchiveFormat(platform), e.archived); err != nil {
+		return nil, "", err
+	}
+	checksum := hex.EncodeToString(hash.Sum(nil))
+	// the artifact is downloadable once it is stored, the previous one is kept if it is rejected
+	if err := scanArtifact(written, destinationName, checksum, ArchiveFormat(platform)); err != nil {
+		return nil, "", err
+	}
+	if err := storeArtifact(written, destinationName, checksum); err != nil {
+		return nil, "", err
+	}
+	if zstdFile != nil {
+		if err := syncClose(zstdFile); err != nil {
+			return nil, "", err
+		}
+		if err := verifyArtifact(zstdWritten, ArchiveFormat(platform), e.archived); err != nil {
+			return nil, "", err
+		}
+		if err := storeArtifact(zstdWritten, ZstdPath(destinationName), hex.EncodeToString(zstdHash.Sum(nil))); err != nil {
+			return nil, "", err
+		}
+	} else if tarGz {
+		// the variant of the previous extraction is not served once they are disabled
+		if err := RemoveArtifact(ZstdPath(destinationName)); err != nil {
+			return nil, "", err
+		}
+	}
+	if err := raw.store(); err != nil {
+		return nil, "", err
+	}
+	if err := storeCompletions(destinationName, completions); err != nil {
+		return nil, "", err
+	}
+	if len(platform.ManPages) > 0 {
+		err = storeManPages(destinationName, ArchiveFormat(platform))
+	} else {
+		err = RemoveArtifact(ManPagesPath(destinationName))
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	if sbom == nil {
+		sbom = &sbomCapture{artifact: destinationName}
+	}
+	// the SBOM of the previous extraction is removed if the image has none
+	if err := sbom.store(); err != nil {
+		return nil, "", err
+	}
+	return fileLocation, checksum, nil
+}
+
+// artifactLayout is the version of the way the files are written to the artifacts, which is bumped
+// whenever the same files yield another artifact so that the artifacts are extracted again.
+const artifactLayout = 1
+
+// withBundledFiles returns the platform with the file locations of its completion scripts and of its
+// man pages appended to its files.
+func withBundledFiles(platform v1alpha1.PluginPlatform) v1alpha1.PluginPlatform {
+	return withManPages(withCompletions(platform))
+}
+
+// ChecksumPath returns the path of the file holding the sha256 checksum of the artifact in hex format.
+func ChecksumPath(tarballPath string) string {
+	return tarballPath + ".sha256"
+}
+
+// ExtractionHash returns the sha256 hash in hex format of the inputs of Extract besides the image.
+func ExtractionHash(platform v1alpha1.PluginPlatform) string {
+	// the maps are marshalled with their keys sorted
+	data, _ := json.Marshal(struct {
+		Layout           int                     `json:"layout"`
+		Platform         string                  `json:"platform"`
+		Bin              string                  `json:"bin"`
+		RawBinary        bool                    `json:"rawBinary"`
+		ArchiveFormat    v1alpha1.ArchiveFormat  `json:"archiveFormat"`
+		Files            []v1alpha1.FileLocation `json:"files"`
+		Placeholders     map[string]string       `json:"placeholders"`
+		GzipLevel        int                     `json:"gzipLevel"`
+		Owner            []string                `json:"owner"`
+		ZstdArtifacts    bool                    `json:"zstdArtifacts"`
+		SBOMs            bool                    `json:"sboms"`
+		MaxFileSize      int64                   `json:"maxFileSize"`
+		MaxArtifactSize  int64                   `json:"maxArtifactSize"`
+		RejectPrivileged bool                    `json:"rejectPrivilegedFiles"`
+		ScanWebhookURL   string                  `json:"scanWebhookURL"`
+	}{
+		Layout:           artifactLayout,
+		Platform:         platform.Platform,
+		Bin:              platform.Bin,
+		RawBinary:        platform.RawBinary,
+		ArchiveFormat:    ArchiveFormat(platform),
+		Files:            withBundledFiles(platform).Files,
+		Placeholders:     Placeholders,
+		GzipLevel:        GzipLevel,
+		Owner:            []string{strconv.Itoa(ArtifactUID), strconv.Itoa(ArtifactGID), ArtifactUname, ArtifactGname},
+		ZstdArtifacts:    ZstdArtifacts,
+		SBOMs:            SBOMs,
+		MaxFileSize:      MaxFileSize,
+		MaxArtifactSize:  MaxArtifactSize,
+		RejectPrivileged: RejectPrivilegedFiles,
+		ScanWebhookURL:   ScanWebhookURL,
+	})
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// Validate looks up the files of the platform in the image like Extract, without writing the artifact.
+func Validate(ctx context.Context, img v1.Image, platform v1alpha1.PluginPlatform, progress ProgressFunc) ([]v1alpha1.FileLocation, error) {
+	layers, err := img.Layers()
+	if err != nil {
+		return nil, fmt.Errorf("retrieving image layers: %v", err)
+	}
+	if progress == nil {
+		progress = func(int, int) {}
+	}
+	platform = withBundledFiles(platform)
+	if err := validateFiles(platform.Files); err != nil {
+		return nil, err
+	}
+	return extractFiles(ctx, img, layers, platform, newExtraction(platform, discardWriter{}, len(layers)), progress)
+}
+
+// extractFiles writes the files of the platform found in the layers of the image with the extraction.
+func extractFiles(ctx context.Context, img v1.Image, layers []v1.Layer, platform v1alpha1.PluginPlatform, e *extraction, progress ProgressFunc) ([]v1alpha1.FileLocation, error) {
+
+	// the layers with eStargz TOC are read lazily, if the image is pulled from a registry
+	lazyImage, _ := img.(*remoteImage)
+	var layerDescriptors []v1.Descriptor
+	if lazyImage != nil && lazyImage.lazy {
+		manifest, err := img.Manifest()
+		if err == nil && len(manifest.Layers) == len(layers) {
+			layerDescriptors = manifest.Layers
+		}
+	}
+	release, err := reserveMemory(ctx, extractionMemory(platform, layerDescriptors != nil))
+	if err != nil {
+		return nil, fmt.Errorf("waiting for the memory of the extraction: %w", err)
+	}
+	defer release()
+
+	readLayer := func(i int, visit visitFunc) error {
+		layersProcessed := len(layers) - 1 - i
+		layerProgress := func() {
+			progress(layersProcessed, len(layers))
+		}
+		if layerDescriptors != nil && len(layerDescriptors[i].Annotations[estargz.TOCJSONDigestAnnotation]) > 0 {
+			visited, err := lazyImage.forEachEStargzEntry(layerDescriptors[i], layerProgress, visit)
+			if err == nil || visited {
+				if err != nil {
+					return fmt.Errorf("reading eStargz layer: %v", err)
 				}
+				return nil
 			}
-			if foundLen == len(platform.Files) {
-				break
+			// the registry may not support range requests, read the whole layer instead
+		}
+		return forEachEntry(layers[i], layerProgress, visit)
+	}
+	// the layers read whole are indexed, so that they are only read again if one of their regular
+	// files is wanted, see LayerIndexCacheSize
+	visitLayer := func(i int, wants func(name string) bool, visit visitFunc) error {
+		digest, err := layers[i].Digest()
+		if err != nil || LayerIndexCacheSize <= 0 {
+			return readLayer(i, visit)
+		}
+		if index, ok := layerIndexes.get(digest); ok {
+			if replayed, err := index.replay(wants, visit); replayed || err != nil {
+				return err
 			}
 		}
-		layerReader.Close()
+		builder := &indexBuilder{}
+		if err := readLayer(i, builder.wrap(visit)); err != nil {
+			return err
+		}
+		if builder.complete {
+			layerIndexes.add(digest, builder.index)
+		}
+		return nil
+	}
+
+	// we iterate through the layers in reverse order because it makes handling
+	// whiteout layers more efficient, since we can just keep track of the removed
+	// files as we see .wh. layers and ignore those in previous layers.
+	for i := len(layers) - 1; i >= 0; i-- {
+		if e.done() {
+			break
+		}
+		e.layer = i
+		if err := visitLayer(i, e.wants, e.visit); err != nil {
+			return nil, err
+		}
+		e.nextLayer()
+		progress(len(layers)-i, len(layers))
+	}
+	if err := e.resolveLinks(len(layers), visitLayer); err != nil {
+		return nil, err
 	}
 
 	var fileLocation []v1alpha1.FileLocation
+	var missing []string
 	for _, f := range platform.Files {
-		if _, ok := processedTargets[f.From]; ok {
+		if _, ok := e.found[f.From]; ok {
 			fileLocation = append(fileLocation, f)
+		} else if !f.Optional {
+			missing = append(missing, f.From)
 		}
 	}
-
+	if len(missing) > 0 {
+		return nil, &MissingFilesError{Files: missing}
+	}
 	return fileLocation, nil
 }
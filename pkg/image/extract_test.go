@@ -0,0 +1,2508 @@
+package image
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"debug/elf"
+	"debug/macho"
+	"debug/pe"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/containerd/stargz-snapshotter/estargz"
+	"github.com/google/go-containerregistry/pkg/compression"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/layout"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/klauspost/compress/zstd"
+	"github.com/opencontainers/go-digest"
+
+	"github.com/openshift/cli-manager/api/v1alpha1"
+)
+
+// newLayer returns a layer of the files compressed with the given algorithm.
+func newLayer(t *testing.T, files map[string]string, comp compression.Compression) v1.Layer {
+	t.Helper()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for name, content := range files {
+		if err := tw.WriteHeader(&tar.Header{
+			Name:     name,
+			Mode:     0755,
+			Size:     int64(len(content)),
+			Typeflag: tar.TypeReg,
+		}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	mediaType := types.OCILayer
+	if comp == compression.ZStd {
+		mediaType = types.OCILayerZStd
+	}
+	layer, err := tarball.LayerFromOpener(func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(buf.Bytes())), nil
+	}, tarball.WithCompression(comp), tarball.WithMediaType(mediaType))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return layer
+}
+
+// newImage returns a linux/amd64 image of the layers.
+func newImage(t *testing.T, layers ...v1.Layer) v1.Image {
+	t.Helper()
+	img, err := mutate.AppendLayers(empty.Image, layers...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := img.ConfigFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg = cfg.DeepCopy()
+	cfg.OS = "linux"
+	cfg.Architecture = "amd64"
+	img, err = mutate.ConfigFile(img, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return mutate.MediaType(img, types.OCIManifestSchema1)
+}
+
+// readArtifact returns the files in the extracted tar.gz artifact.
+func readArtifact(t *testing.T, path string) map[string]string {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	gr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{}
+	tr := tar.NewReader(gr)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return files
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, err := io.ReadAll(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[header.Name] = string(content)
+	}
+}
+
+// readModes returns the modes of the files in the extracted tar.gz artifact.
+func readModes(t *testing.T, path string) map[string]int64 {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	gr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	modes := map[string]int64{}
+	tr := tar.NewReader(gr)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return modes
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		modes[header.Name] = header.Mode
+	}
+}
+
+var testPlatform = v1alpha1.PluginPlatform{
+	Platform: "linux/amd64",
+	Files: []v1alpha1.FileLocation{
+		{From: "/usr/bin/zstd-tool", To: "."},
+		{From: "/usr/bin/gzip-tool", To: "."},
+	},
+	Bin: "zstd-tool",
+}
+
+func TestExtractZstdLayers(t *testing.T) {
+	img := newImage(t,
+		newLayer(t, map[string]string{"usr/bin/gzip-tool": "gzip"}, compression.GZip),
+		newLayer(t, map[string]string{"usr/bin/zstd-tool": "zstd"}, compression.ZStd),
+	)
+
+	destination := filepath.Join(t.TempDir(), "plugin.tar.gz")
+	files, _, err := Extract(context.Background(), img, testPlatform, destination, nil)
+	if err != nil {
+		t.Fatalf("extract error: %v", err)
+	}
+	if len(files) != 2 {
+		t.Fatalf("expected 2 files, got %v", files)
+	}
+	artifact := readArtifact(t, destination)
+	if artifact["zstd-tool"] != "zstd" || artifact["gzip-tool"] != "gzip" {
+		t.Fatalf("unexpected artifact contents %v", artifact)
+	}
+}
+
+func TestPullZstdOCIArchive(t *testing.T) {
+	img := newImage(t,
+		newLayer(t, map[string]string{"usr/bin/gzip-tool": "gzip"}, compression.GZip),
+		newLayer(t, map[string]string{"usr/bin/zstd-tool": "zstd"}, compression.ZStd),
+	)
+
+	// write the image as OCI layout and pack it as oci-archive
+	layoutDir := t.TempDir()
+	p, err := layout.Write(layoutDir, empty.Index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.AppendImage(img, layout.WithPlatform(v1.Platform{OS: "linux", Architecture: "amd64"})); err != nil {
+		t.Fatal(err)
+	}
+	imagesDir := t.TempDir()
+	archive, err := os.Create(filepath.Join(imagesDir, "tool.tar"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tw := tar.NewWriter(archive)
+	if err := tw.AddFS(os.DirFS(layoutDir)); err != nil {
+		t.Fatal(err)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	archive.Close()
+
+	defer func(path string) { LocalImagesPath = path }(LocalImagesPath)
+	LocalImagesPath = imagesDir
+	pulled, err := Pull(OCIArchivePrefix+"tool.tar", PullOptions{Platform: "linux/amd64"})
+	if err != nil {
+		t.Fatalf("pull error: %v", err)
+	}
+
+	destination := filepath.Join(t.TempDir(), "plugin.tar.gz")
+	files, _, err := Extract(context.Background(), pulled, testPlatform, destination, nil)
+	if err != nil {
+		t.Fatalf("extract error: %v", err)
+	}
+	if len(files) != 2 {
+		t.Fatalf("expected 2 files, got %v", files)
+	}
+	artifact := readArtifact(t, destination)
+	if artifact["zstd-tool"] != "zstd" || artifact["gzip-tool"] != "gzip" {
+		t.Fatalf("unexpected artifact contents %v", artifact)
+	}
+
+	if _, err := Pull(OCIArchivePrefix+"tool.tar", PullOptions{Platform: "linux/arm64"}); !IsPlatformMissing(err) {
+		t.Fatalf("expected missing platform error, got %v", err)
+	}
+}
+
+func TestPlatforms(t *testing.T) {
+	imagesDir := t.TempDir()
+	defer func(path string) { LocalImagesPath = path }(LocalImagesPath)
+	LocalImagesPath = imagesDir
+	// writeArchive packs the images into an oci-archive, with their platforms if any
+	writeArchive := func(name string, platforms ...v1.Platform) {
+		layoutDir := t.TempDir()
+		p, err := layout.Write(layoutDir, empty.Index)
+		if err != nil {
+			t.Fatal(err)
+		}
+		img := newImage(t, newLayer(t, map[string]string{"usr/bin/tool": "tool"}, compression.GZip))
+		if len(platforms) == 0 {
+			if err := p.AppendImage(img); err != nil {
+				t.Fatal(err)
+			}
+		}
+		for _, platform := range platforms {
+			if err := p.AppendImage(img, layout.WithPlatform(platform)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		archive, err := os.Create(filepath.Join(imagesDir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer archive.Close()
+		tw := tar.NewWriter(archive)
+		if err := tw.AddFS(os.DirFS(layoutDir)); err != nil {
+			t.Fatal(err)
+		}
+		if err := tw.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	writeArchive("multi.tar",
+		v1.Platform{OS: "linux", Architecture: "amd64"},
+		v1.Platform{OS: "linux", Architecture: "arm64"},
+		v1.Platform{OS: "linux", Architecture: "arm", Variant: "v7"},
+		v1.Platform{OS: "linux", Architecture: "arm", Variant: "v6"},
+		v1.Platform{OS: "unknown", Architecture: "unknown"},
+	)
+	platforms, err := Platforms(OCIArchivePrefix+"multi.tar", PullOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{"linux/amd64", "linux/arm64", "linux/arm"}; !reflect.DeepEqual(platforms, expected) {
+		t.Fatalf("expected platforms %v, got %v", expected, platforms)
+	}
+
+	// the platform of a single image is read from its config
+	writeArchive("single.tar")
+	platforms, err = Platforms(OCIArchivePrefix+"single.tar", PullOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{"linux/amd64"}; !reflect.DeepEqual(platforms, expected) {
+		t.Fatalf("expected platforms %v, got %v", expected, platforms)
+	}
+
+	if _, err := Platforms("configmap://tools/tool", PullOptions{}); err == nil {
+		t.Fatal("expected the platforms of the ConfigMaps not to be listed")
+	}
+}
+
+func TestPlatformsBreaker(t *testing.T) {
+	server := httptest.NewServer(registry.New(registry.Logger(log.New(io.Discard, "", 0))))
+	defer server.Close()
+	host := strings.TrimPrefix(server.URL, "http://")
+	ref, err := name.ParseReference(host + "/tools/tool:latest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	img := newImage(t, newLayer(t, map[string]string{"usr/bin/tool": "tool"}, compression.GZip))
+	index := mutate.AppendManifests(empty.Index, mutate.IndexAddendum{
+		Add:        img,
+		Descriptor: v1.Descriptor{Platform: &v1.Platform{OS: "linux", Architecture: "arm64"}},
+	})
+	if err := remote.WriteIndex(ref, index); err != nil {
+		t.Fatal(err)
+	}
+
+	defer func(threshold int, cooldown time.Duration) {
+		CircuitBreakerThreshold, CircuitBreakerCooldown = threshold, cooldown
+	}(CircuitBreakerThreshold, CircuitBreakerCooldown)
+	CircuitBreakerThreshold, CircuitBreakerCooldown = 1, time.Millisecond
+	done, err := allowPull(host)
+	if err != nil {
+		t.Fatal(err)
+	}
+	done(errors.New("connection refused"))
+	time.Sleep(2 * CircuitBreakerCooldown)
+
+	// the trial pull of the platforms closes the breaker
+	platforms, err := Platforms(ref.String(), PullOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{"linux/arm64"}; !reflect.DeepEqual(platforms, expected) {
+		t.Fatalf("expected platforms %v, got %v", expected, platforms)
+	}
+	if _, err := allowPull(host); err != nil {
+		t.Fatalf("expected the breaker to be closed, got %v", err)
+	}
+}
+
+func TestBreaker(t *testing.T) {
+	const host = "breaker.example.com"
+	defer func(threshold int, cooldown time.Duration) {
+		CircuitBreakerThreshold, CircuitBreakerCooldown = threshold, cooldown
+		breakersMu.Lock()
+		delete(breakers, host)
+		breakersMu.Unlock()
+	}(CircuitBreakerThreshold, CircuitBreakerCooldown)
+	CircuitBreakerThreshold, CircuitBreakerCooldown = 3, time.Hour
+	unavailable := &transport.Error{StatusCode: http.StatusServiceUnavailable}
+	// pull records the result of a pull allowed by the breaker
+	pull := func(result error) {
+		t.Helper()
+		done, err := allowPull(host)
+		if err != nil {
+			t.Fatalf("expected the pull to be allowed, got %v", err)
+		}
+		done(result)
+	}
+	shortCircuited := func() bool {
+		t.Helper()
+		_, err := allowPull(host)
+		var unavailableErr *RegistryUnavailableError
+		if err != nil && !errors.As(err, &unavailableErr) {
+			t.Fatalf("expected registry unavailable error, got %v", err)
+		}
+		return err != nil
+	}
+
+	// the failures specific to the image reset the count of consecutive failures
+	pull(unavailable)
+	pull(unavailable)
+	pull(&transport.Error{StatusCode: http.StatusUnauthorized})
+	pull(unavailable)
+	pull(unavailable)
+	if shortCircuited() {
+		t.Fatal("expected the breaker to be closed below the threshold")
+	}
+
+	// the breaker trips at the threshold
+	pull(unavailable)
+	if !shortCircuited() || !shortCircuited() {
+		t.Fatal("expected the pulls to be short-circuited while the breaker is open")
+	}
+
+	// a single trial pull is let through once the cooldown elapses, and reopens the breaker on failure
+	CircuitBreakerCooldown = time.Millisecond
+	time.Sleep(2 * CircuitBreakerCooldown)
+	done, err := allowPull(host)
+	if err != nil {
+		t.Fatalf("expected the trial pull to be allowed, got %v", err)
+	}
+	if !shortCircuited() {
+		t.Fatal("expected the pulls to be short-circuited during the trial pull")
+	}
+	CircuitBreakerCooldown = time.Hour
+	done(unavailable)
+	if !shortCircuited() {
+		t.Fatal("expected the failed trial pull to reopen the breaker")
+	}
+
+	// the successful trial pull closes the breaker
+	CircuitBreakerCooldown = time.Millisecond
+	time.Sleep(2 * CircuitBreakerCooldown)
+	pull(nil)
+	pull(unavailable)
+	if shortCircuited() {
+		t.Fatal("expected the successful trial pull to close the breaker")
+	}
+
+	// the breaker is disabled without threshold
+	CircuitBreakerThreshold = 0
+	for i := 0; i < 5; i++ {
+		pull(unavailable)
+	}
+}
+
+func TestExtractToTargetPaths(t *testing.T) {
+	img := newImage(t,
+		newLayer(t, map[string]string{"usr/bin/tool": "tool", "usr/share/tool/LICENSE": "license", "etc/tool.bash": "completion"}, compression.GZip),
+	)
+	platform := v1alpha1.PluginPlatform{
+		Platform: "linux/amd64",
+		Files: []v1alpha1.FileLocation{
+			{From: "/usr/bin/tool", To: "bin/"},
+			{From: "/usr/share/tool/LICENSE"},
+			{From: "/etc/tool.bash", To: "completions/tool"},
+		},
+		Bin: "bin/tool",
+	}
+
+	destination := filepath.Join(t.TempDir(), "plugin.tar.gz")
+	_, checksum, err := Extract(context.Background(), img, platform, destination, nil)
+	if err != nil {
+		t.Fatalf("extract error: %v", err)
+	}
+	data, err := os.ReadFile(destination)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sum := sha256.Sum256(data); checksum != hex.EncodeToString(sum[:]) {
+		t.Fatalf("checksum %s does not match the artifact", checksum)
+	}
+	if written, err := os.ReadFile(ChecksumPath(destination)); err != nil || string(written) != checksum+"\n" {
+		t.Fatalf("unexpected checksum file %q: %v", written, err)
+	}
+	artifact := readArtifact(t, destination)
+	if len(artifact) != 3 || artifact["bin/tool"] != "tool" || artifact["LICENSE"] != "license" || artifact["completions/tool"] != "completion" {
+		t.Fatalf("unexpected artifact contents %v", artifact)
+	}
+
+	platform.Files = []v1alpha1.FileLocation{{From: "/usr/bin/tool", To: "../tool"}}
+	if _, _, err := Extract(context.Background(), img, platform, filepath.Join(t.TempDir(), "plugin.tar.gz"), nil); err == nil {
+		t.Fatal("expected error for destination outside of the installation folder")
+	}
+}
+
+func TestExtractGlobPatterns(t *testing.T) {
+	img := newImage(t,
+		newLayer(t, map[string]string{"usr/local/bin/tool-v1.2.3": "old", "usr/share/doc/tool/README.md": "readme"}, compression.GZip),
+		newLayer(t, map[string]string{"usr/local/bin/tool-v1.2.3": "tool", "usr/share/doc/tool/CHANGES.md": "changes"}, compression.GZip),
+	)
+	platform := v1alpha1.PluginPlatform{
+		Platform: "linux/amd64",
+		Files: []v1alpha1.FileLocation{
+			{From: "/usr/local/bin/tool-v*", To: "tool"},
+			{From: "/usr/share/doc/*/*.md", To: "docs/"},
+			{From: "/usr/share/man/*", To: "man/", Optional: true},
+		},
+		Bin: "tool",
+	}
+
+	destination := filepath.Join(t.TempDir(), "plugin.tar.gz")
+	files, _, err := Extract(context.Background(), img, platform, destination, nil)
+	if err != nil {
+		t.Fatalf("extract error: %v", err)
+	}
+	if len(files) != 2 {
+		t.Fatalf("expected 2 files, got %v", files)
+	}
+	artifact := readArtifact(t, destination)
+	if len(artifact) != 3 || artifact["tool"] != "tool" || artifact["docs/README.md"] != "readme" || artifact["docs/CHANGES.md"] != "changes" {
+		t.Fatalf("unexpected artifact contents %v", artifact)
+	}
+
+	platform.Files = []v1alpha1.FileLocation{{From: "/usr/share/doc/tool/*", To: "doc"}}
+	if _, _, err := Extract(context.Background(), img, platform, filepath.Join(t.TempDir(), "plugin.tar.gz"), nil); err == nil {
+		t.Fatal("expected error for a pattern matching several files written to the same path")
+	}
+}
+
+func TestExtractDirectories(t *testing.T) {
+	img := newImage(t,
+		newLayer(t, map[string]string{
+			"usr/bin/tool":                       "old",
+			"usr/share/tool/templates/a.tmpl":    "a",
+			"usr/share/tool/templates/removed":   "removed",
+			"usr/share/tool/templates/old/x.txt": "x",
+		}, compression.GZip),
+		newLayer(t, map[string]string{
+			"usr/bin/tool":                         "tool",
+			"usr/share/tool/templates/sub/b.tmpl":  "b",
+			"usr/share/tool/templates/.wh.removed": "",
+			"usr/share/tool/templates/.wh.old":     "",
+		}, compression.GZip),
+	)
+	platform := v1alpha1.PluginPlatform{
+		Platform: "linux/amd64",
+		Files: []v1alpha1.FileLocation{
+			{From: "/usr/bin/tool", To: "."},
+			{From: "/usr/share/tool/templates/", To: "."},
+		},
+		Bin: "tool",
+	}
+
+	destination := filepath.Join(t.TempDir(), "plugin.tar.gz")
+	files, _, err := Extract(context.Background(), img, platform, destination, nil)
+	if err != nil {
+		t.Fatalf("extract error: %v", err)
+	}
+	if len(files) != 2 {
+		t.Fatalf("expected 2 files, got %v", files)
+	}
+	artifact := readArtifact(t, destination)
+	expected := map[string]string{
+		"tool":                 "tool",
+		"templates/a.tmpl":     "a",
+		"templates/sub/b.tmpl": "b",
+	}
+	if len(artifact) != len(expected) {
+		t.Fatalf("unexpected artifact contents %v", artifact)
+	}
+	for name, content := range expected {
+		if artifact[name] != content {
+			t.Fatalf("unexpected artifact contents %v", artifact)
+		}
+	}
+}
+
+// countingLayer counts the reads of the layer.
+type countingLayer struct {
+	v1.Layer
+	reads int
+}
+
+func (l *countingLayer) Uncompressed() (io.ReadCloser, error) {
+	l.reads++
+	return l.Layer.Uncompressed()
+}
+
+func TestExtractLayerIndex(t *testing.T) {
+	base := &countingLayer{Layer: newLayer(t, map[string]string{"usr/bin/indexed-old": "stale", "usr/lib/indexed/a.so": "a"}, compression.GZip)}
+	middle := &countingLayer{Layer: newLayer(t, map[string]string{"usr/bin/.wh.indexed-old": "", "usr/lib/indexed/b.so": "b"}, compression.GZip)}
+	top := &countingLayer{Layer: newLayer(t, map[string]string{"usr/bin/indexed": "tool"}, compression.GZip)}
+	img := newImage(t, base, middle, top)
+	platform := v1alpha1.PluginPlatform{
+		Platform: "linux/amd64",
+		Files:    []v1alpha1.FileLocation{{From: "/usr/bin/", To: "."}},
+		Bin:      "bin/indexed",
+	}
+
+	extract := func(platform v1alpha1.PluginPlatform) map[string]string {
+		t.Helper()
+		destination := filepath.Join(t.TempDir(), "plugin.tar.gz")
+		if _, _, err := Extract(context.Background(), img, platform, destination, nil); err != nil {
+			t.Fatalf("extract error: %v", err)
+		}
+		return readArtifact(t, destination)
+	}
+	expected := map[string]string{"bin/indexed": "tool"}
+	if artifact := extract(platform); !reflect.DeepEqual(artifact, expected) {
+		t.Fatalf("unexpected artifact contents %v", artifact)
+	}
+	if base.reads != 1 || middle.reads != 1 || top.reads != 1 {
+		t.Fatalf("expected every layer to be read once, got %d, %d and %d reads", base.reads, middle.reads, top.reads)
+	}
+
+	// the whiteouts of the indexed layers apply without reading them
+	if artifact := extract(platform); !reflect.DeepEqual(artifact, expected) {
+		t.Fatalf("unexpected artifact contents %v", artifact)
+	}
+	if base.reads != 1 || middle.reads != 1 || top.reads != 2 {
+		t.Fatalf("expected only the top layer to be read again, got %d, %d and %d reads", base.reads, middle.reads, top.reads)
+	}
+
+	// the layers with files wanted are read again
+	platform.Files = []v1alpha1.FileLocation{{From: "/usr/lib/indexed/b.so", To: "."}}
+	platform.Bin = ""
+	if artifact := extract(platform); !reflect.DeepEqual(artifact, map[string]string{"b.so": "b"}) {
+		t.Fatalf("unexpected artifact contents %v", artifact)
+	}
+	if base.reads != 1 || middle.reads != 2 || top.reads != 2 {
+		t.Fatalf("expected only the middle layer to be read again, got %d, %d and %d reads", base.reads, middle.reads, top.reads)
+	}
+}
+
+func TestExtractOpaqueWhiteouts(t *testing.T) {
+	img := newImage(t,
+		newLayer(t, map[string]string{
+			"usr/bin/tool":                       "tool",
+			"usr/share/tool/templates/a.tmpl":    "old",
+			"usr/share/tool/templates/removed":   "removed",
+			"usr/share/tool/templates/old/x.txt": "x",
+			"opt/tool/share/completion.bash":     "completion",
+		}, compression.GZip),
+		newLayer(t, map[string]string{
+			"usr/share/tool/templates/.wh..wh..opq": "",
+			"usr/share/tool/templates/a.tmpl":       "a",
+			"usr/share/tool/templates/new.tmpl":     "new",
+			"opt/tool/share/.wh..wh..opq":           "",
+		}, compression.GZip),
+		newLinkLayer(t, map[string]string{"usr/share/completion.bash": "/opt/tool/share/completion.bash"}),
+		newLayer(t, map[string]string{"usr/share/tool/templates/sub/b.tmpl": "b"}, compression.GZip),
+	)
+	platform := v1alpha1.PluginPlatform{
+		Platform: "linux/amd64",
+		Files: []v1alpha1.FileLocation{
+			{From: "/usr/bin/tool", To: "."},
+			{From: "/usr/share/tool/templates/", To: "."},
+			{From: "/usr/share/tool/templates/removed", To: ".", Optional: true},
+			{From: "/usr/share/completion.bash", To: ".", Optional: true},
+		},
+		Bin: "tool",
+	}
+
+	destination := filepath.Join(t.TempDir(), "plugin.tar.gz")
+	if _, _, err := Extract(context.Background(), img, platform, destination, nil); err != nil {
+		t.Fatalf("extract error: %v", err)
+	}
+	artifact := readArtifact(t, destination)
+	// the contents of the opaque directories in the lower layers are deleted, the ones of
+	// the layer of the opaque whiteout and of the upper layers are kept
+	expected := map[string]string{
+		"tool":                 "tool",
+		"templates/a.tmpl":     "a",
+		"templates/new.tmpl":   "new",
+		"templates/sub/b.tmpl": "b",
+	}
+	if len(artifact) != len(expected) {
+		t.Fatalf("unexpected artifact contents %v", artifact)
+	}
+	for name, content := range expected {
+		if artifact[name] != content {
+			t.Fatalf("unexpected artifact contents %v", artifact)
+		}
+	}
+
+	platform.Files = []v1alpha1.FileLocation{{From: "/usr/share/tool/templates/removed", To: "."}}
+	if _, _, err := Extract(context.Background(), img, platform, filepath.Join(t.TempDir(), "plugin.tar.gz"), nil); err == nil {
+		t.Fatal("expected error for a file deleted by an opaque whiteout")
+	}
+}
+
+func TestExtractExcludePatterns(t *testing.T) {
+	img := newImage(t,
+		newLayer(t, map[string]string{
+			"usr/bin/tool":                   "tool",
+			"usr/lib/tool/libtool.so":        "so",
+			"usr/lib/tool/libtool.a":         "a",
+			"usr/lib/tool/plugins/libx.a":    "x",
+			"usr/lib/tool/test/unit":         "unit",
+			"usr/lib/tool/test/data/fixture": "fixture",
+			"usr/lib/tool/testdata/keep":     "keep",
+			"usr/share/doc/tool/README.md":   "readme",
+			"usr/share/doc/tool/README.orig": "orig",
+		}, compression.GZip),
+	)
+	platform := v1alpha1.PluginPlatform{
+		Platform: "linux/amd64",
+		Files: []v1alpha1.FileLocation{
+			{From: "/usr/bin/tool", To: "."},
+			{From: "/usr/lib/tool", To: ".", Exclude: []string{"**/*.a", "test/**"}},
+			{From: "/usr/share/doc/tool/*", To: "doc/", Exclude: []string{"*.orig"}},
+		},
+		Bin: "tool",
+	}
+
+	destination := filepath.Join(t.TempDir(), "plugin.tar.gz")
+	if _, _, err := Extract(context.Background(), img, platform, destination, nil); err != nil {
+		t.Fatalf("extract error: %v", err)
+	}
+	artifact := readArtifact(t, destination)
+	expected := map[string]string{
+		"tool":               "tool",
+		"tool/libtool.so":    "so",
+		"tool/testdata/keep": "keep",
+		"doc/README.md":      "readme",
+	}
+	if len(artifact) != len(expected) {
+		t.Fatalf("unexpected artifact contents %v", artifact)
+	}
+	for name, content := range expected {
+		if artifact[name] != content {
+			t.Fatalf("unexpected artifact contents %v", artifact)
+		}
+	}
+
+	for _, pattern := range []string{"", "/usr/lib/tool/test", "../tool/*.a", "[a"} {
+		platform.Files = []v1alpha1.FileLocation{{From: "/usr/lib/tool", To: ".", Exclude: []string{pattern}}}
+		if _, _, err := Extract(context.Background(), img, platform, filepath.Join(t.TempDir(), "plugin.tar.gz"), nil); err == nil {
+			t.Fatalf("expected error for the exclude pattern %q", pattern)
+		}
+	}
+}
+
+func TestExtractLicenseFiles(t *testing.T) {
+	img := newImage(t,
+		newLayer(t, map[string]string{
+			"usr/bin/tool":                    "tool",
+			"LICENSE":                         "apache",
+			"README.md":                       "readme",
+			"licenses/LICENSE":                "gpl",
+			"usr/share/licenses/tool/LICENSE": "mit",
+			"usr/share/licenses/other/NOTICE": "other",
+		}, compression.GZip),
+	)
+	platform := v1alpha1.PluginPlatform{
+		Platform: "linux/amd64",
+		Files:    append([]v1alpha1.FileLocation{{From: "/usr/bin/tool", To: "."}}, LicenseFiles("tool", &v1alpha1.Licenses{})...),
+		Bin:      "tool",
+	}
+
+	destination := filepath.Join(t.TempDir(), "plugin.tar.gz")
+	if _, _, err := Extract(context.Background(), img, platform, destination, nil); err != nil {
+		t.Fatalf("extract error: %v", err)
+	}
+	artifact := readArtifact(t, destination)
+	// the files found in the common locations are copied to their own directories
+	expected := map[string]string{
+		"tool":                   "tool",
+		"licenses/LICENSE":       "apache",
+		"licenses/README.md":     "readme",
+		"licenses/image/LICENSE": "gpl",
+		"licenses/tool/LICENSE":  "mit",
+	}
+	if len(artifact) != len(expected) {
+		t.Fatalf("unexpected artifact contents %v", artifact)
+	}
+	for name, content := range expected {
+		if artifact[name] != content {
+			t.Fatalf("unexpected artifact contents %v", artifact)
+		}
+	}
+
+	licenses := &v1alpha1.Licenses{Files: []string{"/usr/share/licenses/tool/LICENSE"}}
+	platform.Files = append([]v1alpha1.FileLocation{{From: "/usr/bin/tool", To: "."}}, LicenseFiles("tool", licenses)...)
+	if _, _, err := Extract(context.Background(), img, platform, destination, nil); err != nil {
+		t.Fatalf("extract error: %v", err)
+	}
+	if artifact := readArtifact(t, destination); len(artifact) != 2 || artifact["licenses/LICENSE"] != "mit" {
+		t.Fatalf("unexpected artifact contents %v", artifact)
+	}
+
+	// the files listed are required
+	licenses.Files = []string{"/usr/share/licenses/tool/COPYING"}
+	platform.Files = append([]v1alpha1.FileLocation{{From: "/usr/bin/tool", To: "."}}, LicenseFiles("tool", licenses)...)
+	var missingErr *MissingFilesError
+	if _, _, err := Extract(context.Background(), img, platform, destination, nil); !errors.As(err, &missingErr) {
+		t.Fatalf("expected missing files error, got %v", err)
+	}
+}
+
+// newLinkLayer returns a layer of the symbolic links to the given paths.
+func newLinkLayer(t *testing.T, links map[string]string) v1.Layer {
+	t.Helper()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for name, linkname := range links {
+		if err := tw.WriteHeader(&tar.Header{
+			Name:     name,
+			Linkname: linkname,
+			Mode:     0777,
+			Typeflag: tar.TypeSymlink,
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	layer, err := tarball.LayerFromOpener(func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(buf.Bytes())), nil
+	}, tarball.WithMediaType(types.OCILayer))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return layer
+}
+
+func TestExtractSymlinks(t *testing.T) {
+	img := newImage(t,
+		newLayer(t, map[string]string{"opt/tool/bin/tool": "old", "opt/tool/share/completion.bash": "completion"}, compression.GZip),
+		newLinkLayer(t, map[string]string{
+			"usr/bin/tool":       "/opt/tool/bin/tool",
+			"usr/bin/tool-alias": "tool",
+			"usr/share/tool":     "../../opt/tool/share",
+			"usr/bin/loop":       "loop-back",
+			"usr/bin/loop-back":  "loop",
+		}),
+		newLayer(t, map[string]string{"opt/tool/bin/tool": "tool"}, compression.GZip),
+	)
+	platform := v1alpha1.PluginPlatform{
+		Platform: "linux/amd64",
+		Files: []v1alpha1.FileLocation{
+			{From: "/usr/bin/tool", To: "."},
+			{From: "/usr/bin/tool-alias", To: "alias"},
+			{From: "/usr/share/tool/completion.bash", To: "."},
+		},
+		Bin: "tool",
+	}
+
+	destination := filepath.Join(t.TempDir(), "plugin.tar.gz")
+	files, _, err := Extract(context.Background(), img, platform, destination, nil)
+	if err != nil {
+		t.Fatalf("extract error: %v", err)
+	}
+	if len(files) != 3 {
+		t.Fatalf("expected 3 files, got %v", files)
+	}
+	artifact := readArtifact(t, destination)
+	if len(artifact) != 3 || artifact["tool"] != "tool" || artifact["alias"] != "tool" || artifact["completion.bash"] != "completion" {
+		t.Fatalf("unexpected artifact contents %v", artifact)
+	}
+
+	platform.Files = []v1alpha1.FileLocation{{From: "/usr/bin/loop", To: "."}}
+	if _, _, err := Extract(context.Background(), img, platform, filepath.Join(t.TempDir(), "plugin.tar.gz"), nil); err == nil {
+		t.Fatal("expected error for a symlink loop")
+	}
+}
+
+// newHardlinkLayer returns a layer of the files followed by the hard links to the given paths.
+func newHardlinkLayer(t *testing.T, files map[string]string, links map[string]string) v1.Layer {
+	t.Helper()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for name, content := range files {
+		if err := tw.WriteHeader(&tar.Header{
+			Name:     name,
+			Mode:     0755,
+			Size:     int64(len(content)),
+			Typeflag: tar.TypeReg,
+		}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for name, linkname := range links {
+		if err := tw.WriteHeader(&tar.Header{
+			Name:     name,
+			Linkname: linkname,
+			Mode:     0755,
+			Typeflag: tar.TypeLink,
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	layer, err := tarball.LayerFromOpener(func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(buf.Bytes())), nil
+	}, tarball.WithMediaType(types.OCILayer))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return layer
+}
+
+func TestExtractHardlinks(t *testing.T) {
+	img := newImage(t,
+		newHardlinkLayer(t, map[string]string{
+			"opt/tool/bin/tool-1.0":          "tool",
+			"opt/tool/share/completion.bash": "completion",
+		}, map[string]string{
+			"usr/bin/tool":                   "opt/tool/bin/tool-1.0",
+			"usr/bin/kubectl-tool":           "usr/bin/tool",
+			"usr/share/tool/completion.bash": "opt/tool/share/completion.bash",
+		}),
+		// the files the hard links of the lower layer point to are deleted and replaced
+		newLayer(t, map[string]string{
+			"opt/tool/bin/.wh.tool-1.0":      "",
+			"opt/tool/share/completion.bash": "replaced",
+			"opt/tool/libexec/helper":        "helper",
+		}, compression.GZip),
+		newHardlinkLayer(t, nil, map[string]string{"usr/libexec/tool-helper": "opt/tool/libexec/helper"}),
+	)
+	platform := v1alpha1.PluginPlatform{
+		Platform: "linux/amd64",
+		Files: []v1alpha1.FileLocation{
+			{From: "/usr/bin/kubectl-tool", To: "."},
+			{From: "/usr/share/tool/completion.bash", To: "."},
+			{From: "/usr/libexec/tool-helper", To: "helper"},
+		},
+		Bin: "kubectl-tool",
+	}
+
+	destination := filepath.Join(t.TempDir(), "plugin.tar.gz")
+	files, _, err := Extract(context.Background(), img, platform, destination, nil)
+	if err != nil {
+		t.Fatalf("extract error: %v", err)
+	}
+	if len(files) != 3 {
+		t.Fatalf("expected 3 files, got %v", files)
+	}
+	artifact := readArtifact(t, destination)
+	if len(artifact) != 3 || artifact["kubectl-tool"] != "tool" || artifact["completion.bash"] != "completion" || artifact["helper"] != "helper" {
+		t.Fatalf("unexpected artifact contents %v", artifact)
+	}
+	if modes := readModes(t, destination); modes["kubectl-tool"] != 0o755 {
+		t.Fatalf("unexpected artifact modes %v", modes)
+	}
+}
+
+// elfBinary returns the start of a little-endian 64-bit ELF executable for the machine.
+func elfBinary(machine elf.Machine) string {
+	header := make([]byte, 64)
+	copy(header, elf.ELFMAG)
+	header[elf.EI_CLASS] = byte(elf.ELFCLASS64)
+	header[elf.EI_DATA] = byte(elf.ELFDATA2LSB)
+	binary.LittleEndian.PutUint16(header[18:], uint16(machine))
+	return string(header)
+}
+
+// peBinary returns the start of a PE executable for the machine.
+func peBinary(machine uint16) string {
+	header := make([]byte, 0x48)
+	copy(header, "MZ")
+	binary.LittleEndian.PutUint32(header[0x3c:], 0x40)
+	copy(header[0x40:], "PE\x00\x00")
+	binary.LittleEndian.PutUint16(header[0x44:], machine)
+	return string(header)
+}
+
+// machoUniversalBinary returns the start of a Mach-O universal executable for the cpus.
+func machoUniversalBinary(cpus ...macho.Cpu) string {
+	header := make([]byte, 8+20*len(cpus))
+	binary.BigEndian.PutUint32(header, macho.MagicFat)
+	binary.BigEndian.PutUint32(header[4:], uint32(len(cpus)))
+	for i, cpu := range cpus {
+		binary.BigEndian.PutUint32(header[8+20*i:], uint32(cpu))
+	}
+	return string(header)
+}
+
+func TestExtractBinaryPlatform(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		platform string
+		bin      string
+		valid    bool
+	}{
+		{name: "linux binary", platform: "linux/amd64", bin: elfBinary(elf.EM_X86_64), valid: true},
+		{name: "linux binary of another architecture", platform: "linux/arm64", bin: elfBinary(elf.EM_X86_64)},
+		{name: "linux binary on windows", platform: "windows/amd64", bin: elfBinary(elf.EM_X86_64)},
+		{name: "windows binary", platform: "windows/arm64", bin: peBinary(pe.IMAGE_FILE_MACHINE_ARM64), valid: true},
+		{name: "windows binary on linux", platform: "linux/amd64", bin: peBinary(pe.IMAGE_FILE_MACHINE_AMD64)},
+		{name: "universal darwin binary", platform: "darwin/arm64", bin: machoUniversalBinary(macho.CpuAmd64, macho.CpuArm64), valid: true},
+		{name: "darwin binary of another architecture", platform: "darwin/arm64", bin: machoUniversalBinary(macho.CpuAmd64)},
+		{name: "script", platform: "windows/amd64", bin: "#!/bin/sh\necho tool\n", valid: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			img := newImage(t, newLayer(t, map[string]string{"usr/bin/tool": tc.bin}, compression.GZip))
+			platform := v1alpha1.PluginPlatform{
+				Platform:      tc.platform,
+				Files:         []v1alpha1.FileLocation{{From: "/usr/bin/tool", To: "."}},
+				Bin:           "tool",
+				ArchiveFormat: v1alpha1.ArchiveFormatTarGz,
+			}
+			destination := filepath.Join(t.TempDir(), "plugin.tar.gz")
+			_, _, err := Extract(context.Background(), img, platform, destination, nil)
+			var platformErr *BinaryPlatformError
+			if tc.valid && err != nil {
+				t.Fatalf("extract error: %v", err)
+			}
+			if !tc.valid && !errors.As(err, &platformErr) {
+				t.Fatalf("expected binary platform error, got %v", err)
+			}
+			if tc.valid && readArtifact(t, destination)["tool"] != tc.bin {
+				t.Fatal("unexpected binary contents")
+			}
+		})
+	}
+}
+
+func TestExtractRawBinary(t *testing.T) {
+	bin := elfBinary(elf.EM_X86_64)
+	img := newImage(t, newLayer(t, map[string]string{"usr/bin/tool": bin, "usr/share/tool/README": "readme"}, compression.GZip))
+	platform := v1alpha1.PluginPlatform{
+		Platform:  "linux/amd64",
+		Files:     []v1alpha1.FileLocation{{From: "/usr/bin/tool", To: "bin/"}, {From: "/usr/share/tool/README", To: "."}},
+		Bin:       "bin/tool",
+		RawBinary: true,
+	}
+
+	destination := filepath.Join(t.TempDir(), "tool_linux_amd64.tar.gz")
+	if _, _, err := Extract(context.Background(), img, platform, destination, nil); err != nil {
+		t.Fatalf("extract error: %v", err)
+	}
+	data, err := os.ReadFile(RawBinaryPath(destination))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != bin || readArtifact(t, destination)["bin/tool"] != bin {
+		t.Fatal("executable differs from the one of the artifact")
+	}
+	checksum, err := os.ReadFile(ChecksumPath(RawBinaryPath(destination)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sum := sha256.Sum256(data); strings.TrimSpace(string(checksum)) != hex.EncodeToString(sum[:]) {
+		t.Fatalf("checksum %s does not match the executable", checksum)
+	}
+	if mediaType := ExecutableMediaType(data); mediaType != "application/x-executable" {
+		t.Fatalf("unexpected media type %s", mediaType)
+	}
+
+	// the executable of the previous extraction is removed once it is not published
+	platform.RawBinary = false
+	if _, _, err := Extract(context.Background(), img, platform, destination, nil); err != nil {
+		t.Fatalf("extract error: %v", err)
+	}
+	if _, err := os.Stat(RawBinaryPath(destination)); !os.IsNotExist(err) {
+		t.Fatalf("executable is kept once it is not published: %v", err)
+	}
+	if entries, err := filepath.Glob(filepath.Join(filepath.Dir(destination), "*"+partialSuffix)); err != nil || len(entries) > 0 {
+		t.Fatalf("partial files are left: %v %v", entries, err)
+	}
+}
+
+func TestExtractCompletions(t *testing.T) {
+	img := newImage(t, newLayer(t, map[string]string{
+		"usr/bin/tool": "tool",
+		"usr/share/bash-completion/completions/tool": "complete -F _tool tool",
+		"usr/share/zsh/site-functions/_tool":         "#compdef tool",
+	}, compression.GZip))
+	platform := v1alpha1.PluginPlatform{
+		Platform: "linux/amd64",
+		Files:    []v1alpha1.FileLocation{{From: "/usr/bin/tool", To: "."}},
+		Bin:      "tool",
+		Completions: &v1alpha1.Completions{
+			Bash: "/usr/share/bash-completion/completions/tool",
+			Zsh:  "/usr/share/zsh/site-functions/_tool",
+			Fish: "/usr/share/fish/vendor_completions.d/tool.fish",
+		},
+	}
+
+	destination := filepath.Join(t.TempDir(), "tool_linux_amd64.tar.gz")
+	files, _, err := Extract(context.Background(), img, platform, destination, nil)
+	if err != nil {
+		t.Fatalf("extract error: %v", err)
+	}
+	// the missing fish script is skipped
+	if len(files) != 3 || files[1].To != "completions/bash" || files[2].To != "completions/zsh" {
+		t.Fatalf("unexpected file locations %v", files)
+	}
+	artifact := readArtifact(t, destination)
+	if artifact["completions/bash"] != "complete -F _tool tool" || artifact["completions/zsh"] != "#compdef tool" {
+		t.Fatalf("unexpected artifact contents %v", artifact)
+	}
+	for shell, expected := range map[string]string{CompletionBash: "complete -F _tool tool", CompletionZsh: "#compdef tool"} {
+		data, err := os.ReadFile(CompletionPath(destination, shell))
+		if err != nil || string(data) != expected {
+			t.Fatalf("unexpected %s completion %q: %v", shell, data, err)
+		}
+		if _, err := os.Stat(ChecksumPath(CompletionPath(destination, shell))); err != nil {
+			t.Fatalf("%s completion has no checksum: %v", shell, err)
+		}
+	}
+	if _, err := os.Stat(CompletionPath(destination, CompletionFish)); !os.IsNotExist(err) {
+		t.Fatalf("missing fish completion is stored: %v", err)
+	}
+	if ExtractionHash(platform) == ExtractionHash(v1alpha1.PluginPlatform{Platform: platform.Platform, Files: platform.Files, Bin: platform.Bin}) {
+		t.Fatal("hash did not change with the completions")
+	}
+
+	// the scripts of the previous extraction are removed once they are not published
+	platform.Completions = &v1alpha1.Completions{Zsh: "/usr/share/zsh/site-functions/_tool"}
+	if _, _, err := Extract(context.Background(), img, platform, destination, nil); err != nil {
+		t.Fatalf("extract error: %v", err)
+	}
+	if _, err := os.Stat(CompletionPath(destination, CompletionBash)); !os.IsNotExist(err) {
+		t.Fatalf("bash completion is kept once it is not published: %v", err)
+	}
+	if _, err := os.Stat(CompletionPath(destination, CompletionZsh)); err != nil {
+		t.Fatalf("zsh completion is not stored: %v", err)
+	}
+	if entries, err := filepath.Glob(filepath.Join(filepath.Dir(destination), "*"+partialSuffix)); err != nil || len(entries) > 0 {
+		t.Fatalf("partial files are left: %v %v", entries, err)
+	}
+}
+
+func TestExtractManPages(t *testing.T) {
+	img := newImage(t, newLayer(t, map[string]string{
+		"usr/bin/tool":                          "tool",
+		"usr/share/man/man1/tool.1.gz":          "tool.1",
+		"usr/share/man/man1/tool-sub.1.gz":      "tool-sub.1",
+		"usr/share/man/man1/other.1.gz":         "other.1",
+		"usr/share/man/man5/tool.conf.5.gz":     "tool.conf.5",
+		"usr/share/man/man5/tool.defaults.5.gz": "tool.defaults.5",
+	}, compression.GZip))
+	platform := v1alpha1.PluginPlatform{
+		Platform: "linux/amd64",
+		Files:    []v1alpha1.FileLocation{{From: "/usr/bin/tool", To: "."}},
+		Bin:      "tool",
+		ManPages: []string{"/usr/share/man/man1/tool*.1.gz", "/usr/share/man/man5", "/usr/share/man/man8/tool.8"},
+	}
+
+	destination := filepath.Join(t.TempDir(), "tool_linux_amd64.tar.gz")
+	files, _, err := Extract(context.Background(), img, platform, destination, nil)
+	if err != nil {
+		t.Fatalf("extract error: %v", err)
+	}
+	// the missing man page is skipped
+	if len(files) != 3 || files[1].To != "man/man1/" || files[2].To != "man/" {
+		t.Fatalf("unexpected file locations %v", files)
+	}
+	expected := map[string]string{
+		"tool":                        "tool",
+		"man/man1/tool.1.gz":          "tool.1",
+		"man/man1/tool-sub.1.gz":      "tool-sub.1",
+		"man/man5/tool.conf.5.gz":     "tool.conf.5",
+		"man/man5/tool.defaults.5.gz": "tool.defaults.5",
+	}
+	if artifact := readArtifact(t, destination); !reflect.DeepEqual(artifact, expected) {
+		t.Fatalf("unexpected artifact contents %v", artifact)
+	}
+
+	data, err := os.ReadFile(ManPagesPath(destination))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	tr := tar.NewReader(bytes.NewReader(data))
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		contents, err := io.ReadAll(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected["man/"+header.Name] != string(contents) {
+			t.Fatalf("unexpected contents %q of %s", contents, header.Name)
+		}
+		names = append(names, header.Name)
+	}
+	if !reflect.DeepEqual(names, []string{"man1/tool-sub.1.gz", "man1/tool.1.gz", "man5/tool.conf.5.gz", "man5/tool.defaults.5.gz"}) {
+		t.Fatalf("unexpected man pages %v", names)
+	}
+	checksum, err := os.ReadFile(ChecksumPath(ManPagesPath(destination)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sum := sha256.Sum256(data); strings.TrimSpace(string(checksum)) != hex.EncodeToString(sum[:]) {
+		t.Fatalf("checksum %s does not match the man pages", checksum)
+	}
+
+	// the man pages of the previous extraction are removed once they are not published
+	platform.ManPages = nil
+	if _, _, err := Extract(context.Background(), img, platform, destination, nil); err != nil {
+		t.Fatalf("extract error: %v", err)
+	}
+	if _, err := os.Stat(ManPagesPath(destination)); !os.IsNotExist(err) {
+		t.Fatalf("man pages are kept once they are not published: %v", err)
+	}
+}
+
+func TestExtractTransforms(t *testing.T) {
+	img := newImage(t,
+		newLayer(t, map[string]string{
+			"etc/tool/config.yaml.tmpl": "server: ${CLUSTER_API_URL}\nhome: ${HOME}\n",
+			"usr/bin/tool-linux-amd64":  "tool",
+		}, compression.GZip),
+	)
+	platform := v1alpha1.PluginPlatform{
+		Platform: "linux/amd64",
+		Files: []v1alpha1.FileLocation{
+			{From: "/etc/tool/config.yaml.tmpl", To: "config/", Transforms: []v1alpha1.FileTransform{
+				{Type: v1alpha1.FileTransformSubstitute},
+				{Type: v1alpha1.FileTransformRename, Name: "config.yaml"},
+				{Type: v1alpha1.FileTransformChmod, Mode: "0600"},
+			}},
+			{From: "/usr/bin/tool-*", To: ".", Transforms: []v1alpha1.FileTransform{
+				{Type: v1alpha1.FileTransformRename, Name: "tool"},
+			}},
+		},
+		Bin: "tool",
+	}
+	Placeholders = map[string]string{PlaceholderClusterAPIURL: "https://api.example.com:6443"}
+	defer func() { Placeholders = nil }()
+
+	destination := filepath.Join(t.TempDir(), "plugin.tar.gz")
+	if _, _, err := Extract(context.Background(), img, platform, destination, nil); err != nil {
+		t.Fatalf("extract error: %v", err)
+	}
+	artifact := readArtifact(t, destination)
+	if len(artifact) != 2 || artifact["config/config.yaml"] != "server: https://api.example.com:6443\nhome: ${HOME}\n" || artifact["tool"] != "tool" {
+		t.Fatalf("unexpected artifact contents %v", artifact)
+	}
+	if p := ArchivePath(platform.Files[0]); p != "config/config.yaml" {
+		t.Fatalf("unexpected archive path %s", p)
+	}
+
+	if mode := readModes(t, destination)["config/config.yaml"]; mode != 0600 {
+		t.Fatalf("unexpected mode %o of config/config.yaml", mode)
+	}
+
+	for _, transform := range []v1alpha1.FileTransform{
+		{Type: v1alpha1.FileTransformRename, Name: "../tool"},
+		{Type: v1alpha1.FileTransformChmod, Mode: "4755"},
+		{Type: "Compress"},
+	} {
+		platform.Files = []v1alpha1.FileLocation{{From: "/usr/bin/tool-linux-amd64", To: ".", Transforms: []v1alpha1.FileTransform{transform}}}
+		if _, _, err := Extract(context.Background(), img, platform, filepath.Join(t.TempDir(), "plugin.tar.gz"), nil); err == nil {
+			t.Fatalf("expected error for invalid transform %v", transform)
+		}
+	}
+}
+
+func TestExtractFileModes(t *testing.T) {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for name, mode := range map[string]int64{
+		"usr/bin/tool":        0600,
+		"usr/bin/helper":      04711,
+		"usr/share/tool/data": 0666,
+	} {
+		if err := tw.WriteHeader(&tar.Header{
+			Name:     name,
+			Mode:     mode,
+			Size:     int64(len(name)),
+			Uid:      1000,
+			Uname:    "builder",
+			Typeflag: tar.TypeReg,
+		}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	layer, err := tarball.LayerFromOpener(func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(buf.Bytes())), nil
+	}, tarball.WithMediaType(types.OCILayer))
+	if err != nil {
+		t.Fatal(err)
+	}
+	platform := v1alpha1.PluginPlatform{
+		Platform: "linux/amd64",
+		Files: []v1alpha1.FileLocation{
+			{From: "/usr/bin/tool", To: "bin/"},
+			{From: "/usr/bin/helper", To: "bin/"},
+			{From: "/usr/share/tool", To: "."},
+		},
+		Bin: "./bin/tool",
+	}
+
+	// the setuid bit is dropped once the privileged files are not rejected
+	defer func(reject bool) { RejectPrivilegedFiles = reject }(RejectPrivilegedFiles)
+	RejectPrivilegedFiles = false
+	destination := filepath.Join(t.TempDir(), "plugin.tar.gz")
+	if _, _, err := Extract(context.Background(), newImage(t, layer), platform, destination, nil); err != nil {
+		t.Fatalf("extract error: %v", err)
+	}
+	modes := readModes(t, destination)
+	if len(modes) != 3 || modes["bin/tool"] != 0755 || modes["bin/helper"] != 0755 || modes["tool/data"] != 0644 {
+		t.Fatalf("unexpected modes %v", modes)
+	}
+}
+
+func TestExtractPrivilegedFiles(t *testing.T) {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, header := range []*tar.Header{
+		{Name: "usr/bin/tool", Mode: 0755, Size: 4, Typeflag: tar.TypeReg},
+		{Name: "usr/bin/su-helper", Mode: 04755, Size: 4, Typeflag: tar.TypeReg},
+		{Name: "usr/bin/sg-helper", Mode: 02755, Size: 4, Typeflag: tar.TypeReg},
+		{Name: "usr/share/tool/tty", Mode: 0666, Typeflag: tar.TypeChar, Devmajor: 5},
+		{Name: "usr/share/tool/disk", Mode: 0660, Typeflag: tar.TypeBlock, Devmajor: 8},
+		{Name: "usr/share/tool/data", Mode: 0644, Size: 4, Typeflag: tar.TypeReg},
+		{Name: "usr/bin/tty-link", Typeflag: tar.TypeSymlink, Linkname: "/usr/share/tool/tty"},
+		{Name: "dev/null", Mode: 0666, Typeflag: tar.TypeChar, Devmajor: 1, Devminor: 3},
+	} {
+		if err := tw.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte("data")[:header.Size]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	layer, err := tarball.LayerFromOpener(func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(buf.Bytes())), nil
+	}, tarball.WithMediaType(types.OCILayer))
+	if err != nil {
+		t.Fatal(err)
+	}
+	img := newImage(t, layer)
+
+	// the devices which are not copied are ignored
+	platform := v1alpha1.PluginPlatform{Platform: "linux/amd64", Files: []v1alpha1.FileLocation{{From: "/usr/bin/tool", To: "."}}, Bin: "tool"}
+	if _, _, err := Extract(context.Background(), img, platform, filepath.Join(t.TempDir(), "plugin.tar.gz"), nil); err != nil {
+		t.Fatalf("extract error: %v", err)
+	}
+	for from, reason := range map[string]string{
+		"/usr/bin/su-helper": "setuid",
+		"/usr/bin/sg-helper": "setgid",
+		"/usr/share/tool":    "a character device",
+		"/usr/bin/tty-link":  "a character device",
+	} {
+		platform.Files = []v1alpha1.FileLocation{{From: "/usr/bin/tool", To: "."}, {From: from, To: "."}}
+		destination := filepath.Join(t.TempDir(), "plugin.tar.gz")
+		_, _, err := Extract(context.Background(), img, platform, destination, nil)
+		var privilegedErr *PrivilegedFileError
+		if !errors.As(err, &privilegedErr) || privilegedErr.Reason != reason {
+			t.Fatalf("%s is not rejected as %s: %v", from, reason, err)
+		}
+		if _, err := os.Stat(destination); !os.IsNotExist(err) {
+			t.Fatalf("artifact with %s is published: %v", from, err)
+		}
+	}
+}
+
+func TestExtractConfigMapFiles(t *testing.T) {
+	namespace, name, err := ParseConfigMap("configmap://tools/kubectl-hello")
+	if err != nil || namespace != "tools" || name != "kubectl-hello" {
+		t.Fatalf("unexpected config map %s/%s: %v", namespace, name, err)
+	}
+	for _, src := range []string{"configmap://kubectl-hello", "configmap:///kubectl-hello", "configmap://tools/"} {
+		if _, _, err := ParseConfigMap(src); err == nil {
+			t.Fatalf("expected error for invalid config map %s", src)
+		}
+	}
+
+	files := map[string][]byte{
+		"kubectl-hello": []byte("#!/bin/bash\necho hello\n"),
+		"README.md":     []byte("hello"),
+	}
+	platform := v1alpha1.PluginPlatform{
+		Platform: "linux/amd64",
+		Image:    "configmap://tools/kubectl-hello",
+		Files:    []v1alpha1.FileLocation{{From: "/kubectl-hello", To: "."}, {From: "/README.md", To: "."}},
+		Bin:      "kubectl-hello",
+	}
+	var checksums []string
+	for i := 0; i < 2; i++ {
+		img, err := ImageFromFiles(files)
+		if err != nil {
+			t.Fatal(err)
+		}
+		destination := filepath.Join(t.TempDir(), "plugin.tar.gz")
+		_, checksum, err := Extract(context.Background(), img, platform, destination, nil)
+		if err != nil {
+			t.Fatalf("extract error: %v", err)
+		}
+		artifact := readArtifact(t, destination)
+		if len(artifact) != 2 || artifact["kubectl-hello"] != "#!/bin/bash\necho hello\n" || artifact["README.md"] != "hello" {
+			t.Fatalf("unexpected artifact contents %v", artifact)
+		}
+		if mode := readModes(t, destination)["kubectl-hello"]; mode != 0755 {
+			t.Fatalf("unexpected mode %o of kubectl-hello", mode)
+		}
+		checksums = append(checksums, checksum)
+	}
+	if checksums[0] != checksums[1] {
+		t.Fatalf("checksums of the same files differ: %v", checksums)
+	}
+}
+
+func TestExtractZipArchives(t *testing.T) {
+	img := newImage(t,
+		newLayer(t, map[string]string{"tool.exe": "tool", "LICENSE": "license"}, compression.GZip),
+	)
+	platform := v1alpha1.PluginPlatform{
+		Platform: "windows/amd64",
+		Files:    []v1alpha1.FileLocation{{From: "/tool.exe", To: "."}, {From: "/LICENSE", To: "."}},
+		Bin:      "tool.exe",
+	}
+	if format := ArchiveFormat(platform); format != v1alpha1.ArchiveFormatZip {
+		t.Fatalf("unexpected archive format %s of windows", format)
+	}
+	if format := ArchiveFormat(v1alpha1.PluginPlatform{Platform: "linux/amd64"}); format != v1alpha1.ArchiveFormatTarGz {
+		t.Fatalf("unexpected archive format %s of linux", format)
+	}
+
+	destination := filepath.Join(t.TempDir(), "plugin.zip")
+	if _, _, err := Extract(context.Background(), img, platform, destination, nil); err != nil {
+		t.Fatalf("extract error: %v", err)
+	}
+	zr, err := zip.OpenReader(destination)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer zr.Close()
+	artifact := map[string]string{}
+	for _, f := range zr.File {
+		r, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, err := io.ReadAll(r)
+		r.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		artifact[f.Name] = string(content)
+		if f.Name == "tool.exe" && f.Mode().Perm() != 0755 {
+			t.Fatalf("unexpected mode %o of %s", f.Mode().Perm(), f.Name)
+		}
+	}
+	if len(artifact) != 2 || artifact["tool.exe"] != "tool" || artifact["LICENSE"] != "license" {
+		t.Fatalf("unexpected artifact contents %v", artifact)
+	}
+}
+
+// newOrderedLayer returns a layer of the files in the order given, modified at the time.
+func newOrderedLayer(t *testing.T, names, contents []string, modTime time.Time) v1.Layer {
+	t.Helper()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for i, name := range names {
+		if err := tw.WriteHeader(&tar.Header{
+			Name:     name,
+			Mode:     0755,
+			Size:     int64(len(contents[i])),
+			ModTime:  modTime,
+			Uid:      1000,
+			Uname:    "builder",
+			Typeflag: tar.TypeReg,
+		}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(contents[i])); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	layer, err := tarball.LayerFromOpener(func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(buf.Bytes())), nil
+	}, tarball.WithMediaType(types.OCILayer))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return layer
+}
+
+func TestExtractReproducible(t *testing.T) {
+	// the same files built at other times, in another order
+	img := newImage(t, newOrderedLayer(t, []string{"tool", "b", "a"}, []string{"tool", "b", "a"}, time.Unix(1700000000, 123)))
+	rebuilt := newImage(t, newOrderedLayer(t, []string{"a", "tool", "b"}, []string{"a", "tool", "b"}, time.Unix(1800000000, 0)))
+
+	for _, platform := range []v1alpha1.PluginPlatform{
+		{Platform: "linux/amd64", Files: []v1alpha1.FileLocation{{From: "/*", To: "."}}, Bin: "tool"},
+		{Platform: "linux/amd64", Files: []v1alpha1.FileLocation{{From: "/*", To: "."}}, Bin: "tool", ArchiveFormat: v1alpha1.ArchiveFormatZip},
+	} {
+		dir := t.TempDir()
+		destination := filepath.Join(dir, "plugin."+string(ArchiveFormat(platform)))
+		_, checksum, err := Extract(context.Background(), img, platform, destination, nil)
+		if err != nil {
+			t.Fatalf("extract error: %v", err)
+		}
+		first, err := os.ReadFile(destination)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, rebuiltChecksum, err := Extract(context.Background(), rebuilt, platform, filepath.Join(dir, "rebuilt."+string(ArchiveFormat(platform))), nil)
+		if err != nil {
+			t.Fatalf("extract error: %v", err)
+		}
+		if checksum != rebuiltChecksum {
+			t.Fatalf("%s artifacts of the same files differ", ArchiveFormat(platform))
+		}
+		if entries, err := filepath.Glob(filepath.Join(dir, "*"+spoolSuffix+"*")); err != nil || len(entries) > 0 {
+			t.Fatalf("unexpected files left %v, %v", entries, err)
+		}
+
+		var names []string
+		if ArchiveFormat(platform) == v1alpha1.ArchiveFormatZip {
+			zr, err := zip.NewReader(bytes.NewReader(first), int64(len(first)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, f := range zr.File {
+				names = append(names, f.Name)
+				if !f.Modified.Equal(artifactModTime) {
+					t.Fatalf("unexpected modification time %v of %s", f.Modified, f.Name)
+				}
+			}
+		} else {
+			gr, err := gzip.NewReader(bytes.NewReader(first))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !gr.ModTime.IsZero() || len(gr.Name) > 0 {
+				t.Fatalf("unexpected gzip header %v", gr.Header)
+			}
+			tr := tar.NewReader(gr)
+			for {
+				header, err := tr.Next()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				names = append(names, header.Name)
+				if !header.ModTime.Equal(artifactModTime) || header.Uid != 0 || len(header.Uname) > 0 {
+					t.Fatalf("unexpected header %v of %s", header, header.Name)
+				}
+			}
+		}
+		if !reflect.DeepEqual(names, []string{"a", "b", "tool"}) {
+			t.Fatalf("unexpected order of the files %v", names)
+		}
+	}
+}
+
+func TestExtractOwner(t *testing.T) {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	if err := tw.WriteHeader(&tar.Header{
+		Name:       "tool",
+		Mode:       0755,
+		Size:       4,
+		Uid:        1000,
+		Gid:        1000,
+		Uname:      "builder",
+		Gname:      "builder",
+		Typeflag:   tar.TypeReg,
+		PAXRecords: map[string]string{"SCHILY.xattr.security.capability": "cap", "comment": "built by ci"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tw.Write([]byte("tool")); err != nil {
+		t.Fatal(err)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	layer, err := tarball.LayerFromOpener(func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(buf.Bytes())), nil
+	}, tarball.WithMediaType(types.OCILayer))
+	if err != nil {
+		t.Fatal(err)
+	}
+	img := newImage(t, layer)
+	platform := v1alpha1.PluginPlatform{Platform: "linux/amd64", Files: []v1alpha1.FileLocation{{From: "/tool", To: "."}}, Bin: "tool"}
+
+	readHeader := func(destination string) *tar.Header {
+		t.Helper()
+		f, err := os.Open(destination)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		gr, err := gzip.NewReader(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		header, err := tar.NewReader(gr).Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return header
+	}
+
+	destination := filepath.Join(t.TempDir(), "plugin.tar.gz")
+	if _, _, err := Extract(context.Background(), img, platform, destination, nil); err != nil {
+		t.Fatalf("extract error: %v", err)
+	}
+	header := readHeader(destination)
+	if header.Uid != 0 || header.Gid != 0 || len(header.Uname) > 0 || len(header.Gname) > 0 {
+		t.Fatalf("unexpected owner %d:%d %s:%s", header.Uid, header.Gid, header.Uname, header.Gname)
+	}
+	if len(header.PAXRecords) > 0 || header.Format != tar.FormatUSTAR {
+		t.Fatalf("unexpected PAX records %v in %s header", header.PAXRecords, header.Format)
+	}
+
+	defer func(uid, gid int, uname, gname string) {
+		ArtifactUID, ArtifactGID, ArtifactUname, ArtifactGname = uid, gid, uname, gname
+	}(ArtifactUID, ArtifactGID, ArtifactUname, ArtifactGname)
+	ArtifactUID, ArtifactGID, ArtifactUname, ArtifactGname = 65534, 65534, "nobody", "nobody"
+	if _, _, err := Extract(context.Background(), img, platform, destination, nil); err != nil {
+		t.Fatalf("extract error: %v", err)
+	}
+	header = readHeader(destination)
+	if header.Uid != 65534 || header.Gid != 65534 || header.Uname != "nobody" || header.Gname != "nobody" {
+		t.Fatalf("unexpected owner %d:%d %s:%s", header.Uid, header.Gid, header.Uname, header.Gname)
+	}
+
+	if err := ValidateArtifactOwner(-1, 0, "", ""); err == nil {
+		t.Fatal("negative owner id is valid")
+	}
+	if err := ValidateArtifactOwner(0, 0, strings.Repeat("u", 33), ""); err == nil {
+		t.Fatal("owner name longer than USTAR headers is valid")
+	}
+}
+
+func TestVerifyArtifact(t *testing.T) {
+	img := newImage(t, newLayer(t, map[string]string{"tool": strings.Repeat("tool", 1000), "LICENSE": "license"}, compression.GZip))
+	for _, format := range []v1alpha1.ArchiveFormat{v1alpha1.ArchiveFormatTarGz, v1alpha1.ArchiveFormatZip} {
+		platform := v1alpha1.PluginPlatform{
+			Platform:      "linux/amd64",
+			Files:         []v1alpha1.FileLocation{{From: "/tool", To: "."}, {From: "/LICENSE", To: "."}},
+			Bin:           "tool",
+			ArchiveFormat: format,
+		}
+		destination := filepath.Join(t.TempDir(), "plugin."+string(format))
+		if _, _, err := Extract(context.Background(), img, platform, destination, nil); err != nil {
+			t.Fatalf("extract error: %v", err)
+		}
+		if err := verifyArtifact(destination, format, []string{"tool", "LICENSE"}); err != nil {
+			t.Fatalf("%s artifact is not verified: %v", format, err)
+		}
+		var corruptErr *CorruptArtifactError
+		if err := verifyArtifact(destination, format, []string{"tool", "LICENSE", "completion.bash"}); !errors.As(err, &corruptErr) {
+			t.Fatalf("%s artifact without expected file is verified: %v", format, err)
+		}
+
+		contents, err := os.ReadFile(destination)
+		if err != nil {
+			t.Fatal(err)
+		}
+		corrupted := filepath.Join(t.TempDir(), "corrupted."+string(format))
+		for name, data := range map[string][]byte{
+			"truncated": contents[:len(contents)/2],
+			"flipped":   append(append(append([]byte{}, contents[:len(contents)/2]...), contents[len(contents)/2]^0xff), contents[len(contents)/2+1:]...),
+		} {
+			if err := os.WriteFile(corrupted, data, 0644); err != nil {
+				t.Fatal(err)
+			}
+			if err := verifyArtifact(corrupted, format, []string{"tool", "LICENSE"}); !errors.As(err, &corruptErr) {
+				t.Fatalf("%s %s artifact is verified: %v", name, format, err)
+			}
+		}
+	}
+}
+
+func TestExtractZstdVariant(t *testing.T) {
+	img := newImage(t,
+		newLayer(t, map[string]string{"usr/bin/tool": "tool", "usr/share/tool/LICENSE": "license"}, compression.GZip),
+	)
+	platform := v1alpha1.PluginPlatform{
+		Platform: "linux/amd64",
+		Files:    []v1alpha1.FileLocation{{From: "/usr/bin/tool", To: "."}, {From: "/usr/share/tool/LICENSE", To: "."}},
+		Bin:      "tool",
+	}
+	defer func(enabled bool) { ZstdArtifacts = enabled }(ZstdArtifacts)
+	ZstdArtifacts = true
+
+	destination := filepath.Join(t.TempDir(), "tool_linux_amd64.tar.gz")
+	if _, _, err := Extract(context.Background(), img, platform, destination, nil); err != nil {
+		t.Fatalf("extract error: %v", err)
+	}
+	variant := ZstdPath(destination)
+	f, err := os.Open(variant)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	zr, err := zstd.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer zr.Close()
+	files := map[string]string{}
+	tr := tar.NewReader(zr)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, err := io.ReadAll(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[header.Name] = string(content)
+	}
+	if expected := readArtifact(t, destination); !reflect.DeepEqual(files, expected) {
+		t.Fatalf("zstd variant contents %v differ from the tar.gz artifact %v", files, expected)
+	}
+	data, err := os.ReadFile(variant)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checksum, err := os.ReadFile(ChecksumPath(variant))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sum := sha256.Sum256(data); strings.TrimSpace(string(checksum)) != hex.EncodeToString(sum[:]) {
+		t.Fatalf("checksum %s does not match the zstd variant", checksum)
+	}
+
+	ZstdArtifacts = false
+	if _, _, err := Extract(context.Background(), img, platform, destination, nil); err != nil {
+		t.Fatalf("extract error: %v", err)
+	}
+	if _, err := os.Stat(variant); !os.IsNotExist(err) {
+		t.Fatalf("zstd variant is kept once disabled: %v", err)
+	}
+}
+
+func TestExtractStripComponents(t *testing.T) {
+	img := newImage(t,
+		newLayer(t, map[string]string{
+			"opt/tool/dist/v1/bin/tool":         "tool",
+			"opt/tool/dist/v1/share/man/tool.1": "man",
+			"opt/tool/dist/README":              "readme",
+			"LICENSE":                           "license",
+		}, compression.GZip),
+	)
+	platform := v1alpha1.PluginPlatform{
+		Platform: "linux/amd64",
+		Files: []v1alpha1.FileLocation{
+			{From: "/opt/tool/dist", To: ".", StripComponents: 2},
+			{From: "/LICENSE", To: "."},
+		},
+		Bin: "bin/tool",
+	}
+
+	destination := filepath.Join(t.TempDir(), "plugin.tar.gz")
+	if _, _, err := Extract(context.Background(), img, platform, destination, nil); err != nil {
+		t.Fatalf("extract error: %v", err)
+	}
+	artifact := readArtifact(t, destination)
+	expected := map[string]string{
+		"bin/tool":         "tool",
+		"share/man/tool.1": "man",
+		"README":           "readme",
+		"LICENSE":          "license",
+	}
+	if len(artifact) != len(expected) {
+		t.Fatalf("unexpected artifact contents %v", artifact)
+	}
+	for name, content := range expected {
+		if artifact[name] != content {
+			t.Fatalf("unexpected artifact contents %v", artifact)
+		}
+	}
+	if modes := readModes(t, destination); modes["bin/tool"] != 0755 {
+		t.Fatalf("bin is not executable: %v", modes)
+	}
+
+	ordered := InstallOrder(platform.Files)
+	if ordered[0].From != "/LICENSE" || ArchivePath(ordered[1]) != "*" {
+		t.Fatalf("unexpected install order %v", ordered)
+	}
+
+	platform.Files[0].To = "tool"
+	if _, _, err := Extract(context.Background(), img, platform, destination, nil); err == nil {
+		t.Fatalf("components are stripped to the file %s", platform.Files[0].To)
+	}
+}
+
+func TestExtractMissingFiles(t *testing.T) {
+	img := newImage(t,
+		newLayer(t, map[string]string{"usr/bin/tool": "tool"}, compression.GZip),
+	)
+	platform := v1alpha1.PluginPlatform{
+		Platform: "linux/amd64",
+		Files: []v1alpha1.FileLocation{
+			{From: "/usr/bin/tool", To: "."},
+			{From: "/usr/share/tool/completion.bash", To: ".", Optional: true},
+			{From: "/etc/tool/config.yaml", To: "."},
+			{From: "/usr/lib/tool/*.so", To: "lib/"},
+		},
+		Bin: "tool",
+	}
+
+	destination := filepath.Join(t.TempDir(), "plugin.tar.gz")
+	_, _, err := Extract(context.Background(), img, platform, destination, nil)
+	var missingErr *MissingFilesError
+	if !errors.As(err, &missingErr) {
+		t.Fatalf("expected missing files error, got %v", err)
+	}
+	if len(missingErr.Files) != 2 || missingErr.Files[0] != "/etc/tool/config.yaml" || missingErr.Files[1] != "/usr/lib/tool/*.so" {
+		t.Fatalf("unexpected missing files %v", missingErr.Files)
+	}
+	if _, err := os.Stat(destination); !os.IsNotExist(err) {
+		t.Fatalf("incomplete artifact is not removed: %v", err)
+	}
+
+	platform.Files = platform.Files[:2]
+	files, _, err := Extract(context.Background(), img, platform, destination, nil)
+	if err != nil {
+		t.Fatalf("extract error: %v", err)
+	}
+	if len(files) != 1 || files[0].From != "/usr/bin/tool" {
+		t.Fatalf("unexpected files %v", files)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	img := newImage(t,
+		newLayer(t, map[string]string{"usr/bin/tool": "tool", "usr/share/tool/templates/a.tmpl": "a"}, compression.GZip),
+	)
+	platform := v1alpha1.PluginPlatform{
+		Platform: "linux/amd64",
+		Files: []v1alpha1.FileLocation{
+			{From: "/usr/bin/tool", To: "."},
+			{From: "/usr/share/tool/templates", To: "."},
+			{From: "/usr/share/tool/completion.bash", To: ".", Optional: true},
+		},
+		Bin: "tool",
+	}
+
+	files, err := Validate(context.Background(), img, platform, nil)
+	if err != nil {
+		t.Fatalf("validate error: %v", err)
+	}
+	if len(files) != 2 || files[0].From != "/usr/bin/tool" || files[1].From != "/usr/share/tool/templates" {
+		t.Fatalf("unexpected files %v", files)
+	}
+
+	platform.Files = append(platform.Files, v1alpha1.FileLocation{From: "/etc/tool/config.yaml", To: "."})
+	_, err = Validate(context.Background(), img, platform, nil)
+	var missingErr *MissingFilesError
+	if !errors.As(err, &missingErr) {
+		t.Fatalf("expected missing files error, got %v", err)
+	}
+	if len(missingErr.Files) != 1 || missingErr.Files[0] != "/etc/tool/config.yaml" {
+		t.Fatalf("unexpected missing files %v", missingErr.Files)
+	}
+}
+
+func TestExtractSBOMs(t *testing.T) {
+	sbom := `{"spdxVersion": "SPDX-2.3", "name": "tool"}`
+	img := newImage(t,
+		newLayer(t, map[string]string{"sbom/tool.spdx.json": sbom, "usr/share/doc/tool.spdx.json": "ignored"}, compression.GZip),
+		newLayer(t, map[string]string{"usr/bin/tool": "tool"}, compression.GZip),
+	)
+	platform := v1alpha1.PluginPlatform{
+		Platform: "linux/amd64",
+		Files:    []v1alpha1.FileLocation{{From: "/usr/bin/tool", To: "."}},
+		Bin:      "tool",
+	}
+	defer func(enabled bool) { SBOMs = enabled }(SBOMs)
+	SBOMs = true
+
+	destination := filepath.Join(t.TempDir(), "tool_linux_amd64.tar.gz")
+	if _, _, err := Extract(context.Background(), img, platform, destination, nil); err != nil {
+		t.Fatalf("extract error: %v", err)
+	}
+	if files := readArtifact(t, destination); !reflect.DeepEqual(files, map[string]string{"tool": "tool"}) {
+		t.Fatalf("unexpected artifact contents %v", files)
+	}
+	found, err := FindSBOM(destination)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found == nil || found.Format != SBOMFormatSPDX || found.Path != SBOMPath(destination, SBOMFormatSPDX) {
+		t.Fatalf("unexpected SBOM %+v", found)
+	}
+	data, err := os.ReadFile(found.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sum := sha256.Sum256(data); string(data) != sbom || found.Sha256 != hex.EncodeToString(sum[:]) {
+		t.Fatalf("SBOM %s with checksum %s does not match the SBOM of the image", data, found.Sha256)
+	}
+
+	// the SBOM of the topmost layer is extracted
+	img = newImage(t,
+		newLayer(t, map[string]string{"sbom/tool.spdx.json": sbom}, compression.GZip),
+		newLayer(t, map[string]string{"usr/bin/tool": "tool", "bom.json": `{"bomFormat": "CycloneDX"}`}, compression.GZip),
+	)
+	if _, _, err := Extract(context.Background(), img, platform, destination, nil); err != nil {
+		t.Fatalf("extract error: %v", err)
+	}
+	if found, err := FindSBOM(destination); err != nil || found == nil || found.Format != SBOMFormatCycloneDX {
+		t.Fatalf("unexpected SBOM %+v: %v", found, err)
+	}
+	if _, err := os.Stat(SBOMPath(destination, SBOMFormatSPDX)); !os.IsNotExist(err) {
+		t.Fatalf("SBOM of the previous extraction is kept: %v", err)
+	}
+
+	// the SBOM of the previous extraction is removed if the image has none
+	img = newImage(t, newLayer(t, map[string]string{"usr/bin/tool": "tool"}, compression.GZip))
+	if _, _, err := Extract(context.Background(), img, platform, destination, nil); err != nil {
+		t.Fatalf("extract error: %v", err)
+	}
+	if found, err := FindSBOM(destination); err != nil || found != nil {
+		t.Fatalf("unexpected SBOM %+v: %v", found, err)
+	}
+}
+
+func TestExtractionHash(t *testing.T) {
+	platform := v1alpha1.PluginPlatform{
+		Platform: "linux/amd64",
+		Image:    "quay.io/acme/tool:v1",
+		Files:    []v1alpha1.FileLocation{{From: "/usr/bin/tool", To: "."}},
+		Bin:      "tool",
+	}
+	hash := ExtractionHash(platform)
+
+	// the image is compared by its digest, the files and the settings by the hash
+	retagged := platform
+	retagged.Image = "quay.io/acme/tool:latest"
+	if ExtractionHash(retagged) != hash {
+		t.Fatal("hash changed with the image reference")
+	}
+	changed := platform
+	changed.Files = []v1alpha1.FileLocation{{From: "/usr/bin/tool", To: ".", Exclude: []string{"*.md"}}}
+	if ExtractionHash(changed) == hash {
+		t.Fatal("hash did not change with the files")
+	}
+	defer func(level int) { GzipLevel = level }(GzipLevel)
+	GzipLevel = 1
+	if ExtractionHash(platform) == hash {
+		t.Fatal("hash did not change with the gzip level")
+	}
+	hash = ExtractionHash(platform)
+	defer func(uid int) { ArtifactUID = uid }(ArtifactUID)
+	ArtifactUID = 1000
+	if ExtractionHash(platform) == hash {
+		t.Fatal("hash did not change with the owner")
+	}
+}
+
+func TestExtractDeduplicatesArtifacts(t *testing.T) {
+	platform := v1alpha1.PluginPlatform{
+		Platform: "linux/amd64",
+		Files:    []v1alpha1.FileLocation{{From: "/usr/bin/tool", To: "."}},
+		Bin:      "tool",
+	}
+	img := newImage(t, newLayer(t, map[string]string{"usr/bin/tool": "tool"}, compression.GZip))
+	dir := t.TempDir()
+	contents := func() []os.DirEntry {
+		entries, err := os.ReadDir(filepath.Join(dir, StoreDir))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return entries
+	}
+
+	first, second := filepath.Join(dir, "tool_linux_amd64.tar.gz"), filepath.Join(dir, "tool_linux_arm64.tar.gz")
+	_, checksum, err := Extract(context.Background(), img, platform, first, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := Extract(context.Background(), img, platform, second, nil); err != nil {
+		t.Fatal(err)
+	}
+	firstInfo, err := os.Stat(first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secondInfo, err := os.Stat(second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !os.SameFile(firstInfo, secondInfo) {
+		t.Fatalf("identical artifacts are not shared")
+	}
+	if entries := contents(); len(entries) != 1 || entries[0].Name() != checksum {
+		t.Fatalf("unexpected contents %v, expected %s", entries, checksum)
+	}
+
+	// rebuilding the second artifact releases nothing while the first one references the content
+	changed := newImage(t, newLayer(t, map[string]string{"usr/bin/tool": "tool v2"}, compression.GZip))
+	if _, _, err := Extract(context.Background(), changed, platform, second, nil); err != nil {
+		t.Fatal(err)
+	}
+	if entries := contents(); len(entries) != 2 {
+		t.Fatalf("unexpected contents %v", entries)
+	}
+	if err := RemoveArtifact(first); err != nil {
+		t.Fatal(err)
+	}
+	if entries := contents(); len(entries) != 1 || entries[0].Name() == checksum {
+		t.Fatalf("unreferenced content is not removed: %v", entries)
+	}
+	if unreferenced, err := UnreferencedContents(dir); err != nil || len(unreferenced) > 0 {
+		t.Fatalf("unexpected unreferenced contents %v: %v", unreferenced, err)
+	}
+	if err := RemoveArtifact(second); err != nil {
+		t.Fatal(err)
+	}
+	if entries := contents(); len(entries) > 0 {
+		t.Fatalf("unreferenced content is not removed: %v", entries)
+	}
+}
+
+func TestRemoveTemporaryFiles(t *testing.T) {
+	dir := t.TempDir()
+	img := newImage(t, newLayer(t, map[string]string{"usr/bin/tool": "tool"}, compression.GZip))
+	platform := v1alpha1.PluginPlatform{
+		Platform: "linux/amd64",
+		Files:    []v1alpha1.FileLocation{{From: "/usr/bin/tool", To: "."}},
+		Bin:      "tool",
+	}
+	artifact := filepath.Join(dir, "tool_linux_amd64.tar.gz")
+	if _, _, err := Extract(context.Background(), img, platform, artifact, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// the files left by a crash while artifacts were written
+	leftovers := []string{
+		"tool_linux_arm64.tar.gz.partial",
+		"tool_linux_amd64.tar.gz.sha256.partial",
+		"tool_linux_amd64.tar.gz.link",
+	}
+	for _, name := range leftovers {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("truncated"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := RemoveTemporaryFiles(dir); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	if len(names) != 3 || names[0] != "blobs" || names[1] != "tool_linux_amd64.tar.gz" || names[2] != "tool_linux_amd64.tar.gz.sha256" {
+		t.Fatalf("unexpected files %v", names)
+	}
+	if artifact := readArtifact(t, artifact); artifact["tool"] != "tool" {
+		t.Fatalf("unexpected artifact contents %v", artifact)
+	}
+	if err := RemoveTemporaryFiles(filepath.Join(dir, "missing")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestExtractScanWebhook(t *testing.T) {
+	failing := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failing {
+			http.Error(w, "scanner unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Error(err)
+		}
+		sum := sha256.Sum256(body)
+		if r.Header.Get("X-Artifact-Name") != "tool_linux_amd64.tar.gz" || r.Header.Get("X-Artifact-Sha256") != hex.EncodeToString(sum[:]) {
+			t.Errorf("unexpected headers %v", r.Header)
+		}
+		gr, err := gzip.NewReader(bytes.NewReader(body))
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		contents, _ := io.ReadAll(gr)
+		if bytes.Contains(contents, []byte("EICAR")) {
+			http.Error(w, "Eicar-Signature FOUND", http.StatusForbidden)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+	ScanWebhookURL = server.URL
+	defer func() { ScanWebhookURL = "" }()
+
+	platform := v1alpha1.PluginPlatform{
+		Platform: "linux/amd64",
+		Files:    []v1alpha1.FileLocation{{From: "/usr/bin/tool", To: "."}},
+		Bin:      "tool",
+	}
+	destination := filepath.Join(t.TempDir(), "tool_linux_amd64.tar.gz")
+	clean := newImage(t, newLayer(t, map[string]string{"usr/bin/tool": "tool"}, compression.GZip))
+	if _, _, err := Extract(context.Background(), clean, platform, destination, nil); err != nil {
+		t.Fatalf("extract error: %v", err)
+	}
+
+	// the rejected artifact is not published, the previous one is kept
+	infected := newImage(t, newLayer(t, map[string]string{"usr/bin/tool": "EICAR"}, compression.GZip))
+	_, _, err := Extract(context.Background(), infected, platform, destination, nil)
+	var rejectedErr *ArtifactRejectedError
+	if !errors.As(err, &rejectedErr) || rejectedErr.Reason != "Eicar-Signature FOUND" {
+		t.Fatalf("expected artifact rejected error, got %v", err)
+	}
+	if artifact := readArtifact(t, destination); artifact["tool"] != "tool" {
+		t.Fatalf("unexpected artifact contents %v", artifact)
+	}
+
+	// the artifacts are not published unscanned
+	failing = true
+	_, _, err = Extract(context.Background(), clean, platform, filepath.Join(filepath.Dir(destination), "other.tar.gz"), nil)
+	if err == nil || errors.As(err, &rejectedErr) {
+		t.Fatalf("expected scan error, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(filepath.Dir(destination), "other.tar.gz")); !os.IsNotExist(err) {
+		t.Fatalf("unscanned artifact is published: %v", err)
+	}
+}
+
+func TestPullUnauthorized(t *testing.T) {
+	registry := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer registry.Close()
+
+	src := strings.TrimPrefix(registry.URL, "http://") + "/tools/tool:latest"
+	_, err := Pull(src, PullOptions{Auth: "dXNlcjpwYXNzd29yZA=="})
+	if !IsUnauthorized(err) {
+		t.Fatalf("expected unauthorized error, got %v", err)
+	}
+	if IsUnauthorized(&MissingFilesError{Files: []string{"/tool"}}) {
+		t.Fatalf("missing files are reported as unauthorized")
+	}
+}
+
+func TestTransportTLSMinVersion(t *testing.T) {
+	registry := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	registry.TLS = &tls.Config{MaxVersion: tls.VersionTLS12}
+	registry.StartTLS()
+	defer registry.Close()
+
+	caFile := filepath.Join(t.TempDir(), "ca.crt")
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: registry.Certificate().Raw})
+	if err := os.WriteFile(caFile, ca, 0644); err != nil {
+		t.Fatal(err)
+	}
+	defer func(minVersion uint16) { TLSMinVersion = minVersion }(TLSMinVersion)
+
+	for _, tc := range []struct {
+		minVersion uint16
+		fails      bool
+	}{
+		{minVersion: tls.VersionTLS12},
+		{minVersion: tls.VersionTLS13, fails: true},
+	} {
+		TLSMinVersion = tc.minVersion
+		transport, err := newTransport(PullOptions{CAFile: caFile})
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := (&http.Client{Transport: transport}).Get(registry.URL)
+		if err == nil {
+			resp.Body.Close()
+		}
+		if (err != nil) != tc.fails {
+			t.Fatalf("minimum version %s: unexpected error %v", tls.VersionName(tc.minVersion), err)
+		}
+	}
+}
+
+func TestExtractSizeLimits(t *testing.T) {
+	img := newImage(t,
+		newLayer(t, map[string]string{
+			"usr/bin/tool":       strings.Repeat("t", 100),
+			"usr/share/tool/doc": strings.Repeat("d", 60),
+		}, compression.GZip),
+	)
+	platform := v1alpha1.PluginPlatform{
+		Platform: "linux/amd64",
+		Files: []v1alpha1.FileLocation{
+			{From: "/usr/bin/tool", To: "."},
+			{From: "/usr/share/tool/doc", To: "."},
+		},
+		Bin: "tool",
+	}
+	defer func() { MaxFileSize, MaxArtifactSize = 0, 0 }()
+
+	for _, tc := range []struct {
+		name         string
+		maxFile      int64
+		maxArtifact  int64
+		tooLarge     bool
+		expectedFile string
+	}{
+		{name: "within limits", maxFile: 100, maxArtifact: 160},
+		{name: "file too large", maxFile: 99, tooLarge: true, expectedFile: "usr/bin/tool"},
+		{name: "artifact too large", maxArtifact: 159, tooLarge: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			MaxFileSize, MaxArtifactSize = tc.maxFile, tc.maxArtifact
+			destination := filepath.Join(t.TempDir(), "plugin.tar.gz")
+			_, _, err := Extract(context.Background(), img, platform, destination, nil)
+			if !tc.tooLarge {
+				if err != nil {
+					t.Fatalf("extract error: %v", err)
+				}
+				return
+			}
+			var tooLargeErr *ArtifactTooLargeError
+			if !errors.As(err, &tooLargeErr) {
+				t.Fatalf("expected artifact too large error, got %v", err)
+			}
+			if tooLargeErr.File != tc.expectedFile {
+				t.Fatalf("unexpected file %q exceeding the limit", tooLargeErr.File)
+			}
+			if _, err := os.Stat(destination); !os.IsNotExist(err) {
+				t.Fatalf("incomplete artifact is not removed: %v", err)
+			}
+		})
+	}
+}
+
+func TestReserveMemory(t *testing.T) {
+	MemoryBudget = 10 << 20
+	defer func() { MemoryBudget = 0 }()
+
+	reserve := func(ctx context.Context, memory int64) func() {
+		release, err := reserveMemory(ctx, memory)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return release
+	}
+	release := reserve(context.Background(), 6<<20)
+	reserved := make(chan func())
+	go func() {
+		release, _ := reserveMemory(context.Background(), 6<<20)
+		reserved <- release
+	}()
+	select {
+	case <-reserved:
+		t.Fatalf("memory is reserved beyond the budget")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// the reservations are given up once their context is done
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := reserveMemory(ctx, 6<<20); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the reservation to time out, got %v", err)
+	}
+
+	release()
+	select {
+	case release := <-reserved:
+		release()
+	case <-time.After(5 * time.Second):
+		t.Fatalf("memory is not reserved once released")
+	}
+
+	// reservations larger than the budget wait for the whole budget
+	reserve(context.Background(), 20<<20)()
+	if !memoryReservations.TryAcquire(10 << 20) {
+		t.Fatal("memory is not released")
+	}
+	memoryReservations.Release(10 << 20)
+}
+
+func TestReserveMemoryCancelled(t *testing.T) {
+	MemoryBudget = 10 << 20
+	defer func() { MemoryBudget = 0 }()
+
+	release, err := reserveMemory(context.Background(), 10<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the sync is cancelled while its extraction waits for the budget
+	img := newImage(t, newLayer(t, map[string]string{"usr/bin/zstd-tool": "zstd", "usr/bin/gzip-tool": "gzip"}, compression.GZip))
+	destination := filepath.Join(t.TempDir(), "plugin.tar.gz")
+	ctx, cancel := context.WithCancel(context.Background())
+	waiting := make(chan error)
+	go func() {
+		_, _, err := Extract(ctx, img, testPlatform, destination, nil)
+		waiting <- err
+	}()
+	select {
+	case err := <-waiting:
+		t.Fatalf("extraction does not wait for the budget, got %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	cancel()
+	select {
+	case err := <-waiting:
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("expected the extraction to be cancelled, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("extraction is not cancelled while waiting for the budget")
+	}
+
+	// the cancelled extraction holds no memory once the budget is released
+	release()
+	if !memoryReservations.TryAcquire(10 << 20) {
+		t.Fatal("memory is held by the cancelled extraction")
+	}
+	memoryReservations.Release(10 << 20)
+}
+
+func TestCheckRegistryPolicy(t *testing.T) {
+	defer func(allowed, blocked []string) {
+		AllowedRegistries, BlockedRegistries = allowed, blocked
+	}(AllowedRegistries, BlockedRegistries)
+
+	for _, tc := range []struct {
+		src     string
+		allowed []string
+		blocked []string
+		reason  string
+	}{
+		{src: "quay.io/org/tool:v1"},
+		{src: "quay.io/org/tool:v1", allowed: []string{"quay.io/org"}},
+		{src: "quay.io/org/team/tool:v1", allowed: []string{"quay.io/org/"}},
+		{src: "quay.io/organization/tool:v1", allowed: []string{"quay.io/org"}, reason: "registry is not one of the allowed quay.io/org"},
+		{src: "quay.io/org/tool:v1", allowed: []string{"quay.io/org/tool"}},
+		{src: "quay.io/org/tools:v1", allowed: []string{"quay.io/org/tool"}, reason: "registry is not one of the allowed"},
+		{src: "org/tool:v1", allowed: []string{"docker.io/org"}},
+		{src: "docker.io/org/tool:v1", allowed: []string{"index.docker.io"}},
+		{src: "index.docker.io/library/busybox", blocked: []string{"docker.io/library"}, reason: "registry docker.io/library is blocked"},
+		{src: "quay.io/org/blocked/tool:v1", allowed: []string{"quay.io/org"}, blocked: []string{"quay.io/org/blocked"}, reason: "registry quay.io/org/blocked is blocked"},
+		{src: "quay.io/org/blocked-tool:v1", allowed: []string{"quay.io/org"}, blocked: []string{"quay.io/org/blocked"}},
+		{src: "quay.io/org/tool:v1", allowed: []string{""}, reason: "registry is not one of the allowed"},
+		{src: "configmap://tools/tool", allowed: []string{"quay.io/org"}},
+		{src: "Invalid!", allowed: []string{"quay.io/org"}, reason: "could not parse reference"},
+	} {
+		AllowedRegistries, BlockedRegistries = tc.allowed, tc.blocked
+		err := CheckRegistryPolicy(tc.src)
+		if len(tc.reason) == 0 {
+			if err != nil {
+				t.Errorf("%s allowed %v blocked %v: unexpected error %v", tc.src, tc.allowed, tc.blocked, err)
+			}
+			continue
+		}
+		var policyErr *RegistryPolicyError
+		if !errors.As(err, &policyErr) || !strings.Contains(policyErr.Reason, tc.reason) {
+			t.Errorf("%s allowed %v blocked %v: expected %q, got %v", tc.src, tc.allowed, tc.blocked, tc.reason, err)
+		}
+	}
+}
+
+func TestParseImageStreamTag(t *testing.T) {
+	namespace, name, tag, err := ParseImageStreamTag("imagestreamtag://tools/tool:v1.2.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if namespace != "tools" || name != "tool" || tag != "v1.2.0" {
+		t.Fatalf("expected tools/tool:v1.2.0, got %s/%s:%s", namespace, name, tag)
+	}
+	for _, src := range []string{
+		"imagestreamtag://tool:v1",
+		"imagestreamtag:///tool:v1",
+		"imagestreamtag://tools/tool",
+		"imagestreamtag://tools/:v1",
+		"imagestreamtag://tools/tool:",
+	} {
+		if _, _, _, err := ParseImageStreamTag(src); err == nil {
+			t.Errorf("expected %s to be invalid", src)
+		}
+	}
+	if IsImageStreamTag("quay.io/tools/tool:v1") || !IsImageStreamTag("imagestreamtag://tools/tool:v1") {
+		t.Fatal("expected only the imagestreamtag references to be ImageStreamTags")
+	}
+}
+
+// stargzCompression writes the 51 bytes footer of the eStargz layers itself, since compress/gzip no
+// longer writes the empty stored block estargz.Build expects at the NoCompression level.
+type stargzCompression struct {
+	*estargz.GzipCompressor
+	*estargz.GzipDecompressor
+}
+
+func (c stargzCompression) WriteTOCAndFooter(w io.Writer, off int64, toc *estargz.JTOC, diffHash hash.Hash) (digest.Digest, error) {
+	tocJSON, err := json.MarshalIndent(toc, "", "\t")
+	if err != nil {
+		return "", err
+	}
+	gz := gzip.NewWriter(w)
+	gw := io.Writer(gz)
+	if diffHash != nil {
+		gw = io.MultiWriter(gz, diffHash)
+	}
+	tw := tar.NewWriter(gw)
+	if err := tw.WriteHeader(&tar.Header{Typeflag: tar.TypeReg, Name: estargz.TOCTarName, Size: int64(len(tocJSON))}); err != nil {
+		return "", err
+	}
+	if _, err := tw.Write(tocJSON); err != nil {
+		return "", err
+	}
+	if err := tw.Close(); err != nil {
+		return "", err
+	}
+	if err := gz.Close(); err != nil {
+		return "", err
+	}
+	// the gzip header with the TOC offset in its extra field, an empty stored block and the trailer
+	footer := []byte{0x1f, 0x8b, 0x08, 0x04, 0, 0, 0, 0, 0, 0xff, 26, 0, 'S', 'G', 22, 0}
+	footer = append(footer, fmt.Sprintf("%016xSTARGZ", off)...)
+	footer = append(footer, 0x01, 0, 0, 0xff, 0xff, 0, 0, 0, 0, 0, 0, 0, 0)
+	if _, err := w.Write(footer); err != nil {
+		return "", err
+	}
+	return digest.FromBytes(tocJSON), nil
+}
+
+func TestExtractEStargz(t *testing.T) {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, f := range []struct{ name, content string }{
+		{"usr/bin/gzip-tool", "gzip"},
+		{"usr/bin/zstd-tool", "zstd"},
+		{"usr/share/data", strings.Repeat("data", 1<<18)},
+	} {
+		if err := tw.WriteHeader(&tar.Header{Name: f.name, Mode: 0755, Size: int64(len(f.content)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(f.content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	blob, err := estargz.Build(io.NewSectionReader(bytes.NewReader(buf.Bytes()), 0, int64(buf.Len())),
+		estargz.WithCompression(stargzCompression{estargz.NewGzipCompressor(), &estargz.GzipDecompressor{}}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer blob.Close()
+	raw, err := io.ReadAll(blob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	layer, err := tarball.LayerFromOpener(func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(raw)), nil
+	}, tarball.WithMediaType(types.OCILayer))
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := mutate.Append(newImage(t), mutate.Addendum{
+		Layer:       layer,
+		Annotations: map[string]string{estargz.TOCJSONDigestAnnotation: blob.TOCDigest().String()},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	layerDigest, err := layer.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the requests of the layer are counted, whether they read a range of it or the whole of it
+	var ranged, whole atomic.Int32
+	handler := registry.New(registry.Logger(log.New(io.Discard, "", 0)))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet && strings.HasSuffix(r.URL.Path, "/blobs/"+layerDigest.String()) {
+			if len(r.Header.Get("Range")) > 0 {
+				ranged.Add(1)
+			} else {
+				whole.Add(1)
+			}
+		}
+		handler.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+	ref, err := name.ParseReference(strings.TrimPrefix(server.URL, "http://") + "/tools/tool:v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := remote.Write(ref, img); err != nil {
+		t.Fatal(err)
+	}
+
+	defer func(lazy bool) { LazyPull = lazy }(LazyPull)
+	for _, lazy := range []bool{true, false} {
+		LazyPull = lazy
+		ranged.Store(0)
+		whole.Store(0)
+		pulled, err := Pull(ref.String(), PullOptions{Platform: "linux/amd64"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		destination := filepath.Join(t.TempDir(), "tool_linux_amd64.tar.gz")
+		if _, _, err := Extract(context.Background(), pulled, testPlatform, destination, nil); err != nil {
+			t.Fatalf("lazy %t: extract error: %v", lazy, err)
+		}
+		if artifact := readArtifact(t, destination); artifact["zstd-tool"] != "zstd" || artifact["gzip-tool"] != "gzip" {
+			t.Fatalf("lazy %t: unexpected artifact contents %v", lazy, artifact)
+		}
+		// only the chunks of the target files and the TOC are fetched from the eStargz layer
+		if lazy && (ranged.Load() == 0 || whole.Load() > 0) {
+			t.Errorf("expected the layer to be read in ranges, got %d range and %d whole requests", ranged.Load(), whole.Load())
+		}
+		if !lazy && whole.Load() == 0 {
+			t.Errorf("expected the layer to be read whole without lazy pulls, got %d range requests", ranged.Load())
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package image
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// GitHubAPI is the URL of the GitHub API the releases are looked up with.
+var GitHubAPI = "https://api.github.com"
+
+// maxGitHubResponseSize bounds the responses of the GitHub API and the checksum assets.
+const maxGitHubResponseSize = 4 << 20
+
+// Release is a release of a GitHub repository.
+type Release struct {
+	Tag    string         `json:"tag_name"`
+	Assets []ReleaseAsset `json:"assets"`
+}
+
+// ReleaseAsset is an asset of a GitHub release.
+type ReleaseAsset struct {
+	Name string `json:"name"`
+	// URL is the API URL of the asset, which downloads it with the application/octet-stream Accept
+	// header, including the assets of the private repositories.
+	URL string `json:"url"`
+	// BrowserDownloadURL downloads the asset without authentication.
+	BrowserDownloadURL string `json:"browser_download_url"`
+	// Digest of the asset computed by GitHub, i.e. sha256:<hex>, empty for the older assets.
+	Digest string `json:"digest"`
+}
+
+// GitHubRelease returns the release of the tag of the GitHub repository, or its latest release.
+func GitHubRelease(ctx context.Context, repository, tag, token string, opts PullOptions) (*Release, error) {
+	endpoint := fmt.Sprintf("%s/repos/%s/releases/latest", strings.TrimSuffix(GitHubAPI, "/"), repository)
+	if len(tag) > 0 {
+		endpoint = fmt.Sprintf("%s/repos/%s/releases/tags/%s", strings.TrimSuffix(GitHubAPI, "/"), repository, url.PathEscape(tag))
+	}
+	data, err := gitHubGet(ctx, endpoint, "application/vnd.github+json", token, opts)
+	if err != nil {
+		return nil, err
+	}
+	release := &Release{}
+	if err := json.Unmarshal(data, release); err != nil {
+		return nil, fmt.Errorf("invalid release of %s: %w", repository, err)
+	}
+	return release, nil
+}
+
+// ReadReleaseAsset returns the content of a small asset of a GitHub release.
+func ReadReleaseAsset(ctx context.Context, asset ReleaseAsset, token string, opts PullOptions) ([]byte, error) {
+	if len(token) > 0 {
+		return gitHubGet(ctx, asset.URL, "application/octet-stream", token, opts)
+	}
+	return gitHubGet(ctx, asset.BrowserDownloadURL, "application/octet-stream", "", opts)
+}
+
+// gitHubGet returns the response of the GET request of the GitHub URL, bounded by maxGitHubResponseSize.
+func gitHubGet(ctx context.Context, uri, accept, token string, opts PullOptions) ([]byte, error) {
+	transport, err := newTransport(opts)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, uri, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", accept)
+	if len(token) > 0 {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := (&http.Client{Transport: transport}).Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxGitHubResponseSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: unexpected status %s", uri, resp.Status)
+	}
+	if len(data) > maxGitHubResponseSize {
+		return nil, fmt.Errorf("GET %s: response exceeds %d bytes", uri, maxGitHubResponseSize)
+	}
+	return data, nil
+}
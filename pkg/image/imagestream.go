@@ -0,0 +1,39 @@
+package image
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	// ImageStreamTagPrefix references an ImageStreamTag in the format
+	// imagestreamtag://namespace/name:tag that is resolved to its image
+	// in the internal registry.
+	ImageStreamTagPrefix = "imagestreamtag://"
+
+	// ServiceAccountTokenPath is the token of the controller's service account,
+	// used to pull images of ImageStreamTags from the internal registry.
+	ServiceAccountTokenPath = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+	// ServiceCAPath is the CA bundle the internal registry is signed by.
+	ServiceCAPath = "/var/run/secrets/kubernetes.io/serviceaccount/service-ca.crt"
+)
+
+// IsImageStreamTag reports whether the image reference points to an ImageStreamTag.
+func IsImageStreamTag(src string) bool {
+	return strings.HasPrefix(src, ImageStreamTagPrefix)
+}
+
+// ParseImageStreamTag splits the ImageStreamTag reference into its namespace,
+// image stream name and tag.
+func ParseImageStreamTag(src string) (namespace, name, tag string, err error) {
+	ref := strings.TrimPrefix(src, ImageStreamTagPrefix)
+	fields := strings.SplitN(ref, "/", 2)
+	if len(fields) != 2 || len(fields[0]) == 0 {
+		return "", "", "", fmt.Errorf("invalid image stream tag %s, should be in %snamespace/name:tag format", src, ImageStreamTagPrefix)
+	}
+	nameTag := strings.SplitN(fields[1], ":", 2)
+	if len(nameTag) != 2 || len(nameTag[0]) == 0 || len(nameTag[1]) == 0 {
+		return "", "", "", fmt.Errorf("invalid image stream tag %s, should be in %snamespace/name:tag format", src, ImageStreamTagPrefix)
+	}
+	return fields[0], nameTag[0], nameTag[1], nil
+}
@@ -0,0 +1,112 @@
+package image
+
+import (
+	"archive/tar"
+	"bytes"
+	"container/list"
+	"io"
+	"sync"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+)
+
+// LayerIndexCacheSize is the number of entries of the layer indexes cached in memory.
+var LayerIndexCacheSize = 1 << 18
+
+// indexEntry is an entry of a layer tarball, without its contents.
+type indexEntry struct {
+	name     string
+	typeflag byte
+	size     int64
+	linkname string
+}
+
+// layerIndex lists the entries of a layer tarball in order.
+type layerIndex []indexEntry
+
+// replay calls visit for the entries of the layer from its index, and reports whether it did.
+func (index layerIndex) replay(wants func(name string) bool, visit visitFunc) (bool, error) {
+	for _, entry := range index {
+		if entry.typeflag == tar.TypeReg && entry.size > 0 && !isWhiteout(entry.name) && wants(entry.name) {
+			return false, nil
+		}
+	}
+	for _, entry := range index {
+		if entry.typeflag == tar.TypeReg && !isWhiteout(entry.name) {
+			continue
+		}
+		header := &tar.Header{Name: entry.name, Typeflag: entry.typeflag, Size: entry.size, Linkname: entry.linkname}
+		next, err := visit(header, bytes.NewReader(nil))
+		if err != nil || !next {
+			return true, err
+		}
+	}
+	return true, nil
+}
+
+// indexBuilder records the entries of a layer as they are visited.
+type indexBuilder struct {
+	index layerIndex
+	// complete reports whether all the entries are visited
+	complete bool
+}
+
+// wrap returns the visit function recording the entries visited.
+func (b *indexBuilder) wrap(visit visitFunc) visitFunc {
+	b.complete = true
+	return func(header *tar.Header, contents io.Reader) (bool, error) {
+		b.index = append(b.index, indexEntry{name: header.Name, typeflag: header.Typeflag, size: header.Size, linkname: header.Linkname})
+		next, err := visit(header, contents)
+		if err != nil || !next {
+			b.complete = false
+		}
+		return next, err
+	}
+}
+
+// layerIndexCache is an LRU cache of the indexes of the layers by digest, bounded by
+// LayerIndexCacheSize entries.
+type layerIndexCache struct {
+	lock    sync.Mutex
+	entries int
+	lru     *list.List
+	layers  map[v1.Hash]*list.Element
+}
+
+type indexedLayer struct {
+	digest v1.Hash
+	index  layerIndex
+}
+
+var layerIndexes = newLayerIndexCache()
+
+func newLayerIndexCache() *layerIndexCache {
+	return &layerIndexCache{lru: list.New(), layers: map[v1.Hash]*list.Element{}}
+}
+
+func (c *layerIndexCache) get(digest v1.Hash) (layerIndex, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	element, ok := c.layers[digest]
+	if !ok {
+		return nil, false
+	}
+	c.lru.MoveToFront(element)
+	return element.Value.(*indexedLayer).index, true
+}
+
+// add caches the index of the layer, evicting the least recently used ones beyond LayerIndexCacheSize.
+func (c *layerIndexCache) add(digest v1.Hash, index layerIndex) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if _, ok := c.layers[digest]; ok || len(index) > LayerIndexCacheSize {
+		return
+	}
+	c.layers[digest] = c.lru.PushFront(&indexedLayer{digest: digest, index: index})
+	c.entries += len(index)
+	for c.entries > LayerIndexCacheSize {
+		oldest := c.lru.Remove(c.lru.Back()).(*indexedLayer)
+		delete(c.layers, oldest.digest)
+		c.entries -= len(oldest.index)
+	}
+}
@@ -0,0 +1,29 @@
+package image
+
+import (
+	"github.com/openshift/cli-manager/api/v1alpha1"
+)
+
+// LicenseDir is the directory of the artifacts the license and documentation files are copied to.
+const LicenseDir = "licenses"
+
+// LicenseFiles returns the file locations of the license and documentation files of the plugin.
+func LicenseFiles(name string, licenses *v1alpha1.Licenses) []v1alpha1.FileLocation {
+	if licenses == nil {
+		return nil
+	}
+	var files []v1alpha1.FileLocation
+	if len(licenses.Files) > 0 {
+		for _, f := range licenses.Files {
+			files = append(files, v1alpha1.FileLocation{From: f, To: LicenseDir + "/"})
+		}
+		return files
+	}
+	for _, pattern := range []string{"/LICENSE*", "/COPYING*", "/NOTICE*", "/README*"} {
+		files = append(files, v1alpha1.FileLocation{From: pattern, To: LicenseDir + "/", Optional: true})
+	}
+	return append(files,
+		v1alpha1.FileLocation{From: "/licenses/*", To: LicenseDir + "/image/", Optional: true},
+		v1alpha1.FileLocation{From: "/usr/share/licenses/" + name + "/*", To: LicenseDir + "/" + name + "/", Optional: true},
+	)
+}
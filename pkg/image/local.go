@@ -0,0 +1,223 @@
+package image
+
+import (
+	"archive/tar"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/partial"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+const (
+	// OCIArchivePrefix references an oci-archive tarball (i.e. created by `skopeo copy ... oci-archive:`)
+	// relative to LocalImagesPath.
+	OCIArchivePrefix = "oci-archive:"
+	// DockerArchivePrefix references a docker-archive tarball (i.e. created by `docker save`)
+	// relative to LocalImagesPath.
+	DockerArchivePrefix = "docker-archive:"
+)
+
+// LocalImagesPath is the directory pre-loaded image tarballs are read from.
+var LocalImagesPath = "/var/run/images"
+
+// IsLocal reports whether the image reference points to a pre-loaded image tarball.
+func IsLocal(src string) bool {
+	return strings.HasPrefix(src, OCIArchivePrefix) || strings.HasPrefix(src, DockerArchivePrefix)
+}
+
+// pullLocal loads the image from a pre-loaded tarball without any registry access.
+func pullLocal(src string, platform *v1.Platform) (v1.Image, error) {
+	switch {
+	case strings.HasPrefix(src, DockerArchivePrefix):
+		path, err := localImagePath(strings.TrimPrefix(src, DockerArchivePrefix))
+		if err != nil {
+			return nil, err
+		}
+		return tarball.ImageFromPath(path, nil)
+	case strings.HasPrefix(src, OCIArchivePrefix):
+		path, err := localImagePath(strings.TrimPrefix(src, OCIArchivePrefix))
+		if err != nil {
+			return nil, err
+		}
+		return ociArchiveImage(path, platform)
+	}
+	return nil, fmt.Errorf("unsupported local image reference %s", src)
+}
+
+// localImagePath resolves the path of the tarball and ensures that
+// it does not escape LocalImagesPath.
+func localImagePath(path string) (string, error) {
+	if len(path) == 0 {
+		return "", fmt.Errorf("empty local image path")
+	}
+	if filepath.IsAbs(path) {
+		rel, err := filepath.Rel(LocalImagesPath, filepath.Clean(path))
+		if err != nil || strings.HasPrefix(rel, "..") {
+			return "", fmt.Errorf("local image %s is not under %s", path, LocalImagesPath)
+		}
+		path = rel
+	}
+	return filepath.Join(LocalImagesPath, filepath.Clean("/"+path)), nil
+}
+
+// ociArchive reads the blobs of an OCI image layout stored in a tarball.
+type ociArchive struct {
+	path string
+}
+
+func (a *ociArchive) open(name string) (io.ReadCloser, int64, error) {
+	f, err := os.Open(a.path)
+	if err != nil {
+		return nil, 0, err
+	}
+	tr := tar.NewReader(f)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			f.Close()
+			return nil, 0, fmt.Errorf("reading %s: %w", a.path, err)
+		}
+		if filepath.Clean(header.Name) == name {
+			return &readCloser{Reader: tr, Closer: f}, header.Size, nil
+		}
+	}
+	f.Close()
+	return nil, 0, fmt.Errorf("%s is not found in %s", name, a.path)
+}
+
+func (a *ociArchive) readAll(name string) ([]byte, error) {
+	rc, _, err := a.open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return io.ReadAll(rc)
+}
+
+func (a *ociArchive) blob(h v1.Hash) (io.ReadCloser, int64, error) {
+	return a.open(filepath.Join("blobs", h.Algorithm, h.Hex))
+}
+
+func (a *ociArchive) readBlob(h v1.Hash) ([]byte, error) {
+	return a.readAll(filepath.Join("blobs", h.Algorithm, h.Hex))
+}
+
+// ociArchiveImage returns the image of the oci-archive matching the platform,
+// descending into nested indexes if necessary.
+func ociArchiveImage(path string, platform *v1.Platform) (v1.Image, error) {
+	a := &ociArchive{path: path}
+	raw, err := a.readAll("index.json")
+	if err != nil {
+		return nil, err
+	}
+	for {
+		index, err := v1.ParseIndexManifest(bytes.NewReader(raw))
+		if err != nil {
+			return nil, fmt.Errorf("parsing index of %s: %w", path, err)
+		}
+		desc, err := selectManifest(index, platform)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		raw, err = a.readBlob(desc.Digest)
+		if err != nil {
+			return nil, err
+		}
+		if desc.MediaType.IsIndex() {
+			continue
+		}
+		return partial.CompressedToImage(&ociArchiveImageCore{
+			archive:     a,
+			rawManifest: raw,
+			mediaType:   desc.MediaType,
+		})
+	}
+}
+
+// selectManifest picks the manifest matching the platform.
+func selectManifest(index *v1.IndexManifest, platform *v1.Platform) (*v1.Descriptor, error) {
+	if len(index.Manifests) == 1 && (platform == nil || index.Manifests[0].Platform == nil) {
+		return &index.Manifests[0], nil
+	}
+	for i, desc := range index.Manifests {
+		if platform == nil || (desc.Platform != nil && desc.Platform.Satisfies(*platform)) {
+			return &index.Manifests[i], nil
+		}
+	}
+	return nil, &PlatformNotFoundError{Requested: platform.String()}
+}
+
+type ociArchiveImageCore struct {
+	archive     *ociArchive
+	rawManifest []byte
+	mediaType   types.MediaType
+}
+
+func (i *ociArchiveImageCore) MediaType() (types.MediaType, error) {
+	return i.mediaType, nil
+}
+
+func (i *ociArchiveImageCore) RawManifest() ([]byte, error) {
+	return i.rawManifest, nil
+}
+
+func (i *ociArchiveImageCore) RawConfigFile() ([]byte, error) {
+	manifest, err := v1.ParseManifest(bytes.NewReader(i.rawManifest))
+	if err != nil {
+		return nil, err
+	}
+	return i.archive.readBlob(manifest.Config.Digest)
+}
+
+func (i *ociArchiveImageCore) LayerByDigest(h v1.Hash) (partial.CompressedLayer, error) {
+	manifest, err := v1.ParseManifest(bytes.NewReader(i.rawManifest))
+	if err != nil {
+		return nil, err
+	}
+	for _, desc := range manifest.Layers {
+		if desc.Digest == h {
+			return &ociArchiveLayer{archive: i.archive, desc: desc}, nil
+		}
+	}
+	if manifest.Config.Digest == h {
+		return &ociArchiveLayer{archive: i.archive, desc: manifest.Config}, nil
+	}
+	return nil, fmt.Errorf("layer %s is not found", h)
+}
+
+type ociArchiveLayer struct {
+	archive *ociArchive
+	desc    v1.Descriptor
+}
+
+func (l *ociArchiveLayer) Digest() (v1.Hash, error) {
+	return l.desc.Digest, nil
+}
+
+func (l *ociArchiveLayer) Compressed() (io.ReadCloser, error) {
+	rc, _, err := l.archive.blob(l.desc.Digest)
+	return rc, err
+}
+
+func (l *ociArchiveLayer) Size() (int64, error) {
+	return l.desc.Size, nil
+}
+
+func (l *ociArchiveLayer) MediaType() (types.MediaType, error) {
+	return l.desc.MediaType, nil
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
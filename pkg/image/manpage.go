@@ -0,0 +1,80 @@
+package image
+
+import (
+	"archive/tar"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/openshift/cli-manager/api/v1alpha1"
+)
+
+// manDir is the directory of the artifacts the man pages are bundled in.
+const manDir = "man"
+
+// ManPagesPath returns the path of the tar archive of the man pages stored next to the artifact,
+// which holds the section directories of the man pages, like man1/tool.1.gz.
+func ManPagesPath(artifact string) string {
+	return artifactBase(artifact) + ".man.tar"
+}
+
+// manPageLocation returns the file location bundling the man page in the man directory of the artifact.
+func manPageLocation(page string) v1alpha1.FileLocation {
+	to := manDir + "/"
+	if section := path.Base(path.Dir(page)); len(section) > len(manDir) && strings.HasPrefix(section, manDir) {
+		to = path.Join(manDir, section) + "/"
+	}
+	return v1alpha1.FileLocation{From: page, To: to, Optional: true}
+}
+
+// withManPages returns the platform with the file locations of its man pages appended to its files.
+func withManPages(platform v1alpha1.PluginPlatform) v1alpha1.PluginPlatform {
+	if len(platform.ManPages) == 0 {
+		return platform
+	}
+	files := append([]v1alpha1.FileLocation{}, platform.Files...)
+	for _, page := range platform.ManPages {
+		files = append(files, manPageLocation(page))
+	}
+	platform.Files = files
+	return platform
+}
+
+// storeManPages stores the man pages bundled in the artifact in a tar archive next to it.
+func storeManPages(artifact string, format v1alpha1.ArchiveFormat) error {
+	f, err := newRawFile(ManPagesPath(artifact))
+	if err != nil {
+		return err
+	}
+	defer f.close()
+	tw := tar.NewWriter(io.MultiWriter(f.file, f.hash))
+	err = forEachArtifactFile(artifact, format, func(header *tar.Header, contents io.Reader) error {
+		name, ok := strings.CutPrefix(header.Name, manDir+"/")
+		if !ok {
+			return nil
+		}
+		f.found = true
+		if err := tw.WriteHeader(&tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     name,
+			Size:     header.Size,
+			Mode:     header.Mode,
+			ModTime:  artifactModTime,
+			Uid:      ArtifactUID,
+			Gid:      ArtifactGID,
+			Uname:    ArtifactUname,
+			Gname:    ArtifactGname,
+		}); err != nil {
+			return err
+		}
+		_, err := io.Copy(tw, contents)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return f.store()
+}
@@ -0,0 +1,94 @@
+package image
+
+import (
+	"context"
+	"io"
+	"sync"
+
+	"golang.org/x/sync/semaphore"
+
+	"github.com/openshift/cli-manager/api/v1alpha1"
+)
+
+const (
+	// streamMemory is the estimated memory of the streams of an extraction, which are the
+	// decompressor of the layer, the tar reader, the compressor of the artifact and the
+	// copy buffer. The files are streamed through them and never read in memory as a whole,
+	// except for the placeholders substituted in files up to maxSubstituteSize.
+	streamMemory = 4 << 20
+
+	// copyBufferSize is the size of the buffers the files are copied to the artifact with.
+	copyBufferSize = 32 << 10
+
+	// maxChunkSize is the maximum size of the chunks of the eStargz layers, which are read
+	// in memory to be verified.
+	maxChunkSize = 16 << 20
+
+	// zstdMemory is the estimated memory of the zstd encoder of the tar.zst variants.
+	zstdMemory = 8 << 20
+)
+
+// MemoryBudget is the memory in bytes the extractions running at once may use, unlimited if zero.
+var MemoryBudget int64
+
+var (
+	memoryMu sync.Mutex
+	// memoryReservations is the semaphore of memoryBudget, recreated if MemoryBudget changes
+	memoryReservations *semaphore.Weighted
+	memoryBudget       int64
+)
+
+var copyBuffers = sync.Pool{
+	New: func() interface{} {
+		buf := make([]byte, copyBufferSize)
+		return &buf
+	},
+}
+
+// extractionMemory returns the estimated memory of the extraction of the platform.
+func extractionMemory(platform v1alpha1.PluginPlatform, lazy bool) int64 {
+	memory := int64(streamMemory)
+	if lazy {
+		memory += maxChunkSize
+	}
+	if ZstdArtifacts && ArchiveFormat(platform) == v1alpha1.ArchiveFormatTarGz {
+		memory += zstdMemory
+	}
+	for _, f := range platform.Files {
+		for _, t := range f.Transforms {
+			if t.Type == v1alpha1.FileTransformSubstitute {
+				return memory + maxSubstituteSize
+			}
+		}
+	}
+	return memory
+}
+
+// reserveMemory waits until the memory is available within MemoryBudget and reserves it.
+func reserveMemory(ctx context.Context, memory int64) (func(), error) {
+	budget := MemoryBudget
+	if budget <= 0 {
+		return func() {}, nil
+	}
+	memory = min(memory, budget)
+	memoryMu.Lock()
+	if memoryReservations == nil || memoryBudget != budget {
+		memoryReservations, memoryBudget = semaphore.NewWeighted(budget), budget
+	}
+	reservations := memoryReservations
+	memoryMu.Unlock()
+	if err := reservations.Acquire(ctx, memory); err != nil {
+		return nil, err
+	}
+	return func() {
+		reservations.Release(memory)
+	}, nil
+}
+
+// copyBuffered copies the contents with a pooled buffer, rather than a buffer allocated for every file.
+func copyBuffered(dst io.Writer, src io.Reader) error {
+	buf := copyBuffers.Get().(*[]byte)
+	defer copyBuffers.Put(buf)
+	_, err := io.CopyBuffer(dst, src, *buf)
+	return err
+}
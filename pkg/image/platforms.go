@@ -0,0 +1,95 @@
+package image
+
+import (
+	"bytes"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+// Platforms returns the os/arch platforms the image is built for.
+func Platforms(src string, opts PullOptions) ([]string, error) {
+	var index *v1.IndexManifest
+	switch {
+	case strings.HasPrefix(src, OCIArchivePrefix):
+		path, err := localImagePath(strings.TrimPrefix(src, OCIArchivePrefix))
+		if err != nil {
+			return nil, err
+		}
+		raw, err := (&ociArchive{path: path}).readAll("index.json")
+		if err != nil {
+			return nil, err
+		}
+		index, err = v1.ParseIndexManifest(bytes.NewReader(raw))
+		if err != nil {
+			return nil, fmt.Errorf("parsing index of %s: %w", path, err)
+		}
+	case IsLocal(src) || IsConfigMap(src) || IsImageStreamTag(src):
+		// the docker-archives hold a single image, the other sources are not images of any registry
+	default:
+		ref, err := name.ParseReference(src)
+		if err != nil {
+			return nil, err
+		}
+		done, err := allowPull(ref.Context().RegistryStr())
+		if err != nil {
+			return nil, err
+		}
+		transport, err := newTransport(opts)
+		if err != nil {
+			return nil, err
+		}
+		remoteOptions := []remote.Option{remote.WithTransport(transport), remote.WithAuthFromKeychain(authn.DefaultKeychain)}
+		if len(opts.Auth) > 0 {
+			remoteOptions = []remote.Option{remote.WithTransport(transport), remote.WithAuth(authn.FromConfig(authn.AuthConfig{Auth: opts.Auth}))}
+		}
+		desc, err := remote.Get(ref, remoteOptions...)
+		done(err)
+		if err != nil {
+			return nil, err
+		}
+		if desc.MediaType.IsIndex() {
+			if index, err = v1.ParseIndexManifest(bytes.NewReader(desc.Manifest)); err != nil {
+				return nil, fmt.Errorf("parsing index of %s: %w", src, err)
+			}
+		}
+	}
+	if platforms := indexPlatforms(index); len(platforms) > 0 {
+		return platforms, nil
+	}
+	if IsConfigMap(src) || IsImageStreamTag(src) {
+		return nil, fmt.Errorf("platforms of %s can not be listed", src)
+	}
+	img, err := Pull(src, opts)
+	if err != nil {
+		return nil, err
+	}
+	config, err := img.ConfigFile()
+	if err != nil {
+		return nil, err
+	}
+	return []string{config.OS + "/" + config.Architecture}, nil
+}
+
+// indexPlatforms returns the os/arch platforms of the manifests of the index in order.
+func indexPlatforms(index *v1.IndexManifest) []string {
+	if index == nil {
+		return nil
+	}
+	var platforms []string
+	for _, desc := range index.Manifests {
+		if desc.Platform == nil || len(desc.Platform.OS) == 0 || desc.Platform.OS == "unknown" {
+			continue
+		}
+		platform := desc.Platform.OS + "/" + desc.Platform.Architecture
+		if !slices.Contains(platforms, platform) {
+			platforms = append(platforms, platform)
+		}
+	}
+	return platforms
+}
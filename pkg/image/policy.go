@@ -0,0 +1,72 @@
+package image
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+)
+
+var (
+	// AllowedRegistries are the registry prefixes (i.e. quay.io or quay.io/org) plugin images
+	// may be pulled from. All registries are allowed if empty.
+	AllowedRegistries []string
+	// BlockedRegistries are the registry prefixes plugin images must not be pulled from.
+	// They take precedence over AllowedRegistries.
+	BlockedRegistries []string
+)
+
+// RegistryPolicyError is returned when the image is not allowed by the registry policy.
+type RegistryPolicyError struct {
+	Image  string
+	Reason string
+}
+
+func (e *RegistryPolicyError) Error() string {
+	return fmt.Sprintf("image %s is not allowed: %s", e.Image, e.Reason)
+}
+
+// CheckRegistryPolicy validates the image reference against AllowedRegistries and BlockedRegistries.
+func CheckRegistryPolicy(src string) error {
+	if IsLocal(src) || IsConfigMap(src) || (len(AllowedRegistries) == 0 && len(BlockedRegistries) == 0) {
+		return nil
+	}
+	ref, err := name.ParseReference(src)
+	if err != nil {
+		return &RegistryPolicyError{Image: src, Reason: err.Error()}
+	}
+	repository := ref.Context().Name()
+	for _, prefix := range BlockedRegistries {
+		if matchesRegistryPrefix(repository, prefix) {
+			return &RegistryPolicyError{Image: src, Reason: fmt.Sprintf("registry %s is blocked", prefix)}
+		}
+	}
+	if len(AllowedRegistries) == 0 {
+		return nil
+	}
+	for _, prefix := range AllowedRegistries {
+		if matchesRegistryPrefix(repository, prefix) {
+			return nil
+		}
+	}
+	return &RegistryPolicyError{Image: src, Reason: fmt.Sprintf("registry is not one of the allowed %s", strings.Join(AllowedRegistries, ", "))}
+}
+
+// matchesRegistryPrefix reports whether the repository is under the prefix on
+// path segment boundaries, so that quay.io/org does not match quay.io/organization.
+func matchesRegistryPrefix(repository, prefix string) bool {
+	prefix = strings.TrimSuffix(prefix, "/")
+	if len(prefix) == 0 {
+		return false
+	}
+	// normalize the registry of the prefix the same way as the repository, i.e. docker.io to index.docker.io
+	registry, path, _ := strings.Cut(prefix, "/")
+	if r, err := name.NewRegistry(registry); err == nil {
+		registry = r.Name()
+	}
+	prefix = registry
+	if len(path) > 0 {
+		prefix += "/" + path
+	}
+	return repository == prefix || strings.HasPrefix(repository, prefix+"/")
+}
@@ -0,0 +1,223 @@
+package image
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"k8s.io/klog/v2"
+)
+
+// SBOMs extracts the SBOM of the plugin images next to their artifacts.
+var SBOMs bool
+
+const (
+	SBOMFormatSPDX      = "SPDX"
+	SBOMFormatCycloneDX = "CycloneDX"
+
+	// maxSBOMSize bounds the size of the SBOMs extracted, the larger ones are ignored.
+	maxSBOMSize = 64 << 20
+)
+
+// sbomFormats are the SBOM formats with the suffix of their files next to the artifacts,
+// and their media type.
+var sbomFormats = []struct {
+	format    string
+	suffix    string
+	mediaType string
+}{
+	{SBOMFormatSPDX, ".spdx.json", "application/spdx+json"},
+	{SBOMFormatCycloneDX, ".cdx.json", "application/vnd.cyclonedx+json"},
+}
+
+// sbomDirs are the directories of the image the SBOMs are looked up in.
+var sbomDirs = []string{".", "sbom", "usr/share/sbom"}
+
+// SBOM is the SBOM extracted next to an artifact.
+type SBOM struct {
+	// Format is SPDX or CycloneDX
+	Format string
+	// Path is the file of the SBOM
+	Path string
+	// Sha256 is the checksum of the file in hex format
+	Sha256 string
+}
+
+// SBOMPath returns the path of the SBOM of the artifact in the format.
+func SBOMPath(artifact, format string) string {
+	base := artifactBase(artifact)
+	for _, f := range sbomFormats {
+		if f.format == format {
+			return base + f.suffix
+		}
+	}
+	return base + ".sbom.json"
+}
+
+// SBOMMediaType returns the media type of the SBOM format.
+func SBOMMediaType(format string) string {
+	for _, f := range sbomFormats {
+		if f.format == format {
+			return f.mediaType
+		}
+	}
+	return "application/json"
+}
+
+// SBOMSuffixes returns the suffixes of the SBOM files next to the artifacts, without the leading dot.
+func SBOMSuffixes() []string {
+	var suffixes []string
+	for _, f := range sbomFormats {
+		suffixes = append(suffixes, strings.TrimPrefix(f.suffix, "."))
+	}
+	return suffixes
+}
+
+// FindSBOM returns the SBOM extracted next to the artifact, or nil if it has none.
+func FindSBOM(artifact string) (*SBOM, error) {
+	for _, f := range sbomFormats {
+		p := SBOMPath(artifact, f.format)
+		checksum, err := os.ReadFile(ChecksumPath(p))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return &SBOM{Format: f.format, Path: p, Sha256: strings.TrimSpace(string(checksum))}, nil
+	}
+	return nil, nil
+}
+
+// sbomFormat returns the format of the file of the image if it is an SBOM in one of the sbomDirs.
+func sbomFormat(name string) (string, bool) {
+	if !slices.Contains(sbomDirs, path.Dir(name)) {
+		return "", false
+	}
+	base := path.Base(name)
+	switch {
+	case strings.HasSuffix(base, ".spdx.json"):
+		return SBOMFormatSPDX, true
+	case strings.HasSuffix(base, ".cdx.json"), strings.HasSuffix(base, ".cyclonedx.json"), base == "bom.json":
+		return SBOMFormatCycloneDX, true
+	}
+	return "", false
+}
+
+// sbomCapture writes the SBOM found for the artifact aside, until the artifact is stored.
+type sbomCapture struct {
+	artifact string
+	// format, written and checksum are set once the SBOM is found
+	format   string
+	written  string
+	checksum string
+}
+
+func (c *sbomCapture) found() bool {
+	return len(c.written) > 0
+}
+
+// write writes the SBOM in the format aside.
+func (c *sbomCapture) write(format string, contents io.Reader) error {
+	written := SBOMPath(c.artifact, format) + partialSuffix
+	f, err := os.Create(written)
+	if err != nil {
+		return err
+	}
+	hash := sha256.New()
+	n, err := io.Copy(io.MultiWriter(f, hash), io.LimitReader(contents, maxSBOMSize+1))
+	if err == nil && n > maxSBOMSize {
+		err = fmt.Errorf("SBOM exceeds the limit of %d bytes", maxSBOMSize)
+	}
+	if err == nil {
+		err = syncClose(f)
+	} else {
+		f.Close()
+	}
+	if err != nil {
+		os.Remove(written)
+		return err
+	}
+	c.format, c.written, c.checksum = format, written, hex.EncodeToString(hash.Sum(nil))
+	return nil
+}
+
+// store stores the SBOM next to the artifact, and removes the SBOMs of the previous extractions.
+func (c *sbomCapture) store() error {
+	for _, f := range sbomFormats {
+		if f.format == c.format {
+			continue
+		}
+		if err := RemoveArtifact(SBOMPath(c.artifact, f.format)); err != nil {
+			return err
+		}
+	}
+	if !c.found() {
+		return nil
+	}
+	return storeArtifact(c.written, SBOMPath(c.artifact, c.format), c.checksum)
+}
+
+// discard removes the SBOM written aside, if any.
+func (c *sbomCapture) discard() {
+	if c.found() {
+		os.Remove(c.written)
+	}
+}
+
+// referrerSBOM writes the first SBOM attached to the image with the OCI referrers API, if any.
+func (i *remoteImage) referrerSBOM(c *sbomCapture) error {
+	d, err := i.Digest()
+	if err != nil {
+		return err
+	}
+	options := []remote.Option{remote.WithAuth(i.auth), remote.WithTransport(i.inner)}
+	index, err := remote.Referrers(i.repository.Digest(d.String()), options...)
+	if err != nil {
+		return err
+	}
+	manifest, err := index.IndexManifest()
+	if err != nil {
+		return err
+	}
+	for _, desc := range manifest.Manifests {
+		format := ""
+		for _, f := range sbomFormats {
+			if f.mediaType == desc.ArtifactType {
+				format = f.format
+			}
+		}
+		if len(format) == 0 {
+			continue
+		}
+		artifact, err := remote.Image(i.repository.Digest(desc.Digest.String()), options...)
+		if err != nil {
+			return err
+		}
+		artifactManifest, err := artifact.Manifest()
+		if err != nil {
+			return err
+		}
+		if len(artifactManifest.Layers) == 0 || artifactManifest.Layers[0].Size > maxSBOMSize {
+			klog.V(2).Infof("SBOM %s of image %s is skipped", desc.Digest, i.repository)
+			continue
+		}
+		layer, err := remote.Layer(i.repository.Digest(artifactManifest.Layers[0].Digest.String()), options...)
+		if err != nil {
+			return err
+		}
+		contents, err := layer.Compressed()
+		if err != nil {
+			return err
+		}
+		defer contents.Close()
+		return c.write(format, contents)
+	}
+	return nil
+}
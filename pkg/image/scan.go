@@ -0,0 +1,114 @@
+package image
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/openshift/cli-manager/api/v1alpha1"
+)
+
+var (
+	// ScanWebhookURL is the webhook every artifact is streamed to before it is published, i.e. a
+	// malware scanner like ClamAV behind an HTTP adapter. The artifacts are not scanned if empty.
+	ScanWebhookURL string
+	// ScanWebhookCAFile is the PEM bundle trusted for the scan webhook in addition to the system roots.
+	ScanWebhookCAFile string
+	// ScanTimeout bounds the scan of an artifact.
+	ScanTimeout = 5 * time.Minute
+)
+
+// maxScanResponseSize bounds the size of the responses of the scan webhook.
+const maxScanResponseSize = 4096
+
+// ArtifactRejectedError is returned by Extract when the scan webhook rejects the artifact.
+type ArtifactRejectedError struct {
+	// Reason is the response of the webhook.
+	Reason string
+}
+
+func (e *ArtifactRejectedError) Error() string {
+	if len(e.Reason) == 0 {
+		return "artifact is rejected by the scan webhook"
+	}
+	return fmt.Sprintf("artifact is rejected by the scan webhook: %s", e.Reason)
+}
+
+// scanArtifact streams the written artifact to the scan webhook.
+func scanArtifact(written, destinationName, checksum string, format v1alpha1.ArchiveFormat) error {
+	if len(ScanWebhookURL) == 0 {
+		return nil
+	}
+	f, err := os.Open(written)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), ScanTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, ScanWebhookURL, f)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = info.Size()
+	req.Header.Set("Content-Type", "application/gzip")
+	if format == v1alpha1.ArchiveFormatZip {
+		req.Header.Set("Content-Type", "application/zip")
+	}
+	req.Header.Set("X-Artifact-Name", filepath.Base(destinationName))
+	req.Header.Set("X-Artifact-Sha256", checksum)
+
+	client, err := newScanClient()
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("scanning artifact: %w", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxScanResponseSize))
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusNoContent:
+		return nil
+	case http.StatusForbidden:
+		return &ArtifactRejectedError{Reason: strings.TrimSpace(string(body))}
+	}
+	return fmt.Errorf("scanning artifact: webhook returned %s: %s", resp.Status, strings.TrimSpace(string(body)))
+}
+
+func newScanClient() (*http.Client, error) {
+	tlsConfig := &tls.Config{
+		MinVersion:   TLSMinVersion,
+		CipherSuites: TLSCipherSuites,
+	}
+	if len(ScanWebhookCAFile) > 0 {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		ca, err := os.ReadFile(ScanWebhookCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading scan webhook CA bundle: %w", err)
+		}
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("no certificates found in %s", ScanWebhookCAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	return &http.Client{Transport: transport}, nil
+}
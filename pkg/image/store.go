@@ -0,0 +1,206 @@
+package image
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+
+	"k8s.io/klog/v2"
+)
+
+// StoreDir is the directory next to the artifacts holding their contents by sha256 digest.
+const StoreDir = "blobs/sha256"
+
+const (
+	// partialSuffix is the suffix of the artifacts and the checksum files being written, which are
+	// renamed once complete so that the server never serves a partially written file.
+	partialSuffix = ".partial"
+	// spoolSuffix is the suffix of the files of the artifacts being written, see sortedWriter
+	spoolSuffix = ".files"
+	// linkSuffix is the suffix of the links to the contents being renamed over the artifacts.
+	linkSuffix = ".link"
+)
+
+// storeLock serializes the changes of the links, so that a content is not removed while it is linked.
+var storeLock sync.Mutex
+
+// storePath returns the path of the content of the digest in the store of the artifacts of the directory.
+func storePath(dir, checksum string) string {
+	return filepath.Join(dir, StoreDir, checksum)
+}
+
+// storeArtifact moves the written artifact into the store under its checksum and links the artifact to it.
+func storeArtifact(written, artifact, checksum string) error {
+	dir := filepath.Dir(artifact)
+	content := storePath(dir, checksum)
+	if err := os.MkdirAll(filepath.Dir(content), 0755); err != nil {
+		return err
+	}
+
+	storeLock.Lock()
+	defer storeLock.Unlock()
+	previous, _ := os.ReadFile(ChecksumPath(artifact))
+	if _, err := os.Stat(content); err == nil {
+		if err := os.Remove(written); err != nil {
+			return err
+		}
+	} else if err := os.Rename(written, content); err != nil {
+		return err
+	}
+	link := artifact + linkSuffix
+	os.Remove(link)
+	if err := os.Link(content, link); err != nil {
+		return err
+	}
+	if err := os.Rename(link, artifact); err != nil {
+		os.Remove(link)
+		return err
+	}
+	if err := writeFileAtomic(ChecksumPath(artifact), []byte(checksum+"\n")); err != nil {
+		return err
+	}
+	if err := syncDir(dir); err != nil {
+		return err
+	}
+	if previous := strings.TrimSpace(string(previous)); len(previous) > 0 && previous != checksum {
+		return releaseContent(storePath(dir, previous))
+	}
+	return nil
+}
+
+// writeFileAtomic writes the file aside, flushes it and renames it over the file.
+func writeFileAtomic(name string, data []byte) error {
+	written := name + partialSuffix
+	f, err := os.OpenFile(written, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(written)
+		return err
+	}
+	if err := syncClose(f); err != nil {
+		os.Remove(written)
+		return err
+	}
+	if err := os.Rename(written, name); err != nil {
+		os.Remove(written)
+		return err
+	}
+	return nil
+}
+
+// syncClose flushes the file to disk and closes it.
+func syncClose(f *os.File) error {
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// syncDir flushes the entries of the directory, so that the renames in it survive a crash.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	return syncClose(d)
+}
+
+// RemoveTemporaryFiles removes the files left partially written in the directory by a crash.
+func RemoveTemporaryFiles(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || (!strings.HasSuffix(name, partialSuffix) && !strings.HasSuffix(name, linkSuffix)) {
+			continue
+		}
+		klog.Infof("removing temporary file %s", name)
+		if err := os.Remove(filepath.Join(dir, name)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// RemoveArtifact removes the artifact and its checksum file, and its content if no longer referenced.
+func RemoveArtifact(artifact string) error {
+	storeLock.Lock()
+	defer storeLock.Unlock()
+	checksum, _ := os.ReadFile(ChecksumPath(artifact))
+	if err := os.Remove(artifact); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	os.Remove(ChecksumPath(artifact))
+	if checksum := strings.TrimSpace(string(checksum)); len(checksum) > 0 {
+		return releaseContent(storePath(filepath.Dir(artifact), checksum))
+	}
+	return nil
+}
+
+// UnreferencedContents returns the contents of the store of the directory no artifact links to.
+func UnreferencedContents(dir string) ([]string, error) {
+	entries, err := os.ReadDir(filepath.Join(dir, StoreDir))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var contents []string
+	for _, entry := range entries {
+		content := filepath.Join(dir, StoreDir, entry.Name())
+		if links, err := linkCount(content); err == nil && links <= 1 {
+			contents = append(contents, content)
+		}
+	}
+	return contents, nil
+}
+
+// PruneContent removes the content if it is still not referenced.
+func PruneContent(content string) error {
+	storeLock.Lock()
+	defer storeLock.Unlock()
+	return releaseContent(content)
+}
+
+// releaseContent removes the content once the store holds its only link.
+func releaseContent(content string) error {
+	links, err := linkCount(content)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if links > 1 {
+		return nil
+	}
+	if err := os.Remove(content); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func linkCount(path string) (uint64, error) {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return 0, err
+	}
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, errors.New("link count is not supported")
+	}
+	return uint64(stat.Nlink), nil
+}
@@ -0,0 +1,173 @@
+package image
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"k8s.io/klog/v2"
+
+	"github.com/openshift/cli-manager/api/v1alpha1"
+)
+
+// maxLinkHops bounds the chains of links, like the symlink loop limit of Linux.
+const maxLinkHops = 40
+
+// link is a target found as a symbolic or hard link, or below a symbolic link to a directory.
+type link struct {
+	target      v1alpha1.FileLocation
+	name        string
+	archiveName string
+	// path is the file the link points to, resolved so far
+	path string
+	// layer is the topmost layer path is looked up in. A hard link points to the file of its layer or
+	// of the lower layers, even if the upper layers replace or delete it, and a symbolic link to the
+	// file of the top layer.
+	layer int
+	hops  int
+}
+
+// linkPath returns the path the link of the layer points to, relative to the root.
+func linkPath(header *tar.Header) string {
+	linkname := header.Linkname
+	if header.Typeflag == tar.TypeSymlink && !path.IsAbs(linkname) {
+		linkname = path.Join(path.Dir(header.Name), linkname)
+	}
+	// the links can not point above the root
+	p := path.Clean("/" + linkname)
+	return strings.TrimPrefix(p, "/")
+}
+
+// linkLayer returns the topmost layer the path the link of the layer points to is looked up in.
+func (e *extraction) linkLayer(header *tar.Header, layer int) int {
+	if header.Typeflag == tar.TypeLink {
+		return layer
+	}
+	return e.top
+}
+
+// addLink records the link if it is a target, or a symbolic link to a directory a target is in.
+func (e *extraction) addLink(name string, header *tar.Header) error {
+	if target, archiveName, ok := e.target(name); ok {
+		if err := e.reserve(target, name, archiveName); err != nil {
+			return err
+		}
+		e.linked[target.From] = struct{}{}
+		e.links = append(e.links, &link{target: target, name: name, archiveName: archiveName, path: linkPath(header), layer: e.linkLayer(header, e.layer), hops: 1})
+		return nil
+	}
+	if header.Typeflag != tar.TypeSymlink || e.deleted(name) {
+		return nil
+	}
+	// the files below the symbolic link are not in the lower layers
+	for _, f := range e.files {
+		from := strings.Trim(f.From, "/")
+		_, found := e.found[f.From]
+		_, linked := e.linked[f.From]
+		if isGlob(from) || found || linked || !strings.HasPrefix(from, name+"/") {
+			continue
+		}
+		archiveName := archivePath(f, f.From)
+		if err := e.reserve(f, from, archiveName); err != nil {
+			return err
+		}
+		e.linked[f.From] = struct{}{}
+		e.links = append(e.links, &link{target: f, name: from, archiveName: archiveName, path: path.Join(linkPath(header), strings.TrimPrefix(from, name+"/")), layer: e.top, hops: 1})
+	}
+	return nil
+}
+
+// resolveLinks copies the files the links point to, following the chains of links across the layers.
+func (e *extraction) resolveLinks(layers int, visitLayer func(i int, wants func(name string) bool, visit visitFunc) error) error {
+	for len(e.links) > 0 {
+		// whiteouts are the whiteouts of the layers read in this pass
+		whiteouts := make([]whiteouts, layers)
+		// deleted reports whether the path of the link is deleted by the layers above the layer, up to its topmost layer
+		deleted := func(l *link, layer int) bool {
+			for i := layer + 1; i <= l.layer; i++ {
+				if whiteouts[i].isDeleted(l.path) {
+					return true
+				}
+			}
+			return false
+		}
+		top := 0
+		for _, l := range e.links {
+			top = max(top, l.layer)
+		}
+		// settled are the links whose path is found in this pass, and next the ones to resolve in the next pass
+		settled := map[*link]bool{}
+		var next []*link
+		for i := top; i >= 0 && len(settled) < len(e.links); i-- {
+			layerWhiteouts := newWhiteouts()
+			// the contents of the files the links point to are read
+			wants := func(name string) bool {
+				for _, l := range e.links {
+					if !settled[l] && l.layer >= i && l.path == name {
+						return true
+					}
+				}
+				return false
+			}
+			err := visitLayer(i, wants, func(header *tar.Header, contents io.Reader) (bool, error) {
+				name := header.Name
+				if isWhiteout(name) {
+					layerWhiteouts.add(name)
+					return true, nil
+				}
+				copied := false
+				for _, l := range e.links {
+					if settled[l] || l.layer < i || deleted(l, i) {
+						continue
+					}
+					if l.path == name {
+						settled[l] = true
+						switch header.Typeflag {
+						case tar.TypeReg:
+							if copied {
+								// the contents are read once, the other links to the file are copied in the next pass
+								next = append(next, l)
+								continue
+							}
+							copied = true
+							if err := e.write(l.target, l.name, l.archiveName, header, contents); err != nil {
+								return false, err
+							}
+							e.found[l.target.From] = struct{}{}
+						case tar.TypeSymlink, tar.TypeLink:
+							l.path = linkPath(header)
+							l.layer = e.linkLayer(header, i)
+							l.hops++
+							next = append(next, l)
+						default:
+							if err := checkPrivileged(name, header); err != nil {
+								return false, err
+							}
+							klog.V(2).Infof("%s links to %s, which is not a regular file", l.name, name)
+						}
+					} else if header.Typeflag == tar.TypeSymlink && strings.HasPrefix(l.path, name+"/") {
+						settled[l] = true
+						l.path = path.Join(linkPath(header), strings.TrimPrefix(l.path, name+"/"))
+						l.layer = e.top
+						l.hops++
+						next = append(next, l)
+					}
+				}
+				return len(settled) < len(e.links), nil
+			})
+			if err != nil {
+				return err
+			}
+			whiteouts[i] = layerWhiteouts
+		}
+		for _, l := range next {
+			if l.hops > maxLinkHops {
+				return fmt.Errorf("too many levels of links resolving %s", l.name)
+			}
+		}
+		e.links = next
+	}
+	return nil
+}
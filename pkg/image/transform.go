@@ -0,0 +1,99 @@
+package image
+
+import (
+	"archive/tar"
+	"bytes"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/openshift/cli-manager/api/v1alpha1"
+)
+
+// PlaceholderClusterAPIURL is the placeholder of the URL of the cluster API server.
+const PlaceholderClusterAPIURL = "CLUSTER_API_URL"
+
+// maxSubstituteSize is the maximum size of the files placeholders are substituted in,
+// since they are read in memory.
+const maxSubstituteSize = 1 << 20
+
+// Placeholders are the values substituted for the ${NAME} placeholders with the Substitute transform.
+var Placeholders map[string]string
+
+// rename returns the path of the file in the artifact with the Rename transforms of f applied.
+func rename(f v1alpha1.FileLocation, p string) string {
+	for _, t := range f.Transforms {
+		if t.Type == v1alpha1.FileTransformRename {
+			p = path.Join(path.Dir(p), t.Name)
+		}
+	}
+	return p
+}
+
+// validateTransforms rejects the transforms that can not be applied.
+func validateTransforms(f v1alpha1.FileLocation) error {
+	for _, t := range f.Transforms {
+		switch t.Type {
+		case v1alpha1.FileTransformRename:
+			if len(t.Name) == 0 || t.Name == "." || t.Name == ".." || strings.Contains(t.Name, "/") {
+				return fmt.Errorf("invalid name %q to rename %s to, should be a base name", t.Name, f.From)
+			}
+		case v1alpha1.FileTransformChmod:
+			if _, err := parseMode(t.Mode); err != nil {
+				return fmt.Errorf("invalid mode of %s: %w", f.From, err)
+			}
+		case v1alpha1.FileTransformSubstitute:
+		default:
+			return fmt.Errorf("unknown transform %q of %s", t.Type, f.From)
+		}
+	}
+	return nil
+}
+
+func parseMode(mode string) (int64, error) {
+	m, err := strconv.ParseInt(mode, 8, 64)
+	if err != nil || m < 0 || m > 0o777 {
+		return 0, fmt.Errorf("%q should be octal permission bits, like 0644", mode)
+	}
+	return m, nil
+}
+
+// transform applies the Chmod and Substitute transforms of f to the header and the contents of the file.
+func transform(f v1alpha1.FileLocation, header *tar.Header, contents io.Reader) (io.Reader, error) {
+	for _, t := range f.Transforms {
+		switch t.Type {
+		case v1alpha1.FileTransformChmod:
+			mode, err := parseMode(t.Mode)
+			if err != nil {
+				return nil, err
+			}
+			header.Mode = header.Mode&^0o777 | mode
+		case v1alpha1.FileTransformSubstitute:
+			if header.Size > maxSubstituteSize {
+				return nil, fmt.Errorf("%s is too large to substitute placeholders in, %d bytes exceeds %d bytes", header.Name, header.Size, maxSubstituteSize)
+			}
+			data, err := io.ReadAll(contents)
+			if err != nil {
+				return nil, err
+			}
+			data = substitute(data, Placeholders)
+			header.Size = int64(len(data))
+			contents = bytes.NewReader(data)
+		}
+	}
+	return contents, nil
+}
+
+// substitute replaces the ${NAME} placeholders in data with their values.
+func substitute(data []byte, values map[string]string) []byte {
+	if len(values) == 0 {
+		return data
+	}
+	oldnew := make([]string, 0, 2*len(values))
+	for name, value := range values {
+		oldnew = append(oldnew, "${"+name+"}", value)
+	}
+	return []byte(strings.NewReplacer(oldnew...).Replace(string(data)))
+}
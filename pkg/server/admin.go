@@ -0,0 +1,73 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	authorizationv1 "k8s.io/api/authorization/v1"
+	"k8s.io/klog/v2"
+)
+
+// authorizeAdmin checks with a SubjectAccessReview that the user of the request
+// is allowed to perform the verb on all plugins.
+func (s *Server) authorizeAdmin(w http.ResponseWriter, r *http.Request, verb string) bool {
+	user := userFrom(r.Context())
+	if user == nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return false
+	}
+	allowed, err := s.authorize(r.Context(), user, &authorizationv1.ResourceAttributes{
+		Verb:     verb,
+		Group:    pluginsGVR.Group,
+		Version:  pluginsGVR.Version,
+		Resource: pluginsGVR.Resource,
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return false
+	}
+	if !allowed {
+		http.Error(w, fmt.Sprintf("user %s cannot %s plugins", user.Username, verb), http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// handleFsck reports the inconsistencies between the Plugins, their artifacts and the indexes.
+// GET only checks and requires the list permission on plugins, POST with repair=true
+// repairs the inconsistencies as well and requires the update permission.
+func (s *Server) handleFsck(w http.ResponseWriter, r *http.Request) {
+	var repair bool
+	switch r.Method {
+	case http.MethodGet:
+		if !s.authorizeAdmin(w, r, "list") {
+			return
+		}
+	case http.MethodPost:
+		var err error
+		repair, err = strconv.ParseBool(r.URL.Query().Get("repair"))
+		if err != nil {
+			http.Error(w, "invalid repair parameter", http.StatusBadRequest)
+			return
+		}
+		verb := "list"
+		if repair {
+			verb = "update"
+		}
+		if !s.authorizeAdmin(w, r, verb) {
+			return
+		}
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	report, err := s.controller.Fsck(r.Context(), repair)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	klog.Infof("fsck by %s found %d issues, repair %t", userFrom(r.Context()).Username, len(report.Issues), repair)
+	writeJSON(w, http.StatusOK, report)
+}
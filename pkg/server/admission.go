@@ -0,0 +1,172 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+
+	"github.com/openshift/cli-manager/api/v1alpha1"
+	"github.com/openshift/cli-manager/pkg/controller"
+)
+
+const (
+	// ValidatingWebhookPath is the path of the validating admission webhook of the Plugins.
+	ValidatingWebhookPath = "/validate-plugins"
+	// DefaultingWebhookPath is the path of the mutating admission webhook setting the defaults of the Plugins.
+	DefaultingWebhookPath = "/default-plugins"
+	// ConversionWebhookPath is the path of the conversion webhook of the Plugins between the API versions.
+	ConversionWebhookPath = "/convert-plugins"
+
+	// maxAdmissionReviewSize bounds the size of the admission reviews, which hold the Plugin twice on updates.
+	maxAdmissionReviewSize = 8 << 20
+)
+
+// RegisterWebhookHandlers registers the admission and conversion webhooks into the mux, which is
+// served over HTTPS to the API server. The webhooks do not depend on the informers, as the API server
+// calls the conversion webhook to serve the informers of the controller themselves.
+func RegisterWebhookHandlers(mux *http.ServeMux) {
+	mux.Handle(ValidatingWebhookPath, instrument("validate", http.HandlerFunc(handleValidate)))
+	mux.Handle(DefaultingWebhookPath, instrument("default", http.HandlerFunc(handleDefault)))
+	mux.Handle(ConversionWebhookPath, instrument("convert", http.HandlerFunc(handleConvert)))
+}
+
+// handleValidate rejects the Plugins whose spec is invalid, see controller.ValidatePlugin.
+func handleValidate(w http.ResponseWriter, r *http.Request) {
+	review, ok := readAdmissionReview(w, r)
+	if !ok {
+		return
+	}
+	review.Response = validatePlugin(review.Request)
+	writeAdmissionReview(w, review)
+}
+
+// validatePlugin returns the admission response of the request. The updates keeping the spec
+// unchanged are allowed, so that the Plugins created before the webhook, or invalidated by
+// a stricter registry policy, can still be relabeled, annotated and finalized.
+func validatePlugin(request *admissionv1.AdmissionRequest) *admissionv1.AdmissionResponse {
+	response := &admissionv1.AdmissionResponse{UID: request.UID, Allowed: true}
+	if request.Operation != admissionv1.Create && request.Operation != admissionv1.Update {
+		return response
+	}
+	plugin := &v1alpha1.Plugin{}
+	if err := json.Unmarshal(request.Object.Raw, plugin); err != nil {
+		return deny(response, http.StatusBadRequest, metav1.StatusReasonBadRequest, fmt.Sprintf("invalid plugin: %v", err))
+	}
+	if request.Operation == admissionv1.Update {
+		old := &v1alpha1.Plugin{}
+		if err := json.Unmarshal(request.OldObject.Raw, old); err == nil && equality.Semantic.DeepEqual(old.Spec, plugin.Spec) {
+			return response
+		}
+	}
+	if err := controller.ValidatePlugin(plugin); err != nil {
+		klog.V(2).Infof("plugin %s is rejected: %v", plugin.Name, err)
+		return deny(response, http.StatusUnprocessableEntity, metav1.StatusReasonInvalid, fmt.Sprintf("plugin %s is invalid: %v", plugin.Name, err))
+	}
+	return response
+}
+
+// handleDefault sets the defaults of the Plugins, see controller.DefaultPlugin.
+func handleDefault(w http.ResponseWriter, r *http.Request) {
+	review, ok := readAdmissionReview(w, r)
+	if !ok {
+		return
+	}
+	review.Response = defaultPlugin(review.Request)
+	writeAdmissionReview(w, review)
+}
+
+// defaultPlugin returns the admission response of the request, with the JSON patch replacing the
+// defaulted platforms. The updates keeping the spec unchanged are not defaulted again, like they
+// are not validated.
+func defaultPlugin(request *admissionv1.AdmissionRequest) *admissionv1.AdmissionResponse {
+	response := &admissionv1.AdmissionResponse{UID: request.UID, Allowed: true}
+	if request.Operation != admissionv1.Create && request.Operation != admissionv1.Update {
+		return response
+	}
+	plugin := &v1alpha1.Plugin{}
+	if err := json.Unmarshal(request.Object.Raw, plugin); err != nil {
+		return deny(response, http.StatusBadRequest, metav1.StatusReasonBadRequest, fmt.Sprintf("invalid plugin: %v", err))
+	}
+	if request.Operation == admissionv1.Update {
+		old := &v1alpha1.Plugin{}
+		if err := json.Unmarshal(request.OldObject.Raw, old); err == nil && equality.Semantic.DeepEqual(old.Spec, plugin.Spec) {
+			return response
+		}
+	}
+	defaulted := plugin.DeepCopy()
+	if err := controller.DefaultPlugin(defaulted); err != nil {
+		return deny(response, http.StatusUnprocessableEntity, metav1.StatusReasonInvalid, fmt.Sprintf("plugin %s is invalid: %v", plugin.Name, err))
+	}
+	var patch []jsonPatchOperation
+	if !equality.Semantic.DeepEqual(plugin.Spec.Platforms, defaulted.Spec.Platforms) {
+		patch = append(patch, jsonPatchOperation{Op: "replace", Path: "/spec/platforms", Value: defaulted.Spec.Platforms})
+	}
+	for i := range plugin.Spec.Versions {
+		if !equality.Semantic.DeepEqual(plugin.Spec.Versions[i].Platforms, defaulted.Spec.Versions[i].Platforms) {
+			patch = append(patch, jsonPatchOperation{Op: "replace", Path: fmt.Sprintf("/spec/versions/%d/platforms", i), Value: defaulted.Spec.Versions[i].Platforms})
+		}
+	}
+	if len(patch) == 0 {
+		return response
+	}
+	raw, err := json.Marshal(patch)
+	if err != nil {
+		return deny(response, http.StatusInternalServerError, metav1.StatusReasonInternalError, err.Error())
+	}
+	patchType := admissionv1.PatchTypeJSONPatch
+	response.Patch = raw
+	response.PatchType = &patchType
+	return response
+}
+
+// jsonPatchOperation is an operation of a JSON patch, see RFC 6902.
+type jsonPatchOperation struct {
+	Op    string      `json:"op"`
+	Path  string      `json:"path"`
+	Value interface{} `json:"value,omitempty"`
+}
+
+func deny(response *admissionv1.AdmissionResponse, code int32, reason metav1.StatusReason, message string) *admissionv1.AdmissionResponse {
+	response.Allowed = false
+	response.Result = &metav1.Status{
+		Status:  metav1.StatusFailure,
+		Code:    code,
+		Reason:  reason,
+		Message: message,
+	}
+	return response
+}
+
+// readAdmissionReview decodes the admission review of the request, or responds with the error.
+func readAdmissionReview(w http.ResponseWriter, r *http.Request) (*admissionv1.AdmissionReview, bool) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return nil, false
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxAdmissionReviewSize))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("reading the admission review: %v", err), http.StatusRequestEntityTooLarge)
+		return nil, false
+	}
+	review := &admissionv1.AdmissionReview{}
+	if err := json.Unmarshal(body, review); err != nil || review.Request == nil {
+		http.Error(w, "invalid admission review", http.StatusBadRequest)
+		return nil, false
+	}
+	return review, true
+}
+
+// writeAdmissionReview responds with the admission review, keeping the version of the request.
+func writeAdmissionReview(w http.ResponseWriter, review *admissionv1.AdmissionReview) {
+	review.Request = nil
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(review); err != nil {
+		klog.Errorf("writing the admission review error %v", err)
+	}
+}
@@ -0,0 +1,193 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	admissionv1 "k8s.io/api/admission/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/openshift/cli-manager/api/v1alpha1"
+	"github.com/openshift/cli-manager/pkg/image"
+)
+
+// newAdmissionRequest returns the admission request of the operation on the plugin, and on the old one for updates.
+func newAdmissionRequest(t *testing.T, operation admissionv1.Operation, plugin, old *v1alpha1.Plugin) *admissionv1.AdmissionRequest {
+	t.Helper()
+	request := &admissionv1.AdmissionRequest{UID: types.UID("uid-" + plugin.Name), Operation: operation}
+	raw, err := json.Marshal(plugin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	request.Object = runtime.RawExtension{Raw: raw}
+	if old != nil {
+		if request.OldObject.Raw, err = json.Marshal(old); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return request
+}
+
+// newValidPlugin returns the valid plugin of the image.
+func newValidPlugin(name, img string) *v1alpha1.Plugin {
+	plugin := newApplyPlugin(name, img)
+	plugin.Spec.ShortDescription = name
+	plugin.Spec.Platforms[0].Files = []v1alpha1.FileLocation{{From: "/usr/bin/" + name}}
+	return plugin
+}
+
+func TestValidatePlugin(t *testing.T) {
+	blocked := image.BlockedRegistries
+	image.BlockedRegistries = []string{"quay.io/blocked"}
+	defer func() {
+		image.BlockedRegistries = blocked
+	}()
+
+	valid := newValidPlugin("tool", "quay.io/org/tool:v1")
+	blockedRegistry := valid.DeepCopy()
+	blockedRegistry.Spec.Platforms[0].Image = "quay.io/blocked/tool:v1"
+	duplicatePlatforms := valid.DeepCopy()
+	duplicatePlatforms.Spec.Platforms = append(duplicatePlatforms.Spec.Platforms, duplicatePlatforms.Spec.Platforms[0])
+	relabeled := blockedRegistry.DeepCopy()
+	relabeled.Labels = map[string]string{"team": "tools"}
+
+	for name, tc := range map[string]struct {
+		request *admissionv1.AdmissionRequest
+		code    int32
+		message string
+	}{
+		"create":               {request: newAdmissionRequest(t, admissionv1.Create, valid, nil)},
+		"update":               {request: newAdmissionRequest(t, admissionv1.Update, valid, blockedRegistry)},
+		"blocked registry":     {request: newAdmissionRequest(t, admissionv1.Create, blockedRegistry, nil), code: http.StatusUnprocessableEntity, message: "registry quay.io/blocked is blocked"},
+		"blocked registry set": {request: newAdmissionRequest(t, admissionv1.Update, blockedRegistry, valid), code: http.StatusUnprocessableEntity, message: "registry quay.io/blocked is blocked"},
+		"unchanged spec":       {request: newAdmissionRequest(t, admissionv1.Update, relabeled, blockedRegistry)},
+		"duplicate platforms":  {request: newAdmissionRequest(t, admissionv1.Create, duplicatePlatforms, nil), code: http.StatusUnprocessableEntity, message: "platform linux/amd64 is set more than once"},
+		"delete":               {request: &admissionv1.AdmissionRequest{UID: "uid-delete", Operation: admissionv1.Delete}},
+		"undecodable plugin":   {request: &admissionv1.AdmissionRequest{UID: "uid-invalid", Operation: admissionv1.Create, Object: runtime.RawExtension{Raw: []byte("{")}}, code: http.StatusBadRequest, message: "invalid plugin"},
+		"undecodable old spec": {request: &admissionv1.AdmissionRequest{UID: "uid-old", Operation: admissionv1.Update, Object: newAdmissionRequest(t, admissionv1.Create, blockedRegistry, nil).Object, OldObject: runtime.RawExtension{Raw: []byte("{")}}, code: http.StatusUnprocessableEntity, message: "is blocked"},
+	} {
+		response := validatePlugin(tc.request)
+		if response.UID != tc.request.UID {
+			t.Errorf("%s: expected the UID %s, got %s", name, tc.request.UID, response.UID)
+		}
+		if tc.code == 0 {
+			if !response.Allowed {
+				t.Errorf("%s: expected the plugin to be allowed, got %v", name, response.Result)
+			}
+			continue
+		}
+		if response.Allowed || response.Result == nil || response.Result.Code != tc.code || !strings.Contains(response.Result.Message, tc.message) {
+			t.Errorf("%s: expected the plugin to be denied with %d %q, got %v", name, tc.code, tc.message, response.Result)
+		}
+	}
+}
+
+func TestHandleValidate(t *testing.T) {
+	plugin := newValidPlugin("tool", "quay.io/org/tool:v1")
+	review := &admissionv1.AdmissionReview{Request: newAdmissionRequest(t, admissionv1.Create, plugin, nil)}
+	review.APIVersion, review.Kind = admissionv1.SchemeGroupVersion.String(), "AdmissionReview"
+	body, err := json.Marshal(review)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	handleValidate(w, httptest.NewRequest(http.MethodPost, ValidatingWebhookPath, bytes.NewReader(body)))
+	response := &admissionv1.AdmissionReview{}
+	if err := json.Unmarshal(w.Body.Bytes(), response); err != nil {
+		t.Fatal(err)
+	}
+	if w.Code != http.StatusOK || response.Request != nil || response.Response == nil || response.Response.UID != review.Request.UID || !response.Response.Allowed {
+		t.Fatalf("expected the review to be allowed for the UID %s, got %d %s", review.Request.UID, w.Code, w.Body)
+	}
+	if response.APIVersion != review.APIVersion || response.Kind != review.Kind {
+		t.Fatalf("expected the version of the review to be kept, got %s %s", response.APIVersion, response.Kind)
+	}
+
+	for name, tc := range map[string]struct {
+		method string
+		body   []byte
+		code   int
+	}{
+		"oversize review": {method: http.MethodPost, body: bytes.Repeat([]byte(" "), maxAdmissionReviewSize+1), code: http.StatusRequestEntityTooLarge},
+		"without request": {method: http.MethodPost, body: []byte("{}"), code: http.StatusBadRequest},
+		"get":             {method: http.MethodGet, code: http.StatusMethodNotAllowed},
+	} {
+		w := httptest.NewRecorder()
+		handleValidate(w, httptest.NewRequest(tc.method, ValidatingWebhookPath, bytes.NewReader(tc.body)))
+		if w.Code != tc.code {
+			t.Errorf("%s: expected %d, got %d %s", name, tc.code, w.Code, w.Body)
+		}
+	}
+}
+
+func TestDefaultPlugin(t *testing.T) {
+	server := httptest.NewServer(registry.New(registry.Logger(log.New(io.Discard, "", 0))))
+	defer server.Close()
+	ref, err := name.ParseReference(strings.TrimPrefix(server.URL, "http://") + "/tools/tool:v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	index := mutate.AppendManifests(empty.Index,
+		mutate.IndexAddendum{Add: empty.Image, Descriptor: v1.Descriptor{Platform: &v1.Platform{OS: "linux", Architecture: "amd64"}}},
+		mutate.IndexAddendum{Add: empty.Image, Descriptor: v1.Descriptor{Platform: &v1.Platform{OS: "darwin", Architecture: "arm64"}}},
+	)
+	if err := remote.WriteIndex(ref, index); err != nil {
+		t.Fatal(err)
+	}
+
+	plugin := newValidPlugin("tool", "")
+	plugin.Spec.Image = ref.Name()
+	plugin.Spec.Platforms[0].Platform = ""
+	defaulted := plugin.Spec.Platforms[0]
+	defaulted.Platform, defaulted.Files = "linux/amd64", []v1alpha1.FileLocation{{From: "/usr/bin/tool", To: "tool"}}
+	plugin.Spec.Versions = []v1alpha1.PluginVersion{
+		{Version: "v0.2.0", Image: ref.Name(), Platforms: []v1alpha1.PluginPlatform{defaulted}},
+		{Version: "v0.1.0", Image: ref.Name(), Platforms: plugin.Spec.Platforms},
+	}
+
+	response := defaultPlugin(newAdmissionRequest(t, admissionv1.Create, plugin, nil))
+	if !response.Allowed || response.UID != "uid-tool" || response.PatchType == nil || *response.PatchType != admissionv1.PatchTypeJSONPatch {
+		t.Fatalf("expected the plugin to be patched, got %v", response)
+	}
+	var patch []struct {
+		Op    string                    `json:"op"`
+		Path  string                    `json:"path"`
+		Value []v1alpha1.PluginPlatform `json:"value"`
+	}
+	if err := json.Unmarshal(response.Patch, &patch); err != nil {
+		t.Fatal(err)
+	}
+	// the platforms of the version already defaulted are not replaced
+	if len(patch) != 2 || patch[0].Path != "/spec/platforms" || patch[1].Path != "/spec/versions/1/platforms" {
+		t.Fatalf("expected the platforms of the spec and of the version v0.1.0 to be replaced, got %s", response.Patch)
+	}
+	for _, op := range patch {
+		if op.Op != "replace" || len(op.Value) != 2 || op.Value[0].Platform != "linux/amd64" || op.Value[1].Platform != "darwin/arm64" || op.Value[0].Files[0].To != "tool" {
+			t.Errorf("expected the platforms of the image at %s, got %v", op.Path, op.Value)
+		}
+	}
+
+	// the updates keeping the spec unchanged are not defaulted again
+	if response := defaultPlugin(newAdmissionRequest(t, admissionv1.Update, plugin, plugin)); !response.Allowed || response.Patch != nil {
+		t.Fatalf("expected the unchanged spec not to be patched, got %v", response)
+	}
+	// the platforms of the archives are not listed
+	plugin.Spec.Platforms[0].URL = "https://example.com/tool.tar.gz"
+	if response := defaultPlugin(newAdmissionRequest(t, admissionv1.Create, plugin, nil)); response.Allowed || response.Result.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("expected the plugin to be denied, got %v", response)
+	}
+}
@@ -0,0 +1,291 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/klog/v2"
+
+	"github.com/openshift/cli-manager/api/v1alpha1"
+	"github.com/openshift/cli-manager/pkg/image"
+)
+
+const (
+	// maxApplyBodySize bounds the size of the batch manifests.
+	maxApplyBodySize = 10 << 20
+	// applySyncTimeout is how long the index commits are held for the plugins of the batches
+	// to be synced, from the first batch of the hold. The changes synced so far are committed
+	// once it elapses.
+	applySyncTimeout = 10 * time.Minute
+	// applySyncInterval is how often the plugins of the batches are checked to be synced.
+	applySyncInterval = time.Second
+)
+
+// applyHold is the hold of the index commits shared by the overlapping batches. A single hold is
+// taken at a time, and released once the plugins of its batches are synced or applySyncTimeout
+// after it is taken, so that overlapping batches do not extend it indefinitely.
+type applyHold struct {
+	lock sync.Mutex
+	// applying is the number of batches being applied
+	applying int
+	// generations are the generations the plugins of the batches are waited for at,
+	// nil if the index is not held
+	generations map[string]int64
+}
+
+// ApplyResult is the outcome of applying a batch of plugins.
+type ApplyResult struct {
+	// DryRun is set if the batch is only validated.
+	DryRun bool `json:"dryRun"`
+	// Plugins are the results of the plugins in the order of the manifest.
+	Plugins []ApplyPluginResult `json:"plugins"`
+}
+
+// ApplyPluginResult is the outcome of applying a single plugin of the batch.
+type ApplyPluginResult struct {
+	Name string `json:"name"`
+	// Action is either created or updated.
+	Action string `json:"action,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// failed reports whether any plugin of the batch failed.
+func (r *ApplyResult) failed() bool {
+	for _, p := range r.Plugins {
+		if len(p.Error) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// handleApply creates or updates the plugins of a multi-document manifest. The whole batch is
+// validated before any plugin is applied: the names must be unique and valid, the images must
+// satisfy the registry policy, and every plugin must be accepted by a dry-run of the API server.
+// The index commits are held while the plugins are synced, so that the batch is published with
+// a single index regeneration, and the overlapping batches share the hold. dryRun=true only validates the batch. Applying requires the create
+// and update permissions on plugins.
+func (s *Server) handleApply(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var dryRun bool
+	if value := r.URL.Query().Get("dryRun"); len(value) > 0 {
+		var err error
+		dryRun, err = strconv.ParseBool(value)
+		if err != nil {
+			http.Error(w, "invalid dryRun parameter", http.StatusBadRequest)
+			return
+		}
+	}
+	if !s.authorizeAdmin(w, r, "create") || !s.authorizeAdmin(w, r, "update") {
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxApplyBodySize))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("reading request body: %s", err), http.StatusBadRequest)
+		return
+	}
+	plugins, err := decodePlugins(body)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("invalid manifest: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	result := s.validateBatch(r.Context(), plugins)
+	result.DryRun = dryRun
+	if result.failed() {
+		writeJSON(w, http.StatusUnprocessableEntity, result)
+		return
+	}
+	if dryRun {
+		writeJSON(w, http.StatusOK, result)
+		return
+	}
+
+	applied := s.holdIndex()
+	generations := map[string]int64{}
+	for i, plugin := range plugins {
+		obj, code, err := s.applyPlugin(r.Context(), plugin, nil, false)
+		if err != nil {
+			result.Plugins[i].Error = err.Error()
+			continue
+		}
+		result.Plugins[i].Action = actionOf(code)
+		generations[plugin.Name] = obj.GetGeneration()
+	}
+	applied(generations)
+
+	user := userFrom(r.Context())
+	klog.Infof("batch of %d plugins is applied by %s", len(plugins), user.Username)
+	code := http.StatusOK
+	if result.failed() {
+		// the batch is validated, so only conflicting changes may fail
+		code = http.StatusConflict
+	}
+	writeJSON(w, code, result)
+}
+
+// decodePlugins decodes the Plugins of the multi-document YAML or JSON manifest.
+func decodePlugins(body []byte) ([]*v1alpha1.Plugin, error) {
+	var plugins []*v1alpha1.Plugin
+	decoder := utilyaml.NewYAMLOrJSONDecoder(bytes.NewReader(body), 4096)
+	for {
+		plugin := &v1alpha1.Plugin{}
+		err := decoder.Decode(plugin)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("document %d: %w", len(plugins)+1, err)
+		}
+		if len(plugin.Kind) == 0 && len(plugin.Name) == 0 {
+			// empty document
+			continue
+		}
+		plugins = append(plugins, plugin)
+	}
+	if len(plugins) == 0 {
+		return nil, fmt.Errorf("no plugins found")
+	}
+	return plugins, nil
+}
+
+// validateBatch validates the whole batch without applying any plugin.
+func (s *Server) validateBatch(ctx context.Context, plugins []*v1alpha1.Plugin) *ApplyResult {
+	result := &ApplyResult{Plugins: make([]ApplyPluginResult, len(plugins))}
+	names := map[string]bool{}
+	for i, plugin := range plugins {
+		result.Plugins[i].Name = plugin.Name
+		var errs []string
+		if (len(plugin.APIVersion) > 0 && plugin.APIVersion != v1alpha1.GroupVersion.String()) || plugin.Kind != "Plugin" {
+			errs = append(errs, fmt.Sprintf("unexpected kind %s %s", plugin.APIVersion, plugin.Kind))
+		}
+		if !safePluginRegexp.MatchString(plugin.Name) || len(plugin.Name) > 100 {
+			errs = append(errs, fmt.Sprintf("invalid plugin name %q", plugin.Name))
+		}
+		if names[plugin.Name] {
+			errs = append(errs, fmt.Sprintf("plugin %s is defined more than once", plugin.Name))
+		}
+		names[plugin.Name] = true
+		for _, p := range plugin.Spec.Platforms {
+			if len(p.Image) == 0 && len(p.URL) == 0 && p.GitHub == nil {
+				p.Image = plugin.Spec.Image
+			}
+			if image.IsImageStreamTag(p.Image) || len(p.URL) > 0 || p.GitHub != nil {
+				// resolved to the internal registry by the controller, or downloaded from an archive
+				continue
+			}
+			if err := image.CheckRegistryPolicy(p.Image); err != nil {
+				errs = append(errs, fmt.Sprintf("platform %s: %s", p.Platform, err))
+			}
+		}
+		if len(errs) == 0 {
+			if _, _, err := s.applyPlugin(ctx, plugin, nil, true); err != nil {
+				errs = append(errs, err.Error())
+			}
+		}
+		if len(errs) > 0 {
+			result.Plugins[i].Error = strings.Join(errs, "; ")
+		}
+	}
+	return result
+}
+
+// holdIndex holds the index commits while the batch is applied and synced, or joins the hold
+// of the batches applied before. The returned function records the generations the plugins of
+// the batch are applied at, once it is applied.
+func (s *Server) holdIndex() func(generations map[string]int64) {
+	h := &s.applyHold
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.applying++
+	if h.generations == nil {
+		h.generations = map[string]int64{}
+		release := s.controller.HoldIndex()
+		go func() {
+			defer release()
+			s.waitForSync()
+		}()
+	}
+	return func(generations map[string]int64) {
+		h.lock.Lock()
+		defer h.lock.Unlock()
+		h.applying--
+		if h.generations == nil {
+			// the hold timed out, the plugins are committed as they are synced
+			return
+		}
+		for name, generation := range generations {
+			if current, ok := h.generations[name]; !ok || generation > current {
+				h.generations[name] = generation
+			}
+		}
+	}
+}
+
+// waitForSync waits for the batches of the hold to be applied and their plugins to be synced,
+// or applySyncTimeout, and ends the hold.
+func (s *Server) waitForSync() {
+	h := &s.applyHold
+	ctx, cancel := context.WithTimeout(context.Background(), applySyncTimeout)
+	defer cancel()
+	err := wait.PollUntilContextCancel(ctx, applySyncInterval, true, func(ctx context.Context) (bool, error) {
+		h.lock.Lock()
+		defer h.lock.Unlock()
+		generations := h.generations
+		for name, generation := range generations {
+			obj, err := s.lister.Get(name)
+			if apierrors.IsNotFound(err) {
+				delete(generations, name)
+				continue
+			}
+			if err != nil {
+				return false, nil
+			}
+			u, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+			if err != nil {
+				return false, nil
+			}
+			plugin := &v1alpha1.Plugin{}
+			if err := runtime.DefaultUnstructuredConverter.FromUnstructured(u, plugin); err != nil {
+				return false, nil
+			}
+			condition := meta.FindStatusCondition(plugin.Status.Conditions, v1alpha1.PluginInstalledCondition)
+			if condition == nil || condition.ObservedGeneration < generation {
+				return false, nil
+			}
+			delete(generations, name)
+		}
+		return h.applying == 0 && len(generations) == 0, nil
+	})
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if err != nil {
+		klog.Warningf("%d plugins of the batches are not synced in %s, the index is regenerated without them", len(h.generations), applySyncTimeout)
+	}
+	h.generations = nil
+}
+
+func actionOf(code int) string {
+	if code == http.StatusCreated {
+		return "created"
+	}
+	return "updated"
+}
@@ -0,0 +1,184 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/apimachinery/pkg/util/wait"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	clienttesting "k8s.io/client-go/testing"
+
+	"github.com/openshift/cli-manager/api/v1alpha1"
+	"github.com/openshift/cli-manager/pkg/git"
+	"github.com/openshift/cli-manager/pkg/image"
+)
+
+const applyManifest = `apiVersion: config.openshift.io/v1alpha1
+kind: Plugin
+metadata:
+  name: tool
+spec:
+  shortDescription: tool
+  version: v1.0.0
+  platforms:
+  - platform: linux/amd64
+    url: https://example.com/tool.tar.gz
+    sha256: 0000000000000000000000000000000000000000000000000000000000000000
+    files:
+    - from: tool
+      to: .
+    bin: tool
+`
+
+func newApplyPlugin(name, img string) *v1alpha1.Plugin {
+	return &v1alpha1.Plugin{
+		TypeMeta:   metav1.TypeMeta{APIVersion: v1alpha1.GroupVersion.String(), Kind: "Plugin"},
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Spec: v1alpha1.PluginSpec{
+			Version:   "v1.0.0",
+			Platforms: []v1alpha1.PluginPlatform{{Platform: "linux/amd64", Image: img, Bin: name}},
+		},
+	}
+}
+
+func applyRequest(query, manifest string) *http.Request {
+	r := httptest.NewRequest(http.MethodPost, git.PathPrefix+"/api/v1alpha1/admin/apply"+query, strings.NewReader(manifest))
+	r.Header.Set("Authorization", "Bearer "+adminToken)
+	return r
+}
+
+func TestApplyRequiresBearerToken(t *testing.T) {
+	c := newFakeController()
+	s := newTestServer(t, c, Options{})
+	r := httptest.NewRequest(http.MethodPost, git.PathPrefix+"/api/v1alpha1/admin/apply", strings.NewReader(applyManifest))
+	r.AddCookie(forgedSession(t, adminUser))
+	if w := serve(s, r); w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected the forged session to be unauthorized, got %d %s", w.Code, w.Body)
+	}
+	if _, holds := c.indexHolds(); holds > 0 {
+		t.Fatal("index is held by an unauthorized apply")
+	}
+}
+
+func TestValidateBatch(t *testing.T) {
+	blocked := image.BlockedRegistries
+	image.BlockedRegistries = []string{"quay.io/blocked"}
+	defer func() {
+		image.BlockedRegistries = blocked
+	}()
+
+	wrongKind := newApplyPlugin("deployment", "quay.io/org/tool:v1")
+	wrongKind.Kind = "Deployment"
+	s := newTestServer(t, newFakeController(), Options{})
+	s.dynamicClient.(*dynamicfake.FakeDynamicClient).PrependReactor("create", "plugins", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		obj := action.(clienttesting.CreateAction).GetObject()
+		if name := obj.(metav1.Object).GetName(); name == "rejected" {
+			return true, nil, apierrors.NewInvalid(v1alpha1.GroupVersion.WithKind("Plugin").GroupKind(), name, field.ErrorList{field.Required(field.NewPath("spec", "shortDescription"), "")})
+		}
+		return false, nil, nil
+	})
+
+	result := s.validateBatch(context.Background(), []*v1alpha1.Plugin{
+		newApplyPlugin("tool", "quay.io/org/tool:v1"),
+		newApplyPlugin("tool", "quay.io/org/tool:v2"),
+		newApplyPlugin("Invalid!", "quay.io/org/tool:v1"),
+		wrongKind,
+		newApplyPlugin("blocked", "quay.io/blocked/tool:v1"),
+		newApplyPlugin("rejected", "quay.io/org/tool:v1"),
+		newApplyPlugin("stream", "openshift/tool:v1"),
+	})
+	expected := []string{
+		"",
+		"plugin tool is defined more than once",
+		`invalid plugin name "Invalid!"`,
+		"unexpected kind config.openshift.io/v1alpha1 Deployment",
+		"registry quay.io/blocked is blocked",
+		"spec.shortDescription: Required value",
+		"",
+	}
+	if len(result.Plugins) != len(expected) {
+		t.Fatalf("expected %d results, got %v", len(expected), result.Plugins)
+	}
+	for i, e := range expected {
+		got := result.Plugins[i]
+		if (len(e) == 0 && len(got.Error) > 0) || !strings.Contains(got.Error, e) {
+			t.Errorf("%d: expected error %q, got %v", i, e, got)
+		}
+	}
+	if !result.failed() {
+		t.Fatal("expected the batch to fail")
+	}
+}
+
+func TestHandleApply(t *testing.T) {
+	c := newFakeController()
+	s := newTestServer(t, c, Options{})
+
+	w := serve(s, applyRequest("?dryRun=true", applyManifest))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"dryRun":true`) {
+		t.Fatalf("expected the batch to be validated, got %d %s", w.Code, w.Body)
+	}
+	w = serve(s, applyRequest("", applyManifest+"---\n"+applyManifest))
+	if w.Code != http.StatusUnprocessableEntity || !strings.Contains(w.Body.String(), "defined more than once") {
+		t.Fatalf("expected the batch to be rejected, got %d %s", w.Code, w.Body)
+	}
+	if _, holds := c.indexHolds(); holds > 0 {
+		t.Fatal("index is held without applying the batch")
+	}
+
+	// the plugin is not synced until its status is updated
+	plugin := &v1alpha1.Plugin{ObjectMeta: metav1.ObjectMeta{Name: "tool"}}
+	if err := c.indexer.Add(plugin); err != nil {
+		t.Fatal(err)
+	}
+
+	// the overlapping batches share the hold until their plugins are synced
+	for i := 0; i < 2; i++ {
+		w = serve(s, applyRequest("", applyManifest))
+		result := ApplyResult{}
+		if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+			t.Fatal(err)
+		}
+		if w.Code != http.StatusOK || len(result.Plugins) != 1 || len(result.Plugins[0].Action) == 0 {
+			t.Fatalf("expected the batch to be applied, got %d %s", w.Code, w.Body)
+		}
+	}
+	if held, holds := c.indexHolds(); held != 1 || holds != 1 {
+		t.Fatalf("expected a single hold of the index, got %d holds", holds)
+	}
+	obj, err := s.dynamicClient.Resource(pluginsGVR).Get(context.Background(), "tool", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plugin = plugin.DeepCopy()
+	plugin.Status.Conditions = []metav1.Condition{{
+		Type:               v1alpha1.PluginInstalledCondition,
+		Status:             metav1.ConditionTrue,
+		ObservedGeneration: obj.GetGeneration(),
+	}}
+	if err := c.indexer.Update(plugin); err != nil {
+		t.Fatal(err)
+	}
+	if err := wait.PollUntilContextTimeout(context.Background(), 100*time.Millisecond, 5*applySyncInterval, true, func(ctx context.Context) (bool, error) {
+		held, _ := c.indexHolds()
+		return held == 0, nil
+	}); err != nil {
+		t.Fatal("expected the index to be released once the plugins are synced")
+	}
+
+	// the next batch holds the index again
+	serve(s, applyRequest("", applyManifest))
+	if _, holds := c.indexHolds(); holds != 2 {
+		t.Fatalf("expected another hold of the index, got %d holds", holds)
+	}
+}
@@ -0,0 +1,256 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"net/url"
+	"slices"
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/klog/v2"
+
+	"github.com/openshift/cli-manager/api/v1alpha1"
+	"github.com/openshift/cli-manager/pkg/controller"
+	"github.com/openshift/cli-manager/pkg/git"
+)
+
+// PluginInfo is the catalog entry of a plugin.
+type PluginInfo struct {
+	Name             string                          `json:"name"`
+	Version          string                          `json:"version"`
+	ShortDescription string                          `json:"shortDescription"`
+	Description      string                          `json:"description,omitempty"`
+	Caveats          string                          `json:"caveats,omitempty"`
+	Homepage         string                          `json:"homepage,omitempty"`
+	Preview          bool                            `json:"preview,omitempty"`
+	Platforms        []v1alpha1.PluginPlatformStatus `json:"platforms,omitempty"`
+	// OnDemandPlatforms are the platforms that are published once demanded.
+	OnDemandPlatforms []string `json:"onDemandPlatforms,omitempty"`
+	// Deprecation is set if the plugin is deprecated.
+	Deprecation *v1alpha1.Deprecation `json:"deprecation,omitempty"`
+	// Versions are the older versions of the plugin published to the index.
+	Versions []VersionInfo `json:"versions,omitempty"`
+	// Dependencies are the plugins the plugin requires.
+	Dependencies []v1alpha1.PluginDependency `json:"dependencies,omitempty"`
+	// Dependents are the plugins in the catalog which require the plugin.
+	Dependents []string `json:"dependents,omitempty"`
+	// Aliases are the other names the plugin is published under.
+	Aliases []string `json:"aliases,omitempty"`
+	// Categories are the broad areas of the plugin the catalog is filtered by.
+	Categories []string `json:"categories,omitempty"`
+	// Tags are the keywords of the plugin the catalog is filtered by.
+	Tags []string `json:"tags,omitempty"`
+}
+
+// VersionInfo is an older version of a plugin in its catalog entry.
+type VersionInfo struct {
+	Version string `json:"version"`
+	// Name is the name the version is published to the index with.
+	Name string `json:"name"`
+	// Deprecation is set if the version is deprecated, by itself or with the plugin.
+	Deprecation *v1alpha1.Deprecation `json:"deprecation,omitempty"`
+}
+
+// PluginInfoList is the catalog of plugins.
+type PluginInfoList struct {
+	Items []PluginInfo `json:"items"`
+}
+
+var catalogTemplate = template.Must(template.New("catalog").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>CLI Manager Plugins</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; width: 100%; }
+th, td { border-bottom: 1px solid #ddd; padding: 0.5em; text-align: left; vertical-align: top; }
+</style>
+</head>
+<body>
+<h1>CLI Manager Plugins</h1>
+<table>
+<tr><th>Name</th><th>Version</th><th>Description</th><th>Platforms</th></tr>
+{{- range .Items }}
+<tr>
+<td>{{ if .Homepage }}<a href="{{ .Homepage }}">{{ .Name }}</a>{{ else }}{{ .Name }}{{ end }}{{ if .Preview }} (preview){{ end }}{{ if .Deprecation }} (deprecated){{ end }}{{ if .Aliases }}<br>Aliases: {{ range $i, $a := .Aliases }}{{ if $i }}, {{ end }}{{ $a }}{{ end }}{{ end }}</td>
+<td>{{ .Version }}</td>
+<td>{{ .ShortDescription }}{{ with .Deprecation }}<br><strong>Deprecated: {{ .Message }}{{ if .Replacement }}, use {{ .Replacement }} instead{{ end }}</strong>{{ end }}{{ if .Caveats }}<br><em>{{ .Caveats }}</em>{{ end }}{{ if .Dependencies }}<br>Requires: {{ range $i, $d := .Dependencies }}{{ if $i }}, {{ end }}{{ $d.Name }}{{ if $d.MinVersion }} ({{ $d.MinVersion }} or later){{ end }}{{ end }}{{ end }}{{ if or .Categories .Tags }}<br>{{ range .Categories }}<a href="?category={{ . }}">{{ . }}</a> {{ end }}{{ range .Tags }}<a href="?tag={{ . }}">#{{ . }}</a> {{ end }}{{ end }}</td>
+<td>{{ range .Platforms }}<a href="{{ .URI }}">{{ .Platform }}</a><br>{{ end }}{{ range .OnDemandPlatforms }}{{ . }} (on demand)<br>{{ end }}</td>
+</tr>
+{{- end }}
+</table>
+</body>
+</html>
+`))
+
+// listPlugins returns the catalog entries of the plugins visible to the user sorted by name.
+func (s *Server) listPlugins(ctx context.Context) ([]PluginInfo, error) {
+	objs, err := s.lister.List(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+	plugins := make([]PluginInfo, 0, len(objs))
+	for _, obj := range objs {
+		u, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+		if err != nil {
+			continue
+		}
+		plugin := &v1alpha1.Plugin{}
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(u, plugin); err != nil {
+			klog.V(2).Infof("invalid plugin %v is ignored in the catalog", obj)
+			continue
+		}
+		plugins = append(plugins, s.newPluginInfo(plugin))
+	}
+	sort.Slice(plugins, func(i, j int) bool {
+		return plugins[i].Name < plugins[j].Name
+	})
+	plugins, err = s.visiblePlugins(ctx, plugins)
+	if err != nil {
+		return nil, err
+	}
+	// the dependents are listed after filtering, not to disclose the plugins the user can not get
+	index := map[string]int{}
+	for i := range plugins {
+		index[plugins[i].Name] = i
+	}
+	for _, plugin := range plugins {
+		for _, d := range plugin.Dependencies {
+			if i, ok := index[d.Name]; ok {
+				plugins[i].Dependents = append(plugins[i].Dependents, plugin.Name)
+			}
+		}
+	}
+	return plugins, nil
+}
+
+func (s *Server) newPluginInfo(plugin *v1alpha1.Plugin) PluginInfo {
+	info := PluginInfo{
+		Name:             plugin.Name,
+		Version:          plugin.Spec.Version,
+		ShortDescription: plugin.Spec.ShortDescription,
+		Description:      plugin.Spec.Description,
+		Caveats:          plugin.Spec.Caveats,
+		Homepage:         plugin.Spec.Homepage,
+		Preview:          plugin.Spec.Preview,
+		Platforms:        plugin.Status.Platforms,
+		Deprecation:      plugin.Spec.Deprecation,
+		Dependencies:     plugin.Spec.Dependencies,
+		Aliases:          plugin.Spec.Aliases,
+		Categories:       plugin.Spec.Categories,
+		Tags:             plugin.Spec.Tags,
+	}
+	for _, v := range plugin.Status.Versions {
+		version := VersionInfo{Version: v.Version, Name: v.Name, Deprecation: plugin.Spec.Deprecation}
+		for _, sv := range plugin.Spec.Versions {
+			if sv.Version == v.Version && sv.Deprecation != nil {
+				version.Deprecation = sv.Deprecation
+			}
+		}
+		info.Versions = append(info.Versions, version)
+	}
+	if len(plugin.Status.ResolvedVersion) > 0 {
+		info.Version = plugin.Status.ResolvedVersion
+	}
+	for _, p := range plugin.Spec.Platforms {
+		if !p.Disabled && controller.IsOnDemandPlatform(p.Platform, s.options.OnDemandPlatforms) && !controller.IsDemandedPlatform(plugin, p.Platform) {
+			info.OnDemandPlatforms = append(info.OnDemandPlatforms, p.Platform)
+		}
+	}
+	return info
+}
+
+// handleListPlugins serves the catalog of plugins in JSON format,
+// or a single plugin if its name is given in the path.
+func (s *Server) handleListPlugins(w http.ResponseWriter, r *http.Request) {
+	if name, ok := strings.CutSuffix(strings.TrimPrefix(r.URL.Path, git.PathPrefix+"/api/v1alpha1/plugins/"), "/demand"); ok {
+		s.handleDemand(w, r, name)
+		return
+	}
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	plugins, err := s.listPlugins(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	name := strings.Trim(strings.TrimPrefix(r.URL.Path, git.PathPrefix+"/api/v1alpha1/plugins"), "/")
+	if len(name) > 0 {
+		for _, p := range plugins {
+			if p.Name == name {
+				writeJSON(w, http.StatusOK, p)
+				return
+			}
+		}
+		// the aliases resolve to the plugins declaring them, the plugins named after them take precedence
+		for _, p := range plugins {
+			if slices.Contains(p.Aliases, name) {
+				writeJSON(w, http.StatusOK, p)
+				return
+			}
+		}
+		http.Error(w, "plugin "+name+" is not found", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, PluginInfoList{Items: filterPlugins(plugins, r.URL.Query())})
+}
+
+// filterPlugins returns the plugins listing all the categories and the tags of the category and the
+// tag query parameters, i.e. ?category=networking&tag=istio.
+func filterPlugins(plugins []PluginInfo, query url.Values) []PluginInfo {
+	categories, tags := query["category"], query["tag"]
+	if len(categories) == 0 && len(tags) == 0 {
+		return plugins
+	}
+	filtered := make([]PluginInfo, 0, len(plugins))
+	for _, p := range plugins {
+		if containsAll(p.Categories, categories) && containsAll(p.Tags, tags) {
+			filtered = append(filtered, p)
+		}
+	}
+	return filtered
+}
+
+// containsAll reports whether the values contain all the wanted ones.
+func containsAll(values, wanted []string) bool {
+	for _, w := range wanted {
+		if !slices.Contains(values, w) {
+			return false
+		}
+	}
+	return true
+}
+
+// handleCatalog serves the catalog of plugins as HTML page.
+func (s *Server) handleCatalog(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	plugins, err := s.listPlugins(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := catalogTemplate.Execute(w, PluginInfoList{Items: filterPlugins(plugins, r.URL.Query())}); err != nil {
+		klog.Errorf("catalog rendering error %v", err)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, code int, obj interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(obj); err != nil {
+		klog.Errorf("response encoding error %v", err)
+	}
+}
@@ -0,0 +1,129 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+
+	"github.com/openshift/cli-manager/api/v1alpha1"
+	"github.com/openshift/cli-manager/pkg/controller"
+)
+
+// handleDemand requests the on-demand platform given in the platform query parameter
+// of the plugin to be extracted and published. The demand is recorded in the
+// DemandedPlatformsAnnotation of the plugin, which is picked up by its shard.
+func (s *Server) handleDemand(w http.ResponseWriter, r *http.Request, name string) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	platform := r.URL.Query().Get("platform")
+	if !controller.IsOnDemandPlatform(platform, s.options.OnDemandPlatforms) {
+		http.Error(w, fmt.Sprintf("platform %s is not published on demand", platform), http.StatusBadRequest)
+		return
+	}
+
+	// the plugin must be visible to the user demanding it
+	plugins, err := s.listPlugins(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	visible := false
+	for _, p := range plugins {
+		visible = visible || p.Name == name
+	}
+	if !visible {
+		http.Error(w, "plugin "+name+" is not found", http.StatusNotFound)
+		return
+	}
+
+	// concurrent demands of the same platform, i.e. by the users of a team adopting a new
+	// laptop architecture at once, are coalesced into a single patch of the plugin. The patch
+	// outlives the request it is made for, since the other requests wait for it.
+	ctx := context.WithoutCancel(r.Context())
+	v, _, shared := s.demands.Do(name+"/"+platform, func() (interface{}, error) {
+		return s.demand(ctx, name, platform), nil
+	})
+	result := v.(demandResult)
+	if shared {
+		klog.V(4).Infof("demand of platform %s of plugin %s is coalesced", platform, name)
+	}
+	if len(result.err) > 0 {
+		http.Error(w, result.err, result.code)
+		return
+	}
+	writeJSON(w, result.code, result.info)
+}
+
+// demandResult is the response to the demands of a platform coalesced into a single patch.
+type demandResult struct {
+	code int
+	info PluginInfo
+	// err is the message of the failed demand
+	err string
+}
+
+// demand records the demand of the platform in the DemandedPlatformsAnnotation of the plugin.
+func (s *Server) demand(ctx context.Context, name, platform string) demandResult {
+	obj, err := s.dynamicClient.Resource(pluginsGVR).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		code := http.StatusInternalServerError
+		if errors.IsNotFound(err) {
+			code = http.StatusNotFound
+		}
+		return demandResult{code: code, err: err.Error()}
+	}
+	plugin := &v1alpha1.Plugin{}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, plugin); err != nil {
+		return demandResult{code: http.StatusInternalServerError, err: err.Error()}
+	}
+	inSpec := false
+	for _, p := range plugin.Spec.Platforms {
+		inSpec = inSpec || (p.Platform == platform && !p.Disabled)
+	}
+	if !inSpec {
+		return demandResult{code: http.StatusNotFound, err: fmt.Sprintf("plugin %s has no platform %s", name, platform)}
+	}
+	if controller.IsDemandedPlatform(plugin, platform) {
+		return demandResult{code: http.StatusAccepted, info: s.newPluginInfo(plugin)}
+	}
+
+	demanded := platform
+	if existing := plugin.Annotations[controller.DemandedPlatformsAnnotation]; len(existing) > 0 {
+		demanded = strings.Join([]string{existing, platform}, ",")
+	}
+	// the resource version guards against losing concurrent demands
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"resourceVersion": plugin.ResourceVersion,
+			"annotations": map[string]string{
+				controller.DemandedPlatformsAnnotation: demanded,
+			},
+		},
+	})
+	if err != nil {
+		return demandResult{code: http.StatusInternalServerError, err: err.Error()}
+	}
+	obj, err = s.dynamicClient.Resource(pluginsGVR).Patch(ctx, name, types.MergePatchType, patch, metav1.PatchOptions{})
+	if err != nil {
+		code := http.StatusInternalServerError
+		if errors.IsConflict(err) {
+			code = http.StatusConflict
+		}
+		return demandResult{code: code, err: err.Error()}
+	}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, plugin); err != nil {
+		return demandResult{code: http.StatusInternalServerError, err: err.Error()}
+	}
+	klog.Infof("platform %s of plugin %s is demanded", platform, name)
+	return demandResult{code: http.StatusAccepted, info: s.newPluginInfo(plugin)}
+}
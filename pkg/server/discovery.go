@@ -0,0 +1,100 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/openshift/cli-manager/api/v1alpha1"
+	"github.com/openshift/cli-manager/pkg/git"
+)
+
+// DiscoveryPath is the well-known path of the discovery document, served outside of the path prefix.
+const DiscoveryPath = "/.well-known/cli-manager.json"
+
+// Authentication methods of the discovery document.
+const (
+	// AuthenticationNone serves the endpoints without authentication.
+	AuthenticationNone = "none"
+	// AuthenticationBearer authenticates users with their cluster bearer tokens.
+	AuthenticationBearer = "bearer"
+	// AuthenticationOAuth authenticates users with their cluster bearer tokens,
+	// or browsers with a session after logging in to the cluster OAuth server.
+	AuthenticationOAuth = "oauth"
+	// AuthenticationPublisherToken authenticates CI systems with the publisher tokens.
+	AuthenticationPublisherToken = "publisher-token"
+)
+
+// Discovery describes the endpoints of the CLI manager, so that client tooling
+// can configure itself from the base URL only.
+type Discovery struct {
+	// PathPrefix is the URL path the indexes, the catalog and the JSON API are served under.
+	PathPrefix string `json:"pathPrefix"`
+	// Indexes are the URLs of the krew indexes.
+	Indexes DiscoveryIndexes `json:"indexes"`
+	// APIVersions are the versions of the JSON API.
+	APIVersions []string `json:"apiVersions"`
+	// Endpoints are the URLs of the enabled endpoints and their authentication methods.
+	Endpoints []DiscoveryEndpoint `json:"endpoints"`
+}
+
+// DiscoveryIndexes are the URLs of the krew indexes.
+type DiscoveryIndexes struct {
+	Default string `json:"default"`
+	Preview string `json:"preview"`
+	// Channels are the URLs of the indexes of the release channels by channel.
+	Channels map[string]string `json:"channels"`
+}
+
+// DiscoveryEndpoint is an endpoint of the CLI manager.
+type DiscoveryEndpoint struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+	// Authentication is none, bearer, oauth or publisher-token.
+	Authentication string `json:"authentication"`
+}
+
+// handleDiscovery serves the discovery document. The URLs are absolute, built from
+// the host and the scheme the request is forwarded by the route with.
+func (s *Server) handleDiscovery(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	scheme := r.Header.Get("X-Forwarded-Proto")
+	if len(scheme) == 0 {
+		scheme = "https"
+	}
+	base := scheme + "://" + r.Host + git.PathPrefix
+
+	users := AuthenticationNone
+	if s.oauth != nil && s.oauth.config != nil {
+		users = AuthenticationOAuth
+	} else if s.oauth != nil {
+		users = AuthenticationBearer
+	}
+	version := v1alpha1.GroupVersion.Version
+	discovery := Discovery{
+		PathPrefix: git.PathPrefix,
+		Indexes: DiscoveryIndexes{
+			Default:  base,
+			Preview:  base + "-preview",
+			Channels: map[string]string{},
+		},
+		APIVersions: []string{version},
+		Endpoints: []DiscoveryEndpoint{
+			{Name: "plugins", URL: base + "/api/" + version + "/plugins", Authentication: users},
+			{Name: "catalog", URL: base + "/catalog", Authentication: users},
+			{Name: "fsck", URL: base + "/api/" + version + "/admin/fsck", Authentication: AuthenticationBearer},
+			{Name: "apply", URL: base + "/api/" + version + "/admin/apply", Authentication: AuthenticationBearer},
+		},
+	}
+	for _, channel := range v1alpha1.Channels {
+		discovery.Indexes.Channels[string(channel)] = base + "-" + string(channel)
+	}
+	if len(s.options.UpstreamIndexURL) > 0 {
+		discovery.Endpoints = append(discovery.Endpoints, DiscoveryEndpoint{Name: "upgrades", URL: base + "/api/" + version + "/admin/upgrades", Authentication: AuthenticationBearer})
+	}
+	if len(s.options.PublisherTokensSecret) > 0 {
+		discovery.Endpoints = append(discovery.Endpoints, DiscoveryEndpoint{Name: "publish", URL: base + "/api/" + version + "/publish/", Authentication: AuthenticationPublisherToken})
+	}
+	writeJSON(w, http.StatusOK, discovery)
+}
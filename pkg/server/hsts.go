@@ -0,0 +1,24 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// StrictTransportSecurity adds the Strict-Transport-Security header to the responses served over
+// HTTPS, either by the listener itself or by the route terminating TLS in front of it, so that
+// browsers and clients never downgrade to plain HTTP for maxAge. The handler is returned as is
+// if maxAge is zero.
+func StrictTransportSecurity(handler http.Handler, maxAge time.Duration) http.Handler {
+	if maxAge <= 0 {
+		return handler
+	}
+	value := fmt.Sprintf("max-age=%d", int64(maxAge.Seconds()))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+			w.Header().Set("Strict-Transport-Security", value)
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
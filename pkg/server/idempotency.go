@@ -0,0 +1,200 @@
+package server
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+const (
+	// IdempotencyKeyHeader is the header clients set to retry mutating requests safely.
+	IdempotencyKeyHeader = "Idempotency-Key"
+	// IdempotentReplayedHeader is set on the responses replayed for a retried request.
+	IdempotentReplayedHeader = "Idempotent-Replayed"
+
+	// idempotencyKeyTTL is how long the responses are replayed for their keys.
+	idempotencyKeyTTL = 24 * time.Hour
+	// maxIdempotencyKeys bounds the number of remembered keys, the oldest ones are evicted first.
+	maxIdempotencyKeys = 10000
+	// maxIdempotentResponseSize bounds the size of the remembered responses, the keys of
+	// larger responses are forgotten once the request completes.
+	maxIdempotentResponseSize = 1 << 20
+)
+
+// idempotentResponse is the response remembered for an idempotency key.
+type idempotentResponse struct {
+	// fingerprint identifies the request the key is used with
+	fingerprint string
+	created     time.Time
+	// done is closed once the request completes
+	done        chan struct{}
+	code        int
+	contentType string
+	body        []byte
+}
+
+// idempotencyCache remembers the responses of the mutating requests by their idempotency keys.
+// The keys are scoped to the caller, and only remembered by the replica serving the request.
+type idempotencyCache struct {
+	mu        sync.Mutex
+	responses map[string]*idempotentResponse
+}
+
+func newIdempotencyCache() *idempotencyCache {
+	return &idempotencyCache{responses: map[string]*idempotentResponse{}}
+}
+
+// idempotent replays the response of the first request for the retries of the mutating
+// requests with the same Idempotency-Key header, instead of performing them again. Retries
+// of a request in progress are rejected with 409, and reusing a key for another request with
+// 422. The key is forgotten if the request fails with a server error, so that it can be retried.
+// The keys of the anonymous callers are ignored, since they would share their responses.
+func (s *Server) idempotent(handler http.Handler, maxBodySize int64) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(IdempotencyKeyHeader)
+		if len(key) == 0 || r.Method == http.MethodGet || r.Method == http.MethodHead {
+			handler.ServeHTTP(w, r)
+			return
+		}
+		if len(key) > 255 {
+			http.Error(w, "idempotency key is too long", http.StatusBadRequest)
+			return
+		}
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBodySize))
+		if err != nil {
+			http.Error(w, "reading request body: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		// the keys of different callers never collide
+		var scope [sha256.Size]byte
+		if user := userFrom(r.Context()); user != nil {
+			scope = sha256.Sum256([]byte(user.Username))
+		} else if authorization := r.Header.Get("Authorization"); len(authorization) > 0 {
+			scope = sha256.Sum256([]byte(authorization))
+		} else {
+			klog.V(4).Infof("idempotency key of the anonymous %s %s is ignored", r.Method, r.URL.Path)
+			handler.ServeHTTP(w, r)
+			return
+		}
+		cacheKey := hex.EncodeToString(scope[:]) + "/" + key
+		hash := sha256.New()
+		hash.Write([]byte(r.Method + " " + r.URL.RequestURI() + "\n"))
+		hash.Write(body)
+		fingerprint := hex.EncodeToString(hash.Sum(nil))
+
+		response, ok := s.idempotency.start(cacheKey, fingerprint)
+		if !ok {
+			select {
+			case <-response.done:
+			default:
+				http.Error(w, "a request with the same idempotency key is in progress", http.StatusConflict)
+				return
+			}
+			if response.fingerprint != fingerprint {
+				http.Error(w, "idempotency key is already used for another request", http.StatusUnprocessableEntity)
+				return
+			}
+			klog.V(2).Infof("replaying the response of %s %s for idempotency key %s", r.Method, r.URL.Path, key)
+			if len(response.contentType) > 0 {
+				w.Header().Set("Content-Type", response.contentType)
+			}
+			w.Header().Set(IdempotentReplayedHeader, "true")
+			w.WriteHeader(response.code)
+			w.Write(response.body)
+			return
+		}
+
+		recorder := &responseRecorder{ResponseWriter: w, code: http.StatusOK}
+		handler.ServeHTTP(recorder, r)
+		s.idempotency.finish(cacheKey, response, recorder)
+	})
+}
+
+// start returns the remembered response of the key, or registers the request in progress
+// for the key and reports whether the request should be performed.
+func (c *idempotencyCache) start(key, fingerprint string) (*idempotentResponse, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	if response, ok := c.responses[key]; ok {
+		if now.Sub(response.created) < idempotencyKeyTTL {
+			return response, false
+		}
+		delete(c.responses, key)
+	}
+	if len(c.responses) >= maxIdempotencyKeys {
+		c.evict(now)
+	}
+	response := &idempotentResponse{fingerprint: fingerprint, created: now, done: make(chan struct{})}
+	c.responses[key] = response
+	return response, true
+}
+
+// finish records the response of the completed request.
+func (c *idempotencyCache) finish(key string, response *idempotentResponse, recorder *responseRecorder) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if recorder.code >= http.StatusInternalServerError || recorder.overflow {
+		delete(c.responses, key)
+	} else {
+		response.code = recorder.code
+		response.contentType = recorder.Header().Get("Content-Type")
+		response.body = recorder.body.Bytes()
+	}
+	close(response.done)
+}
+
+// evict removes the expired keys, or the oldest completed one if none is expired.
+func (c *idempotencyCache) evict(now time.Time) {
+	var oldest string
+	for key, response := range c.responses {
+		select {
+		case <-response.done:
+		default:
+			continue
+		}
+		if now.Sub(response.created) >= idempotencyKeyTTL {
+			delete(c.responses, key)
+			continue
+		}
+		if len(oldest) == 0 || response.created.Before(c.responses[oldest].created) {
+			oldest = key
+		}
+	}
+	if len(c.responses) >= maxIdempotencyKeys && len(oldest) > 0 {
+		delete(c.responses, oldest)
+	}
+}
+
+// responseRecorder records the status code and the body of the response.
+type responseRecorder struct {
+	http.ResponseWriter
+	code     int
+	body     bytes.Buffer
+	overflow bool
+}
+
+func (r *responseRecorder) WriteHeader(code int) {
+	r.code = code
+	r.ResponseWriter.WriteHeader(code)
+}
+
+func (r *responseRecorder) Write(p []byte) (int, error) {
+	if !r.overflow {
+		if r.body.Len()+len(p) > maxIdempotentResponseSize {
+			r.overflow = true
+			r.body.Reset()
+		} else {
+			r.body.Write(p)
+		}
+	}
+	return r.ResponseWriter.Write(p)
+}
@@ -0,0 +1,143 @@
+package server
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// countingHandler responds with its code and the body of the request, and counts the requests.
+type countingHandler struct {
+	lock  sync.Mutex
+	calls int
+	code  int
+	// block delays the responses until it is closed, if set
+	block chan struct{}
+}
+
+func (h *countingHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.lock.Lock()
+	h.calls++
+	code, block := h.code, h.block
+	h.lock.Unlock()
+	if block != nil {
+		<-block
+	}
+	body, _ := io.ReadAll(r.Body)
+	w.Header().Set("Content-Type", "text/plain")
+	w.WriteHeader(code)
+	w.Write(body)
+}
+
+func (h *countingHandler) callCount() int {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	return h.calls
+}
+
+func idempotentRequest(key, authorization, body string) *http.Request {
+	r := httptest.NewRequest(http.MethodPost, "/apply", strings.NewReader(body))
+	r.Header.Set(IdempotencyKeyHeader, key)
+	if len(authorization) > 0 {
+		r.Header.Set("Authorization", authorization)
+	}
+	return r
+}
+
+func TestIdempotent(t *testing.T) {
+	s := &Server{idempotency: newIdempotencyCache()}
+	h := &countingHandler{code: http.StatusCreated}
+	handler := s.idempotent(h, 1<<20)
+	serveIdempotent := func(r *http.Request) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	// the retries replay the response of the first request
+	for i := 0; i < 2; i++ {
+		w := serveIdempotent(idempotentRequest("key", "Bearer a", "plugin"))
+		if w.Code != http.StatusCreated || w.Body.String() != "plugin" || w.Header().Get("Content-Type") != "text/plain" {
+			t.Fatalf("expected the response of the first request, got %d %s", w.Code, w.Body)
+		}
+		if replayed := w.Header().Get(IdempotentReplayedHeader) == "true"; replayed != (i > 0) {
+			t.Errorf("%d: expected replayed %t", i, i > 0)
+		}
+	}
+	if h.callCount() != 1 {
+		t.Fatalf("expected a single request, got %d", h.callCount())
+	}
+
+	// the keys are scoped to the callers
+	if w := serveIdempotent(idempotentRequest("key", "Bearer b", "plugin")); w.Header().Get(IdempotentReplayedHeader) == "true" || h.callCount() != 2 {
+		t.Fatalf("expected the request of another caller to be performed, got %d requests", h.callCount())
+	}
+
+	// the key is rejected for another request
+	if w := serveIdempotent(idempotentRequest("key", "Bearer a", "other")); w.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("expected the reused key to be rejected, got %d %s", w.Code, w.Body)
+	}
+
+	// the keys of the anonymous callers are ignored
+	for i := 0; i < 2; i++ {
+		if w := serveIdempotent(idempotentRequest("anonymous", "", "plugin")); w.Header().Get(IdempotentReplayedHeader) == "true" {
+			t.Fatal("expected the anonymous request not to be replayed")
+		}
+	}
+	if h.callCount() != 4 {
+		t.Fatalf("expected the anonymous requests to be performed, got %d requests", h.callCount())
+	}
+}
+
+func TestIdempotentInProgress(t *testing.T) {
+	s := &Server{idempotency: newIdempotencyCache()}
+	h := &countingHandler{code: http.StatusOK, block: make(chan struct{})}
+	handler := s.idempotent(h, 1<<20)
+
+	first := httptest.NewRecorder()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		handler.ServeHTTP(first, idempotentRequest("key", "Bearer a", "plugin"))
+	}()
+	// the first request is in progress once the handler is called
+	for h.callCount() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, idempotentRequest("key", "Bearer a", "plugin"))
+	if w.Code != http.StatusConflict {
+		t.Fatalf("expected the retry in progress to be rejected, got %d %s", w.Code, w.Body)
+	}
+	close(h.block)
+	<-done
+	if first.Code != http.StatusOK {
+		t.Fatalf("expected the first request to succeed, got %d", first.Code)
+	}
+}
+
+func TestIdempotentServerError(t *testing.T) {
+	s := &Server{idempotency: newIdempotencyCache()}
+	h := &countingHandler{code: http.StatusInternalServerError}
+	handler := s.idempotent(h, 1<<20)
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, idempotentRequest("key", "Bearer a", "plugin"))
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("expected the server error, got %d", w.Code)
+	}
+
+	// the key of the failed request is forgotten, so that it is retried
+	h.lock.Lock()
+	h.code = http.StatusOK
+	h.lock.Unlock()
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, idempotentRequest("key", "Bearer a", "plugin"))
+	if w.Code != http.StatusOK || w.Header().Get(IdempotentReplayedHeader) == "true" || h.callCount() != 2 {
+		t.Fatalf("expected the request to be retried, got %d after %d requests", w.Code, h.callCount())
+	}
+}
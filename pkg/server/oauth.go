@@ -0,0 +1,320 @@
+package server
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/klog/v2"
+
+	"github.com/openshift/cli-manager/pkg/git"
+)
+
+const (
+	sessionCookie = "cli-manager-session"
+	stateCookie   = "cli-manager-oauth-state"
+
+	// maxSessionDuration bounds the lifetime of the sessions regardless of the access token expiry.
+	maxSessionDuration = 24 * time.Hour
+)
+
+// OAuthOptions configures the cluster OAuth integration gating the catalog and the JSON API.
+type OAuthOptions struct {
+	// ClientID of the OAuthClient registered for the catalog. OAuth is disabled if empty.
+	ClientID string
+	// ClientSecretFile contains the secret of the OAuthClient.
+	ClientSecretFile string
+	// RedirectURL is the callback URL registered in the OAuthClient,
+	// i.e. https://<route>/cli-manager/oauth/callback, under the configured path prefix.
+	RedirectURL string
+	// CAFile is a PEM bundle trusted when connecting to the OAuth server.
+	CAFile string
+	// SessionSecretFile contains the key sessions are signed with.
+	// A random key is generated if empty, invalidating sessions on restarts.
+	SessionSecretFile string
+}
+
+type userKey struct{}
+
+// userFrom returns the user authenticated for the request, if any.
+func userFrom(ctx context.Context) *authenticationv1.UserInfo {
+	user, _ := ctx.Value(userKey{}).(*authenticationv1.UserInfo)
+	return user
+}
+
+// session is the identity of the user stored in the signed session cookie.
+type session struct {
+	User    authenticationv1.UserInfo `json:"user"`
+	Expires int64                     `json:"expires"`
+}
+
+// oauthAuthenticator authenticates users with the cluster OAuth server
+// using the authorization code flow. Requests carrying a bearer token are
+// authenticated directly with a TokenReview, which is the only method if
+// the OAuth config is not set.
+type oauthAuthenticator struct {
+	client     kubernetes.Interface
+	config     *oauth2.Config
+	httpClient *http.Client
+	sessionKey []byte
+}
+
+// newBearerAuthenticator returns the authenticator of the bearer tokens only, for the admin API and
+// the RBAC-scoped visibility without OAuth. It has no session key, so it accepts no session cookie.
+func newBearerAuthenticator(client kubernetes.Interface) *oauthAuthenticator {
+	return &oauthAuthenticator{client: client}
+}
+
+// newOAuthAuthenticator discovers the cluster OAuth server and returns the authenticator.
+func newOAuthAuthenticator(ctx context.Context, client kubernetes.Interface, options OAuthOptions) (*oauthAuthenticator, error) {
+	clientSecret, err := os.ReadFile(options.ClientSecretFile)
+	if err != nil {
+		return nil, fmt.Errorf("reading OAuth client secret: %w", err)
+	}
+
+	var sessionKey []byte
+	if len(options.SessionSecretFile) > 0 {
+		sessionKey, err = os.ReadFile(options.SessionSecretFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading session secret: %w", err)
+		}
+		if len(sessionKey) == 0 {
+			return nil, fmt.Errorf("session secret %s is empty", options.SessionSecretFile)
+		}
+	} else {
+		sessionKey = make([]byte, 32)
+		if _, err := rand.Read(sessionKey); err != nil {
+			return nil, err
+		}
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if len(options.CAFile) > 0 {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		ca, err := os.ReadFile(options.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading OAuth CA bundle: %w", err)
+		}
+		pool.AppendCertsFromPEM(ca)
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}
+	}
+
+	// the OAuth server metadata is served by the API server
+	raw, err := client.Discovery().RESTClient().Get().AbsPath("/.well-known/oauth-authorization-server").DoRaw(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("discovering OAuth server: %w", err)
+	}
+	metadata := struct {
+		AuthorizationEndpoint string `json:"authorization_endpoint"`
+		TokenEndpoint         string `json:"token_endpoint"`
+	}{}
+	if err := json.Unmarshal(raw, &metadata); err != nil {
+		return nil, fmt.Errorf("invalid OAuth server metadata: %w", err)
+	}
+
+	return &oauthAuthenticator{
+		client: client,
+		config: &oauth2.Config{
+			ClientID:     options.ClientID,
+			ClientSecret: strings.TrimSpace(string(clientSecret)),
+			RedirectURL:  options.RedirectURL,
+			Scopes:       []string{"user:info"},
+			Endpoint: oauth2.Endpoint{
+				AuthURL:  metadata.AuthorizationEndpoint,
+				TokenURL: metadata.TokenEndpoint,
+			},
+		},
+		httpClient: &http.Client{Transport: transport, Timeout: 30 * time.Second},
+		sessionKey: sessionKey,
+	}, nil
+}
+
+// require authenticates the request before passing it to the handler. Unauthenticated
+// browsers are redirected to the OAuth server, other clients get 401.
+func (a *oauthAuthenticator) require(handler http.Handler, browser bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, err := a.authenticate(r)
+		if err != nil {
+			klog.V(2).Infof("request authentication error %v", err)
+		}
+		if user != nil {
+			handler.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), userKey{}, user)))
+			return
+		}
+		if !browser || a.config == nil {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="cli-manager"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		a.redirectToLogin(w, r)
+	})
+}
+
+// authenticate returns the user of the bearer token or the session cookie of the request. The
+// session cookies are only accepted by the authenticators with a session key.
+func (a *oauthAuthenticator) authenticate(r *http.Request) (*authenticationv1.UserInfo, error) {
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		return a.reviewToken(r.Context(), token)
+	}
+	if len(a.sessionKey) == 0 {
+		return nil, nil
+	}
+	cookie, err := r.Cookie(sessionCookie)
+	if err != nil {
+		return nil, nil
+	}
+	return a.verifySession(cookie.Value)
+}
+
+// reviewToken returns the user the token belongs to.
+func (a *oauthAuthenticator) reviewToken(ctx context.Context, token string) (*authenticationv1.UserInfo, error) {
+	review, err := a.client.AuthenticationV1().TokenReviews().Create(ctx, &authenticationv1.TokenReview{
+		Spec: authenticationv1.TokenReviewSpec{Token: token},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		return nil, err
+	}
+	if !review.Status.Authenticated {
+		return nil, fmt.Errorf("token is not authenticated: %s", review.Status.Error)
+	}
+	return &review.Status.User, nil
+}
+
+func (a *oauthAuthenticator) redirectToLogin(w http.ResponseWriter, r *http.Request) {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	state := hex.EncodeToString(nonce)
+	http.SetCookie(w, &http.Cookie{
+		Name:     stateCookie,
+		Value:    state + "|" + r.URL.RequestURI(),
+		Path:     "/",
+		MaxAge:   int((10 * time.Minute).Seconds()),
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, a.config.AuthCodeURL(state), http.StatusFound)
+}
+
+// handleCallback exchanges the authorization code for an access token
+// and stores the identity of its user in the session cookie.
+func (a *oauthAuthenticator) handleCallback(w http.ResponseWriter, r *http.Request) {
+	cookie, err := r.Cookie(stateCookie)
+	if err != nil {
+		http.Error(w, "missing OAuth state", http.StatusBadRequest)
+		return
+	}
+	state, redirect, _ := strings.Cut(cookie.Value, "|")
+	if len(state) == 0 || !hmac.Equal([]byte(state), []byte(r.URL.Query().Get("state"))) {
+		http.Error(w, "invalid OAuth state", http.StatusBadRequest)
+		return
+	}
+	if errMsg := r.URL.Query().Get("error"); len(errMsg) > 0 {
+		http.Error(w, fmt.Sprintf("OAuth error: %s", errMsg), http.StatusForbidden)
+		return
+	}
+
+	ctx := context.WithValue(r.Context(), oauth2.HTTPClient, a.httpClient)
+	token, err := a.config.Exchange(ctx, r.URL.Query().Get("code"))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("OAuth code exchange error: %s", err), http.StatusForbidden)
+		return
+	}
+	user, err := a.reviewToken(r.Context(), token.AccessToken)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("OAuth token review error: %s", err), http.StatusForbidden)
+		return
+	}
+
+	expires := time.Now().Add(maxSessionDuration)
+	if !token.Expiry.IsZero() && token.Expiry.Before(expires) {
+		expires = token.Expiry
+	}
+	value, err := a.signSession(session{User: *user, Expires: expires.Unix()})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookie,
+		Value:    value,
+		Path:     "/",
+		Expires:  expires,
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.SetCookie(w, &http.Cookie{Name: stateCookie, Path: "/", MaxAge: -1})
+
+	// only redirect to local paths
+	if u, err := url.Parse(redirect); err != nil || len(u.Host) > 0 || !strings.HasPrefix(redirect, "/") || strings.HasPrefix(redirect, "//") {
+		redirect = git.PathPrefix + "/catalog"
+	}
+	http.Redirect(w, r, redirect, http.StatusFound)
+}
+
+// signSession returns the session signed with the session key.
+func (a *oauthAuthenticator) signSession(s session) (string, error) {
+	payload, err := json.Marshal(s)
+	if err != nil {
+		return "", err
+	}
+	mac := hmac.New(sha256.New, a.sessionKey)
+	mac.Write(payload)
+	return base64.RawURLEncoding.EncodeToString(payload) + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil)), nil
+}
+
+// verifySession returns the user of the signed session. The sessions are rejected without session
+// key, since anyone can sign them with an empty key.
+func (a *oauthAuthenticator) verifySession(value string) (*authenticationv1.UserInfo, error) {
+	if len(a.sessionKey) == 0 {
+		return nil, fmt.Errorf("sessions are not accepted without session key")
+	}
+	encodedPayload, encodedSignature, ok := strings.Cut(value, ".")
+	if !ok {
+		return nil, fmt.Errorf("malformed session")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encodedPayload)
+	if err != nil {
+		return nil, err
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(encodedSignature)
+	if err != nil {
+		return nil, err
+	}
+	mac := hmac.New(sha256.New, a.sessionKey)
+	mac.Write(payload)
+	if !hmac.Equal(signature, mac.Sum(nil)) {
+		return nil, fmt.Errorf("invalid session signature")
+	}
+	s := session{}
+	if err := json.Unmarshal(payload, &s); err != nil {
+		return nil, err
+	}
+	if time.Now().Unix() > s.Expires {
+		return nil, fmt.Errorf("session of %s is expired", s.User.Username)
+	}
+	return &s.User, nil
+}
@@ -0,0 +1,119 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestSession(t *testing.T) {
+	a := &oauthAuthenticator{sessionKey: []byte("key")}
+	user := authenticationv1.UserInfo{Username: "developer", Groups: []string{"system:authenticated"}}
+	value, err := a.signSession(session{User: user, Expires: time.Now().Add(time.Hour).Unix()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	verified, err := a.verifySession(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if verified.Username != user.Username || len(verified.Groups) != 1 {
+		t.Fatalf("expected the user of the session, got %v", verified)
+	}
+
+	payload, signature, _ := strings.Cut(value, ".")
+	forged, err := (&oauthAuthenticator{sessionKey: []byte("other")}).signSession(session{User: authenticationv1.UserInfo{Username: "admin"}, Expires: time.Now().Add(time.Hour).Unix()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	forgedPayload, _, _ := strings.Cut(forged, ".")
+	expired, err := a.signSession(session{User: user, Expires: time.Now().Add(-time.Minute).Unix()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, value := range map[string]string{
+		"signed with another key": forged,
+		"tampered payload":        forgedPayload + "." + signature,
+		"truncated signature":     payload + "." + signature[:len(signature)-2],
+		"unsigned":                payload,
+		"expired":                 expired,
+	} {
+		if verified, err := a.verifySession(value); err == nil {
+			t.Errorf("%s: expected the session to be rejected, got %v", name, verified)
+		}
+	}
+
+	// the sessions are rejected without session key, since anyone can sign them
+	unsigned := &oauthAuthenticator{}
+	value, err = unsigned.signSession(session{User: user, Expires: time.Now().Add(time.Hour).Unix()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if verified, err := unsigned.verifySession(value); err == nil {
+		t.Errorf("expected the session to be rejected without session key, got %v", verified)
+	}
+}
+
+func TestRequire(t *testing.T) {
+	a := &oauthAuthenticator{
+		client:     newTestClient(),
+		config:     &oauth2.Config{Endpoint: oauth2.Endpoint{AuthURL: "https://oauth.example.com/authorize"}},
+		sessionKey: []byte("key"),
+	}
+	value, err := a.signSession(session{User: authenticationv1.UserInfo{Username: "developer"}, Expires: time.Now().Add(time.Hour).Unix()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := func(browser bool) http.Handler {
+		return a.require(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(userFrom(r.Context()).Username))
+		}), browser)
+	}
+
+	for name, tc := range map[string]struct {
+		authorization string
+		cookie        string
+		browser       bool
+		code          int
+		user          string
+	}{
+		"bearer token":             {authorization: "Bearer " + adminToken, code: http.StatusOK, user: adminUser},
+		"invalid bearer token":     {authorization: "Bearer other", code: http.StatusUnauthorized},
+		"bearer token over cookie": {authorization: "Bearer " + adminToken, cookie: value, code: http.StatusOK, user: adminUser},
+		"session cookie":           {cookie: value, code: http.StatusOK, user: "developer"},
+		"forged session cookie":    {cookie: forgedSession(t, adminUser).Value, code: http.StatusUnauthorized},
+		"anonymous":                {code: http.StatusUnauthorized},
+		"anonymous browser":        {browser: true, code: http.StatusFound},
+	} {
+		r := httptest.NewRequest(http.MethodGet, "/catalog", nil)
+		if len(tc.authorization) > 0 {
+			r.Header.Set("Authorization", tc.authorization)
+		}
+		if len(tc.cookie) > 0 {
+			r.AddCookie(&http.Cookie{Name: sessionCookie, Value: tc.cookie})
+		}
+		w := httptest.NewRecorder()
+		handler(tc.browser).ServeHTTP(w, r)
+		if w.Code != tc.code {
+			t.Errorf("%s: expected %d, got %d %s", name, tc.code, w.Code, w.Body)
+			continue
+		}
+		if len(tc.user) > 0 && w.Body.String() != tc.user {
+			t.Errorf("%s: expected user %s, got %s", name, tc.user, w.Body)
+		}
+	}
+
+	// the bearer authenticators ignore the session cookies
+	bearer := newBearerAuthenticator(fake.NewSimpleClientset())
+	r := httptest.NewRequest(http.MethodGet, "/catalog", nil)
+	r.AddCookie(&http.Cookie{Name: sessionCookie, Value: value})
+	if user, err := bearer.authenticate(r); user != nil || err != nil {
+		t.Errorf("expected the session cookie to be ignored, got %v %v", user, err)
+	}
+}
@@ -0,0 +1,151 @@
+package server
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/yaml"
+
+	"github.com/openshift/cli-manager/api/v1alpha1"
+	"github.com/openshift/cli-manager/pkg/git"
+)
+
+// PublishedByAnnotation records the name prefix of the token the plugin is published with.
+const PublishedByAnnotation = "cli-manager.openshift.io/published-by"
+
+var safePluginRegexp = regexp.MustCompile(`^[\w-]+$`)
+
+// handlePublish creates or updates the plugin in the request path with the spec
+// of the Plugin in the request body. Publishers authenticate with a bearer token
+// that is only allowed to publish plugins whose names start with the prefix the
+// token is stored under in the publisher tokens Secret. This decouples plugin
+// publication by CI systems from the cluster RBAC on the Plugin resource.
+func (s *Server) handlePublish(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut && r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	name := strings.TrimPrefix(r.URL.Path, git.PathPrefix+"/api/v1alpha1/publish/")
+	if !safePluginRegexp.MatchString(name) || len(name) > 100 {
+		http.Error(w, fmt.Sprintf("invalid plugin name %s", name), http.StatusBadRequest)
+		return
+	}
+
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || len(token) == 0 {
+		http.Error(w, "missing bearer token", http.StatusUnauthorized)
+		return
+	}
+	prefix, err := s.publisherPrefix(r, token, name)
+	if err != nil {
+		klog.Errorf("publisher tokens can not be retrieved: %v", err)
+		http.Error(w, "publisher tokens can not be retrieved", http.StatusInternalServerError)
+		return
+	}
+	if len(prefix) == 0 {
+		http.Error(w, fmt.Sprintf("token is not allowed to publish plugin %s", name), http.StatusForbidden)
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, 1<<20))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("reading request body: %s", err), http.StatusBadRequest)
+		return
+	}
+	requested := &v1alpha1.Plugin{}
+	if err := yaml.Unmarshal(body, requested); err != nil {
+		http.Error(w, fmt.Sprintf("invalid plugin: %s", err), http.StatusBadRequest)
+		return
+	}
+	if len(requested.Name) > 0 && requested.Name != name {
+		http.Error(w, fmt.Sprintf("plugin name %s does not match %s", requested.Name, name), http.StatusBadRequest)
+		return
+	}
+
+	requested.Name = name
+	obj, code, err := s.applyPlugin(r.Context(), requested, map[string]string{PublishedByAnnotation: prefix}, false)
+	if err != nil {
+		if errors.IsInvalid(err) || errors.IsBadRequest(err) {
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+			return
+		}
+		http.Error(w, fmt.Sprintf("publishing plugin %s: %s", name, err), http.StatusInternalServerError)
+		return
+	}
+
+	klog.Infof("plugin %s is published by the token of %s", name, prefix)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(obj.Object)
+}
+
+// publisherPrefix returns the name prefix the token is stored under if the
+// plugin name starts with it, or an empty string if the token is not allowed
+// to publish the plugin.
+func (s *Server) publisherPrefix(r *http.Request, token, name string) (string, error) {
+	namespace, secretName, ok := strings.Cut(s.options.PublisherTokensSecret, "/")
+	if !ok {
+		return "", fmt.Errorf("invalid publisher tokens secret %s, should be in namespace/name format", s.options.PublisherTokensSecret)
+	}
+	secret, err := s.client.CoreV1().Secrets(namespace).Get(r.Context(), secretName, metav1.GetOptions{})
+	if err != nil {
+		return "", err
+	}
+	for prefix, value := range secret.Data {
+		if subtle.ConstantTimeCompare([]byte(strings.TrimSpace(string(value))), []byte(token)) == 1 && strings.HasPrefix(name, prefix) {
+			return prefix, nil
+		}
+	}
+	return "", nil
+}
+
+// applyPlugin creates the plugin, or updates the spec of the existing one, and merges the
+// annotations into its annotations. The status code of the created or updated plugin is returned.
+func (s *Server) applyPlugin(ctx context.Context, plugin *v1alpha1.Plugin, annotations map[string]string, dryRun bool) (*unstructured.Unstructured, int, error) {
+	spec, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&plugin.Spec)
+	if err != nil {
+		return nil, 0, errors.NewBadRequest(fmt.Sprintf("invalid plugin spec: %s", err))
+	}
+	var dryRunOptions []string
+	if dryRun {
+		dryRunOptions = []string{metav1.DryRunAll}
+	}
+
+	obj, err := s.dynamicClient.Resource(pluginsGVR).Get(ctx, plugin.Name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		obj = &unstructured.Unstructured{Object: map[string]interface{}{}}
+		obj.SetAPIVersion(v1alpha1.GroupVersion.String())
+		obj.SetKind("Plugin")
+		obj.SetName(plugin.Name)
+		obj.SetAnnotations(annotations)
+		obj.Object["spec"] = spec
+		obj, err = s.dynamicClient.Resource(pluginsGVR).Create(ctx, obj, metav1.CreateOptions{DryRun: dryRunOptions})
+		return obj, http.StatusCreated, err
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	merged := obj.GetAnnotations()
+	if merged == nil {
+		merged = map[string]string{}
+	}
+	for k, v := range annotations {
+		merged[k] = v
+	}
+	obj.SetAnnotations(merged)
+	obj.Object["spec"] = spec
+	obj, err = s.dynamicClient.Resource(pluginsGVR).Update(ctx, obj, metav1.UpdateOptions{DryRun: dryRunOptions})
+	return obj, http.StatusOK, err
+}
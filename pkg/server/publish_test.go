@@ -0,0 +1,71 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/openshift/cli-manager/pkg/git"
+)
+
+func publishRequest(name, token, manifest string) *http.Request {
+	r := httptest.NewRequest(http.MethodPut, git.PathPrefix+"/api/v1alpha1/publish/"+name, strings.NewReader(manifest))
+	if len(token) > 0 {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	return r
+}
+
+func TestHandlePublish(t *testing.T) {
+	s := newTestServer(t, newFakeController(), Options{PublisherTokensSecret: "cli-manager/publishers"})
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "cli-manager", Name: "publishers"},
+		Data: map[string][]byte{
+			"acme-":  []byte("acme-token\n"),
+			"other-": []byte("other-token"),
+		},
+	}
+	if _, err := s.client.CoreV1().Secrets(secret.Namespace).Create(context.Background(), secret, metav1.CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	manifest := strings.Replace(applyManifest, "name: tool", "name: acme-tool", 1)
+
+	for _, tc := range []struct {
+		name     string
+		plugin   string
+		token    string
+		manifest string
+		code     int
+	}{
+		{name: "without token", plugin: "acme-tool", manifest: manifest, code: http.StatusUnauthorized},
+		{name: "unknown token", plugin: "acme-tool", token: "unknown", manifest: manifest, code: http.StatusForbidden},
+		{name: "token of another prefix", plugin: "acme-tool", token: "other-token", manifest: manifest, code: http.StatusForbidden},
+		{name: "invalid name", plugin: "acme-tool!", token: "acme-token", manifest: manifest, code: http.StatusBadRequest},
+		{name: "name mismatch", plugin: "acme-other", token: "acme-token", manifest: manifest, code: http.StatusBadRequest},
+		{name: "create", plugin: "acme-tool", token: "acme-token", manifest: manifest, code: http.StatusCreated},
+		{name: "update", plugin: "acme-tool", token: "acme-token", manifest: manifest, code: http.StatusOK},
+		{name: "name of the path", plugin: "acme-cli", token: "acme-token", manifest: strings.Replace(manifest, "name: acme-tool", "name: ''", 1), code: http.StatusCreated},
+	} {
+		if w := serve(s, publishRequest(tc.plugin, tc.token, tc.manifest)); w.Code != tc.code {
+			t.Errorf("%s: expected %d, got %d %s", tc.name, tc.code, w.Code, w.Body)
+		}
+	}
+
+	for _, name := range []string{"acme-tool", "acme-cli"} {
+		obj, err := s.dynamicClient.Resource(pluginsGVR).Get(context.Background(), name, metav1.GetOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if prefix := obj.GetAnnotations()[PublishedByAnnotation]; prefix != "acme-" {
+			t.Errorf("expected plugin %s to be published by acme-, got %q", name, prefix)
+		}
+	}
+	if _, err := s.dynamicClient.Resource(pluginsGVR).Get(context.Background(), "acme-other", metav1.GetOptions{}); err == nil {
+		t.Error("expected the mismatching plugin not to be published")
+	}
+}
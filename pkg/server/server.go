@@ -0,0 +1,162 @@
+// Package server implements the REST API served next to the git index.
+package server
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"golang.org/x/sync/singleflight"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/component-base/metrics"
+	"k8s.io/component-base/metrics/legacyregistry"
+
+	"github.com/openshift/cli-manager/api/v1alpha1"
+	"github.com/openshift/cli-manager/pkg/controller"
+	"github.com/openshift/cli-manager/pkg/git"
+)
+
+var (
+	registerMetrics  sync.Once
+	apiRequestCounts = metrics.NewCounterVec(
+		&metrics.CounterOpts{
+			Name:           "cli_manager_api_requests_total",
+			Help:           "Total counts of REST API requests",
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{"name", "code"},
+	)
+
+	pluginsGVR = schema.GroupVersionResource{
+		Group:    v1alpha1.GroupVersion.Group,
+		Version:  v1alpha1.GroupVersion.Version,
+		Resource: "plugins",
+	}
+)
+
+func init() {
+	registerMetrics.Do(func() {
+		legacyregistry.MustRegister(apiRequestCounts)
+	})
+}
+
+// Options holds the REST API configuration set by command line flags.
+type Options struct {
+	// PublisherTokensSecret is the namespace/name of the Secret that maps plugin
+	// name prefixes to the tokens allowed to publish them. Publishing is disabled if empty.
+	PublisherTokensSecret string
+	// OAuth gates the catalog and the JSON API behind the cluster OAuth server.
+	OAuth OAuthOptions
+	// RBACVisibility limits the catalog and the JSON API to the plugins the user is allowed to get.
+	// Trusted frontends may then query on behalf of their users with impersonation headers.
+	RBACVisibility bool
+	// OnDemandPlatforms are the platforms only published once demanded through the API.
+	OnDemandPlatforms []string
+	// UpstreamIndexURL is the directory of the plugin manifests of the upstream krew index the
+	// mirrored plugins are compared against. The upgrade report is disabled if empty.
+	UpstreamIndexURL string
+}
+
+// Controller is the plugin controller the REST API is served from.
+type Controller interface {
+	// Lister returns the lister of the Plugins cache.
+	Lister() cache.GenericLister
+	// Fsck cross-checks the Plugins, artifacts and indexes and optionally repairs them.
+	Fsck(ctx context.Context, repair bool) (*controller.FsckReport, error)
+	// HoldIndex defers the index commits until the returned function is called.
+	HoldIndex() func()
+}
+
+// Server serves the REST API.
+type Server struct {
+	client        kubernetes.Interface
+	dynamicClient dynamic.Interface
+	controller    Controller
+	lister        cache.GenericLister
+	oauth         *oauthAuthenticator
+	// admin authenticates the bearer tokens of the admin API
+	admin       *oauthAuthenticator
+	idempotency *idempotencyCache
+	// applyHold is the index hold of the batches applied
+	applyHold applyHold
+	// demands coalesces the concurrent demands of the same on-demand platform
+	demands singleflight.Group
+	options Options
+}
+
+// New returns the REST API server. The cluster OAuth server is discovered if OAuth is configured.
+func New(ctx context.Context, client kubernetes.Interface, dynamicClient dynamic.Interface, pluginController Controller, options Options) (*Server, error) {
+	s := &Server{
+		client:        client,
+		dynamicClient: dynamicClient,
+		controller:    pluginController,
+		lister:        pluginController.Lister(),
+		admin:         newBearerAuthenticator(client),
+		options:       options,
+		idempotency:   newIdempotencyCache(),
+	}
+	if len(options.OAuth.ClientID) > 0 {
+		oauth, err := newOAuthAuthenticator(ctx, client, options.OAuth)
+		if err != nil {
+			return nil, err
+		}
+		s.oauth = oauth
+	} else if options.RBACVisibility {
+		// users are only identified by their bearer tokens without OAuth
+		s.oauth = newBearerAuthenticator(client)
+	}
+	return s, nil
+}
+
+// RegisterHandlers registers the REST API endpoints into the mux.
+func (s *Server) RegisterHandlers(mux *http.ServeMux) {
+	if len(s.options.PublisherTokensSecret) > 0 {
+		mux.Handle(git.PathPrefix+"/api/v1alpha1/publish/", instrument("publish", s.idempotent(http.HandlerFunc(s.handlePublish), 1<<20)))
+	}
+	mux.Handle(git.PathPrefix+"/api/v1alpha1/plugins", instrument("plugins", s.requireUser(http.HandlerFunc(s.handleListPlugins), false)))
+	mux.Handle(git.PathPrefix+"/api/v1alpha1/plugins/", instrument("plugins", s.requireUser(s.idempotent(http.HandlerFunc(s.handleListPlugins), 1<<20), false)))
+	mux.Handle(git.PathPrefix+"/catalog", instrument("catalog", s.requireUser(http.HandlerFunc(s.handleCatalog), true)))
+	mux.Handle(git.PathPrefix+"/api/v1alpha1/admin/fsck", instrument("fsck", s.admin.require(s.idempotent(http.HandlerFunc(s.handleFsck), 1<<20), false)))
+	mux.Handle(git.PathPrefix+"/api/v1alpha1/admin/apply", instrument("apply", s.admin.require(s.idempotent(http.HandlerFunc(s.handleApply), maxApplyBodySize), false)))
+	if len(s.options.UpstreamIndexURL) > 0 {
+		mux.Handle(git.PathPrefix+"/api/v1alpha1/admin/upgrades", instrument("upgrades", s.admin.require(http.HandlerFunc(s.handleUpgrades), false)))
+	}
+	mux.Handle(DiscoveryPath, instrument("discovery", http.HandlerFunc(s.handleDiscovery)))
+	if s.oauth != nil && s.oauth.config != nil {
+		mux.Handle(git.PathPrefix+"/oauth/callback", instrument("oauth-callback", http.HandlerFunc(s.oauth.handleCallback)))
+	}
+}
+
+// requireUser authenticates the requests of the handler if OAuth or RBAC-scoped visibility is configured.
+func (s *Server) requireUser(handler http.Handler, browser bool) http.Handler {
+	if s.oauth == nil {
+		return handler
+	}
+	if s.options.RBACVisibility {
+		handler = s.impersonate(handler)
+	}
+	return s.oauth.require(handler, browser)
+}
+
+// statusRecorder records the status code of the response.
+type statusRecorder struct {
+	http.ResponseWriter
+	code int
+}
+
+func (r *statusRecorder) WriteHeader(code int) {
+	r.code = code
+	r.ResponseWriter.WriteHeader(code)
+}
+
+func instrument(name string, handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		recorder := &statusRecorder{ResponseWriter: w, code: http.StatusOK}
+		handler.ServeHTTP(recorder, r)
+		apiRequestCounts.WithLabelValues(name, strconv.Itoa(recorder.code)).Inc()
+	})
+}
@@ -0,0 +1,294 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+	clienttesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/openshift/cli-manager/api/v1alpha1"
+	"github.com/openshift/cli-manager/pkg/controller"
+	"github.com/openshift/cli-manager/pkg/git"
+)
+
+const (
+	adminToken = "admin-token"
+	adminUser  = "admin"
+)
+
+// newTestClient returns the clientset that only authenticates the adminToken, as the adminUser
+// allowed to do anything.
+func newTestClient() *fake.Clientset {
+	client := fake.NewSimpleClientset()
+	client.PrependReactor("create", "tokenreviews", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		review := action.(clienttesting.CreateAction).GetObject().(*authenticationv1.TokenReview).DeepCopy()
+		if review.Spec.Token == adminToken {
+			review.Status = authenticationv1.TokenReviewStatus{Authenticated: true, User: authenticationv1.UserInfo{Username: adminUser}}
+		}
+		return true, review, nil
+	})
+	client.PrependReactor("create", "subjectaccessreviews", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		review := action.(clienttesting.CreateAction).GetObject().(*authorizationv1.SubjectAccessReview).DeepCopy()
+		review.Status.Allowed = review.Spec.User == adminUser
+		return true, review, nil
+	})
+	return client
+}
+
+// fakeController serves the plugins of its indexer and counts the index holds.
+type fakeController struct {
+	indexer cache.Indexer
+	lock    sync.Mutex
+	held    int
+	holds   int
+}
+
+func newFakeController() *fakeController {
+	return &fakeController{indexer: cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})}
+}
+
+func (c *fakeController) Lister() cache.GenericLister {
+	return cache.NewGenericLister(c.indexer, pluginsGVR.GroupResource())
+}
+
+func (c *fakeController) Fsck(ctx context.Context, repair bool) (*controller.FsckReport, error) {
+	return &controller.FsckReport{}, nil
+}
+
+func (c *fakeController) HoldIndex() func() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.held++
+	c.holds++
+	return func() {
+		c.lock.Lock()
+		defer c.lock.Unlock()
+		c.held--
+	}
+}
+
+// indexHolds returns the number of holds of the index not released yet, and of all holds.
+func (c *fakeController) indexHolds() (int, int) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.held, c.holds
+}
+
+// newTestServer returns the server of the controller, authenticated by newTestClient.
+func newTestServer(t *testing.T, c *fakeController, options Options) *Server {
+	t.Helper()
+	dynamicClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{pluginsGVR: "PluginList"})
+	s, err := New(context.Background(), newTestClient(), dynamicClient, c, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// forgedSession returns a session cookie of the user signed with an empty key.
+func forgedSession(t *testing.T, username string) *http.Cookie {
+	t.Helper()
+	value, err := (&oauthAuthenticator{}).signSession(session{
+		User:    authenticationv1.UserInfo{Username: username},
+		Expires: time.Now().Add(time.Hour).Unix(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &http.Cookie{Name: sessionCookie, Value: value}
+}
+
+func serve(s *Server, r *http.Request) *httptest.ResponseRecorder {
+	mux := http.NewServeMux()
+	s.RegisterHandlers(mux)
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, r)
+	return w
+}
+
+func TestAdminRequiresBearerToken(t *testing.T) {
+	s := newTestServer(t, newFakeController(), Options{})
+	path := git.PathPrefix + "/api/v1alpha1/admin/fsck"
+
+	r := httptest.NewRequest(http.MethodGet, path, nil)
+	r.AddCookie(forgedSession(t, adminUser))
+	if w := serve(s, r); w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected the forged session to be unauthorized, got %d %s", w.Code, w.Body)
+	}
+
+	r = httptest.NewRequest(http.MethodGet, path, nil)
+	r.Header.Set("Authorization", "Bearer other-token")
+	if w := serve(s, r); w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected the unknown token to be unauthorized, got %d %s", w.Code, w.Body)
+	}
+
+	r = httptest.NewRequest(http.MethodGet, path, nil)
+	r.Header.Set("Authorization", "Bearer "+adminToken)
+	if w := serve(s, r); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "issues") {
+		t.Fatalf("expected the fsck report, got %d %s", w.Code, w.Body)
+	}
+}
+
+func TestRBACVisibilityRequiresBearerToken(t *testing.T) {
+	s := newTestServer(t, newFakeController(), Options{RBACVisibility: true})
+	path := git.PathPrefix + "/api/v1alpha1/plugins"
+
+	r := httptest.NewRequest(http.MethodGet, path, nil)
+	r.AddCookie(forgedSession(t, adminUser))
+	if w := serve(s, r); w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected the forged session to be unauthorized, got %d %s", w.Code, w.Body)
+	}
+
+	r = httptest.NewRequest(http.MethodGet, path, nil)
+	r.Header.Set("Authorization", "Bearer "+adminToken)
+	if w := serve(s, r); w.Code != http.StatusOK {
+		t.Fatalf("expected the plugins, got %d %s", w.Code, w.Body)
+	}
+}
+
+func TestDiscoveryEndpoints(t *testing.T) {
+	for name, tc := range map[string]struct {
+		options  Options
+		upgrades bool
+	}{
+		"without upstream index": {Options{}, false},
+		"with upstream index":    {Options{UpstreamIndexURL: "https://example.com/plugins"}, true},
+	} {
+		s := newTestServer(t, newFakeController(), tc.options)
+		w := serve(s, httptest.NewRequest(http.MethodGet, DiscoveryPath, nil))
+		discovery := Discovery{}
+		if err := json.Unmarshal(w.Body.Bytes(), &discovery); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		found := false
+		for _, e := range discovery.Endpoints {
+			if e.Name == "upgrades" {
+				found = e.Authentication == AuthenticationBearer && strings.HasSuffix(e.URL, "/api/v1alpha1/admin/upgrades")
+			}
+		}
+		if found != tc.upgrades {
+			t.Errorf("%s: expected the upgrades endpoint %t, got %v", name, tc.upgrades, discovery.Endpoints)
+		}
+	}
+}
+
+func TestDemandPlatform(t *testing.T) {
+	c := newFakeController()
+	s := newTestServer(t, c, Options{OnDemandPlatforms: []string{"s390x"}})
+	plugin := newApplyPlugin("tool", "quay.io/org/tool:v1")
+	plugin.Spec.Platforms = append(plugin.Spec.Platforms, v1alpha1.PluginPlatform{Platform: "linux/s390x", Image: "quay.io/org/tool:v1"})
+	if err := c.indexer.Add(plugin); err != nil {
+		t.Fatal(err)
+	}
+	u, err := runtime.DefaultUnstructuredConverter.ToUnstructured(plugin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.dynamicClient.Resource(pluginsGVR).Create(context.Background(), &unstructured.Unstructured{Object: u}, metav1.CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	demand := func(name, platform string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, git.PathPrefix+"/api/v1alpha1/plugins/"+name+"/demand?platform="+platform, nil)
+		r.Header.Set("Authorization", "Bearer "+adminToken)
+		return serve(s, r)
+	}
+
+	for name, tc := range map[string]struct {
+		plugin   string
+		platform string
+		code     int
+	}{
+		"not on demand":    {plugin: "tool", platform: "linux/amd64", code: http.StatusBadRequest},
+		"missing plugin":   {plugin: "other", platform: "linux/s390x", code: http.StatusNotFound},
+		"missing platform": {plugin: "tool", platform: "darwin/s390x", code: http.StatusNotFound},
+		"invalid platform": {plugin: "tool", platform: "", code: http.StatusBadRequest},
+	} {
+		if w := demand(tc.plugin, tc.platform); w.Code != tc.code {
+			t.Errorf("%s: expected %d, got %d %s", name, tc.code, w.Code, w.Body)
+		}
+	}
+
+	// the demands of a platform already demanded are accepted without another patch
+	for i := 0; i < 2; i++ {
+		if w := demand("tool", "linux/s390x"); w.Code != http.StatusAccepted {
+			t.Fatalf("expected the demand to be accepted, got %d %s", w.Code, w.Body)
+		}
+	}
+	obj, err := s.dynamicClient.Resource(pluginsGVR).Get(context.Background(), "tool", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if demanded := obj.GetAnnotations()[controller.DemandedPlatformsAnnotation]; demanded != "linux/s390x" {
+		t.Fatalf("expected the platform to be demanded once, got %q", demanded)
+	}
+}
+
+func TestUpgradeReport(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		versions := map[string]string{"/plugins/stale.yaml": "v1.1.0", "/plugins/current.yaml": "v1.0.0", "/plugins/upstream-tool.yaml": "v2.0.0"}
+		version, ok := versions[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte("apiVersion: krew.googlecontainertools.github.com/v1alpha2\nkind: Plugin\nspec:\n  version: " + version + "\n"))
+	}))
+	defer upstream.Close()
+	c := newFakeController()
+	s := newTestServer(t, c, Options{UpstreamIndexURL: upstream.URL + "/plugins/"})
+	for _, tc := range []struct {
+		name     string
+		mirrored bool
+		upstream string
+		resolved string
+	}{
+		{name: "stale", mirrored: true},
+		{name: "current", mirrored: true},
+		{name: "renamed", mirrored: true, upstream: "upstream-tool", resolved: "v2.0.0"},
+		{name: "missing", mirrored: true},
+		{name: "local"},
+	} {
+		plugin := newApplyPlugin(tc.name, "quay.io/org/tool:v1")
+		if tc.mirrored {
+			plugin.Annotations = map[string]string{UpstreamPluginAnnotation: tc.upstream}
+		}
+		plugin.Status.ResolvedVersion = tc.resolved
+		if err := c.indexer.Add(plugin); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r := httptest.NewRequest(http.MethodGet, git.PathPrefix+"/api/v1alpha1/admin/upgrades", nil)
+	r.Header.Set("Authorization", "Bearer "+adminToken)
+	w := serve(s, r)
+	report := UpgradeReport{}
+	if err := json.Unmarshal(w.Body.Bytes(), &report); err != nil {
+		t.Fatalf("expected the upgrade report, got %d %s", w.Code, w.Body)
+	}
+	// the plugins not mirrored from the upstream index are not reported
+	expected := []PluginUpgrade{
+		{Name: "current", Upstream: "current", Version: "v1.0.0", UpstreamVersion: "v1.0.0"},
+		{Name: "missing", Upstream: "missing", Version: "v1.0.0", Error: "plugin missing is not found in the upstream index"},
+		{Name: "renamed", Upstream: "upstream-tool", Version: "v2.0.0", UpstreamVersion: "v2.0.0"},
+		{Name: "stale", Upstream: "stale", Version: "v1.0.0", UpstreamVersion: "v1.1.0", Stale: true},
+	}
+	if !reflect.DeepEqual(report.Plugins, expected) {
+		t.Fatalf("expected the upgrades %v, got %v", expected, report.Plugins)
+	}
+}
@@ -0,0 +1,179 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8sver "k8s.io/apimachinery/pkg/util/version"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/yaml"
+
+	"github.com/openshift/cli-manager/api/v1alpha1"
+	krew "github.com/openshift/cli-manager/pkg/krew/v1alpha2"
+)
+
+const (
+	// UpstreamPluginAnnotation marks the plugins mirrored from the upstream krew index, with the
+	// name of the plugin in the upstream index, or an empty value if it is the same.
+	UpstreamPluginAnnotation = "cli-manager.openshift.io/upstream-plugin"
+
+	// DefaultUpstreamIndexURL is the directory of the plugin manifests of the upstream krew index.
+	DefaultUpstreamIndexURL = "https://raw.githubusercontent.com/kubernetes-sigs/krew-index/master/plugins"
+
+	// upstreamWorkers is the number of upstream manifests fetched at once.
+	upstreamWorkers = 8
+	// maxManifestSize bounds the size of the upstream manifests read.
+	maxManifestSize = 1 << 20
+)
+
+// UpgradeReport lists the mirrored plugins with their versions in the upstream krew index.
+type UpgradeReport struct {
+	Plugins []PluginUpgrade `json:"plugins"`
+}
+
+// PluginUpgrade compares the version of a mirrored plugin against the upstream krew index.
+type PluginUpgrade struct {
+	// Name is the name of the Plugin.
+	Name string `json:"name"`
+	// Upstream is the name of the plugin in the upstream index.
+	Upstream string `json:"upstream"`
+	// Version is the version of the Plugin.
+	Version string `json:"version"`
+	// UpstreamVersion is the version of the plugin in the upstream index.
+	UpstreamVersion string `json:"upstreamVersion,omitempty"`
+	// Stale reports whether the upstream version is newer than the version of the Plugin.
+	Stale bool `json:"stale"`
+	// Error is the reason the upstream version is unknown.
+	Error string `json:"error,omitempty"`
+}
+
+// handleUpgrades reports which mirrored plugins are older than in the upstream krew index.
+// It requires the list permission on plugins.
+func (s *Server) handleUpgrades(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !s.authorizeAdmin(w, r, "list") {
+		return
+	}
+	report, err := s.upgradeReport(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, report)
+}
+
+// upgradeReport fetches the upstream manifests of the mirrored plugins and compares their versions.
+func (s *Server) upgradeReport(ctx context.Context) (*UpgradeReport, error) {
+	objs, err := s.lister.List(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+	report := &UpgradeReport{Plugins: []PluginUpgrade{}}
+	for _, obj := range objs {
+		u, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+		if err != nil {
+			continue
+		}
+		plugin := &v1alpha1.Plugin{}
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(u, plugin); err != nil {
+			continue
+		}
+		upstream, ok := plugin.Annotations[UpstreamPluginAnnotation]
+		if !ok {
+			continue
+		}
+		if len(upstream) == 0 {
+			upstream = plugin.Name
+		}
+		version := plugin.Spec.Version
+		if len(plugin.Status.ResolvedVersion) > 0 {
+			version = plugin.Status.ResolvedVersion
+		}
+		report.Plugins = append(report.Plugins, PluginUpgrade{
+			Name:     plugin.Name,
+			Upstream: upstream,
+			Version:  version,
+		})
+	}
+	sort.Slice(report.Plugins, func(i, j int) bool {
+		return report.Plugins[i].Name < report.Plugins[j].Name
+	})
+
+	client := &http.Client{Timeout: time.Minute}
+	var workers errgroup.Group
+	workers.SetLimit(upstreamWorkers)
+	for i := range report.Plugins {
+		p := &report.Plugins[i]
+		workers.Go(func() error {
+			version, err := upstreamVersion(ctx, client, s.options.UpstreamIndexURL, p.Upstream)
+			if err != nil {
+				klog.V(2).Infof("upstream version of plugin %s error %v", p.Name, err)
+				p.Error = err.Error()
+				return nil
+			}
+			p.UpstreamVersion = version
+			p.Stale, err = isOlder(p.Version, version)
+			if err != nil {
+				p.Error = err.Error()
+			}
+			return nil
+		})
+	}
+	workers.Wait()
+	return report, nil
+}
+
+// upstreamVersion returns the version of the plugin manifest in the upstream index.
+func upstreamVersion(ctx context.Context, client *http.Client, indexURL, name string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(indexURL, "/")+"/"+name+".yaml", nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return "", fmt.Errorf("plugin %s is not found in the upstream index", name)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("upstream index returned %s for plugin %s", resp.Status, name)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxManifestSize))
+	if err != nil {
+		return "", err
+	}
+	manifest := &krew.Plugin{}
+	if err := yaml.Unmarshal(data, manifest); err != nil {
+		return "", fmt.Errorf("invalid upstream manifest of plugin %s: %w", name, err)
+	}
+	if len(manifest.Spec.Version) == 0 {
+		return "", fmt.Errorf("upstream manifest of plugin %s has no version", name)
+	}
+	return manifest.Spec.Version, nil
+}
+
+// isOlder reports whether the version is older than the upstream version, both in v0.0.0 format.
+func isOlder(version, upstream string) (bool, error) {
+	local, err := k8sver.ParseSemantic(version)
+	if err != nil {
+		return false, fmt.Errorf("invalid version %s: %w", version, err)
+	}
+	remote, err := k8sver.ParseSemantic(upstream)
+	if err != nil {
+		return false, fmt.Errorf("invalid upstream version %s: %w", upstream, err)
+	}
+	return local.LessThan(remote), nil
+}
@@ -0,0 +1,120 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+)
+
+// impersonate replaces the authenticated user of the request with the one in the
+// Impersonate-User and Impersonate-Group headers. Like the API server, the headers
+// are only honored if the authenticated user is allowed to impersonate them, so that
+// trusted frontends can query the plugins visible to their logged-in users.
+func (s *Server) impersonate(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := r.Header.Get(authenticationv1.ImpersonateUserHeader)
+		groups := r.Header.Values(authenticationv1.ImpersonateGroupHeader)
+		if len(name) == 0 {
+			if len(groups) > 0 {
+				http.Error(w, "impersonating groups requires impersonating a user", http.StatusBadRequest)
+				return
+			}
+			handler.ServeHTTP(w, r)
+			return
+		}
+
+		user := userFrom(r.Context())
+		if user == nil {
+			http.Error(w, "impersonation requires authentication", http.StatusUnauthorized)
+			return
+		}
+		attributes := []authorizationv1.ResourceAttributes{{Verb: "impersonate", Resource: "users", Name: name}}
+		if serviceAccount, ok := strings.CutPrefix(name, "system:serviceaccount:"); ok {
+			if namespace, serviceAccountName, ok := strings.Cut(serviceAccount, ":"); ok {
+				attributes[0] = authorizationv1.ResourceAttributes{Verb: "impersonate", Resource: "serviceaccounts", Namespace: namespace, Name: serviceAccountName}
+			}
+		}
+		for _, group := range groups {
+			attributes = append(attributes, authorizationv1.ResourceAttributes{Verb: "impersonate", Resource: "groups", Name: group})
+		}
+		for i := range attributes {
+			allowed, err := s.authorize(r.Context(), user, &attributes[i])
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			if !allowed {
+				http.Error(w, fmt.Sprintf("user %s cannot impersonate %s %s", user.Username, attributes[i].Resource, attributes[i].Name), http.StatusForbidden)
+				return
+			}
+		}
+
+		klog.V(4).Infof("user %s impersonates %s %v", user.Username, name, groups)
+		impersonated := &authenticationv1.UserInfo{Username: name, Groups: groups}
+		handler.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), userKey{}, impersonated)))
+	})
+}
+
+// authorize reports whether the user is allowed to perform the action with a SubjectAccessReview.
+func (s *Server) authorize(ctx context.Context, user *authenticationv1.UserInfo, attributes *authorizationv1.ResourceAttributes) (bool, error) {
+	extra := map[string]authorizationv1.ExtraValue{}
+	for k, v := range user.Extra {
+		extra[k] = authorizationv1.ExtraValue(v)
+	}
+	review, err := s.client.AuthorizationV1().SubjectAccessReviews().Create(ctx, &authorizationv1.SubjectAccessReview{
+		Spec: authorizationv1.SubjectAccessReviewSpec{
+			ResourceAttributes: attributes,
+			User:               user.Username,
+			Groups:             user.Groups,
+			UID:                user.UID,
+			Extra:              extra,
+		},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		return false, err
+	}
+	return review.Status.Allowed, nil
+}
+
+// visiblePlugins filters the plugins to the ones the user of the request is allowed to get.
+// Users allowed to list all plugins see the whole catalog without per plugin reviews.
+func (s *Server) visiblePlugins(ctx context.Context, plugins []PluginInfo) ([]PluginInfo, error) {
+	if !s.options.RBACVisibility {
+		return plugins, nil
+	}
+	user := userFrom(ctx)
+	if user == nil {
+		return []PluginInfo{}, nil
+	}
+
+	attributes := func(verb, name string) *authorizationv1.ResourceAttributes {
+		return &authorizationv1.ResourceAttributes{
+			Verb:     verb,
+			Group:    pluginsGVR.Group,
+			Version:  pluginsGVR.Version,
+			Resource: pluginsGVR.Resource,
+			Name:     name,
+		}
+	}
+	all, err := s.authorize(ctx, user, attributes("list", ""))
+	if err != nil || all {
+		return plugins, err
+	}
+	visible := make([]PluginInfo, 0, len(plugins))
+	for _, p := range plugins {
+		allowed, err := s.authorize(ctx, user, attributes("get", p.Name))
+		if err != nil {
+			return nil, err
+		}
+		if allowed {
+			visible = append(visible, p)
+		}
+	}
+	return visible, nil
+}
@@ -17,6 +17,7 @@ import (
 	apiextclientv1 "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset"
 	"k8s.io/apimachinery/pkg/api/equality"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	machineryruntime "k8s.io/apimachinery/pkg/runtime"
@@ -82,6 +83,20 @@ func TestMain(m *testing.M) {
 				return err
 			},
 		},
+		{
+			path: "assets/01_config.openshift.io_namespacedplugins.yaml",
+			readerAndApply: func(objBytes []byte) error {
+				_, _, err := resourceapply.ApplyCustomResourceDefinitionV1(ctx, apiExtClient.ApiextensionsV1(), eventRecorder, resourceread.ReadCustomResourceDefinitionV1OrDie(objBytes))
+				return err
+			},
+		},
+		{
+			path: "assets/01_config.openshift.io_pluginrepositories.yaml",
+			readerAndApply: func(objBytes []byte) error {
+				_, _, err := resourceapply.ApplyCustomResourceDefinitionV1(ctx, apiExtClient.ApiextensionsV1(), eventRecorder, resourceread.ReadCustomResourceDefinitionV1OrDie(objBytes))
+				return err
+			},
+		},
 		{
 			path: "assets/02_clusterrole.yaml",
 			readerAndApply: func(objBytes []byte) error {
@@ -138,6 +153,34 @@ func TestMain(m *testing.M) {
 				return err
 			},
 		},
+		{
+			path: "assets/11_validatingwebhookconfiguration.yaml",
+			readerAndApply: func(objBytes []byte) error {
+				_, _, err := resourceapply.ApplyValidatingWebhookConfigurationImproved(ctx, kubeClient.AdmissionregistrationV1(), eventRecorder, resourceread.ReadValidatingWebhookConfigurationV1OrDie(objBytes), resourceapply.NewResourceCache())
+				return err
+			},
+		},
+		{
+			path: "assets/12_mutatingwebhookconfiguration.yaml",
+			readerAndApply: func(objBytes []byte) error {
+				_, _, err := resourceapply.ApplyMutatingWebhookConfigurationImproved(ctx, kubeClient.AdmissionregistrationV1(), eventRecorder, resourceread.ReadMutatingWebhookConfigurationV1OrDie(objBytes), resourceapply.NewResourceCache())
+				return err
+			},
+		},
+		{
+			path: "assets/13_clusterrole_namespacedplugins_edit.yaml",
+			readerAndApply: func(objBytes []byte) error {
+				_, _, err := resourceapply.ApplyClusterRole(ctx, kubeClient.RbacV1(), eventRecorder, resourceread.ReadClusterRoleV1OrDie(objBytes))
+				return err
+			},
+		},
+		{
+			path: "assets/14_clusterrole_namespacedplugins_view.yaml",
+			readerAndApply: func(objBytes []byte) error {
+				_, _, err := resourceapply.ApplyClusterRole(ctx, kubeClient.RbacV1(), eventRecorder, resourceread.ReadClusterRoleV1OrDie(objBytes))
+				return err
+			},
+		},
 	}
 
 	// create required resources, e.g. namespace, crd, roles
@@ -360,12 +403,13 @@ func TestCLIManager(t *testing.T) {
 		t.Fatalf("test plugin conversion error %v", err)
 	}
 
-	if len(latestPlugin.Status.Conditions) == 0 {
+	condition := meta.FindStatusCondition(latestPlugin.Status.Conditions, v1alpha1.PluginInstalledCondition)
+	if condition == nil {
 		t.Fatalf("unexpected empty condition of plugin oc")
 	}
 
-	if latestPlugin.Status.Conditions[0].Status != metav1.ConditionTrue || latestPlugin.Status.Conditions[0].Reason != "Installed" {
-		t.Fatalf("unexpected condition of plugin %s reason %s", latestPlugin.Status.Conditions[0].Status, latestPlugin.Status.Conditions[0].Reason)
+	if condition.Status != metav1.ConditionTrue || condition.Reason != "Installed" {
+		t.Fatalf("unexpected condition of plugin %s reason %s", condition.Status, condition.Reason)
 	}
 }
 